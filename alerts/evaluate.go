@@ -0,0 +1,262 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+)
+
+type State string
+
+const (
+	STATE_FIRING   State = "firing"
+	STATE_RESOLVED State = "resolved"
+)
+
+// Status classes of error rate metrics
+var ERROR_CLASSES = map[Metric]string{
+	METRIC_ERROR_RATE_4XX: "4xx",
+	METRIC_ERROR_RATE_5XX: "5xx",
+}
+
+// Analyzes requests since the time, the zero time analyzes the whole log.
+// Results must carry the state.
+type Source func(since time.Time) (*analyzer.AnalyzeResult, error)
+
+// Rule evaluated against the requests of its window
+type Result struct {
+	Rule      string
+	Condition Condition
+	Firing    bool
+
+	// False when the window has no requests or request time isn't logged
+	HasData bool
+	Value   float64
+
+	// Client ip of single ip metrics
+	Subject string
+}
+
+// Notification of a rule starting to fire or being resolved
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Condition string    `json:"condition"`
+	State     State     `json:"state"`
+	Value     string    `json:"value"`
+	Subject   string    `json:"subject,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Evaluates every rule, windows end at the given time or at the last request
+// of the log when it's zero. Each distinct window is analyzed once.
+func (c *Config) Evaluate(source Source, at time.Time) ([]Result, error) {
+	analyzed := make(map[time.Duration]*analyzer.AnalyzeResult)
+	analyze := func(window time.Duration) (*analyzer.AnalyzeResult, error) {
+		if res, ok := analyzed[window]; ok {
+			return res, nil
+		}
+
+		since := time.Time{}
+		if window != 0 {
+			since = at.Add(-window)
+		}
+
+		res, err := source(since)
+		if err != nil {
+			return nil, err
+		}
+
+		analyzed[window] = res
+		return res, nil
+	}
+
+	if at.IsZero() {
+		res, err := analyze(0)
+		if err != nil {
+			return nil, err
+		}
+		at = res.TimeRange.End
+	}
+
+	results := make([]Result, 0, len(c.Rules))
+	for _, rule := range c.Rules {
+		res, err := analyze(rule.condition.Window)
+		if err != nil {
+			return nil, err
+		}
+
+		result := Result{Rule: rule.Name, Condition: rule.condition}
+		result.Value, result.Subject, result.HasData = metricValue(rule.condition, res)
+		result.Firing = result.HasData && rule.condition.compare(result.Value)
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func metricValue(c Condition, res *analyzer.AnalyzeResult) (float64, string, bool) {
+	switch c.Metric {
+	case METRIC_REQUESTS:
+		if c.Per == 0 {
+			return float64(res.TotalRequests), "", true
+		}
+
+		// the whole log rate is averaged over its time range
+		span := c.Window
+		if span == 0 {
+			span = max(res.TimeRange.End.Sub(res.TimeRange.Start), time.Second)
+		}
+
+		return float64(res.TotalRequests) * float64(c.Per) / float64(span), "", true
+	case METRIC_ERROR_RATE_4XX, METRIC_ERROR_RATE_5XX:
+		if res.TotalRequests == 0 {
+			return 0, "", false
+		}
+
+		classes := analyzer.CountClasses(res.StatusCodes)
+		class := slices.Index(analyzer.STATUS_CLASSES, ERROR_CLASSES[c.Metric])
+
+		return float64(classes[class]) / float64(res.TotalRequests), "", true
+	case METRIC_REQUESTS_FROM_SINGLE_IP:
+		return singleIpValue(c, res)
+	}
+
+	latency := res.Latency
+	if latency == nil || latency.Requests == 0 {
+		return 0, "", false
+	}
+
+	durations := map[Metric]time.Duration{
+		METRIC_AVG_LATENCY: latency.Avg,
+		METRIC_P50_LATENCY: latency.P50,
+		METRIC_P95_LATENCY: latency.P95,
+		METRIC_P99_LATENCY: latency.P99,
+		METRIC_MAX_LATENCY: latency.Max,
+	}
+
+	return durations[c.Metric].Seconds(), "", true
+}
+
+// Peak rate of the busiest client, or its requests in the window for plain counts.
+// The busiest client is taken from the state, top ips follow the sort order.
+func singleIpValue(c Condition, res *analyzer.AnalyzeResult) (float64, string, bool) {
+	if c.Per == 0 {
+		if res.State == nil || len(res.State.Ips) == 0 {
+			return 0, "", false
+		}
+
+		busiest := analyzer.TopHits(res.State.Ips, 1, true)[0]
+		return float64(busiest.Hits), busiest.Key.String(), true
+	}
+
+	report := res.Rates
+	if report == nil || report.Clients == 0 {
+		return 0, "", false
+	}
+
+	peak := report.PeakRps.Max
+	if c.Per == time.Minute {
+		peak = report.PeakRpm.Max
+	}
+
+	// the client is known when it's among the top bursting ones
+	subject := ""
+	for _, client := range report.TopBursting {
+		rate := client.PeakRps
+		if c.Per == time.Minute {
+			rate = client.PeakRpm
+		}
+
+		if rate == peak {
+			subject = client.Ip.String()
+			break
+		}
+	}
+
+	return float64(peak), subject, true
+}
+
+// Remembers firing rules between evaluations
+type Tracker struct {
+	firing map[string]bool
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{firing: make(map[string]bool)}
+}
+
+// Alerts of rules which started firing or were resolved since the last update
+func (t *Tracker) Update(results []Result, at time.Time) []Alert {
+	var alerts []Alert
+
+	for _, result := range results {
+		if result.Firing == t.firing[result.Rule] {
+			continue
+		}
+		t.firing[result.Rule] = result.Firing
+
+		state := STATE_RESOLVED
+		if result.Firing {
+			state = STATE_FIRING
+		}
+
+		alerts = append(alerts, result.alert(state, at))
+	}
+
+	return alerts
+}
+
+func (r Result) alert(state State, at time.Time) Alert {
+	value := "no data"
+	if r.HasData {
+		value = r.Condition.format(r.Value)
+	}
+
+	return Alert{
+		Rule:      r.Rule,
+		Condition: r.Condition.String(),
+		State:     state,
+		Value:     value,
+		Subject:   r.Subject,
+		At:        at,
+	}
+}
+
+func (a Alert) String() string {
+	text := fmt.Sprintf("%s [%s] %s: %s, value %s", a.At.Format(time.RFC3339), a.State, a.Rule, a.Condition, a.Value)
+	if a.Subject != "" {
+		text += " from " + a.Subject
+	}
+
+	return text
+}
+
+// Evaluates the rules every interval until the context is done, windows end at
+// the current time. Alerts are sent when a rule starts firing and when it's resolved.
+func (c *Config) Watch(ctx context.Context, source Source, sink Sink, interval time.Duration, onError func(error)) {
+	tracker := NewTracker()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		results, err := c.Evaluate(source, now)
+		if err != nil {
+			onError(err)
+		} else if alerts := tracker.Update(results, now); len(alerts) > 0 {
+			if err := sink.Notify(alerts); err != nil {
+				onError(err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package alerts
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(t *testing.T, conditions map[string]string) *Config {
+	config := &Config{}
+	for name, condition := range conditions {
+		config.Rules = append(config.Rules, Rule{Name: name, Condition: condition})
+	}
+	require.NoError(t, config.compile())
+
+	return config
+}
+
+type recordingSink struct {
+	alerts chan []Alert
+}
+
+func (s recordingSink) Notify(alerts []Alert) error {
+	s.alerts <- alerts
+	return nil
+}
+
+func TestEvaluate(t *testing.T) {
+	end := time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC)
+	whole := &analyzer.AnalyzeResult{
+		TotalRequests: 1000,
+		StatusCodes:   []analyzer.HitsInfo[uint16]{{Key: 200, Hits: 990}, {Key: 500, Hits: 10}},
+		Ips:           []analyzer.HitsInfo[netip.Addr]{{Key: netip.MustParseAddr("10.0.0.1"), Hits: 300}},
+		TimeRange:     analyzer.TimeRange{Start: end.Add(-time.Hour), End: end},
+		State: &analyzer.ResultState{
+			Ips: map[netip.Addr]uint64{netip.MustParseAddr("10.0.0.1"): 300, netip.MustParseAddr("10.0.0.2"): 200},
+		},
+		Rates: &analyzer.RateReport{
+			Clients:     2,
+			PeakRps:     analyzer.RateDistribution{Max: 20},
+			PeakRpm:     analyzer.RateDistribution{Max: 1200},
+			TopBursting: []analyzer.ClientRate{{Ip: netip.MustParseAddr("10.0.0.2"), PeakRps: 20, PeakRpm: 1200}},
+		},
+	}
+	recent := &analyzer.AnalyzeResult{
+		TotalRequests: 100,
+		StatusCodes:   []analyzer.HitsInfo[uint16]{{Key: 200, Hits: 95}, {Key: 502, Hits: 5}},
+		Latency:       &analyzer.LatencyStats{Requests: 100, P99: 3 * time.Second},
+		TimeRange:     analyzer.TimeRange{Start: end.Add(-5 * time.Minute), End: end},
+	}
+
+	var sinces []time.Time
+	source := func(since time.Time) (*analyzer.AnalyzeResult, error) {
+		sinces = append(sinces, since)
+		if since.IsZero() {
+			return whole, nil
+		}
+		return recent, nil
+	}
+
+	t.Run("should end windows at the last request and analyze each once", func(t *testing.T) {
+		sinces = nil
+		config := testConfig(t, map[string]string{
+			"errors":     "error_rate_5xx > 2% over 5m",
+			"slow":       "p99_latency > 2s over 5m",
+			"total":      "error_rate_5xx > 2%",
+			"flood":      "requests_from_single_ip > 1000/min",
+			"busiest":    "requests_from_single_ip >= 300",
+			"rate":       "requests > 10/min",
+			"no latency": "max_latency > 1s",
+			"quiet":      "requests < 50 over 5m",
+		})
+
+		results, err := config.Evaluate(source, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{{}, end.Add(-5 * time.Minute)}, sinces)
+
+		byRule := make(map[string]Result)
+		for _, result := range results {
+			byRule[result.Rule] = result
+		}
+
+		assert.True(t, byRule["errors"].Firing)
+		assert.InDelta(t, 0.05, byRule["errors"].Value, 1e-9)
+		assert.True(t, byRule["slow"].Firing)
+		assert.False(t, byRule["total"].Firing)
+
+		assert.True(t, byRule["flood"].Firing)
+		assert.Equal(t, "10.0.0.2", byRule["flood"].Subject)
+		assert.True(t, byRule["busiest"].Firing)
+		assert.Equal(t, "10.0.0.1", byRule["busiest"].Subject)
+
+		assert.True(t, byRule["rate"].Firing)
+		assert.InDelta(t, 1000.0/60, byRule["rate"].Value, 1e-9)
+
+		assert.False(t, byRule["no latency"].HasData)
+		assert.False(t, byRule["no latency"].Firing)
+		assert.False(t, byRule["quiet"].Firing)
+	})
+
+	t.Run("should take the busiest client in ascending order", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "access.log")
+		require.NoError(t, os.WriteFile(logPath, []byte(`10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 100 "-" "-"
+10.0.0.2 - - [25/Dec/2023:10:30:46 +0000] "GET / HTTP/1.1" 200 100 "-" "-"
+10.0.0.2 - - [25/Dec/2023:10:30:47 +0000] "GET / HTTP/1.1" 200 100 "-" "-"
+`), 0644))
+
+		config := testConfig(t, map[string]string{"busiest": "requests_from_single_ip >= 2"})
+		results, err := config.Evaluate(func(since time.Time) (*analyzer.AnalyzeResult, error) {
+			return analyzer.Analyze(logPath, analyzer.Options{TopN: 1, Desc: false, DatesBy: "none", State: true})
+		}, time.Time{})
+		require.NoError(t, err)
+
+		require.Len(t, results, 1)
+		assert.True(t, results[0].Firing)
+		assert.Equal(t, 2.0, results[0].Value)
+		assert.Equal(t, "10.0.0.2", results[0].Subject)
+	})
+
+	t.Run("should end windows at the given time", func(t *testing.T) {
+		sinces = nil
+		config := testConfig(t, map[string]string{"errors": "error_rate_5xx > 2% over 10m"})
+		at := end.Add(time.Hour)
+
+		_, err := config.Evaluate(source, at)
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{at.Add(-10 * time.Minute)}, sinces)
+	})
+}
+
+func TestTracker(t *testing.T) {
+	condition, err := ParseCondition("error_rate_5xx > 2% over 5m")
+	require.NoError(t, err)
+	at := time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC)
+
+	tracker := NewTracker()
+	firing := []Result{{Rule: "errors", Condition: condition, Firing: true, HasData: true, Value: 0.05}}
+	ok := []Result{{Rule: "errors", Condition: condition, HasData: true, Value: 0.01}}
+
+	t.Run("should alert when a rule starts firing", func(t *testing.T) {
+		assert.Empty(t, tracker.Update(ok, at))
+
+		alerts := tracker.Update(firing, at)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, STATE_FIRING, alerts[0].State)
+		assert.Equal(t, "5.00%", alerts[0].Value)
+		assert.Equal(t, "2023-12-25T12:00:00Z [firing] errors: error_rate_5xx > 2% over 5m, value 5.00%", alerts[0].String())
+	})
+
+	t.Run("should not repeat firing alerts", func(t *testing.T) {
+		assert.Empty(t, tracker.Update(firing, at))
+	})
+
+	t.Run("should alert when a rule is resolved", func(t *testing.T) {
+		alerts := tracker.Update(ok, at)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, STATE_RESOLVED, alerts[0].State)
+	})
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("should notify sinks until the context is done", func(t *testing.T) {
+		config := testConfig(t, map[string]string{"traffic": "requests > 0 over 1m"})
+		source := func(since time.Time) (*analyzer.AnalyzeResult, error) {
+			return &analyzer.AnalyzeResult{TotalRequests: 5}, nil
+		}
+		sink := recordingSink{alerts: make(chan []Alert, 1)}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			config.Watch(ctx, source, sink, time.Hour, func(err error) { t.Error(err) })
+			close(done)
+		}()
+
+		alerts := <-sink.alerts
+		require.Len(t, alerts, 1)
+		assert.Equal(t, "traffic", alerts[0].Rule)
+		assert.Equal(t, "5", alerts[0].Value)
+
+		cancel()
+		<-done
+	})
+}
@@ -0,0 +1,294 @@
+package alerts
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kind of a metric value, it decides the accepted threshold units
+type Kind int
+
+const (
+	// Requests, plain or per "/s", "/min", "/h"
+	KIND_COUNT Kind = iota
+
+	// Share of requests, "2%" or a fraction like 0.02
+	KIND_RATIO
+
+	// Request time, "2s" or "250ms"
+	KIND_DURATION
+)
+
+type Metric string
+
+const (
+	METRIC_REQUESTS                Metric = "requests"
+	METRIC_ERROR_RATE_4XX          Metric = "error_rate_4xx"
+	METRIC_ERROR_RATE_5XX          Metric = "error_rate_5xx"
+	METRIC_REQUESTS_FROM_SINGLE_IP Metric = "requests_from_single_ip"
+	METRIC_AVG_LATENCY             Metric = "avg_latency"
+	METRIC_P50_LATENCY             Metric = "p50_latency"
+	METRIC_P95_LATENCY             Metric = "p95_latency"
+	METRIC_P99_LATENCY             Metric = "p99_latency"
+	METRIC_MAX_LATENCY             Metric = "max_latency"
+)
+
+var METRIC_KINDS = map[Metric]Kind{
+	METRIC_REQUESTS:                KIND_COUNT,
+	METRIC_ERROR_RATE_4XX:          KIND_RATIO,
+	METRIC_ERROR_RATE_5XX:          KIND_RATIO,
+	METRIC_REQUESTS_FROM_SINGLE_IP: KIND_COUNT,
+	METRIC_AVG_LATENCY:             KIND_DURATION,
+	METRIC_P50_LATENCY:             KIND_DURATION,
+	METRIC_P95_LATENCY:             KIND_DURATION,
+	METRIC_P99_LATENCY:             KIND_DURATION,
+	METRIC_MAX_LATENCY:             KIND_DURATION,
+}
+
+// Rate units of count thresholds, per client rates are only counted per second and minute
+var RATE_UNITS = map[string]time.Duration{
+	"s":   time.Second,
+	"min": time.Minute,
+	"h":   time.Hour,
+}
+
+type Op string
+
+const (
+	OP_GT  Op = ">"
+	OP_GTE Op = ">="
+	OP_LT  Op = "<"
+	OP_LTE Op = "<="
+)
+
+// Parsed "<metric> <op> <threshold> [over <window>]", e.g. "error_rate_5xx > 2% over 5m"
+type Condition struct {
+	Metric    Metric
+	Op        Op
+	Threshold float64
+
+	// Rate unit of a count threshold, zero compares plain counts
+	Per time.Duration
+
+	// Requests of the last Window are evaluated, zero evaluates the whole log
+	Window time.Duration
+
+	text string
+}
+
+type Rule struct {
+	Name      string `yaml:"name"`
+	Condition string `yaml:"condition"`
+
+	condition Condition
+}
+
+type Config struct {
+	Rules []Rule       `yaml:"rules"`
+	Sinks []SinkConfig `yaml:"sinks"`
+}
+
+// Loads and validates a YAML rules file
+func Load(fpath string) (*Config, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid alert rules %s: %w", fpath, err)
+	}
+
+	if err := config.compile(); err != nil {
+		return nil, fmt.Errorf("invalid alert rules %s: %w", fpath, err)
+	}
+
+	return &config, nil
+}
+
+func (c *Config) compile() error {
+	if len(c.Rules) == 0 {
+		return fmt.Errorf("no rules")
+	}
+
+	names := make(map[string]bool, len(c.Rules))
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		condition, err := ParseCondition(rule.Condition)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		rule.condition = condition
+	}
+
+	for i, sink := range c.Sinks {
+		if err := sink.validate(); err != nil {
+			return fmt.Errorf("sink %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Whether per client rates have to be analyzed
+func (c *Config) NeedsRates() bool {
+	return slices.ContainsFunc(c.Rules, func(rule Rule) bool {
+		return rule.condition.Metric == METRIC_REQUESTS_FROM_SINGLE_IP && rule.condition.Per != 0
+	})
+}
+
+// Longest rule window, zero when every rule checks the whole log
+func (c *Config) MaxWindow() time.Duration {
+	window := time.Duration(0)
+	for _, rule := range c.Rules {
+		window = max(window, rule.condition.Window)
+	}
+
+	return window
+}
+
+func ParseCondition(text string) (Condition, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 3 && len(fields) != 5 {
+		return Condition{}, fmt.Errorf("condition %q must look like \"<metric> <op> <threshold> [over <window>]\"", text)
+	}
+
+	c := Condition{Metric: Metric(fields[0]), Op: Op(fields[1]), text: strings.Join(fields, " ")}
+
+	kind, ok := METRIC_KINDS[c.Metric]
+	if !ok {
+		return Condition{}, fmt.Errorf("unknown metric %q", fields[0])
+	}
+
+	switch c.Op {
+	case OP_GT, OP_GTE, OP_LT, OP_LTE:
+	default:
+		return Condition{}, fmt.Errorf("unknown operator %q", fields[1])
+	}
+
+	var err error
+	c.Threshold, c.Per, err = parseThreshold(fields[2], kind)
+	if err != nil {
+		return Condition{}, err
+	}
+
+	if c.Metric == METRIC_REQUESTS_FROM_SINGLE_IP && c.Per > time.Minute {
+		return Condition{}, fmt.Errorf("%s rates are counted per s or min", c.Metric)
+	}
+
+	if len(fields) == 5 {
+		if fields[3] != "over" {
+			return Condition{}, fmt.Errorf("expected \"over\" instead of %q", fields[3])
+		}
+
+		c.Window, err = time.ParseDuration(fields[4])
+		if err != nil || c.Window <= 0 {
+			return Condition{}, fmt.Errorf("invalid window %q", fields[4])
+		}
+	}
+
+	return c, nil
+}
+
+func parseThreshold(value string, kind Kind) (float64, time.Duration, error) {
+	switch kind {
+	case KIND_RATIO:
+		number, percent := strings.CutSuffix(value, "%")
+		ratio, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid ratio %q, expected a percentage like 2%%", value)
+		}
+		if percent {
+			if !(ratio >= 0 && ratio <= 100) {
+				return 0, 0, fmt.Errorf("percentage %q is out of range 0-100%%", value)
+			}
+			ratio /= 100
+		}
+
+		if !(ratio >= 0 && ratio <= 1) {
+			return 0, 0, fmt.Errorf("ratio %q is out of range 0-1", value)
+		}
+
+		return ratio, 0, nil
+	case KIND_DURATION:
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return 0, 0, fmt.Errorf("invalid duration %q, expected a value like 2s", value)
+		}
+
+		return duration.Seconds(), 0, nil
+	}
+
+	number, unit, hasUnit := strings.Cut(value, "/")
+	count, err := strconv.ParseFloat(number, 64)
+	if err != nil || count < 0 {
+		return 0, 0, fmt.Errorf("invalid count %q", value)
+	}
+
+	if !hasUnit {
+		return count, 0, nil
+	}
+
+	per, ok := RATE_UNITS[unit]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown rate unit %q, expected s, min or h", unit)
+	}
+
+	return count, per, nil
+}
+
+func (c Condition) String() string {
+	return c.text
+}
+
+func (c Condition) compare(value float64) bool {
+	switch c.Op {
+	case OP_GT:
+		return value > c.Threshold
+	case OP_GTE:
+		return value >= c.Threshold
+	case OP_LT:
+		return value < c.Threshold
+	default:
+		return value <= c.Threshold
+	}
+}
+
+// Formats a value of the condition metric in its threshold units
+func (c Condition) format(value float64) string {
+	switch METRIC_KINDS[c.Metric] {
+	case KIND_RATIO:
+		return strconv.FormatFloat(value*100, 'f', 2, 64) + "%"
+	case KIND_DURATION:
+		return time.Duration(value * float64(time.Second)).Round(time.Millisecond).String()
+	}
+
+	text := strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64)
+	if c.Per != 0 {
+		for unit, per := range RATE_UNITS {
+			if per == c.Per {
+				text += "/" + unit
+			}
+		}
+	}
+
+	return text
+}
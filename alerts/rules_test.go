@@ -0,0 +1,105 @@
+package alerts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCondition(t *testing.T) {
+	t.Run("should parse ratios, rates and durations", func(t *testing.T) {
+		c, err := ParseCondition("error_rate_5xx > 2% over 5m")
+		require.NoError(t, err)
+		assert.Equal(t, METRIC_ERROR_RATE_5XX, c.Metric)
+		assert.Equal(t, OP_GT, c.Op)
+		assert.InDelta(t, 0.02, c.Threshold, 1e-9)
+		assert.Equal(t, 5*time.Minute, c.Window)
+
+		c, err = ParseCondition("requests_from_single_ip >= 1000/min")
+		require.NoError(t, err)
+		assert.Equal(t, 1000.0, c.Threshold)
+		assert.Equal(t, time.Minute, c.Per)
+		assert.Zero(t, c.Window)
+
+		c, err = ParseCondition("p99_latency  >  2s")
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, c.Threshold)
+		assert.Equal(t, "p99_latency > 2s", c.String())
+
+		c, err = ParseCondition("requests < 10 over 1h")
+		require.NoError(t, err)
+		assert.Equal(t, OP_LT, c.Op)
+		assert.Zero(t, c.Per)
+	})
+
+	t.Run("should reject invalid conditions", func(t *testing.T) {
+		for _, text := range []string{
+			"",
+			"error_rate_5xx > 2% during 5m",
+			"error_rate > 2%",
+			"error_rate_5xx = 2%",
+			"error_rate_5xx > two",
+			"error_rate_5xx > -2%",
+			"error_rate_5xx > 150%",
+			"error_rate_5xx > 1.5",
+			"error_rate_5xx > NaN",
+			"p99_latency > -2s",
+			"p99_latency > 2",
+			"requests > 10/day",
+			"requests_from_single_ip > 10/h",
+			"requests > 10 over -5m",
+		} {
+			_, err := ParseCondition(text)
+			assert.Error(t, err, text)
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("should load rules and sinks", func(t *testing.T) {
+		fpath := filepath.Join(dir, "rules.yaml")
+		require.NoError(t, os.WriteFile(fpath, []byte(`
+rules:
+  - name: errors
+    condition: error_rate_5xx > 2% over 5m
+  - name: flood
+    condition: requests_from_single_ip > 1000/min
+sinks:
+  - type: json
+    path: alerts.jsonl
+  - type: webhook
+    url: http://localhost:9093/hook
+    timeout: 3s
+`), 0644))
+
+		config, err := Load(fpath)
+		require.NoError(t, err)
+		assert.Len(t, config.Rules, 2)
+		assert.Equal(t, 3*time.Second, config.Sinks[1].Timeout)
+		assert.True(t, config.NeedsRates())
+		assert.Equal(t, 5*time.Minute, config.MaxWindow())
+	})
+
+	t.Run("should reject invalid files", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"empty":     "rules: []",
+			"unnamed":   "rules:\n  - condition: requests > 1",
+			"duplicate": "rules:\n  - {name: a, condition: requests > 1}\n  - {name: a, condition: requests > 2}",
+			"condition": "rules:\n  - {name: a, condition: requests}",
+			"sink":      "rules:\n  - {name: a, condition: requests > 1}\nsinks:\n  - type: email",
+			"webhook":   "rules:\n  - {name: a, condition: requests > 1}\nsinks:\n  - {type: webhook, url: localhost}",
+		} {
+			fpath := filepath.Join(dir, name+".yaml")
+			require.NoError(t, os.WriteFile(fpath, []byte(content), 0644))
+
+			_, err := Load(fpath)
+			assert.Error(t, err, name)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	SINK_STDOUT  = "stdout"
+	SINK_JSON    = "json"
+	SINK_EXEC    = "exec"
+	SINK_WEBHOOK = "webhook"
+)
+
+const DEFAULT_SINK_TIMEOUT = 10 * time.Second
+
+type SinkConfig struct {
+	// SINK_STDOUT, SINK_JSON, SINK_EXEC or SINK_WEBHOOK
+	Type string `yaml:"type"`
+
+	// File the json sink appends alerts to, one object per line
+	Path string `yaml:"path"`
+
+	// Command and arguments of the exec sink, run without a shell once per alert
+	Command []string `yaml:"command"`
+
+	// Url and headers of the webhook sink, environment variables are expanded
+	Url     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+
+	// Limits exec and webhook sinks, DEFAULT_SINK_TIMEOUT when zero
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type Sink interface {
+	Notify(alerts []Alert) error
+}
+
+// Notifies every sink, a failing sink doesn't stop the others
+type Sinks []Sink
+
+type stdoutSink struct {
+	out io.Writer
+}
+
+type jsonSink struct {
+	path string
+}
+
+type execSink struct {
+	command []string
+	timeout time.Duration
+	out     io.Writer
+}
+
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// Payload posted by the webhook sink
+type WebhookPayload struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+func (c SinkConfig) validate() error {
+	switch c.Type {
+	case SINK_STDOUT:
+	case SINK_JSON:
+		if c.Path == "" {
+			return fmt.Errorf("json sink requires a path")
+		}
+	case SINK_EXEC:
+		if len(c.Command) == 0 {
+			return fmt.Errorf("exec sink requires a command")
+		}
+	case SINK_WEBHOOK:
+		u, err := url.Parse(os.ExpandEnv(c.Url))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook sink requires an http or https url")
+		}
+	default:
+		return fmt.Errorf("unknown sink type %q", c.Type)
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("negative timeout")
+	}
+
+	return nil
+}
+
+// Sinks of the config, stdout when none is configured. Alerts printed by
+// the stdout sink and output of exec commands are written to out.
+func (c *Config) NewSinks(out io.Writer) Sinks {
+	if len(c.Sinks) == 0 {
+		return Sinks{stdoutSink{out: out}}
+	}
+
+	sinks := make(Sinks, 0, len(c.Sinks))
+	for _, config := range c.Sinks {
+		sinks = append(sinks, newSink(config, out))
+	}
+
+	return sinks
+}
+
+func newSink(config SinkConfig, out io.Writer) Sink {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DEFAULT_SINK_TIMEOUT
+	}
+
+	switch config.Type {
+	case SINK_JSON:
+		return jsonSink{path: config.Path}
+	case SINK_EXEC:
+		return execSink{command: config.Command, timeout: timeout, out: out}
+	case SINK_WEBHOOK:
+		headers := make(map[string]string, len(config.Headers))
+		for name, value := range config.Headers {
+			headers[name] = os.ExpandEnv(value)
+		}
+
+		return webhookSink{url: os.ExpandEnv(config.Url), headers: headers, client: &http.Client{Timeout: timeout}}
+	}
+
+	return stdoutSink{out: out}
+}
+
+func (sinks Sinks) Notify(alerts []Alert) error {
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.Notify(alerts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s stdoutSink) Notify(alerts []Alert) error {
+	for _, alert := range alerts {
+		if _, err := fmt.Fprintln(s.out, alert.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s jsonSink) Notify(alerts []Alert) error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("json sink: %w", err)
+	}
+
+	var buf bytes.Buffer
+	for _, alert := range alerts {
+		if err := encodeJson(&buf, alert); err != nil {
+			file.Close()
+			return fmt.Errorf("json sink: %w", err)
+		}
+	}
+
+	// a single write keeps the lines of a batch together
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("json sink: %w", err)
+	}
+
+	return file.Close()
+}
+
+// The alert is passed as JSON on stdin and as ALERT_* environment variables
+func (s execSink) Notify(alerts []Alert) error {
+	for _, alert := range alerts {
+		if err := s.run(alert); err != nil {
+			return fmt.Errorf("exec sink %s: %w", s.command[0], err)
+		}
+	}
+
+	return nil
+}
+
+func (s execSink) run(alert Alert) error {
+	var data bytes.Buffer
+	if err := encodeJson(&data, alert); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Stdin = &data
+	cmd.Stdout = s.out
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"ALERT_RULE="+alert.Rule,
+		"ALERT_CONDITION="+alert.Condition,
+		"ALERT_STATE="+string(alert.State),
+		"ALERT_VALUE="+alert.Value,
+		"ALERT_SUBJECT="+alert.Subject,
+	)
+
+	return cmd.Run()
+}
+
+// Posts the alerts of an evaluation as a single WebhookPayload
+func (s webhookSink) Notify(alerts []Alert) error {
+	var data bytes.Buffer
+	if err := encodeJson(&data, WebhookPayload{Alerts: alerts}); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &data)
+	if err != nil {
+		return fmt.Errorf("webhook sink: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook sink: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook sink: %s responded %s", req.URL.Redacted(), resp.Status)
+	}
+
+	return nil
+}
+
+// Conditions hold comparison operators, they are kept unescaped
+func encodeJson(buf *bytes.Buffer, value any) error {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+
+	return encoder.Encode(value)
+}
@@ -0,0 +1,110 @@
+package alerts
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAlerts() []Alert {
+	at := time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC)
+	return []Alert{
+		{Rule: "errors", Condition: "error_rate_5xx > 2% over 5m", State: STATE_FIRING, Value: "5.00%", At: at},
+		{Rule: "flood", Condition: "requests_from_single_ip > 1000/min", State: STATE_RESOLVED, Value: "20/min", Subject: "10.0.0.1", At: at},
+	}
+}
+
+func TestSinks(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("should print alerts to stdout without configured sinks", func(t *testing.T) {
+		var out strings.Builder
+		config := &Config{}
+
+		require.NoError(t, config.NewSinks(&out).Notify(testAlerts()))
+		assert.Equal(t, "2023-12-25T12:00:00Z [firing] errors: error_rate_5xx > 2% over 5m, value 5.00%\n"+
+			"2023-12-25T12:00:00Z [resolved] flood: requests_from_single_ip > 1000/min, value 20/min from 10.0.0.1\n", out.String())
+	})
+
+	t.Run("should append json lines", func(t *testing.T) {
+		fpath := filepath.Join(dir, "alerts.jsonl")
+		config := &Config{Sinks: []SinkConfig{{Type: SINK_JSON, Path: fpath}}}
+		sinks := config.NewSinks(io.Discard)
+
+		require.NoError(t, sinks.Notify(testAlerts()))
+		require.NoError(t, sinks.Notify(testAlerts()[:1]))
+
+		file, err := os.Open(fpath)
+		require.NoError(t, err)
+		defer file.Close()
+
+		var alerts []Alert
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var alert Alert
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &alert))
+			alerts = append(alerts, alert)
+		}
+		assert.Equal(t, append(testAlerts(), testAlerts()[0]), alerts)
+	})
+
+	t.Run("should run commands with the alert on stdin and in the environment", func(t *testing.T) {
+		var out strings.Builder
+		config := &Config{Sinks: []SinkConfig{{Type: SINK_EXEC, Command: []string{"sh", "-c", `echo "$ALERT_RULE $ALERT_STATE"; cat`}}}}
+
+		require.NoError(t, config.NewSinks(&out).Notify(testAlerts()[:1]))
+		assert.Equal(t, "errors firing\n"+`{"rule":"errors","condition":"error_rate_5xx > 2% over 5m","state":"firing","value":"5.00%","at":"2023-12-25T12:00:00Z"}`+"\n", out.String())
+	})
+
+	t.Run("should report failing commands", func(t *testing.T) {
+		config := &Config{Sinks: []SinkConfig{{Type: SINK_EXEC, Command: []string{"sh", "-c", "exit 3"}}}}
+		assert.Error(t, config.NewSinks(io.Discard).Notify(testAlerts()))
+	})
+
+	t.Run("should post alerts to the webhook", func(t *testing.T) {
+		t.Setenv("ALERT_TOKEN", "secret")
+
+		var payload WebhookPayload
+		var auth string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth = r.Header.Get("Authorization")
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		}))
+		defer srv.Close()
+
+		config := &Config{Sinks: []SinkConfig{{
+			Type:    SINK_WEBHOOK,
+			Url:     srv.URL + "/hook",
+			Headers: map[string]string{"Authorization": "Bearer ${ALERT_TOKEN}"},
+		}}}
+
+		require.NoError(t, config.NewSinks(io.Discard).Notify(testAlerts()))
+		assert.Equal(t, "Bearer secret", auth)
+		assert.Equal(t, testAlerts(), payload.Alerts)
+	})
+
+	t.Run("should report failed webhook responses and keep notifying other sinks", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		var out strings.Builder
+		config := &Config{Sinks: []SinkConfig{{Type: SINK_WEBHOOK, Url: srv.URL}, {Type: SINK_STDOUT}}}
+
+		err := config.NewSinks(&out).Notify(testAlerts())
+		assert.ErrorContains(t, err, "503")
+		assert.NotEmpty(t, out.String())
+	})
+}
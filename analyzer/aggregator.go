@@ -0,0 +1,310 @@
+package analyzer
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// Worker local counters. Every worker aggregates all of its chunks
+// into a single aggregator, aggregators are merged once at the end.
+type aggregator struct {
+	ips         map[netip.Addr]uint64
+	remoteAddrs map[netip.Addr]uint64
+	codes       map[uint16]uint64
+	dates       map[time.Time]uint64
+	uris        map[string]uint64
+	userAgents  map[string]uint64
+	bots        map[string]*botStats
+	threats     threatStats
+	minutes     map[clientMinute]minuteCounts
+	seconds     map[clientSecond]uint64
+	buckets     map[int64]*bucketStats
+	pageViews   map[visitor][]pageView
+
+	// Status classes per second, kept for timelines
+	classSeconds map[int64]ClassCounts
+
+	// Metrics exporter counters
+	routes    map[routeKey]routeCounts
+	durations map[string]*DurationHistogram
+
+	latency latencyHistogram
+
+	totalRequests uint64
+	totalBytes    uint64
+	parseErrors   uint64
+	filtered      uint64
+
+	timeRange    TimeRange
+	timeRangeSet bool
+}
+
+// Aggregators are reused between runs, so their maps keep already grown buckets
+var aggregatorPool = sync.Pool{
+	New: func() any {
+		return newAggregator()
+	},
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{
+		ips:         make(map[netip.Addr]uint64),
+		remoteAddrs: make(map[netip.Addr]uint64),
+		codes:       make(map[uint16]uint64),
+		dates:       make(map[time.Time]uint64),
+		uris:        make(map[string]uint64),
+		userAgents:  make(map[string]uint64),
+		bots:        make(map[string]*botStats),
+		threats:     newThreatStats(),
+		minutes:     make(map[clientMinute]minuteCounts),
+		seconds:     make(map[clientSecond]uint64),
+		buckets:     make(map[int64]*bucketStats),
+		pageViews:   make(map[visitor][]pageView),
+
+		classSeconds: make(map[int64]ClassCounts),
+		routes:       make(map[routeKey]routeCounts),
+		durations:    make(map[string]*DurationHistogram),
+	}
+}
+
+func getAggregator() *aggregator {
+	return aggregatorPool.Get().(*aggregator)
+}
+
+func putAggregator(agg *aggregator) {
+	agg.reset()
+	aggregatorPool.Put(agg)
+}
+
+func (agg *aggregator) add(entry *parser.LogEntry, params ProcessParams) {
+	agg.totalRequests++
+	agg.totalBytes += uint64(entry.RespBytes)
+	if params.RequestTime && entry.RequestTime != parser.NO_REQUEST_TIME {
+		agg.latency.add(entry.RequestTime)
+	}
+	agg.ips[entry.Ip]++
+	if params.RealIp != nil {
+		agg.remoteAddrs[entry.RemoteAddr]++
+	}
+	agg.codes[entry.StatusCode]++
+	agg.dates[groupDate(entry.Date, params.GroupBy)]++
+	agg.uris[entry.Uri]++
+	agg.userAgents[entry.UserAgent]++
+
+	if params.UserAgents != nil {
+		if info := params.UserAgents.Classify(entry.UserAgent); info.IsBot() {
+			agg.addBot(info.Bot, entry, params)
+		}
+	}
+
+	if params.Block != nil {
+		agg.addMinute(entry)
+	}
+	if params.Rates != nil {
+		agg.addSecond(entry)
+	}
+	if params.Anomalies != nil {
+		agg.addBucket(entry, params.GroupBy)
+	}
+	if params.StatusTimeline {
+		agg.addClassSecond(entry)
+	}
+	if params.Metrics {
+		agg.addMetrics(entry, params)
+	}
+	if params.Sessions != nil || params.Funnel != nil {
+		agg.addPageView(entry, params.Sessions != nil && params.Sessions.Assets)
+	}
+
+	agg.trackTime(entry.Date, entry.Date)
+}
+
+func (agg *aggregator) merge(other *aggregator) {
+	mergeCounts(agg.ips, other.ips)
+	mergeCounts(agg.remoteAddrs, other.remoteAddrs)
+	mergeCounts(agg.codes, other.codes)
+	mergeCounts(agg.dates, other.dates)
+	mergeCounts(agg.uris, other.uris)
+	mergeCounts(agg.userAgents, other.userAgents)
+
+	for name, stats := range other.bots {
+		if own, ok := agg.bots[name]; ok {
+			own.merge(stats)
+		} else {
+			agg.bots[name] = stats
+		}
+	}
+
+	agg.threats.merge(&other.threats)
+	mergeMinutes(agg.minutes, other.minutes)
+	mergeCounts(agg.seconds, other.seconds)
+
+	for start, bucket := range other.buckets {
+		if own, ok := agg.buckets[start]; ok {
+			own.merge(bucket)
+		} else {
+			agg.buckets[start] = bucket
+		}
+	}
+
+	mergePageViews(agg.pageViews, other.pageViews)
+	mergeClassSeconds(agg.classSeconds, other.classSeconds)
+	mergeRoutes(agg.routes, other.routes)
+	mergeDurations(agg.durations, other.durations)
+	agg.latency.merge(&other.latency)
+
+	agg.totalRequests += other.totalRequests
+	agg.totalBytes += other.totalBytes
+	agg.parseErrors += other.parseErrors
+	agg.filtered += other.filtered
+
+	if other.timeRangeSet {
+		agg.trackTime(other.timeRange.Start, other.timeRange.End)
+	}
+}
+
+func (agg *aggregator) trackTime(start, end time.Time) {
+	if !agg.timeRangeSet || start.Before(agg.timeRange.Start) {
+		agg.timeRange.Start = start
+	}
+
+	if !agg.timeRangeSet || end.After(agg.timeRange.End) {
+		agg.timeRange.End = end
+	}
+
+	agg.timeRangeSet = true
+}
+
+func (agg *aggregator) result(params MergeParams) AnalyzeResult {
+	res := AnalyzeResult{
+		Version:          RESULT_VERSION,
+		Asc:              !params.Desc,
+		Ips:              *getHitsInfo(agg.ips, params.TopN, params.Desc),
+		Codes:            *getHitsInfo(agg.codes, params.TopN, params.Desc),
+		Dates:            *getHitsInfo(agg.dates, params.TopN, params.Desc),
+		Uris:             *getHitsInfo(agg.uris, params.TopN, params.Desc),
+		TotalRequests:    agg.totalRequests,
+		TotalBytes:       agg.totalBytes,
+		StatusCodes:      *getHitsInfo(agg.codes, len(agg.codes), true),
+		Latency:          agg.latency.stats(),
+		UniqueIPs:        uint64(len(agg.ips)),
+		UniqueUserAgents: uint64(len(agg.userAgents)),
+		TimeRange:        agg.timeRange,
+		ProcessingStats: ProcessingStats{
+			FileSize:    params.FileSize,
+			ParseErrors: agg.parseErrors,
+			Filtered:    agg.filtered,
+		},
+	}
+
+	if params.State {
+		res.State = agg.state(params.GroupBy)
+	}
+
+	masks := DEFAULT_SUBNET_MASKS
+	if params.GroupIp != nil {
+		masks = *params.GroupIp
+	}
+
+	subnets := groupSubnets(agg.ips, masks)
+	res.HotSubnets = findHotSubnets(agg.ips, subnets, params.TopN)
+
+	if params.GroupIp != nil {
+		res.Subnets = *getHitsInfo(subnetHits(subnets), params.TopN, params.Desc)
+	}
+
+	if params.UserAgents != nil {
+		res.UserAgents = *getHitsInfo(agg.userAgents, params.TopN, params.Desc)
+		res.Browsers, res.OperatingSystems, res.Devices, res.Bots = classifyUserAgents(agg.userAgents, params)
+		res.BotReports = botReports(agg.bots, params)
+	}
+
+	if params.Security != nil {
+		res.Security = agg.threats.report(params.TopN)
+	}
+
+	if params.Block != nil {
+		res.Blocked = blockedClients(agg.minutes, &agg.threats, *params.Block)
+	}
+
+	if params.Rates != nil {
+		res.Rates = rateReport(agg.seconds, params.TopN, *params.Rates)
+	}
+
+	if params.Anomalies != nil {
+		res.Anomalies = anomalyReport(agg.buckets, params.GroupBy, params.TopN, *params.Anomalies)
+	}
+
+	if params.Sessions != nil || params.Funnel != nil {
+		sortPageViews(agg.pageViews)
+	}
+
+	if params.Sessions != nil {
+		res.Sessions = sessionReport(agg.pageViews, params.TopN, *params.Sessions)
+	}
+
+	if params.Funnel != nil {
+		var sessions SessionOptions
+		if params.Sessions != nil {
+			sessions = *params.Sessions
+		}
+		res.Funnel = funnelReport(agg.pageViews, params.TopN, *params.Funnel, sessions)
+	}
+
+	if params.Geo != nil {
+		res.Countries, res.Asns, res.IpsGeo = enrich(agg.ips, res.Ips, params)
+	}
+
+	if len(agg.remoteAddrs) > 0 {
+		res.RemoteAddrs = *getHitsInfo(agg.remoteAddrs, params.TopN, params.Desc)
+	}
+
+	return res
+}
+
+func (agg *aggregator) reset() {
+	clear(agg.ips)
+	clear(agg.remoteAddrs)
+	clear(agg.codes)
+	clear(agg.dates)
+	clear(agg.uris)
+	clear(agg.userAgents)
+	clear(agg.bots)
+	agg.threats.reset()
+	clear(agg.minutes)
+	clear(agg.seconds)
+	clear(agg.buckets)
+	clear(agg.pageViews)
+	clear(agg.classSeconds)
+	clear(agg.routes)
+	clear(agg.durations)
+
+	agg.latency.reset()
+
+	agg.totalRequests = 0
+	agg.totalBytes = 0
+	agg.parseErrors = 0
+	agg.filtered = 0
+	agg.timeRange = TimeRange{}
+	agg.timeRangeSet = false
+}
+
+func mergeCounts[T comparable](dst, src map[T]uint64) {
+	for k, hits := range src {
+		dst[k] += hits
+	}
+}
+
+func groupDate(date time.Time, groupBy string) time.Time {
+	switch groupBy {
+	case "hour":
+		return time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), 0, 0, 0, date.Location())
+	case "day":
+		return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	}
+
+	return date
+}
@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregator(t *testing.T) {
+	entry := &parser.LogEntry{
+		Ip:         netip.MustParseAddr("192.168.1.100"),
+		Date:       time.Date(2023, 12, 25, 10, 30, 45, 0, time.UTC),
+		StatusCode: 200,
+		UserAgent:  "Mozilla/5.0",
+	}
+
+	t.Run("should count added entries", func(t *testing.T) {
+		agg := newAggregator()
+
+		agg.add(entry, ProcessParams{GroupBy: "hour"})
+		agg.add(entry, ProcessParams{GroupBy: "hour"})
+
+		assert.Equal(t, uint64(2), agg.totalRequests)
+		assert.Equal(t, uint64(2), agg.ips[entry.Ip])
+		assert.Equal(t, uint64(2), agg.codes[200])
+		assert.Equal(t, uint64(2), agg.dates[time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC)])
+		assert.Len(t, agg.userAgents, 1)
+		assert.Equal(t, entry.Date, agg.timeRange.Start)
+		assert.Equal(t, entry.Date, agg.timeRange.End)
+	})
+
+	t.Run("should not merge empty time range", func(t *testing.T) {
+		agg := newAggregator()
+		agg.add(entry, ProcessParams{})
+
+		agg.merge(newAggregator())
+
+		assert.Equal(t, entry.Date, agg.timeRange.Start)
+		assert.Equal(t, entry.Date, agg.timeRange.End)
+	})
+
+	t.Run("should clear counters on reset", func(t *testing.T) {
+		agg := newAggregator()
+		agg.add(entry, ProcessParams{})
+		agg.parseErrors++
+
+		agg.reset()
+
+		assert.Equal(t, uint64(0), agg.totalRequests)
+		assert.Equal(t, uint64(0), agg.parseErrors)
+		assert.Empty(t, agg.ips)
+		assert.Empty(t, agg.userAgents)
+		assert.False(t, agg.timeRangeSet)
+	})
+}
+
+func TestGroupDate(t *testing.T) {
+	date := time.Date(2023, 12, 25, 10, 30, 45, 0, time.UTC)
+
+	assert.Equal(t, date, groupDate(date, "none"))
+	assert.Equal(t, time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC), groupDate(date, "hour"))
+	assert.Equal(t, time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC), groupDate(date, "day"))
+}
@@ -1,7 +1,8 @@
 package analyzer
 
 import (
-	"errors"
+	"bytes"
+	"fmt"
 	"log"
 	"net/netip"
 	"os"
@@ -10,13 +11,20 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Kostayne/go-nginx-analyzer/crawlers"
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/Kostayne/go-nginx-analyzer/index"
 	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/realip"
+	"github.com/Kostayne/go-nginx-analyzer/security"
+	"github.com/Kostayne/go-nginx-analyzer/uripath"
+	"github.com/Kostayne/go-nginx-analyzer/useragent"
 	"github.com/edsrzf/mmap-go"
 )
 
 // Chunk size in bytes
 const CHUNK_SIZE = 1024 * 1024 * 100 // 100MB
-const CHUNK_OVERLAP = 1024 * 2       // 2KB
+const CHUNK_OVERLAP = 1024 * 16      // 16KB, max length of a line crossing the chunk end
 const AVG_LINE_SIZE = 400            // 400 bytes
 
 type TimeRange struct {
@@ -27,30 +35,84 @@ type TimeRange struct {
 type ProcessingStats struct {
 	FileSize    int64  `json:"fileSize"`
 	ParseErrors uint64 `json:"parseErrors"`
+
+	// Parsed entries rejected by filters
+	Filtered uint64 `json:"filtered"`
 }
 
 type AnalyzeResult struct {
+	// Schema version of the saved result, RESULT_VERSION
+	Version int `json:"version"`
+
+	// Top lists hold the fewest hits instead of the most, set with --asc
+	Asc bool `json:"asc,omitempty"`
+
 	// Top hits by category
 	Ips   []HitsInfo[netip.Addr] `json:"ips"`
 	Codes []HitsInfo[uint16]     `json:"codes"`
 	Dates []HitsInfo[time.Time]  `json:"dates"`
+	Uris  []HitsInfo[string]     `json:"uris"`
 
 	// Summary statistics
 	TotalRequests    uint64 `json:"totalRequests"`
+	TotalBytes       uint64 `json:"totalBytes"`
 	UniqueIPs        uint64 `json:"uniqueIps"`
 	UniqueUserAgents uint64 `json:"uniqueUserAgents"`
 
 	// Status code distribution
 	StatusCodes []HitsInfo[uint16] `json:"statusCodes"`
 
-	// User agents for aggregation
-	UserAgents map[string]bool `json:"userAgents"`
+	// Set when request_time is logged
+	Latency *LatencyStats `json:"latency,omitempty"`
+
+	// Top ip subnets, set when ips are grouped
+	Subnets []HitsInfo[netip.Prefix] `json:"subnets,omitempty"`
+
+	// Subnets with many hits spread over addresses missing in the top ips
+	HotSubnets []HotSubnet `json:"hotSubnets"`
+
+	// User agent classification
+	UserAgents       []HitsInfo[string] `json:"userAgents,omitempty"`
+	Browsers         []HitsInfo[string] `json:"browsers,omitempty"`
+	OperatingSystems []HitsInfo[string] `json:"operatingSystems,omitempty"`
+	Devices          []HitsInfo[string] `json:"devices,omitempty"`
+	Bots             []HitsInfo[string] `json:"bots,omitempty"`
+	BotReports       []BotReport        `json:"botReports,omitempty"`
+
+	// Attack signatures, set when a security scanner is provided
+	Security *SecurityReport `json:"security,omitempty"`
+
+	// Clients exceeding block rules, set when block rules are provided
+	Blocked []BlockedClient `json:"blocked,omitempty"`
+
+	// Per client request rates, set when rate options are provided
+	Rates *RateReport `json:"rates,omitempty"`
+
+	// Spikes and drops over date buckets, set when anomaly options are provided
+	Anomalies *AnomalyReport `json:"anomalies,omitempty"`
+
+	// Visitor sessions, set when session options are provided
+	Sessions *SessionReport `json:"sessions,omitempty"`
+
+	// Funnel steps and navigation sequences, set when funnel options are provided
+	Funnel *FunnelReport `json:"funnel,omitempty"`
+
+	// GeoIP enrichment, set when geoip databases are provided
+	Countries []HitsInfo[string]        `json:"countries,omitempty"`
+	Asns      []HitsInfo[geoip.Asn]     `json:"asns,omitempty"`
+	IpsGeo    map[netip.Addr]geoip.Info `json:"ipsGeo,omitempty"`
+
+	// Top proxy addresses, set when the client ip is resolved from headers
+	RemoteAddrs []HitsInfo[netip.Addr] `json:"remoteAddrs,omitempty"`
 
 	// Time range
 	TimeRange TimeRange `json:"timeRange"`
 
 	// Processing statistics
 	ProcessingStats ProcessingStats `json:"processingStats"`
+
+	// Full counters the result can be merged with others from, set with the State option
+	State *ResultState `json:"state,omitempty"`
 }
 
 type HitsInfo[T comparable] struct {
@@ -58,37 +120,156 @@ type HitsInfo[T comparable] struct {
 	Key  T      `json:"key"`
 }
 
+// Byte range [startPos, endPos) of a file. A chunk processes every line
+// starting inside of its range, the last line may end after endPos.
 type Chunk struct {
 	fileName string
 	startPos int64
 	endPos   int64
 }
 
+type Options struct {
+	TopN    int
+	Desc    bool
+	DatesBy string
+
+	// Quoted fields following the user agent in log_format
+	ExtraFields []parser.ExtraField
+
+	// Derives the client ip from proxy headers, nil keeps remote_addr
+	RealIp *realip.Resolver
+
+	// Groups the ip report by subnets, nil reports single addresses
+	GroupIp *SubnetMasks
+
+	// Analyzes only requests in [Since, Until), zero times don't limit the range
+	Since time.Time
+	Until time.Time
+
+	// Analyzes only requests with these status codes, empty keeps every code
+	Statuses []StatusRange
+
+	// Analyzes only requests of this client ip, the zero addr keeps every client
+	Ip netip.Addr
+
+	// Analyzes only requests of this uri, compared after normalization
+	Uri string
+
+	// Keeps the full counters in the result state, required to merge the
+	// result later and by the timeseries, top and metrics readers of the state
+	State bool
+
+	// Keeps status classes per second in the result state
+	StatusTimeline bool
+
+	// Keeps requests by route, method and status class and duration histograms
+	// in the result state for the metrics exporter
+	Metrics bool
+
+	// Enriches client ips, required by the countries filter
+	Geo       *geoip.DB
+	Countries []string
+
+	// Classifies user agents, required to exclude bots
+	UserAgents  *useragent.Classifier
+	ExcludeBots bool
+
+	// Published crawler ip ranges used to find bot impersonators
+	Crawlers *crawlers.Ranges
+
+	// Collapses uris into templates before aggregation, nil keeps raw uris
+	Uris *uripath.Normalizer
+
+	// Matches requests against attack signatures
+	Security *security.Scanner
+
+	// Finds clients to block, nil skips per minute counting
+	Block *BlockRules
+
+	// Analyzes per client rates, nil skips per second counting
+	Rates *RateOptions
+
+	// Detects anomalies over buckets of DatesBy, nil skips per bucket counting
+	Anomalies *AnomalyOptions
+
+	// Reconstructs visitor sessions, nil skips collecting page views
+	Sessions *SessionOptions
+
+	// Follows visitors through the funnel steps, nil skips it
+	Funnel *FunnelOptions
+
+	// Receives every accepted request, nil skips collecting them
+	Export EntryWriter
+}
+
 type WorkerInfo struct {
 	wg         *sync.WaitGroup
 	chunkChan  <-chan Chunk
-	resultChan chan<- AnalyzeResult
+	resultChan chan<- *aggregator
+	errChan    chan<- error
 	fileName   string
-	desc       bool
-	topN       int
-	groupBy    string
+	fileSize   int64
+	opts       Options
 }
 
 type MergeParams struct {
-	ChunksCount  int
-	TopN         int
-	Desc         bool
-	FileSize     int64
-	WorkersCount int
+	TopN       int
+	Desc       bool
+	GroupBy    string
+	FileSize   int64
+	State      bool
+	GroupIp    *SubnetMasks
+	Geo        *geoip.DB
+	UserAgents *useragent.Classifier
+	Crawlers   *crawlers.Ranges
+	Security   *security.Scanner
+	Block      *BlockRules
+	Rates      *RateOptions
+	Anomalies  *AnomalyOptions
+	Sessions   *SessionOptions
+	Funnel     *FunnelOptions
 }
 
 type ProcessParams struct {
-	TopN    int    `json:"topN"`
-	Desc    bool   `json:"desc"`
-	GroupBy string `json:"groupBy"`
+	GroupBy     string           `json:"groupBy"`
+	RequestTime bool             `json:"requestTime"`
+	FileSize    int64            `json:"fileSize"`
+	RealIp      *realip.Resolver `json:"-"`
+	Geo         *geoip.Cache     `json:"-"`
+	Countries   []string         `json:"countries"`
+	Since       time.Time        `json:"since"`
+	Until       time.Time        `json:"until"`
+	Statuses    []StatusRange    `json:"statuses"`
+	Ip          netip.Addr       `json:"ip"`
+	Uri         string           `json:"uri"`
+
+	StatusTimeline bool `json:"statusTimeline"`
+	Metrics        bool `json:"metrics"`
+
+	UserAgents  *useragent.Cache `json:"-"`
+	ExcludeBots bool             `json:"excludeBots"`
+	Crawlers    *crawlers.Ranges `json:"-"`
+	Uris        *uripath.Cache   `json:"-"`
+	Security    *security.Cache  `json:"-"`
+	Block       *BlockRules      `json:"block"`
+	Rates       *RateOptions     `json:"rates"`
+	Anomalies   *AnomalyOptions  `json:"anomalies"`
+	Sessions    *SessionOptions  `json:"sessions"`
+	Funnel      *FunnelOptions   `json:"funnel"`
+	Export      *entryBatch      `json:"-"`
 }
 
-func Analyze(fpath string, topN int, desc bool, datesBy string) (*AnalyzeResult, error) {
+// Analyzes a log or an index built from one
+func Analyze(fpath string, opts Options) (*AnalyzeResult, error) {
+	if index.IsIndex(fpath) {
+		idx, err := openIndex(fpath)
+		if err != nil {
+			return nil, err
+		}
+
+		return AnalyzeIndex(idx, opts), nil
+	}
+
 	file, err := os.Open(fpath)
 	if err != nil {
 		return nil, err
@@ -101,16 +282,23 @@ func Analyze(fpath string, topN int, desc bool, datesBy string) (*AnalyzeResult,
 	}
 
 	fileSize := fstat.Size()
-	chunksCount := max(int(fileSize/CHUNK_SIZE), 1)
-	workersCount := runtime.NumCPU()
+	return analyzeRange(fpath, 0, fileSize, fileSize, opts)
+}
+
+// Analyzes lines starting in [start, end) of the file, start must be the start of a line.
+// Fails with the first error of a worker, requests may be exported meanwhile.
+func analyzeRange(fpath string, start, end, fileSize int64, opts Options) (*AnalyzeResult, error) {
+	chunksCount := max(int((end-start+CHUNK_SIZE-1)/CHUNK_SIZE), 1)
+	workersCount := min(runtime.NumCPU(), chunksCount)
 
 	chunks := make([]Chunk, chunksCount)
 	for i := 0; i < chunksCount; i++ {
-		chunks[i] = newChunk(i, fpath, fileSize)
+		chunks[i] = newChunk(i, fpath, start, end)
 	}
 
 	chunkChan := make(chan Chunk, chunksCount)
-	resultChan := make(chan AnalyzeResult, chunksCount)
+	resultChan := make(chan *aggregator, workersCount)
+	errChan := make(chan error, workersCount)
 
 	wg := sync.WaitGroup{}
 
@@ -121,10 +309,10 @@ func Analyze(fpath string, topN int, desc bool, datesBy string) (*AnalyzeResult,
 			wg:         &wg,
 			chunkChan:  chunkChan,
 			resultChan: resultChan,
+			errChan:    errChan,
 			fileName:   fpath,
-			desc:       desc,
-			topN:       topN,
-			groupBy:    datesBy,
+			fileSize:   fileSize,
+			opts:       opts,
 		}
 		go worker(wi)
 	}
@@ -136,217 +324,226 @@ func Analyze(fpath string, topN int, desc bool, datesBy string) (*AnalyzeResult,
 
 	wg.Wait()
 	close(resultChan)
+	close(errChan)
 
-	mergeParams := MergeParams{
-		ChunksCount:  int(chunksCount),
-		TopN:         topN,
-		Desc:         desc,
-		FileSize:     fileSize,
-		WorkersCount: workersCount,
+	if err, failed := <-errChan; failed {
+		for agg := range resultChan {
+			putAggregator(agg)
+		}
+		return nil, err
 	}
-	res := mergeResults(resultChan, mergeParams)
+
+	res := mergeResults(resultChan, mergeParams(opts, end-start))
 	return &res, nil
 }
 
-func mergeResults(resChan <-chan AnalyzeResult, params MergeParams) AnalyzeResult {
-	ipHits := make([]HitsInfo[netip.Addr], 0, params.TopN*params.ChunksCount)
-	codeHits := make([]HitsInfo[uint16], 0, params.TopN*params.ChunksCount)
-	dateHits := make([]HitsInfo[time.Time], 0, params.TopN*params.ChunksCount)
-
-	// Aggregate statistics
-	totalRequests := uint64(0)
-	parseErrors := uint64(0)
-	uniqueIPs := make(map[netip.Addr]bool)
-	uniqueUserAgents := make(map[string]bool)
-
-	var timeStart, timeEnd time.Time
-	timeStartSet := false
-
-	for res := range resChan {
-		ipHits = append(ipHits, res.Ips...)
-		codeHits = append(codeHits, res.Codes...)
-		dateHits = append(dateHits, res.Dates...)
-
-		// Aggregate summary statistics
-		totalRequests += res.TotalRequests
-		parseErrors += res.ProcessingStats.ParseErrors
-
-		// Track unique IPs and user agents
-		for _, ipInfo := range res.Ips {
-			uniqueIPs[ipInfo.Key] = true
-		}
+func mergeParams(opts Options, fileSize int64) MergeParams {
+	return MergeParams{
+		TopN:       opts.TopN,
+		Desc:       opts.Desc,
+		GroupBy:    opts.DatesBy,
+		FileSize:   fileSize,
+		State:      opts.State,
+		GroupIp:    opts.GroupIp,
+		Geo:        opts.Geo,
+		UserAgents: opts.UserAgents,
+		Crawlers:   opts.Crawlers,
+		Security:   opts.Security,
+		Block:      opts.Block,
+		Rates:      opts.Rates,
+		Anomalies:  opts.Anomalies,
+		Sessions:   opts.Sessions,
+		Funnel:     opts.Funnel,
+	}
+}
 
-		// Track unique user agents from this chunk
-		for userAgent := range res.UserAgents {
-			uniqueUserAgents[userAgent] = true
-		}
+func mergeResults(aggChan <-chan *aggregator, params MergeParams) AnalyzeResult {
+	total := getAggregator()
+	defer putAggregator(total)
 
-		// Track time range
-		if !timeStartSet || res.TimeRange.Start.Before(timeStart) {
-			timeStart = res.TimeRange.Start
-			timeStartSet = true
-		}
-		if res.TimeRange.End.After(timeEnd) {
-			timeEnd = res.TimeRange.End
-		}
+	for agg := range aggChan {
+		total.merge(agg)
+		putAggregator(agg)
 	}
 
-	result := AnalyzeResult{
-		Ips:              processHitsInfo(ipHits, params.TopN, params.Desc),
-		Codes:            processHitsInfo(codeHits, params.TopN, params.Desc),
-		Dates:            processHitsInfo(dateHits, params.TopN, params.Desc),
-		TotalRequests:    totalRequests,
-		UniqueIPs:        uint64(len(uniqueIPs)),
-		UniqueUserAgents: uint64(len(uniqueUserAgents)),
-		TimeRange: struct {
-			Start time.Time `json:"start"`
-			End   time.Time `json:"end"`
-		}{
-			Start: timeStart,
-			End:   timeEnd,
-		},
-		ProcessingStats: struct {
-			FileSize    int64  `json:"fileSize"`
-			ParseErrors uint64 `json:"parseErrors"`
-		}{
-			FileSize:    params.FileSize,
-			ParseErrors: parseErrors,
-		},
-	}
-
-	return result
+	return total.result(params)
 }
 
+// Sends the aggregator of every processed chunk or the first error,
+// chunks left by a failed worker are processed by the others
 func worker(w *WorkerInfo) {
 	defer w.wg.Done()
 
+	agg := getAggregator()
+	if err := processChunks(w, agg); err != nil {
+		putAggregator(agg)
+		w.errChan <- err
+		return
+	}
+
+	w.resultChan <- agg
+}
+
+func processChunks(w *WorkerInfo, agg *aggregator) error {
 	file, err := os.Open(w.fileName)
 	if err != nil {
-		log.Fatalf("Failed to open file %s: %s", w.fileName, err.Error())
-		return
+		return fmt.Errorf("failed to open file %s: %w", w.fileName, err)
 	}
 	defer file.Close()
 
+	// parser caches dates & strings, so it lives as long as the worker
+	lineParser := parser.NewParser(w.opts.ExtraFields...)
+	processParams := newProcessParams(w.opts, w.fileSize)
+
 	for chunk := range w.chunkChan {
-		processParams := ProcessParams{
-			TopN:    w.topN,
-			Desc:    w.desc,
-			GroupBy: w.groupBy,
-		}
-		result, err := processChunk(chunk, file, processParams)
+		err := processChunk(chunk, file, lineParser, agg, processParams)
 		if err != nil {
-			log.Fatalf("error processing chunk %s: %v", chunk.fileName, err)
+			return fmt.Errorf("failed to process %s at byte %d: %w", chunk.fileName, chunk.startPos, err)
 		}
+	}
 
-		w.resultChan <- result
+	if processParams.Export != nil {
+		processParams.Export.flush()
 	}
+
+	return nil
 }
 
-func processChunk(chunk Chunk, file *os.File, params ProcessParams) (AnalyzeResult, error) {
-	ipsMap := make(map[netip.Addr]uint64)
-	codesMap := make(map[uint16]uint64)
-	datesMap := make(map[time.Time]uint64)
-	statusCodes := make(map[uint16]uint64)
-	uniqueUserAgents := make(map[string]bool)
+// Params of a single worker, caches are not safe for concurrent use
+func newProcessParams(opts Options, fileSize int64) ProcessParams {
+	params := ProcessParams{
+		GroupBy:     opts.DatesBy,
+		RequestTime: slices.Contains(opts.ExtraFields, parser.FIELD_REQUEST_TIME),
+		FileSize:    fileSize,
+		RealIp:      opts.RealIp,
+		Countries:   opts.Countries,
+		Since:       opts.Since,
+		Until:       opts.Until,
+		Statuses:    opts.Statuses,
+		Ip:          opts.Ip,
+		Uri:         opts.Uri,
+
+		StatusTimeline: opts.StatusTimeline,
+		Metrics:        opts.Metrics,
+		ExcludeBots:    opts.ExcludeBots,
+		Crawlers:       opts.Crawlers,
+		Block:          opts.Block,
+		Rates:          opts.Rates,
+		Anomalies:      opts.Anomalies,
+		Sessions:       opts.Sessions,
+		Funnel:         opts.Funnel,
+	}
+	if opts.Geo != nil {
+		params.Geo = opts.Geo.NewCache()
+	}
+	if opts.UserAgents != nil {
+		params.UserAgents = opts.UserAgents.NewCache()
+	}
+	if opts.Uris != nil {
+		params.Uris = opts.Uris.NewCache()
+	}
+	if opts.Security != nil {
+		params.Security = opts.Security.NewCache()
+	}
+	if opts.Export != nil {
+		params.Export = newEntryBatch(opts.Export)
+	}
+
+	return params
+}
 
-	totalRequests := uint64(0)
-	parseErrors := uint64(0)
+func processChunk(chunk Chunk, file *os.File, lineParser *parser.Parser, agg *aggregator, params ProcessParams) error {
+	if chunk.startPos >= chunk.endPos {
+		return nil
+	}
 
-	var timeStart, timeEnd time.Time
-	timeStartSet := false
+	// mmap offset must be page aligned, also one byte before the chunk
+	// is needed to tell whether the chunk starts in the middle of a line
+	pageSize := int64(os.Getpagesize())
+	mapStart := max(chunk.startPos-1, 0) / pageSize * pageSize
+	mapEnd := min(chunk.endPos+CHUNK_OVERLAP, params.FileSize)
 
-	chunkLen := int(chunk.endPos - chunk.startPos)
-	mmapData, err := mmap.MapRegion(file, chunkLen, 0, mmap.RDONLY, chunk.startPos)
+	mmapData, err := mmap.MapRegion(file, int(mapEnd-mapStart), mmap.RDONLY, 0, mapStart)
 	if err != nil {
-		return AnalyzeResult{}, err
+		return err
 	}
 	defer mmapData.Unmap()
 
-	curPos := 0
+	curPos := int(chunk.startPos - mapStart)
+	maxPos := int(chunk.endPos - mapStart)
 
-	// skip first line if it's not the first chunk
-	// because it's already processed in the previous chunk
-	if chunk.startPos != 0 {
-		curPos = findNewLineIndex(mmapData, 0)
+	// skip the first line if it started in the previous chunk
+	// because it's already processed there
+	if curPos > 0 && mmapData[curPos-1] != '\n' {
+		curPos = findNewLineIndex(mmapData, curPos)
 
 		if curPos == -1 {
-			return AnalyzeResult{}, errors.New("no new line found")
+			return nil
 		}
 
 		curPos++
 	}
 
-	maxPos := int(chunk.endPos - chunk.startPos)
+	logEntry := &parser.LogEntry{}
 
-	// process the rest of the chunk
+	// process every line starting inside of the chunk
 	for curPos < maxPos {
 		nextLineIndex := findNewLineIndex(mmapData, curPos)
 
 		// if there is no new line
 		// then read to the end
 		if nextLineIndex == -1 {
-			nextLineIndex = maxPos
+			nextLineIndex = len(mmapData)
 		}
 
-		curLineStr := string(mmapData[curPos:nextLineIndex])
-
-		logEntry, err := parser.ParseLogEntry(curLineStr)
+		err := lineParser.Parse(mmapData[curPos:nextLineIndex], logEntry)
 		if err != nil {
 			log.Print(err.Error())
-			parseErrors++
+			agg.parseErrors++
 			curPos = nextLineIndex + 1
 			continue
 		}
 
-		totalRequests++
-		ipsMap[logEntry.Ip]++
-		codesMap[logEntry.StatusCode]++
-
-		// Group dates if needed
-		dateKey := logEntry.Date
-		if params.GroupBy == "hour" {
-			dateKey = time.Date(logEntry.Date.Year(), logEntry.Date.Month(), logEntry.Date.Day(), logEntry.Date.Hour(), 0, 0, 0, logEntry.Date.Location())
-		} else if params.GroupBy == "day" {
-			dateKey = time.Date(logEntry.Date.Year(), logEntry.Date.Month(), logEntry.Date.Day(), 0, 0, 0, 0, logEntry.Date.Location())
+		if params.RealIp != nil {
+			logEntry.Ip = params.RealIp.Resolve(logEntry.RemoteAddr, logEntry.XForwardedFor, logEntry.XRealIp)
 		}
-		datesMap[dateKey]++
 
-		statusCodes[logEntry.StatusCode]++
-		uniqueUserAgents[logEntry.UserAgent] = true
+		processEntry(logEntry, agg, params)
+		curPos = nextLineIndex + 1
+	}
 
-		// Track time range
-		if !timeStartSet || logEntry.Date.Before(timeStart) {
-			timeStart = logEntry.Date
-			timeStartSet = true
-		}
-		if logEntry.Date.After(timeEnd) {
-			timeEnd = logEntry.Date
-		}
+	return nil
+}
 
-		curPos = nextLineIndex + 1
+// Filters a parsed entry and adds it to the aggregator
+func processEntry(entry *parser.LogEntry, agg *aggregator, params ProcessParams) {
+	if !params.accepts(entry) {
+		agg.filtered++
+		return
 	}
 
-	ipHits := getHitsInfo(ipsMap, params.TopN, params.Desc)
-	codeHits := getHitsInfo(codesMap, params.TopN, params.Desc)
-	dateHits := getHitsInfo(datesMap, params.TopN, params.Desc)
+	rawUri := entry.Uri
+	if params.Uris != nil {
+		entry.Uri = params.Uris.Normalize(entry.Uri)
+	}
+
+	if params.Uri != "" && entry.Uri != params.Uri {
+		agg.filtered++
+		return
+	}
 
-	res := AnalyzeResult{
-		Ips:              *ipHits,
-		Codes:            *codeHits,
-		Dates:            *dateHits,
-		TotalRequests:    totalRequests,
-		UniqueUserAgents: uint64(len(uniqueUserAgents)),
-		UserAgents:       uniqueUserAgents,
-		TimeRange: TimeRange{
-			Start: timeStart,
-			End:   timeEnd,
-		},
-		ProcessingStats: ProcessingStats{
-			ParseErrors: parseErrors,
-		},
+	// signatures are matched against the raw uri, templating may strip the payload
+	if params.Security != nil {
+		if matched := params.Security.Match(rawUri, entry.UserAgent, entry.Referrer); len(matched) > 0 {
+			agg.threats.add(entry, matched)
+		}
 	}
 
-	return res, nil
+	agg.add(entry, params)
+
+	if params.Export != nil {
+		params.Export.add(entry, rawUri, params)
+	}
 }
 
 func getHitsInfo[T comparable](m map[T]uint64, topN int, desc bool) *[]HitsInfo[T] {
@@ -371,44 +568,32 @@ func getHitsInfo[T comparable](m map[T]uint64, topN int, desc bool) *[]HitsInfo[
 	return &hitsArr
 }
 
-func findNewLineIndex(data []byte, start int) int {
-	for i := start; i < len(data); i++ {
-		if data[i] == '\n' {
-			return i
-		}
-	}
-
-	return -1
+// Top N of full counters, like the ones of ResultState
+func TopHits[T comparable](m map[T]uint64, topN int, desc bool) []HitsInfo[T] {
+	return *getHitsInfo(m, topN, desc)
 }
 
-func processHitsInfo[T comparable](hits []HitsInfo[T], topN int, desc bool) []HitsInfo[T] {
-	slices.SortFunc(hits, func(a HitsInfo[T], b HitsInfo[T]) int {
-		if desc {
-			return getSortCompareResultAsc(b.Hits, a.Hits)
-		}
+func findNewLineIndex(data []byte, start int) int {
+	if start >= len(data) {
+		return -1
+	}
 
-		return getSortCompareResultAsc(a.Hits, b.Hits)
-	})
+	index := bytes.IndexByte(data[start:], '\n')
+	if index == -1 {
+		return -1
+	}
 
-	return hits[0:min(len(hits), topN)]
+	return start + index
 }
 
-func newChunk(index int, fileName string, fileSize int64) Chunk {
-	start := int64(index*CHUNK_SIZE - CHUNK_OVERLAP)
-	end := start + CHUNK_SIZE + CHUNK_OVERLAP
-
-	if start < 0 {
-		start = 0
-	}
-
-	if end >= fileSize {
-		end = fileSize - 1
-	}
+// Chunk index of the [offset, end) byte range
+func newChunk(index int, fileName string, offset, end int64) Chunk {
+	start := offset + int64(index)*CHUNK_SIZE
 
 	return Chunk{
 		fileName: fileName,
 		startPos: start,
-		endPos:   end,
+		endPos:   min(start+CHUNK_SIZE, end),
 	}
 }
 
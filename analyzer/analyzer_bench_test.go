@@ -0,0 +1,180 @@
+package analyzer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Kostayne/go-nginx-analyzer/generator"
+	"github.com/Kostayne/go-nginx-analyzer/index"
+)
+
+// Size of the generated benchmark log, override with NGINX_AN_BENCH_SIZE (in MB)
+const DEFAULT_BENCH_SIZE_MB = 256
+
+// Previous byte at a time implementation, kept as the benchmark baseline
+func findNewLineIndexLoop(data []byte, start int) int {
+	for i := start; i < len(data); i++ {
+		if data[i] == '\n' {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Generated log is kept in the temp dir, so it's created only once per size
+func benchLogFile(b *testing.B) string {
+	sizeMb := DEFAULT_BENCH_SIZE_MB
+	if env := os.Getenv("NGINX_AN_BENCH_SIZE"); env != "" {
+		parsed, err := strconv.Atoi(env)
+		if err != nil {
+			b.Fatalf("invalid NGINX_AN_BENCH_SIZE: %v", err)
+		}
+		sizeMb = parsed
+	}
+
+	size := int64(sizeMb) * 1024 * 1024
+	fpath := filepath.Join(os.TempDir(), fmt.Sprintf("nginx-an-bench-%dmb.log", sizeMb))
+
+	if stat, err := os.Stat(fpath); err == nil && stat.Size() >= size {
+		return fpath
+	}
+
+	file, err := os.Create(fpath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriterSize(file, 1024*1024)
+	if _, err := generator.WriteAccessLog(writer, size); err != nil {
+		b.Fatal(err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		b.Fatal(err)
+	}
+
+	return fpath
+}
+
+func BenchmarkAnalyze(b *testing.B) {
+	fpath := benchLogFile(b)
+
+	stat, err := os.Stat(fpath)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(stat.Size())
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	lines := uint64(0)
+	for i := 0; i < b.N; i++ {
+		res, err := Analyze(fpath, Options{TopN: 10, Desc: true, DatesBy: "hour"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		lines += res.TotalRequests + res.ProcessingStats.ParseErrors
+	}
+
+	b.ReportMetric(float64(lines)/b.Elapsed().Seconds(), "lines/s")
+}
+
+// Index of the benchmark log, kept next to it and rebuilt when the log is newer
+// or the index has an older version
+func benchIndexFile(b *testing.B, logPath string) string {
+	fpath := logPath + index.EXTENSION
+
+	logStat, err := os.Stat(logPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if stat, err := os.Stat(fpath); err == nil && stat.ModTime().After(logStat.ModTime()) {
+		if _, err := index.Open(fpath); err == nil {
+			return fpath
+		}
+	}
+
+	idx, err := index.BuildFile(logPath, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	file, err := os.Create(fpath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := idx.Write(file); err != nil {
+		b.Fatal(err)
+	}
+
+	return fpath
+}
+
+// Same analysis of the log and of its index, throughput is in log bytes for both.
+// The index is decoded once and cached, like repeated queries of serve and tui modes.
+func BenchmarkAnalyzeIndex(b *testing.B) {
+	logPath := benchLogFile(b)
+	indexPath := benchIndexFile(b, logPath)
+
+	stat, err := os.Stat(logPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	bench := func(b *testing.B, fpath string) {
+		b.SetBytes(stat.Size())
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := Analyze(fpath, Options{TopN: 10, Desc: true, DatesBy: "hour"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("Log", func(b *testing.B) {
+		bench(b, logPath)
+	})
+
+	b.Run("Index", func(b *testing.B) {
+		bench(b, indexPath)
+	})
+}
+
+func BenchmarkFindNewLineIndex(b *testing.B) {
+	line := []byte(`192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "https://example.com" "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36"` + "\n")
+	data := make([]byte, 0, len(line)*1024)
+	for len(data)+len(line) <= cap(data) {
+		data = append(data, line...)
+	}
+
+	bench := func(b *testing.B, find func([]byte, int) int) {
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			for pos := 0; pos < len(data); pos++ {
+				pos = find(data, pos)
+				if pos == -1 {
+					break
+				}
+			}
+		}
+	}
+
+	b.Run("IndexByte", func(b *testing.B) {
+		bench(b, findNewLineIndex)
+	})
+
+	b.Run("Loop", func(b *testing.B) {
+		bench(b, findNewLineIndexLoop)
+	})
+}
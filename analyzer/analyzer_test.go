@@ -3,9 +3,18 @@ package analyzer
 import (
 	"net/netip"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Kostayne/go-nginx-analyzer/crawlers"
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/realip"
+	"github.com/Kostayne/go-nginx-analyzer/security"
+	"github.com/Kostayne/go-nginx-analyzer/uripath"
+	"github.com/Kostayne/go-nginx-analyzer/useragent"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -26,7 +35,7 @@ func TestAnalyze(t *testing.T) {
 		_, err = tmpFile.WriteString(testData)
 		require.NoError(t, err)
 
-		result, err := Analyze(tmpFile.Name(), 10, true, "hour")
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour"})
 
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
@@ -59,7 +68,7 @@ func TestAnalyze(t *testing.T) {
 		_, err = tmpFile.WriteString("invalid entry 1\ninvalid entry 2\n")
 		require.NoError(t, err)
 
-		result, err := Analyze(tmpFile.Name(), 10, true, "hour")
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour"})
 
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
@@ -82,7 +91,7 @@ invalid log entry
 		_, err = tmpFile.WriteString(testData)
 		require.NoError(t, err)
 
-		result, err := Analyze(tmpFile.Name(), 10, true, "hour")
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour"})
 
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
@@ -91,7 +100,7 @@ invalid log entry
 	})
 
 	t.Run("should return error for non-existent file", func(t *testing.T) {
-		result, err := Analyze("non_existent_file.log", 10, true, "hour")
+		result, err := Analyze("non_existent_file.log", Options{TopN: 10, Desc: true, DatesBy: "hour"})
 
 		assert.Error(t, err)
 		assert.Nil(t, result)
@@ -110,7 +119,7 @@ invalid log entry
 		_, err = tmpFile.WriteString(testData)
 		require.NoError(t, err)
 
-		result, err := Analyze(tmpFile.Name(), 10, true, "day")
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "day"})
 
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
@@ -131,7 +140,7 @@ invalid log entry
 		_, err = tmpFile.WriteString(testData)
 		require.NoError(t, err)
 
-		result, err := Analyze(tmpFile.Name(), 10, false, "hour")
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: false, DatesBy: "hour"})
 
 		assert.NoError(t, err)
 		assert.NotNil(t, result)
@@ -140,6 +149,350 @@ invalid log entry
 		assert.Equal(t, uint64(1), result.Ips[0].Hits)
 		assert.Equal(t, uint64(2), result.Ips[1].Hits)
 	})
+
+	t.Run("should return errors of workers", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing.log")
+
+		result, err := analyzeRange(missing, 0, 3*CHUNK_SIZE, 3*CHUNK_SIZE, Options{TopN: 10, Desc: true})
+
+		assert.ErrorContains(t, err, "failed to open file "+missing)
+		assert.Nil(t, result)
+	})
+}
+
+func TestAnalyzeRealIp(t *testing.T) {
+	testData := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0" "203.0.113.7, 10.0.0.2"
+10.0.0.1 - - [25/Dec/2023:10:31:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0" "203.0.113.7"
+10.0.0.2 - - [25/Dec/2023:10:32:45 +0000] "GET /api/posts HTTP/1.1" 404 123 "-" "Mozilla/5.0" "-"
+198.51.100.1 - - [25/Dec/2023:10:33:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Chrome/5.0" "203.0.113.9"`
+
+	tmpFile, err := os.CreateTemp("", "xff_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(testData)
+	require.NoError(t, err)
+
+	t.Run("should resolve client ip from x-forwarded-for", func(t *testing.T) {
+		resolver, err := realip.New(realip.SOURCE_X_FORWARDED_FOR, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+		require.NoError(t, err)
+
+		result, err := Analyze(tmpFile.Name(), Options{
+			TopN:        10,
+			Desc:        true,
+			DatesBy:     "hour",
+			ExtraFields: []parser.ExtraField{parser.FIELD_X_FORWARDED_FOR},
+			RealIp:      resolver,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(4), result.TotalRequests)
+		assert.Equal(t, uint64(3), result.UniqueIPs)
+		assert.Equal(t, "203.0.113.7", result.Ips[0].Key.String())
+		assert.Equal(t, uint64(2), result.Ips[0].Hits)
+
+		// untrusted peer keeps its own address
+		assert.Contains(t, result.Ips, HitsInfo[netip.Addr]{Key: netip.MustParseAddr("198.51.100.1"), Hits: 1})
+
+		assert.Len(t, result.RemoteAddrs, 3)
+		assert.Equal(t, "10.0.0.1", result.RemoteAddrs[0].Key.String())
+		assert.Equal(t, uint64(2), result.RemoteAddrs[0].Hits)
+	})
+
+	t.Run("should keep remote addr without resolver", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{
+			TopN:        10,
+			Desc:        true,
+			DatesBy:     "hour",
+			ExtraFields: []parser.ExtraField{parser.FIELD_X_FORWARDED_FOR},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "10.0.0.1", result.Ips[0].Key.String())
+		assert.Nil(t, result.RemoteAddrs)
+	})
+}
+
+func TestAnalyzeGeo(t *testing.T) {
+	testData := `203.0.113.7 - - [25/Dec/2023:10:30:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"
+203.0.113.8 - - [25/Dec/2023:10:31:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"
+198.51.100.1 - - [25/Dec/2023:10:32:45 +0000] "GET /api/posts HTTP/1.1" 404 123 "-" "Mozilla/5.0"
+192.0.2.1 - - [25/Dec/2023:10:33:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Chrome/5.0"`
+
+	tmpFile, err := os.CreateTemp("", "geo_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(testData)
+	require.NoError(t, err)
+
+	// 203.0.113.0/24 resolves to US and AS15169, 198.51.100.0/24 to DE
+	geo, err := geoip.Open("../geoip/testdata/GeoLite2-City-Test.mmdb", "../geoip/testdata/GeoLite2-ASN-Test.mmdb")
+	require.NoError(t, err)
+	defer geo.Close()
+
+	t.Run("should report countries and asns", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour", Geo: geo})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []HitsInfo[string]{{Key: "US", Hits: 2}}, result.Countries[:1])
+		assert.Len(t, result.Countries, 3)
+		assert.Contains(t, result.Asns, HitsInfo[geoip.Asn]{Key: geoip.Asn{Number: 15169, Org: "GOOGLE"}, Hits: 2})
+		assert.Equal(t, "Berlin", result.IpsGeo[netip.MustParseAddr("198.51.100.1")].City)
+	})
+
+	t.Run("should filter by country", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour", Geo: geo, Countries: []string{"DE", geoip.UNKNOWN_COUNTRY}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), result.TotalRequests)
+		assert.Equal(t, uint64(2), result.ProcessingStats.Filtered)
+		assert.Len(t, result.Ips, 2)
+	})
+}
+
+func TestAnalyzeUserAgents(t *testing.T) {
+	testData := `192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 1234 "-" "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+192.168.1.101 - - [25/Dec/2023:10:31:45 +0000] "GET / HTTP/1.1" 200 1234 "-" "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+192.168.1.102 - - [25/Dec/2023:10:32:45 +0000] "GET / HTTP/1.1" 200 123 "-" "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1"
+66.249.66.1 - - [25/Dec/2023:10:33:45 +0000] "GET /robots.txt HTTP/1.1" 200 12 "-" "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"`
+
+	tmpFile, err := os.CreateTemp("", "ua_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(testData)
+	require.NoError(t, err)
+
+	t.Run("should classify user agents", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour", UserAgents: useragent.Default()})
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(3), result.UniqueUserAgents)
+		assert.Equal(t, uint64(2), result.UserAgents[0].Hits)
+		assert.Equal(t, []HitsInfo[string]{{Key: "Chrome 120", Hits: 2}, {Key: "Safari 17", Hits: 1}}, result.Browsers)
+		assert.Equal(t, []HitsInfo[string]{{Key: "Windows", Hits: 2}, {Key: "iOS", Hits: 1}}, result.OperatingSystems)
+		assert.Equal(t, []HitsInfo[string]{{Key: "Googlebot", Hits: 1}}, result.Bots)
+		assert.Equal(t, HitsInfo[string]{Key: "desktop", Hits: 2}, result.Devices[0])
+		assert.Len(t, result.Devices, 3)
+	})
+
+	t.Run("should exclude bots", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour", UserAgents: useragent.Default(), ExcludeBots: true})
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(3), result.TotalRequests)
+		assert.Equal(t, uint64(1), result.ProcessingStats.Filtered)
+		assert.Empty(t, result.Bots)
+	})
+}
+
+func TestAnalyzeUris(t *testing.T) {
+	testData := `192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET /blog/post/123 HTTP/1.1" 200 100 "-" "curl/7.68.0"
+192.168.1.100 - - [25/Dec/2023:10:31:45 +0000] "GET /blog/post/456?utm_source=x HTTP/1.1" 200 100 "-" "curl/7.68.0"
+192.168.1.101 - - [25/Dec/2023:10:32:45 +0000] "GET /users/john/orders?page=2 HTTP/1.1" 200 100 "-" "curl/7.68.0"
+192.168.1.102 - - [25/Dec/2023:10:33:45 +0000] "GET /about HTTP/1.1" 200 100 "-" "curl/7.68.0"`
+
+	tmpFile, err := os.CreateTemp("", "uris_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(testData)
+	require.NoError(t, err)
+
+	t.Run("should report raw uris without normalizer", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour"})
+
+		assert.NoError(t, err)
+		assert.Len(t, result.Uris, 4)
+	})
+
+	t.Run("should collapse uris into templates", func(t *testing.T) {
+		uris, err := uripath.New(uripath.Options{
+			Auto:        true,
+			Routes:      []string{"/users/:name/orders"},
+			QueryParams: []string{"page"},
+		})
+		require.NoError(t, err)
+
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour", Uris: uris})
+
+		assert.NoError(t, err)
+		assert.Equal(t, HitsInfo[string]{Key: "/blog/post/{id}", Hits: 2}, result.Uris[0])
+		assert.ElementsMatch(t, []HitsInfo[string]{
+			{Key: "/blog/post/{id}", Hits: 2},
+			{Key: "/users/{name}/orders?page=2", Hits: 1},
+			{Key: "/about", Hits: 1},
+		}, result.Uris)
+	})
+}
+
+func TestAnalyzeSecurity(t *testing.T) {
+	testData := `203.0.113.7 - - [25/Dec/2023:10:30:45 +0000] "GET /wp-login.php HTTP/1.1" 404 100 "-" "Mozilla/5.0"
+203.0.113.7 - - [25/Dec/2023:10:31:45 +0000] "GET /.env HTTP/1.1" 404 100 "-" "Mozilla/5.0"
+203.0.113.7 - - [25/Dec/2023:10:35:45 +0000] "GET /download?file=../../etc/passwd HTTP/1.1" 400 100 "-" "Mozilla/5.0"
+198.51.100.1 - - [25/Dec/2023:10:32:45 +0000] "GET /products?id=1%20UNION%20SELECT%201 HTTP/1.1" 500 100 "-" "sqlmap/1.7.2"
+192.168.1.100 - - [25/Dec/2023:10:33:45 +0000] "GET /products?id=1 HTTP/1.1" 200 100 "-" "Mozilla/5.0"`
+
+	tmpFile, err := os.CreateTemp("", "security_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(testData)
+	require.NoError(t, err)
+
+	t.Run("should not report without scanner", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour"})
+
+		assert.NoError(t, err)
+		assert.Nil(t, result.Security)
+	})
+
+	t.Run("should rank offending ips", func(t *testing.T) {
+		uris, err := uripath.New(uripath.Options{Auto: true, StripQuery: true})
+		require.NoError(t, err)
+
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour", Security: security.Default(), Uris: uris})
+		require.NoError(t, err)
+
+		report := result.Security
+		require.NotNil(t, report)
+		assert.Equal(t, uint64(4), report.Hits)
+		assert.Equal(t, HitsInfo[string]{Key: "probe", Hits: 2}, report.Categories[0])
+		assert.ElementsMatch(t, []HitsInfo[string]{
+			{Key: "probe", Hits: 2},
+			{Key: "traversal", Hits: 1},
+			{Key: "sqli", Hits: 1},
+			{Key: "scanner", Hits: 1},
+		}, report.Categories)
+
+		require.Len(t, report.Offenders, 2)
+		offender := report.Offenders[0]
+		assert.Equal(t, netip.MustParseAddr("203.0.113.7"), offender.Ip)
+		assert.Equal(t, uint64(3), offender.Hits)
+		assert.Equal(t, time.Date(2023, 12, 25, 10, 30, 45, 0, time.UTC), offender.FirstSeen.UTC())
+		assert.Equal(t, time.Date(2023, 12, 25, 10, 35, 45, 0, time.UTC), offender.LastSeen.UTC())
+		assert.Equal(t, []string{"probe", "traversal"}, offender.Categories)
+		assert.Len(t, offender.Rules, 4)
+
+		assert.Equal(t, []string{"scanner", "sqli"}, report.Offenders[1].Categories)
+	})
+}
+
+func TestAnalyzeBlock(t *testing.T) {
+	testData := `203.0.113.7 - - [25/Dec/2023:10:30:01 +0000] "GET /a HTTP/1.1" 404 100 "-" "Mozilla/5.0"
+203.0.113.7 - - [25/Dec/2023:10:30:02 +0000] "GET /b HTTP/1.1" 404 100 "-" "Mozilla/5.0"
+203.0.113.7 - - [25/Dec/2023:10:30:03 +0000] "GET /c HTTP/1.1" 403 100 "-" "Mozilla/5.0"
+198.51.100.1 - - [25/Dec/2023:10:30:04 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+198.51.100.1 - - [25/Dec/2023:10:30:05 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+198.51.100.1 - - [25/Dec/2023:10:30:06 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+198.51.100.1 - - [25/Dec/2023:10:30:07 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+192.0.2.1 - - [25/Dec/2023:10:30:08 +0000] "GET /.env HTTP/1.1" 404 100 "-" "Mozilla/5.0"
+192.168.1.100 - - [25/Dec/2023:10:30:09 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+192.168.1.100 - - [25/Dec/2023:10:31:09 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+192.168.1.100 - - [25/Dec/2023:10:32:09 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+192.168.1.100 - - [25/Dec/2023:10:33:09 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"`
+
+	tmpFile, err := os.CreateTemp("", "block_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(testData)
+	require.NoError(t, err)
+
+	t.Run("should block clients reaching thresholds", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{
+			TopN:     10,
+			Desc:     true,
+			DatesBy:  "hour",
+			Security: security.Default(),
+			Block: &BlockRules{
+				MaxRequestsPerMinute: 3,
+				MaxErrorsPerMinute:   2,
+				MinSecurityHits:      1,
+			},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []BlockedClient{
+			{
+				Ip:                    netip.MustParseAddr("192.0.2.1"),
+				Reasons:               []string{"security hits 1"},
+				PeakRequestsPerMinute: 1,
+				PeakErrorsPerMinute:   1,
+				SecurityHits:          1,
+			},
+			{
+				Ip:                    netip.MustParseAddr("198.51.100.1"),
+				Reasons:               []string{"requests per minute 4"},
+				PeakRequestsPerMinute: 4,
+			},
+			{
+				Ip:                    netip.MustParseAddr("203.0.113.7"),
+				Reasons:               []string{"4xx per minute 3"},
+				PeakRequestsPerMinute: 3,
+				PeakErrorsPerMinute:   3,
+			},
+		}, result.Blocked)
+	})
+
+	t.Run("should not block without rules", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, DatesBy: "hour"})
+
+		assert.NoError(t, err)
+		assert.Nil(t, result.Blocked)
+	})
+}
+
+func TestAnalyzeBots(t *testing.T) {
+	testData := `66.249.64.10 - - [25/Dec/2023:10:30:45 +0000] "GET /robots.txt HTTP/1.1" 200 100 "-" "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+66.249.64.10 - - [25/Dec/2023:10:31:45 +0000] "GET /products HTTP/1.1" 200 1000 "-" "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+203.0.113.7 - - [25/Dec/2023:10:32:45 +0000] "GET /products HTTP/1.1" 404 50 "-" "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+157.55.39.1 - - [25/Dec/2023:10:33:45 +0000] "GET / HTTP/1.1" 200 10 "-" "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)"
+192.168.1.100 - - [25/Dec/2023:10:34:45 +0000] "GET / HTTP/1.1" 200 10 "-" "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"`
+
+	tmpFile, err := os.CreateTemp("", "bots_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(testData)
+	require.NoError(t, err)
+
+	ranges := crawlers.NewRanges()
+	ranges.Add("Googlebot", []netip.Prefix{netip.MustParsePrefix("66.249.64.0/27")})
+
+	result, err := Analyze(tmpFile.Name(), Options{
+		TopN:       10,
+		Desc:       true,
+		DatesBy:    "hour",
+		UserAgents: useragent.Default(),
+		Crawlers:   ranges,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.BotReports, 2)
+
+	google := result.BotReports[0]
+	assert.Equal(t, "Googlebot", google.Name)
+	assert.Equal(t, uint64(3), google.Hits)
+	assert.Equal(t, uint64(1150), google.Bytes)
+	assert.Equal(t, []HitsInfo[uint16]{{Key: 200, Hits: 2}, {Key: 404, Hits: 1}}, google.Codes)
+	assert.Equal(t, HitsInfo[string]{Key: "/products", Hits: 2}, google.Paths[0])
+	assert.Equal(t, &BotVerification{
+		VerifiedHits:     2,
+		ImpersonatorHits: 1,
+		Impersonators:    []HitsInfo[netip.Addr]{{Key: netip.MustParseAddr("203.0.113.7"), Hits: 1}},
+	}, google.Verification)
+
+	bing := result.BotReports[1]
+	assert.Equal(t, "Bingbot", bing.Name)
+	assert.Nil(t, bing.Verification)
 }
 
 func TestGetHitsInfo(t *testing.T) {
@@ -201,15 +554,15 @@ func TestGetHitsInfo(t *testing.T) {
 	})
 }
 
-func TestProcessHitsInfo(t *testing.T) {
+func TestTopHits(t *testing.T) {
 	t.Run("should process and sort hits correctly", func(t *testing.T) {
-		hits := []HitsInfo[string]{
-			{Key: "a", Hits: 10},
-			{Key: "b", Hits: 30},
-			{Key: "c", Hits: 20},
+		hits := map[string]uint64{
+			"a": 10,
+			"b": 30,
+			"c": 20,
 		}
 
-		result := processHitsInfo(hits, 2, true)
+		result := TopHits(hits, 2, true)
 
 		assert.Len(t, result, 2)
 		assert.Equal(t, "b", result[0].Key)
@@ -218,10 +571,8 @@ func TestProcessHitsInfo(t *testing.T) {
 		assert.Equal(t, uint64(20), result[1].Hits)
 	})
 
-	t.Run("should handle empty slice", func(t *testing.T) {
-		hits := []HitsInfo[string]{}
-
-		result := processHitsInfo(hits, 10, true)
+	t.Run("should handle empty map", func(t *testing.T) {
+		result := TopHits(map[string]uint64{}, 10, true)
 
 		assert.Len(t, result, 0)
 	})
@@ -258,41 +609,133 @@ func TestNewChunk(t *testing.T) {
 		fileName := "test.log"
 		fileSize := int64(CHUNK_SIZE * 2) // Large enough file
 
-		chunk := newChunk(0, fileName, fileSize)
+		chunk := newChunk(0, fileName, 0, fileSize)
 
 		assert.Equal(t, fileName, chunk.fileName)
 		assert.Equal(t, int64(0), chunk.startPos)
-		// For index 0: start = 0*CHUNK_SIZE - CHUNK_OVERLAP = -CHUNK_OVERLAP, clamped to 0
-		// end = 0 + CHUNK_SIZE + CHUNK_OVERLAP = CHUNK_SIZE + CHUNK_OVERLAP
-		expectedEnd := int64(CHUNK_SIZE)
-		assert.Equal(t, expectedEnd, chunk.endPos)
+		assert.Equal(t, int64(CHUNK_SIZE), chunk.endPos)
 	})
 
-	t.Run("should handle negative start position", func(t *testing.T) {
+	t.Run("should start next chunk where the previous one ends", func(t *testing.T) {
 		fileName := "test.log"
 		fileSize := int64(CHUNK_SIZE * 2) // Large enough file
 
-		chunk := newChunk(1, fileName, fileSize)
+		chunk := newChunk(1, fileName, 0, fileSize)
 
 		assert.Equal(t, fileName, chunk.fileName)
-		// For index 1: start = 1*CHUNK_SIZE - CHUNK_OVERLAP = CHUNK_SIZE - CHUNK_OVERLAP
-		expectedStart := int64(CHUNK_SIZE - CHUNK_OVERLAP)
-		assert.Equal(t, expectedStart, chunk.startPos)
-		// end = start + CHUNK_SIZE + CHUNK_OVERLAP = (CHUNK_SIZE - CHUNK_OVERLAP) + CHUNK_SIZE + CHUNK_OVERLAP = 2*CHUNK_SIZE
-		expectedEnd := int64(2*CHUNK_SIZE - 1)
-		assert.Equal(t, expectedEnd, chunk.endPos)
+		assert.Equal(t, int64(CHUNK_SIZE), chunk.startPos)
+		assert.Equal(t, int64(2*CHUNK_SIZE), chunk.endPos)
 	})
 
 	t.Run("should handle end position beyond file size", func(t *testing.T) {
 		fileName := "test.log"
 		fileSize := int64(1000) // Small file
 
-		chunk := newChunk(10, fileName, fileSize)
+		chunk := newChunk(0, fileName, 0, fileSize)
 
 		assert.Equal(t, fileName, chunk.fileName)
-		// For index 10: start = 10*CHUNK_SIZE - CHUNK_OVERLAP = 10*CHUNK_SIZE - CHUNK_OVERLAP
-		// end = start + CHUNK_SIZE + CHUNK_OVERLAP = 11*CHUNK_SIZE, but clamped to fileSize-1
-		assert.Equal(t, int64(fileSize-1), chunk.endPos) // Should be clamped to fileSize-1
+		assert.Equal(t, fileSize, chunk.endPos) // Should be clamped to fileSize
+	})
+
+	t.Run("should be empty when the index is past the end", func(t *testing.T) {
+		fileSize := int64(1000) // Small file
+
+		chunk := newChunk(10, "test.log", 0, fileSize)
+
+		assert.Equal(t, int64(10*CHUNK_SIZE), chunk.startPos)
+		assert.Equal(t, fileSize, chunk.endPos)
+		assert.GreaterOrEqual(t, chunk.startPos, chunk.endPos)
+	})
+
+	t.Run("should start chunks of a range at its offset", func(t *testing.T) {
+		chunk := newChunk(1, "test.log", 500, CHUNK_SIZE+1000)
+
+		assert.Equal(t, int64(CHUNK_SIZE+500), chunk.startPos)
+		assert.Equal(t, int64(CHUNK_SIZE+1000), chunk.endPos)
+	})
+}
+
+func TestProcessChunk(t *testing.T) {
+	testData := `192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "https://example.com" "Mozilla/5.0"
+192.168.1.101 - - [25/Dec/2023:10:31:45 +0000] "POST /api/users HTTP/1.1" 201 567 "https://example.com" "Mozilla/5.0"
+192.168.1.100 - - [25/Dec/2023:10:32:45 +0000] "GET /api/posts HTTP/1.1" 404 123 "https://example.com" "Mozilla/5.0"
+192.168.1.102 - - [25/Dec/2023:10:33:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "https://example.com" "Chrome/5.0"`
+
+	tmpFile, err := os.CreateTemp("", "chunks_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(testData)
+	require.NoError(t, err)
+
+	fileSize := int64(len(testData))
+	params := ProcessParams{GroupBy: "none", FileSize: fileSize}
+
+	t.Run("should process every line exactly once for any chunk boundary", func(t *testing.T) {
+		for boundary := int64(1); boundary < fileSize; boundary++ {
+			agg := newAggregator()
+			lineParser := parser.NewParser()
+
+			first := Chunk{fileName: tmpFile.Name(), startPos: 0, endPos: boundary}
+			second := Chunk{fileName: tmpFile.Name(), startPos: boundary, endPos: fileSize}
+
+			require.NoError(t, processChunk(first, tmpFile, lineParser, agg, params))
+			require.NoError(t, processChunk(second, tmpFile, lineParser, agg, params))
+
+			assert.Equal(t, uint64(4), agg.totalRequests, "boundary %d", boundary)
+			assert.Equal(t, uint64(0), agg.parseErrors, "boundary %d", boundary)
+			assert.Equal(t, uint64(2), agg.ips[netip.MustParseAddr("192.168.1.100")], "boundary %d", boundary)
+		}
+	})
+
+	t.Run("should process a line in the chunk it starts in", func(t *testing.T) {
+		// the boundary falls inside of the first line
+		first := newAggregator()
+		require.NoError(t, processChunk(Chunk{fileName: tmpFile.Name(), startPos: 0, endPos: 10}, tmpFile, parser.NewParser(), first, params))
+
+		second := newAggregator()
+		require.NoError(t, processChunk(Chunk{fileName: tmpFile.Name(), startPos: 10, endPos: fileSize}, tmpFile, parser.NewParser(), second, params))
+
+		assert.Equal(t, uint64(1), first.totalRequests)
+		assert.Equal(t, uint64(1), first.ips[netip.MustParseAddr("192.168.1.100")])
+		assert.Equal(t, uint64(3), second.totalRequests)
+		assert.Equal(t, uint64(1), second.ips[netip.MustParseAddr("192.168.1.100")])
+	})
+
+	t.Run("should read at most CHUNK_OVERLAP past the chunk end", func(t *testing.T) {
+		long := `192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET /` + strings.Repeat("a", CHUNK_OVERLAP) + ` HTTP/1.1" 200 1234 "-" "Mozilla/5.0"
+192.168.1.101 - - [25/Dec/2023:10:31:45 +0000] "GET / HTTP/1.1" 200 1234 "-" "Mozilla/5.0"
+`
+		fpath := filepath.Join(t.TempDir(), "long.log")
+		require.NoError(t, os.WriteFile(fpath, []byte(long), 0644))
+
+		file, err := os.Open(fpath)
+		require.NoError(t, err)
+		defer file.Close()
+
+		longParams := ProcessParams{GroupBy: "none", FileSize: int64(len(long))}
+		first := newAggregator()
+		require.NoError(t, processChunk(Chunk{fileName: fpath, startPos: 0, endPos: 10}, file, parser.NewParser(), first, longParams))
+
+		second := newAggregator()
+		require.NoError(t, processChunk(Chunk{fileName: fpath, startPos: 10, endPos: int64(len(long))}, file, parser.NewParser(), second, longParams))
+
+		// the line is cut at the overlap, the next chunk still skips it
+		assert.Equal(t, uint64(0), first.totalRequests)
+		assert.Equal(t, uint64(1), first.parseErrors)
+		assert.Equal(t, uint64(1), second.totalRequests)
+		assert.Equal(t, uint64(0), second.parseErrors)
+	})
+
+	t.Run("should skip empty chunk", func(t *testing.T) {
+		agg := newAggregator()
+		chunk := Chunk{fileName: tmpFile.Name(), startPos: fileSize, endPos: fileSize}
+
+		err := processChunk(chunk, tmpFile, parser.NewParser(), agg, params)
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), agg.totalRequests)
 	})
 }
 
@@ -319,64 +762,36 @@ func TestMergeResults(t *testing.T) {
 		ip2, _ := netip.ParseAddr("192.168.1.101")
 		ip3, _ := netip.ParseAddr("192.168.1.102")
 
-		chunk1 := AnalyzeResult{
-			Ips: []HitsInfo[netip.Addr]{
-				{Key: ip1, Hits: 5},
-				{Key: ip2, Hits: 3},
-			},
-			Codes: []HitsInfo[uint16]{
-				{Key: 200, Hits: 6},
-				{Key: 404, Hits: 2},
-			},
-			TotalRequests:    8,
-			UniqueUserAgents: 2,
-			UserAgents: map[string]bool{
-				"Mozilla/5.0": true,
-				"Chrome/5.0":  true,
-			},
-			TimeRange: TimeRange{
-				Start: time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC),
-				End:   time.Date(2023, 12, 25, 11, 0, 0, 0, time.UTC),
-			},
-			ProcessingStats: ProcessingStats{
-				ParseErrors: 1,
-			},
-		}
-
-		chunk2 := AnalyzeResult{
-			Ips: []HitsInfo[netip.Addr]{
-				{Key: ip1, Hits: 3},
-				{Key: ip3, Hits: 4},
-			},
-			Codes: []HitsInfo[uint16]{
-				{Key: 200, Hits: 4},
-				{Key: 500, Hits: 3},
-			},
-			TotalRequests:    7,
-			UniqueUserAgents: 1,
-			UserAgents: map[string]bool{
-				"Mozilla/5.0": true,
-			},
-			TimeRange: TimeRange{
-				Start: time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC),
-				End:   time.Date(2023, 12, 25, 13, 0, 0, 0, time.UTC),
-			},
-			ProcessingStats: ProcessingStats{
-				ParseErrors: 2,
-			},
-		}
-
-		resultChan := make(chan AnalyzeResult, 2)
-		resultChan <- chunk1
-		resultChan <- chunk2
+		agg1 := newAggregator()
+		agg1.ips[ip1] = 5
+		agg1.ips[ip2] = 3
+		agg1.codes[200] = 6
+		agg1.codes[404] = 2
+		agg1.totalRequests = 8
+		agg1.userAgents["Mozilla/5.0"] = 6
+		agg1.userAgents["Chrome/5.0"] = 2
+		agg1.trackTime(time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC), time.Date(2023, 12, 25, 11, 0, 0, 0, time.UTC))
+		agg1.parseErrors = 1
+
+		agg2 := newAggregator()
+		agg2.ips[ip1] = 3
+		agg2.ips[ip3] = 4
+		agg2.codes[200] = 4
+		agg2.codes[500] = 3
+		agg2.totalRequests = 7
+		agg2.userAgents["Mozilla/5.0"] = 7
+		agg2.trackTime(time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC), time.Date(2023, 12, 25, 13, 0, 0, 0, time.UTC))
+		agg2.parseErrors = 2
+
+		resultChan := make(chan *aggregator, 2)
+		resultChan <- agg1
+		resultChan <- agg2
 		close(resultChan)
 
 		params := MergeParams{
-			ChunksCount:  2,
-			TopN:         10,
-			Desc:         true,
-			FileSize:     1000,
-			WorkersCount: 2,
+			TopN:     10,
+			Desc:     true,
+			FileSize: 1000,
 		}
 
 		result := mergeResults(resultChan, params)
@@ -387,10 +802,138 @@ func TestMergeResults(t *testing.T) {
 		assert.Equal(t, uint64(3), result.ProcessingStats.ParseErrors)
 		assert.Equal(t, int64(1000), result.ProcessingStats.FileSize)
 
+		// Counts are summed before top N is taken
+		assert.Equal(t, ip1, result.Ips[0].Key)
+		assert.Equal(t, uint64(8), result.Ips[0].Hits)
+		assert.Equal(t, uint16(200), result.Codes[0].Key)
+		assert.Equal(t, uint64(10), result.Codes[0].Hits)
+
 		// Check time range
 		expectedStart := time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC)
 		expectedEnd := time.Date(2023, 12, 25, 13, 0, 0, 0, time.UTC)
 		assert.Equal(t, expectedStart, result.TimeRange.Start)
 		assert.Equal(t, expectedEnd, result.TimeRange.End)
 	})
+
+	t.Run("should merge chunks like a single pass", func(t *testing.T) {
+		testData := `192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "-" "Mozilla/5.0"
+192.168.1.101 - - [25/Dec/2023:11:31:45 +0000] "POST /api/users HTTP/1.1" 201 567 "-" "Mozilla/5.0"
+192.168.1.100 - - [25/Dec/2023:12:32:45 +0000] "GET /api/posts HTTP/1.1" 404 123 "-" "Chrome/5.0"
+`
+		fpath := filepath.Join(t.TempDir(), "access.log")
+		require.NoError(t, os.WriteFile(fpath, []byte(testData), 0644))
+
+		file, err := os.Open(fpath)
+		require.NoError(t, err)
+		defer file.Close()
+
+		fileSize := int64(len(testData))
+		params := ProcessParams{GroupBy: "hour", FileSize: fileSize}
+		boundaries := []int64{0, 50, 200, fileSize}
+
+		resultChan := make(chan *aggregator, len(boundaries)-1)
+		for i := 1; i < len(boundaries); i++ {
+			agg := newAggregator()
+			chunk := Chunk{fileName: fpath, startPos: boundaries[i-1], endPos: boundaries[i]}
+			require.NoError(t, processChunk(chunk, file, parser.NewParser(), agg, params))
+			resultChan <- agg
+		}
+		close(resultChan)
+
+		result := mergeResults(resultChan, MergeParams{TopN: 10, Desc: true, GroupBy: "hour", FileSize: fileSize})
+		full, err := Analyze(fpath, Options{TopN: 10, Desc: true, DatesBy: "hour"})
+		require.NoError(t, err)
+
+		assert.Equal(t, full.TotalRequests, result.TotalRequests)
+		assert.Equal(t, full.UniqueIPs, result.UniqueIPs)
+		assert.ElementsMatch(t, full.Ips, result.Ips)
+		assert.ElementsMatch(t, full.Codes, result.Codes)
+		assert.ElementsMatch(t, full.Dates, result.Dates)
+		assert.True(t, full.TimeRange.Start.Equal(result.TimeRange.Start))
+		assert.True(t, full.TimeRange.End.Equal(result.TimeRange.End))
+	})
+}
+
+func TestAnalyzeTimeRange(t *testing.T) {
+	t.Run("should analyze requests in [since, until) only", func(t *testing.T) {
+		testData := `10.0.0.1 - - [25/Dec/2023:10:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.2 - - [25/Dec/2023:11:00:00 +0200] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.3 - - [25/Dec/2023:11:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.4 - - [25/Dec/2023:12:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"`
+
+		tmpFile, err := os.CreateTemp("", "test_log_*.log")
+		require.NoError(t, err)
+		defer os.Remove(tmpFile.Name())
+		defer tmpFile.Close()
+
+		_, err = tmpFile.WriteString(testData)
+		require.NoError(t, err)
+
+		result, err := Analyze(tmpFile.Name(), Options{
+			TopN:  10,
+			Desc:  true,
+			Since: time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC),
+			Until: time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC),
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, uint64(2), result.TotalRequests)
+		assert.Equal(t, uint64(2), result.ProcessingStats.Filtered)
+		assert.ElementsMatch(t, []HitsInfo[netip.Addr]{
+			{Key: netip.MustParseAddr("10.0.0.1"), Hits: 1},
+			{Key: netip.MustParseAddr("10.0.0.3"), Hits: 1},
+		}, result.Ips)
+	})
+}
+
+func TestAnalyzeClientAndUri(t *testing.T) {
+	testData := `10.0.0.1 - - [25/Dec/2023:10:00:00 +0000] "GET /users/1 HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.1 - - [25/Dec/2023:10:01:00 +0000] "GET /about HTTP/1.1" 404 100 "-" "Mozilla/5.0"
+10.0.0.2 - - [25/Dec/2023:10:02:00 +0000] "GET /users/2 HTTP/1.1" 200 100 "-" "Mozilla/5.0"`
+
+	tmpFile, err := os.CreateTemp("", "test_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(testData)
+	require.NoError(t, err)
+
+	t.Run("should analyze requests of the client only", func(t *testing.T) {
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, Ip: netip.MustParseAddr("10.0.0.1")})
+		require.NoError(t, err)
+
+		assert.Equal(t, uint64(2), result.TotalRequests)
+		assert.Equal(t, uint64(1), result.ProcessingStats.Filtered)
+		assert.Len(t, result.Uris, 2)
+	})
+
+	t.Run("should match the normalized uri", func(t *testing.T) {
+		uris, err := uripath.New(uripath.Options{Auto: true})
+		require.NoError(t, err)
+
+		result, err := Analyze(tmpFile.Name(), Options{TopN: 10, Desc: true, Uris: uris, Uri: "/users/{id}"})
+		require.NoError(t, err)
+
+		assert.Equal(t, uint64(2), result.TotalRequests)
+		assert.Equal(t, uint64(1), result.ProcessingStats.Filtered)
+		assert.Len(t, result.Ips, 2)
+	})
+}
+
+func TestParseStatusRanges(t *testing.T) {
+	t.Run("should parse codes and classes", func(t *testing.T) {
+		ranges, err := ParseStatusRanges([]string{"404", " 5XX"})
+		require.NoError(t, err)
+		assert.Equal(t, []StatusRange{{Min: 404, Max: 404}, {Min: 500, Max: 599}}, ranges)
+		assert.True(t, matchesStatus(ranges, 503))
+		assert.False(t, matchesStatus(ranges, 403))
+	})
+
+	t.Run("should reject invalid statuses", func(t *testing.T) {
+		for _, value := range []string{"6xx", "99", "abc", "4x"} {
+			_, err := ParseStatusRanges([]string{value})
+			assert.Error(t, err, value)
+		}
+	})
 }
@@ -0,0 +1,328 @@
+package analyzer
+
+import (
+	"math"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// Robust z-score above which a bucket is anomalous
+const DEFAULT_ANOMALY_THRESHOLD = 3.5
+
+// Min amount of buckets to build a baseline from
+const MIN_ANOMALY_BUCKETS = 8
+
+// Min samples of every hour of day to use the seasonal baseline
+const MIN_SEASONAL_SAMPLES = 3
+
+type AnomalyMetric string
+
+const (
+	METRIC_REQUESTS   AnomalyMetric = "requests"
+	METRIC_ERROR_RATE AnomalyMetric = "errorRate"
+	METRIC_BYTES      AnomalyMetric = "bytes"
+)
+
+type AnomalyKind string
+
+const (
+	ANOMALY_SPIKE AnomalyKind = "spike"
+	ANOMALY_DROP  AnomalyKind = "drop"
+)
+
+type AnomalyOptions struct {
+	// Robust z-score threshold, DEFAULT_ANOMALY_THRESHOLD when zero
+	Threshold float64 `json:"threshold"`
+}
+
+type AnomalyReport struct {
+	// "hourOfDay" when hourly buckets cover enough days, "global" otherwise
+	Baseline  string    `json:"baseline"`
+	Buckets   int       `json:"buckets"`
+	Anomalies []Anomaly `json:"anomalies"`
+}
+
+type Anomaly struct {
+	Start  time.Time     `json:"start"`
+	Metric AnomalyMetric `json:"metric"`
+	Kind   AnomalyKind   `json:"kind"`
+
+	Value    float64 `json:"value"`
+	Expected float64 `json:"expected"`
+	Score    float64 `json:"score"`
+
+	// Top contributors of the bucket, error requests only for error rate anomalies
+	Ips   []HitsInfo[netip.Addr] `json:"ips"`
+	Uris  []HitsInfo[string]     `json:"uris"`
+	Codes []HitsInfo[uint16]     `json:"codes"`
+}
+
+type bucketStats struct {
+	start    time.Time
+	requests uint64
+	errors   uint64
+	bytes    uint64
+
+	ips       map[netip.Addr]uint64
+	uris      map[string]uint64
+	codes     map[uint16]uint64
+	errorIps  map[netip.Addr]uint64
+	errorUris map[string]uint64
+}
+
+func newBucketStats(start time.Time) *bucketStats {
+	return &bucketStats{
+		start:     start,
+		ips:       make(map[netip.Addr]uint64),
+		uris:      make(map[string]uint64),
+		codes:     make(map[uint16]uint64),
+		errorIps:  make(map[netip.Addr]uint64),
+		errorUris: make(map[string]uint64),
+	}
+}
+
+// Server errors, client errors are mostly probes and broken links
+func isErrorCode(code uint16) bool {
+	return code >= 500
+}
+
+// Buckets are keyed by unix time, workers have distinct locations of the same zone
+func (agg *aggregator) addBucket(entry *parser.LogEntry, groupBy string) {
+	start := groupDate(entry.Date, groupBy)
+
+	bucket, ok := agg.buckets[start.Unix()]
+	if !ok {
+		bucket = newBucketStats(start)
+		agg.buckets[start.Unix()] = bucket
+	}
+
+	bucket.requests++
+	bucket.bytes += uint64(entry.RespBytes)
+	bucket.ips[entry.Ip]++
+	bucket.uris[entry.Uri]++
+	bucket.codes[entry.StatusCode]++
+
+	if isErrorCode(entry.StatusCode) {
+		bucket.errors++
+		bucket.errorIps[entry.Ip]++
+		bucket.errorUris[entry.Uri]++
+	}
+}
+
+func (bucket *bucketStats) merge(other *bucketStats) {
+	bucket.requests += other.requests
+	bucket.errors += other.errors
+	bucket.bytes += other.bytes
+	mergeCounts(bucket.ips, other.ips)
+	mergeCounts(bucket.uris, other.uris)
+	mergeCounts(bucket.codes, other.codes)
+	mergeCounts(bucket.errorIps, other.errorIps)
+	mergeCounts(bucket.errorUris, other.errorUris)
+}
+
+func anomalyReport(buckets map[int64]*bucketStats, groupBy string, topN int, opts AnomalyOptions) *AnomalyReport {
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = DEFAULT_ANOMALY_THRESHOLD
+	}
+
+	series := fillBuckets(buckets, groupBy)
+	report := &AnomalyReport{Baseline: "global", Buckets: len(series), Anomalies: make([]Anomaly, 0)}
+
+	if len(series) < MIN_ANOMALY_BUCKETS {
+		return report
+	}
+
+	seasonal := groupBy == "hour" && hasSeasonalSamples(series)
+	if seasonal {
+		report.Baseline = "hourOfDay"
+	}
+
+	metrics := []struct {
+		metric AnomalyMetric
+		value  func(*bucketStats) float64
+	}{
+		{METRIC_REQUESTS, func(b *bucketStats) float64 { return float64(b.requests) }},
+		{METRIC_ERROR_RATE, func(b *bucketStats) float64 {
+			if b.requests == 0 {
+				return 0
+			}
+			return float64(b.errors) / float64(b.requests)
+		}},
+		{METRIC_BYTES, func(b *bucketStats) float64 { return float64(b.bytes) }},
+	}
+
+	for _, m := range metrics {
+		values := make([]float64, len(series))
+		for i, bucket := range series {
+			values[i] = m.value(bucket)
+		}
+
+		for i, score := range robustScores(series, values, seasonal) {
+			if math.Abs(score.z) < threshold {
+				continue
+			}
+
+			kind := ANOMALY_SPIKE
+			if score.z < 0 {
+				kind = ANOMALY_DROP
+			}
+
+			// the log usually starts and ends in the middle of a bucket
+			if kind == ANOMALY_DROP && (i == 0 || i == len(series)-1) {
+				continue
+			}
+
+			bucket := series[i]
+			anomaly := Anomaly{
+				Start:    bucket.start,
+				Metric:   m.metric,
+				Kind:     kind,
+				Value:    values[i],
+				Expected: score.median,
+				Score:    score.z,
+				Ips:      *getHitsInfo(bucket.ips, topN, true),
+				Uris:     *getHitsInfo(bucket.uris, topN, true),
+				Codes:    *getHitsInfo(bucket.codes, topN, true),
+			}
+
+			if m.metric == METRIC_ERROR_RATE {
+				anomaly.Ips = *getHitsInfo(bucket.errorIps, topN, true)
+				anomaly.Uris = *getHitsInfo(bucket.errorUris, topN, true)
+			}
+
+			report.Anomalies = append(report.Anomalies, anomaly)
+		}
+	}
+
+	slices.SortStableFunc(report.Anomalies, func(a, b Anomaly) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	return report
+}
+
+// Buckets sorted by time with empty buckets inserted into gaps,
+// a bucket without requests is the strongest drop
+func fillBuckets(buckets map[int64]*bucketStats, groupBy string) []*bucketStats {
+	keys := make([]int64, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	series := make([]*bucketStats, 0, len(keys))
+	for i, key := range keys {
+		bucket := buckets[key]
+
+		if i > 0 {
+			for next := nextBucket(series[len(series)-1].start, groupBy); next.Unix() < key; next = nextBucket(next, groupBy) {
+				series = append(series, newBucketStats(next))
+			}
+		}
+
+		series = append(series, bucket)
+	}
+
+	return series
+}
+
+func nextBucket(start time.Time, groupBy string) time.Time {
+	switch groupBy {
+	case "hour":
+		return start.Add(time.Hour)
+	case "day":
+		return start.AddDate(0, 0, 1)
+	}
+
+	return start.Add(time.Second)
+}
+
+func hasSeasonalSamples(series []*bucketStats) bool {
+	var samples [24]int
+	for _, bucket := range series {
+		samples[bucket.start.Hour()]++
+	}
+
+	for _, n := range samples {
+		if n < MIN_SEASONAL_SAMPLES {
+			return false
+		}
+	}
+
+	return true
+}
+
+type robustScore struct {
+	median float64
+	z      float64
+}
+
+// Modified z-scores against the median and MAD of the whole series
+// or of the same hour of day when seasonal
+func robustScores(series []*bucketStats, values []float64, seasonal bool) []robustScore {
+	groups := make(map[int][]float64)
+	groupOf := func(i int) int {
+		if seasonal {
+			return series[i].start.Hour()
+		}
+		return 0
+	}
+
+	for i, value := range values {
+		groups[groupOf(i)] = append(groups[groupOf(i)], value)
+	}
+
+	type baseline struct{ median, scale float64 }
+	baselines := make(map[int]baseline, len(groups))
+	for group, groupValues := range groups {
+		median, scale := medianScale(groupValues)
+		baselines[group] = baseline{median, scale}
+	}
+
+	scores := make([]robustScore, len(values))
+	for i, value := range values {
+		b := baselines[groupOf(i)]
+		scores[i].median = b.median
+
+		if b.scale > 0 {
+			scores[i].z = (value - b.median) / b.scale
+		}
+	}
+
+	return scores
+}
+
+// Median and a robust estimate of the standard deviation. MAD is zero when
+// most values are equal, the mean absolute deviation is used then.
+func medianScale(values []float64) (float64, float64) {
+	median := medianOf(values)
+
+	deviations := make([]float64, len(values))
+	sum := 0.0
+	for i, value := range values {
+		deviations[i] = math.Abs(value - median)
+		sum += deviations[i]
+	}
+
+	if mad := medianOf(deviations); mad > 0 {
+		return median, 1.4826 * mad
+	}
+
+	return median, 1.2533 * sum / float64(len(values))
+}
+
+func medianOf(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
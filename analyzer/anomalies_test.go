@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBuckets(start time.Time, step time.Duration, requests []uint64) map[int64]*bucketStats {
+	buckets := make(map[int64]*bucketStats)
+
+	for i, n := range requests {
+		if n == 0 {
+			continue
+		}
+
+		bucketStart := start.Add(time.Duration(i) * step)
+		bucket := newBucketStats(bucketStart)
+		bucket.requests = n
+		bucket.bytes = n * 100
+		buckets[bucketStart.Unix()] = bucket
+	}
+
+	return buckets
+}
+
+func TestMedianScale(t *testing.T) {
+	t.Run("should use MAD", func(t *testing.T) {
+		median, scale := medianScale([]float64{1, 2, 3, 4, 100})
+
+		assert.Equal(t, 3.0, median)
+		assert.InDelta(t, 1.4826, scale, 1e-9)
+	})
+
+	t.Run("should fall back to the mean absolute deviation", func(t *testing.T) {
+		median, scale := medianScale([]float64{10, 10, 10, 10, 20})
+
+		assert.Equal(t, 10.0, median)
+		assert.InDelta(t, 1.2533*2, scale, 1e-9)
+	})
+}
+
+func TestFillBuckets(t *testing.T) {
+	t.Run("should insert empty buckets into gaps", func(t *testing.T) {
+		start := time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC)
+		series := fillBuckets(testBuckets(start, time.Hour, []uint64{5, 0, 0, 7}), "hour")
+
+		require.Len(t, series, 4)
+		assert.Equal(t, uint64(0), series[1].requests)
+		assert.Equal(t, start.Add(2*time.Hour), series[2].start)
+		assert.Equal(t, uint64(7), series[3].requests)
+	})
+}
+
+func TestAnomalyReport(t *testing.T) {
+	start := time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC)
+
+	t.Run("should find spikes and drops", func(t *testing.T) {
+		buckets := testBuckets(start, time.Hour, []uint64{100, 104, 98, 101, 1000, 99, 102, 0, 97, 103})
+		buckets[start.Add(4*time.Hour).Unix()].ips[netip.MustParseAddr("203.0.113.7")] = 900
+
+		report := anomalyReport(buckets, "hour", 5, AnomalyOptions{})
+
+		assert.Equal(t, "global", report.Baseline)
+		assert.Equal(t, 10, report.Buckets)
+
+		kinds := []string{}
+		for _, anomaly := range report.Anomalies {
+			kinds = append(kinds, fmt.Sprintf("%s %s %s", anomaly.Start.Format("15"), anomaly.Metric, anomaly.Kind))
+		}
+		assert.Equal(t, []string{"04 requests spike", "04 bytes spike", "07 requests drop", "07 bytes drop"}, kinds)
+
+		spike := report.Anomalies[0]
+		assert.Equal(t, 1000.0, spike.Value)
+		assert.Equal(t, 100.5, spike.Expected)
+		assert.Equal(t, []HitsInfo[netip.Addr]{{Key: netip.MustParseAddr("203.0.113.7"), Hits: 900}}, spike.Ips)
+	})
+
+	t.Run("should skip short series", func(t *testing.T) {
+		report := anomalyReport(testBuckets(start, time.Hour, []uint64{1, 100, 1}), "hour", 5, AnomalyOptions{})
+
+		assert.Empty(t, report.Anomalies)
+	})
+
+	t.Run("should compare with the same hour of day", func(t *testing.T) {
+		// busy days and quiet nights during 5 days, the night traffic spikes once
+		requests := make([]uint64, 0, 120)
+		for day := range 5 {
+			for hour := range 24 {
+				n := uint64(1000 + (hour+day)%3)
+				if hour < 6 {
+					n = uint64(10 + (hour+day)%3)
+				}
+				if day == 2 && hour == 3 {
+					n = 500
+				}
+				requests = append(requests, n)
+			}
+		}
+
+		report := anomalyReport(testBuckets(start, time.Hour, requests), "hour", 5, AnomalyOptions{})
+
+		assert.Equal(t, "hourOfDay", report.Baseline)
+		require.NotEmpty(t, report.Anomalies)
+		assert.Equal(t, start.AddDate(0, 0, 2).Add(3*time.Hour), report.Anomalies[0].Start)
+		assert.Equal(t, ANOMALY_SPIKE, report.Anomalies[0].Kind)
+	})
+}
+
+func TestAnalyzeAnomalies(t *testing.T) {
+	var sb strings.Builder
+	for hour := range 12 {
+		requests := 5
+		status := 200
+		if hour == 6 {
+			status = 500
+		}
+
+		for i := range requests {
+			fmt.Fprintf(&sb, "192.168.1.%d - - [25/Dec/2023:%02d:%02d:00 +0000] \"GET /page/%d HTTP/1.1\" %d 100 \"-\" \"Mozilla/5.0\"\n", i, hour, i, i, status)
+		}
+	}
+
+	tmpFile, err := os.CreateTemp("", "anomalies_log_*.log")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(sb.String())
+	require.NoError(t, err)
+
+	result, err := Analyze(tmpFile.Name(), Options{TopN: 3, Desc: true, DatesBy: "hour", Anomalies: &AnomalyOptions{}})
+	require.NoError(t, err)
+
+	require.NotNil(t, result.Anomalies)
+	require.Len(t, result.Anomalies.Anomalies, 1)
+
+	anomaly := result.Anomalies.Anomalies[0]
+	assert.Equal(t, METRIC_ERROR_RATE, anomaly.Metric)
+	assert.Equal(t, 6, anomaly.Start.Hour())
+	assert.Equal(t, 1.0, anomaly.Value)
+	assert.Equal(t, []HitsInfo[uint16]{{Key: 500, Hits: 5}}, anomaly.Codes)
+	assert.Len(t, anomaly.Ips, 3)
+}
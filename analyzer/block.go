@@ -0,0 +1,118 @@
+package analyzer
+
+import (
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// Thresholds marking a client for blocking, zero disables a threshold.
+// A client reaching any of them is blocked.
+type BlockRules struct {
+	// Peak requests per minute
+	MaxRequestsPerMinute uint64 `json:"maxRequestsPerMinute"`
+
+	// Peak 4xx responses per minute
+	MaxErrorsPerMinute uint64 `json:"maxErrorsPerMinute"`
+
+	// Min requests matching security rules, requires a security scanner
+	MinSecurityHits uint64 `json:"minSecurityHits"`
+}
+
+type BlockedClient struct {
+	Ip      netip.Addr `json:"ip"`
+	Reasons []string   `json:"reasons"`
+
+	PeakRequestsPerMinute uint64 `json:"peakRequestsPerMinute"`
+	PeakErrorsPerMinute   uint64 `json:"peakErrorsPerMinute"`
+	SecurityHits          uint64 `json:"securityHits"`
+}
+
+// Requests of a client during a single minute
+type clientMinute struct {
+	ip     netip.Addr
+	minute int64
+}
+
+type minuteCounts struct {
+	requests uint64
+	errors   uint64
+}
+
+func (agg *aggregator) addMinute(entry *parser.LogEntry) {
+	key := clientMinute{ip: entry.Ip, minute: entry.Date.Unix() / 60}
+
+	counts := agg.minutes[key]
+	counts.requests++
+	if entry.StatusCode >= 400 && entry.StatusCode < 500 {
+		counts.errors++
+	}
+	agg.minutes[key] = counts
+}
+
+func mergeMinutes(dst, src map[clientMinute]minuteCounts) {
+	for key, counts := range src {
+		own := dst[key]
+		own.requests += counts.requests
+		own.errors += counts.errors
+		dst[key] = own
+	}
+}
+
+// Every client exceeding the rules, sorted by ip
+func blockedClients(minutes map[clientMinute]minuteCounts, threats *threatStats, rules BlockRules) []BlockedClient {
+	peaks := make(map[netip.Addr]*BlockedClient)
+
+	peak := func(ip netip.Addr) *BlockedClient {
+		client, ok := peaks[ip]
+		if !ok {
+			client = &BlockedClient{Ip: ip}
+			peaks[ip] = client
+		}
+
+		return client
+	}
+
+	for key, counts := range minutes {
+		client := peak(key.ip)
+		client.PeakRequestsPerMinute = max(client.PeakRequestsPerMinute, counts.requests)
+		client.PeakErrorsPerMinute = max(client.PeakErrorsPerMinute, counts.errors)
+	}
+
+	for ip, offender := range threats.offenders {
+		peak(ip).SecurityHits = offender.hits
+	}
+
+	blocked := make([]BlockedClient, 0)
+	for _, client := range peaks {
+		if rules.MaxRequestsPerMinute > 0 && client.PeakRequestsPerMinute > rules.MaxRequestsPerMinute {
+			client.Reasons = append(client.Reasons, "requests per minute "+strconv.FormatUint(client.PeakRequestsPerMinute, 10))
+		}
+
+		if rules.MaxErrorsPerMinute > 0 && client.PeakErrorsPerMinute > rules.MaxErrorsPerMinute {
+			client.Reasons = append(client.Reasons, "4xx per minute "+strconv.FormatUint(client.PeakErrorsPerMinute, 10))
+		}
+
+		if rules.MinSecurityHits > 0 && client.SecurityHits >= rules.MinSecurityHits {
+			client.Reasons = append(client.Reasons, "security hits "+strconv.FormatUint(client.SecurityHits, 10))
+		}
+
+		if len(client.Reasons) > 0 {
+			blocked = append(blocked, *client)
+		}
+	}
+
+	slices.SortFunc(blocked, func(a, b BlockedClient) int {
+		return a.Ip.Compare(b.Ip)
+	})
+
+	return blocked
+}
+
+// Joined reasons of a blocked client, like "4xx per minute 120, security hits 3"
+func (client BlockedClient) Reason() string {
+	return strings.Join(client.Reasons, ", ")
+}
@@ -0,0 +1,163 @@
+package analyzer
+
+import (
+	"maps"
+	"net/netip"
+	"slices"
+
+	"github.com/Kostayne/go-nginx-analyzer/crawlers"
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+type BotReport struct {
+	Name  string             `json:"name"`
+	Hits  uint64             `json:"hits"`
+	Bytes uint64             `json:"bytes"`
+	Codes []HitsInfo[uint16] `json:"codes"`
+	Paths []HitsInfo[string] `json:"paths"`
+
+	// Set when published ip ranges of the bot are provided
+	Verification *BotVerification `json:"verification,omitempty"`
+}
+
+type BotVerification struct {
+	VerifiedHits     uint64 `json:"verifiedHits"`
+	ImpersonatorHits uint64 `json:"impersonatorHits"`
+
+	// Ips claiming to be the bot from outside of its ranges
+	Impersonators []HitsInfo[netip.Addr] `json:"impersonators"`
+}
+
+type botStats struct {
+	hits          uint64
+	bytes         uint64
+	codes         map[uint16]uint64
+	paths         map[string]uint64
+	verified      uint64
+	impersonators map[netip.Addr]uint64
+}
+
+// Counters behind a bot report in the result state
+type BotState struct {
+	Hits          uint64                `json:"hits"`
+	Bytes         uint64                `json:"bytes"`
+	Codes         map[uint16]uint64     `json:"codes"`
+	Paths         map[string]uint64     `json:"paths"`
+	Verified      uint64                `json:"verified"`
+	Impersonators map[netip.Addr]uint64 `json:"impersonators,omitempty"`
+}
+
+func newBotStats() *botStats {
+	return &botStats{
+		codes:         make(map[uint16]uint64),
+		paths:         make(map[string]uint64),
+		impersonators: make(map[netip.Addr]uint64),
+	}
+}
+
+func (agg *aggregator) addBot(bot string, entry *parser.LogEntry, params ProcessParams) {
+	stats, ok := agg.bots[bot]
+	if !ok {
+		stats = newBotStats()
+		agg.bots[bot] = stats
+	}
+
+	stats.hits++
+	stats.bytes += uint64(entry.RespBytes)
+	stats.codes[entry.StatusCode]++
+	stats.paths[entry.Uri]++
+
+	if params.Crawlers == nil {
+		return
+	}
+
+	switch params.Crawlers.Verify(bot, entry.Ip) {
+	case crawlers.VERIFIED:
+		stats.verified++
+	case crawlers.IMPERSONATOR:
+		stats.impersonators[entry.Ip]++
+	}
+}
+
+func (stats *botStats) merge(other *botStats) {
+	stats.hits += other.hits
+	stats.bytes += other.bytes
+	stats.verified += other.verified
+	mergeCounts(stats.codes, other.codes)
+	mergeCounts(stats.paths, other.paths)
+	mergeCounts(stats.impersonators, other.impersonators)
+}
+
+// Nil when no bot was counted
+func botsState(bots map[string]*botStats) map[string]*BotState {
+	if len(bots) == 0 {
+		return nil
+	}
+
+	state := make(map[string]*BotState, len(bots))
+	for name, stats := range bots {
+		state[name] = &BotState{
+			Hits:          stats.hits,
+			Bytes:         stats.bytes,
+			Codes:         maps.Clone(stats.codes),
+			Paths:         maps.Clone(stats.paths),
+			Verified:      stats.verified,
+			Impersonators: maps.Clone(stats.impersonators),
+		}
+	}
+
+	return state
+}
+
+func (agg *aggregator) addBotsState(state map[string]*BotState) {
+	for name, bot := range state {
+		stats, ok := agg.bots[name]
+		if !ok {
+			stats = newBotStats()
+			agg.bots[name] = stats
+		}
+
+		stats.hits += bot.Hits
+		stats.bytes += bot.Bytes
+		stats.verified += bot.Verified
+		mergeCounts(stats.codes, bot.Codes)
+		mergeCounts(stats.paths, bot.Paths)
+		mergeCounts(stats.impersonators, bot.Impersonators)
+	}
+}
+
+// Bot reports sorted by hits, limited to top N bots
+func botReports(bots map[string]*botStats, params MergeParams) []BotReport {
+	reports := make([]BotReport, 0, len(bots))
+
+	for name, stats := range bots {
+		report := BotReport{
+			Name:  name,
+			Hits:  stats.hits,
+			Bytes: stats.bytes,
+			Codes: *getHitsInfo(stats.codes, params.TopN, true),
+			Paths: *getHitsInfo(stats.paths, params.TopN, true),
+		}
+
+		if params.Crawlers != nil && params.Crawlers.Has(name) {
+			impersonatorHits := uint64(0)
+			for _, hits := range stats.impersonators {
+				impersonatorHits += hits
+			}
+
+			report.Verification = &BotVerification{
+				VerifiedHits:     stats.verified,
+				ImpersonatorHits: impersonatorHits,
+				Impersonators:    *getHitsInfo(stats.impersonators, params.TopN, true),
+			}
+		}
+
+		reports = append(reports, report)
+	}
+
+	slices.SortFunc(reports, func(a, b BotReport) int {
+		return getSortCompareResultAsc(b.Hits, a.Hits)
+	})
+
+	return reports[:min(len(reports), params.TopN)]
+}
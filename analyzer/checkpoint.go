@@ -0,0 +1,272 @@
+package analyzer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// Version of the checkpoint schema, other versions start fresh
+const CHECKPOINT_VERSION = 1
+
+// Max bytes of the first line hashed into the file identity
+const IDENTITY_BYTES = 4096
+
+// Bytes read at once while looking for the last line break
+const TAIL_BLOCK = 64 * 1024
+
+// Tells a log appended to from a rotated or replaced one
+type FileIdentity struct {
+	// Zero where inodes aren't available
+	Inode uint64 `json:"inode"`
+
+	// sha256 of the first line, empty before a line is analyzed
+	FirstLine string `json:"firstLine"`
+}
+
+// State of an incremental analysis, the next run analyzes bytes after Offset
+// and merges them into Result
+type Checkpoint struct {
+	Version int          `json:"version"`
+	File    FileIdentity `json:"file"`
+
+	// Bytes analyzed so far, they end with a line break
+	Offset int64 `json:"offset"`
+
+	// Options the counters were taken with, resuming requires the same ones
+	Options []string `json:"options"`
+
+	// Result with the mergeable state of the analyzed bytes
+	Result *AnalyzeResult `json:"result"`
+}
+
+// Loads a checkpoint, nil when the file doesn't exist yet
+func LoadCheckpoint(fpath string) (*Checkpoint, error) {
+	data, err := os.ReadFile(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", fpath, err)
+	}
+
+	return &checkpoint, nil
+}
+
+// Why the analysis of the log can't resume from the checkpoint, nil when it can
+func (c *Checkpoint) Check(fpath string, options []string) error {
+	if c.Version != CHECKPOINT_VERSION {
+		return fmt.Errorf("checkpoint version %d is not supported, expected %d", c.Version, CHECKPOINT_VERSION)
+	}
+
+	if c.Result == nil {
+		return fmt.Errorf("checkpoint has no result")
+	}
+
+	if err := validateState(c.Result); err != nil {
+		return fmt.Errorf("checkpoint result: %w", err)
+	}
+
+	if !slices.Equal(c.Options, options) {
+		return fmt.Errorf("options changed")
+	}
+
+	return c.checkFile(fpath)
+}
+
+// Why the log isn't the one the checkpoint was taken from, nil when it is
+func (c *Checkpoint) checkFile(fpath string) error {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if inode := fileInode(info); inode != 0 && c.File.Inode != 0 && inode != c.File.Inode {
+		return fmt.Errorf("log was rotated")
+	}
+
+	if info.Size() < c.Offset {
+		return fmt.Errorf("log was truncated")
+	}
+
+	firstLine, err := firstLineHash(file, c.Offset)
+	if err != nil {
+		return err
+	}
+
+	if firstLine != c.File.FirstLine {
+		return fmt.Errorf("log was replaced")
+	}
+
+	return nil
+}
+
+// Analyzes the log bytes appended since the checkpoint and merges them into its
+// result, a nil checkpoint analyzes the whole log. The checkpoint must pass Check.
+// A last line without a line break may still be written, it's left for the next run.
+// Reports which need per request data (security, rates, funnel, ...) can't be merged,
+// options asking for them are rejected.
+func AnalyzeIncremental(fpath string, opts Options, prev *Checkpoint, options []string) (*AnalyzeResult, *Checkpoint, error) {
+	if report := unmergeableReport(opts); report != "" {
+		return nil, nil, fmt.Errorf("incremental analysis can't keep %s reports, they need every request at once", report)
+	}
+
+	start := int64(0)
+	if prev != nil {
+		start = prev.Offset
+	}
+
+	appended, checkpoint, err := analyzeAppended(fpath, start, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := []*AnalyzeResult{appended}
+	if prev != nil {
+		results = []*AnalyzeResult{prev.Result, appended}
+	}
+
+	// fresh results go through the merge too, so every run reports the same sections
+	res, err := MergeSaved(results, incrementalParams(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checkpoint.Options = options
+	checkpoint.Result = res
+
+	return res, checkpoint, nil
+}
+
+// Analyzes complete lines after the start offset with their state. The returned
+// checkpoint has no result yet, it records the file and where the lines end.
+func analyzeAppended(fpath string, start int64, opts Options) (*AnalyzeResult, *Checkpoint, error) {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fileSize := info.Size()
+	end, err := lastLineEnd(file, start, fileSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the state is merged with results of other bytes
+	opts.State = true
+
+	appended, err := analyzeRange(fpath, start, end, fileSize, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	firstLine, err := firstLineHash(file, end)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checkpoint := &Checkpoint{
+		Version: CHECKPOINT_VERSION,
+		File:    FileIdentity{Inode: fileInode(info), FirstLine: firstLine},
+		Offset:  end,
+	}
+
+	return appended, checkpoint, nil
+}
+
+// Merge params keeping the state of results analyzed with the options
+func incrementalParams(opts Options) MergeParams {
+	return MergeParams{
+		TopN:       opts.TopN,
+		Desc:       opts.Desc,
+		State:      true,
+		GroupIp:    opts.GroupIp,
+		Geo:        opts.Geo,
+		UserAgents: opts.UserAgents,
+		Crawlers:   opts.Crawlers,
+	}
+}
+
+// Hash of the first line if it's within the analyzed bytes
+func firstLineHash(file *os.File, analyzed int64) (string, error) {
+	buf := make([]byte, min(analyzed, IDENTITY_BYTES))
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return "", err
+	}
+
+	if len(buf) == 0 {
+		return "", nil
+	}
+
+	if i := bytes.IndexByte(buf, '\n'); i != -1 {
+		buf = buf[:i]
+	}
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Offset after the last line break in [start, size), start when there's none
+func lastLineEnd(file *os.File, start, size int64) (int64, error) {
+	buf := make([]byte, TAIL_BLOCK)
+
+	for end := size; end > start; {
+		blockStart := max(end-TAIL_BLOCK, start)
+		block := buf[:end-blockStart]
+
+		if _, err := file.ReadAt(block, blockStart); err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if i := bytes.LastIndexByte(block, '\n'); i != -1 {
+			return blockStart + int64(i) + 1, nil
+		}
+
+		end = blockStart
+	}
+
+	return start, nil
+}
+
+// Report of the options which the merge of results would drop, empty when there's none
+func unmergeableReport(opts Options) string {
+	switch {
+	case opts.Security != nil:
+		return "security"
+	case opts.Block != nil:
+		return "block"
+	case opts.Rates != nil:
+		return "rate"
+	case opts.Anomalies != nil:
+		return "anomaly"
+	case opts.Sessions != nil:
+		return "session"
+	case opts.Funnel != nil:
+		return "funnel"
+	}
+
+	return ""
+}
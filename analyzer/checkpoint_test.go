@@ -0,0 +1,124 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Kostayne/go-nginx-analyzer/security"
+	"github.com/Kostayne/go-nginx-analyzer/useragent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeIncremental(t *testing.T) {
+	first := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET /about HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+66.249.64.10 - - [25/Dec/2023:10:31:45 +0000] "GET /robots.txt HTTP/1.1" 200 100 "-" "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+`
+	appended := `10.0.0.2 - - [25/Dec/2023:11:30:45 +0000] "GET /about HTTP/1.1" 500 100 "-" "Mozilla/5.0"
+66.249.64.10 - - [25/Dec/2023:11:31:45 +0000] "GET /products HTTP/1.1" 200 100 "-" "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+`
+	partial := `10.0.0.3 - - [25/Dec/2023:11:32:45 +0000] "GET /about HTTP/1.1" 200 100`
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	opts := Options{TopN: 10, Desc: true, DatesBy: "hour", UserAgents: useragent.Default()}
+	options := []string{"dates-by=hour"}
+
+	// round trips the checkpoint through JSON, like --state does
+	saved := func(checkpoint *Checkpoint) *Checkpoint {
+		statePath := filepath.Join(dir, "state.json")
+		data, err := json.Marshal(checkpoint)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(statePath, data, 0644))
+
+		loaded, err := LoadCheckpoint(statePath)
+		require.NoError(t, err)
+		return loaded
+	}
+
+	require.NoError(t, os.WriteFile(logPath, []byte(first+partial), 0644))
+	res, checkpoint, err := AnalyzeIncremental(logPath, opts, nil, options)
+	require.NoError(t, err)
+	checkpoint = saved(checkpoint)
+
+	t.Run("should leave a line without a line break for the next run", func(t *testing.T) {
+		assert.Equal(t, uint64(2), res.TotalRequests)
+		assert.Equal(t, int64(len(first)), checkpoint.Offset)
+		assert.Equal(t, int64(len(first)), res.ProcessingStats.FileSize)
+		assert.Equal(t, options, checkpoint.Options)
+		assert.NotEmpty(t, checkpoint.File.FirstLine)
+	})
+
+	t.Run("should analyze only appended bytes and merge them", func(t *testing.T) {
+		file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_TRUNC, 0644)
+		require.NoError(t, err)
+		_, err = file.WriteString(first + appended)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		require.NoError(t, checkpoint.Check(logPath, options))
+		res, next, err := AnalyzeIncremental(logPath, opts, checkpoint, options)
+		require.NoError(t, err)
+
+		full, err := Analyze(logPath, opts)
+		require.NoError(t, err)
+
+		assert.Equal(t, full.TotalRequests, res.TotalRequests)
+		assert.ElementsMatch(t, full.Ips, res.Ips)
+		assert.Equal(t, full.StatusCodes, res.StatusCodes)
+		assert.True(t, full.TimeRange.Start.Equal(res.TimeRange.Start))
+		assert.True(t, full.TimeRange.End.Equal(res.TimeRange.End))
+		require.Len(t, res.BotReports, 1)
+		assert.Equal(t, full.BotReports[0].Hits, res.BotReports[0].Hits)
+		assert.ElementsMatch(t, full.BotReports[0].Paths, res.BotReports[0].Paths)
+		assert.Equal(t, int64(len(first+appended)), next.Offset)
+		assert.Equal(t, checkpoint.File, next.File)
+	})
+
+	t.Run("should not resume when the options changed", func(t *testing.T) {
+		assert.ErrorContains(t, checkpoint.Check(logPath, []string{"dates-by=day"}), "options changed")
+	})
+
+	t.Run("should not resume a truncated log", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(logPath, []byte(first[:10]), 0644))
+		assert.ErrorContains(t, checkpoint.Check(logPath, options), "truncated")
+	})
+
+	t.Run("should not resume a replaced log", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(logPath, []byte(appended+first), 0644))
+		assert.Error(t, checkpoint.Check(logPath, options))
+	})
+
+	t.Run("should not resume a rotated log", func(t *testing.T) {
+		rotated := filepath.Join(dir, "access.log.new")
+		require.NoError(t, os.WriteFile(rotated, []byte(first+appended), 0644))
+		require.NoError(t, os.Rename(rotated, logPath))
+
+		assert.Error(t, checkpoint.Check(logPath, options))
+	})
+
+	t.Run("should reject reports which can't be merged", func(t *testing.T) {
+		for report, apply := range map[string]func(opts *Options){
+			"security": func(opts *Options) { opts.Security = security.Default() },
+			"block":    func(opts *Options) { opts.Block = &BlockRules{} },
+			"rate":     func(opts *Options) { opts.Rates = &RateOptions{} },
+			"anomaly":  func(opts *Options) { opts.Anomalies = &AnomalyOptions{} },
+			"session":  func(opts *Options) { opts.Sessions = &SessionOptions{} },
+			"funnel":   func(opts *Options) { opts.Funnel = &FunnelOptions{Steps: []string{"/about"}} },
+		} {
+			unmergeable := opts
+			apply(&unmergeable)
+
+			_, _, err := AnalyzeIncremental(logPath, unmergeable, nil, options)
+			assert.ErrorContains(t, err, "can't keep "+report+" reports")
+		}
+	})
+
+	t.Run("should load a missing checkpoint as nil", func(t *testing.T) {
+		checkpoint, err := LoadCheckpoint(filepath.Join(dir, "missing.json"))
+		require.NoError(t, err)
+		assert.Nil(t, checkpoint)
+	})
+}
@@ -0,0 +1,226 @@
+package analyzer
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+)
+
+// Status classes compared by share of all requests
+var STATUS_CLASSES = []string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+type DiffResult struct {
+	Totals        []MetricDelta        `json:"totals"`
+	StatusClasses []ShareDelta         `json:"statusClasses"`
+	Uris          RankDiff[string]     `json:"uris"`
+	Ips           RankDiff[netip.Addr] `json:"ips"`
+}
+
+type MetricDelta struct {
+	Name   string  `json:"name"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+	Delta  float64 `json:"delta"`
+
+	// Relative change in percents, zero when before is zero
+	Percent float64 `json:"percent"`
+}
+
+// Shares are in percents of all requests
+type ShareDelta struct {
+	Class  string  `json:"class"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+	Delta  float64 `json:"delta"`
+}
+
+// Top lists comparison, ranks start at 1
+type RankDiff[T comparable] struct {
+	Appeared    []RankChange[T] `json:"appeared"`
+	Disappeared []RankChange[T] `json:"disappeared"`
+	Changed     []RankChange[T] `json:"changed"`
+}
+
+type RankChange[T comparable] struct {
+	Key        T      `json:"key"`
+	BeforeRank int    `json:"beforeRank,omitempty"`
+	AfterRank  int    `json:"afterRank,omitempty"`
+	BeforeHits uint64 `json:"beforeHits"`
+	AfterHits  uint64 `json:"afterHits"`
+}
+
+// Loads a result saved as JSON, results without a schema version or of newer ones are rejected
+func LoadResult(fpath string) (*AnalyzeResult, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var res AnalyzeResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("invalid result %s: %w", fpath, err)
+	}
+
+	if res.Version == 0 {
+		return nil, fmt.Errorf("result %s has no schema version, it's not saved with -o or by an older build, analyze the log again", fpath)
+	}
+
+	if res.Version > RESULT_VERSION {
+		return nil, fmt.Errorf("result %s has schema version %d, this build supports up to %d", fpath, res.Version, RESULT_VERSION)
+	}
+
+	return &res, nil
+}
+
+// Compares the after result with the before one. Top lists are cut to top N,
+// so results saved with a bigger top N compare with fresh ones. Ranks are by
+// hits, most first. Results with the fewest hits (--asc) are rejected, their
+// top lists miss the most hit uris and ips.
+func Diff(before, after *AnalyzeResult, topN int) (DiffResult, error) {
+	if before.Asc || after.Asc {
+		return DiffResult{}, fmt.Errorf("results listing the fewest hits (--asc) can't be compared, their top lists miss the most hit uris and ips")
+	}
+
+	topN = max(topN, 0)
+
+	diff := DiffResult{
+		Totals: []MetricDelta{
+			metricDelta("requests", float64(before.TotalRequests), float64(after.TotalRequests)),
+			metricDelta("uniqueIps", float64(before.UniqueIPs), float64(after.UniqueIPs)),
+			metricDelta("uniqueUserAgents", float64(before.UniqueUserAgents), float64(after.UniqueUserAgents)),
+			metricDelta("bytes", float64(before.TotalBytes), float64(after.TotalBytes)),
+			metricDelta("avgBytes", avgBytes(before), avgBytes(after)),
+		},
+		Uris: rankDiff(ranked(before.Uris, topN), ranked(after.Uris, topN)),
+		Ips:  rankDiff(ranked(before.Ips, topN), ranked(after.Ips, topN)),
+	}
+
+	if before.Latency != nil && after.Latency != nil {
+		diff.Totals = append(diff.Totals,
+			metricDelta("latencyAvgMs", millis(before.Latency.Avg), millis(after.Latency.Avg)),
+			metricDelta("latencyP50Ms", millis(before.Latency.P50), millis(after.Latency.P50)),
+			metricDelta("latencyP95Ms", millis(before.Latency.P95), millis(after.Latency.P95)),
+			metricDelta("latencyP99Ms", millis(before.Latency.P99), millis(after.Latency.P99)),
+		)
+	}
+
+	beforeShares := statusClassShares(before)
+	afterShares := statusClassShares(after)
+	for i, class := range STATUS_CLASSES {
+		diff.StatusClasses = append(diff.StatusClasses, ShareDelta{
+			Class:  class,
+			Before: beforeShares[i],
+			After:  afterShares[i],
+			Delta:  afterShares[i] - beforeShares[i],
+		})
+	}
+
+	return diff, nil
+}
+
+func metricDelta(name string, before, after float64) MetricDelta {
+	delta := MetricDelta{Name: name, Before: before, After: after, Delta: after - before}
+	if before != 0 {
+		delta.Percent = (after - before) / before * 100
+	}
+
+	return delta
+}
+
+func avgBytes(res *AnalyzeResult) float64 {
+	if res.TotalRequests == 0 {
+		return 0
+	}
+
+	return float64(res.TotalBytes) / float64(res.TotalRequests)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Shares of STATUS_CLASSES in percents
+func statusClassShares(res *AnalyzeResult) []float64 {
+	shares := make([]float64, len(STATUS_CLASSES))
+	if res.TotalRequests == 0 {
+		return shares
+	}
+
+	for _, code := range res.StatusCodes {
+		if class := statusClass(code.Key); class != -1 {
+			shares[class] += float64(code.Hits) / float64(res.TotalRequests) * 100
+		}
+	}
+
+	return shares
+}
+
+// Top N of the list by hits, most first
+func ranked[T comparable](list []HitsInfo[T], topN int) []HitsInfo[T] {
+	sorted := slices.Clone(list)
+	slices.SortStableFunc(sorted, func(a, b HitsInfo[T]) int {
+		return cmp.Compare(b.Hits, a.Hits)
+	})
+
+	return sorted[:min(topN, len(sorted))]
+}
+
+// Lists must be ranked, the index is the rank
+func rankDiff[T comparable](before, after []HitsInfo[T]) RankDiff[T] {
+	diff := RankDiff[T]{
+		Appeared:    make([]RankChange[T], 0),
+		Disappeared: make([]RankChange[T], 0),
+		Changed:     make([]RankChange[T], 0),
+	}
+
+	beforeRanks := make(map[T]int, len(before))
+	for i, info := range before {
+		beforeRanks[info.Key] = i
+	}
+
+	afterKeys := make(map[T]struct{}, len(after))
+	for i, info := range after {
+		afterKeys[info.Key] = struct{}{}
+
+		j, ok := beforeRanks[info.Key]
+		if !ok {
+			diff.Appeared = append(diff.Appeared, RankChange[T]{Key: info.Key, AfterRank: i + 1, AfterHits: info.Hits})
+			continue
+		}
+
+		if i != j {
+			diff.Changed = append(diff.Changed, RankChange[T]{
+				Key:        info.Key,
+				BeforeRank: j + 1,
+				AfterRank:  i + 1,
+				BeforeHits: before[j].Hits,
+				AfterHits:  info.Hits,
+			})
+		}
+	}
+
+	for i, info := range before {
+		if _, ok := afterKeys[info.Key]; !ok {
+			diff.Disappeared = append(diff.Disappeared, RankChange[T]{Key: info.Key, BeforeRank: i + 1, BeforeHits: info.Hits})
+		}
+	}
+
+	// biggest moves first
+	slices.SortStableFunc(diff.Changed, func(a, b RankChange[T]) int {
+		return cmp.Compare(abs(b.AfterRank-b.BeforeRank), abs(a.AfterRank-a.BeforeRank))
+	})
+
+	return diff
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
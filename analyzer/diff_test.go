@@ -0,0 +1,186 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	before := &AnalyzeResult{
+		TotalRequests: 100,
+		TotalBytes:    10000,
+		UniqueIPs:     10,
+		StatusCodes:   []HitsInfo[uint16]{{Key: 200, Hits: 90}, {Key: 404, Hits: 5}, {Key: 500, Hits: 5}},
+		Uris:          []HitsInfo[string]{{Key: "/", Hits: 50}, {Key: "/about", Hits: 30}, {Key: "/old", Hits: 20}},
+		Latency:       &LatencyStats{Avg: 100 * time.Millisecond, P95: 200 * time.Millisecond},
+	}
+
+	after := &AnalyzeResult{
+		TotalRequests: 200,
+		TotalBytes:    30000,
+		UniqueIPs:     10,
+		StatusCodes:   []HitsInfo[uint16]{{Key: 200, Hits: 160}, {Key: 500, Hits: 40}},
+		Uris:          []HitsInfo[string]{{Key: "/about", Hits: 90}, {Key: "/", Hits: 60}, {Key: "/new", Hits: 50}},
+		Latency:       &LatencyStats{Avg: 150 * time.Millisecond, P95: 500 * time.Millisecond},
+	}
+
+	diff, err := Diff(before, after, 10)
+	require.NoError(t, err)
+
+	t.Run("should compare totals", func(t *testing.T) {
+		assert.Equal(t, MetricDelta{Name: "requests", Before: 100, After: 200, Delta: 100, Percent: 100}, diff.Totals[0])
+		assert.Equal(t, MetricDelta{Name: "uniqueIps", Before: 10, After: 10}, diff.Totals[1])
+		assert.Equal(t, MetricDelta{Name: "avgBytes", Before: 100, After: 150, Delta: 50, Percent: 50}, diff.Totals[4])
+		assert.Equal(t, MetricDelta{Name: "latencyAvgMs", Before: 100, After: 150, Delta: 50, Percent: 50}, diff.Totals[5])
+	})
+
+	t.Run("should compare status class shares", func(t *testing.T) {
+		assert.Equal(t, ShareDelta{Class: "2xx", Before: 90, After: 80, Delta: -10}, diff.StatusClasses[1])
+		assert.Equal(t, ShareDelta{Class: "4xx", Before: 5, After: 0, Delta: -5}, diff.StatusClasses[3])
+		assert.Equal(t, ShareDelta{Class: "5xx", Before: 5, After: 20, Delta: 15}, diff.StatusClasses[4])
+	})
+
+	t.Run("should compare ranks", func(t *testing.T) {
+		assert.Equal(t, []RankChange[string]{{Key: "/new", AfterRank: 3, AfterHits: 50}}, diff.Uris.Appeared)
+		assert.Equal(t, []RankChange[string]{{Key: "/old", BeforeRank: 3, BeforeHits: 20}}, diff.Uris.Disappeared)
+		assert.Equal(t, []RankChange[string]{
+			{Key: "/about", BeforeRank: 2, AfterRank: 1, BeforeHits: 30, AfterHits: 90},
+			{Key: "/", BeforeRank: 1, AfterRank: 2, BeforeHits: 50, AfterHits: 60},
+		}, diff.Uris.Changed)
+		assert.Empty(t, diff.Ips.Appeared)
+	})
+
+	t.Run("should compare top N only", func(t *testing.T) {
+		diff, err := Diff(before, after, 1)
+		require.NoError(t, err)
+
+		assert.Equal(t, []RankChange[string]{{Key: "/about", AfterRank: 1, AfterHits: 90}}, diff.Uris.Appeared)
+		assert.Equal(t, []RankChange[string]{{Key: "/", BeforeRank: 1, BeforeHits: 50}}, diff.Uris.Disappeared)
+	})
+
+	t.Run("should rank by hits in ascending results", func(t *testing.T) {
+		ascBefore, ascAfter := *before, *after
+		ascBefore.Uris = slices.Clone(before.Uris)
+		ascAfter.Uris = slices.Clone(after.Uris)
+		slices.Reverse(ascBefore.Uris)
+		slices.Reverse(ascAfter.Uris)
+
+		ascDiff, err := Diff(&ascBefore, &ascAfter, 10)
+		require.NoError(t, err)
+		assert.Equal(t, diff.Uris, ascDiff.Uris)
+		assert.Equal(t, []HitsInfo[string]{{Key: "/old", Hits: 20}, {Key: "/about", Hits: 30}, {Key: "/", Hits: 50}}, ascBefore.Uris)
+	})
+
+	t.Run("should compare no ranks for a negative top N", func(t *testing.T) {
+		diff, err := Diff(before, after, -1)
+		require.NoError(t, err)
+
+		assert.Empty(t, diff.Uris.Appeared)
+		assert.Empty(t, diff.Uris.Disappeared)
+		assert.Empty(t, diff.Uris.Changed)
+		assert.Equal(t, MetricDelta{Name: "requests", Before: 100, After: 200, Delta: 100, Percent: 100}, diff.Totals[0])
+	})
+
+	t.Run("should mark ascending results", func(t *testing.T) {
+		fpath := filepath.Join(t.TempDir(), "access.log")
+		require.NoError(t, os.WriteFile(fpath, []byte(`10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+`), 0644))
+
+		asc, err := Analyze(fpath, Options{TopN: 10, DatesBy: "none"})
+		require.NoError(t, err)
+		assert.True(t, asc.Asc)
+
+		desc, err := Analyze(fpath, Options{TopN: 10, Desc: true, DatesBy: "none"})
+		require.NoError(t, err)
+		assert.False(t, desc.Asc)
+	})
+
+	t.Run("should reject results listing the fewest hits", func(t *testing.T) {
+		ascAfter := *after
+		ascAfter.Asc = true
+
+		_, err := Diff(before, &ascAfter, 10)
+		assert.ErrorContains(t, err, "--asc")
+	})
+}
+
+func TestLoadResult(t *testing.T) {
+	t.Run("should load a saved result", func(t *testing.T) {
+		res := AnalyzeResult{
+			Version:       RESULT_VERSION,
+			TotalRequests: 3,
+			Ips:           []HitsInfo[netip.Addr]{{Key: netip.MustParseAddr("10.0.0.1"), Hits: 3}},
+			Uris:          []HitsInfo[string]{{Key: "/", Hits: 3}},
+		}
+
+		data, err := json.Marshal(res)
+		require.NoError(t, err)
+
+		fpath := filepath.Join(t.TempDir(), "result.json")
+		require.NoError(t, os.WriteFile(fpath, data, 0644))
+
+		loaded, err := LoadResult(fpath)
+		require.NoError(t, err)
+		assert.Equal(t, res.TotalRequests, loaded.TotalRequests)
+		assert.Equal(t, res.Ips, loaded.Ips)
+		assert.Equal(t, res.Uris, loaded.Uris)
+	})
+
+	t.Run("should reject results without a schema version", func(t *testing.T) {
+		fpath := filepath.Join(t.TempDir(), "result.json")
+		require.NoError(t, os.WriteFile(fpath, []byte(`{"totalRequests": 3}`), 0644))
+
+		_, err := LoadResult(fpath)
+		assert.ErrorContains(t, err, "no schema version")
+	})
+
+	t.Run("should reject invalid json", func(t *testing.T) {
+		fpath := filepath.Join(t.TempDir(), "result.json")
+		require.NoError(t, os.WriteFile(fpath, []byte("{"), 0644))
+
+		_, err := LoadResult(fpath)
+		assert.Error(t, err)
+	})
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	t.Run("should estimate percentiles within the bucket growth", func(t *testing.T) {
+		var h latencyHistogram
+		for i := 1; i <= 1000; i++ {
+			h.add(time.Duration(i) * time.Millisecond)
+		}
+
+		stats := h.stats()
+		require.NotNil(t, stats)
+		assert.Equal(t, uint64(1000), stats.Requests)
+		assert.Equal(t, 500500*time.Microsecond, stats.Avg)
+		assert.InEpsilon(t, float64(500*time.Millisecond), float64(stats.P50), LATENCY_BUCKET_GROWTH-1)
+		assert.InEpsilon(t, float64(990*time.Millisecond), float64(stats.P99), LATENCY_BUCKET_GROWTH-1)
+		assert.Equal(t, time.Second, stats.Max)
+	})
+
+	t.Run("should merge histograms", func(t *testing.T) {
+		var a, b latencyHistogram
+		a.add(time.Millisecond)
+		b.add(time.Hour)
+		a.merge(&b)
+
+		stats := a.stats()
+		assert.Equal(t, uint64(2), stats.Requests)
+		assert.Equal(t, time.Hour, stats.Max)
+		assert.Equal(t, time.Hour, stats.P99)
+	})
+
+	t.Run("should return nil without requests", func(t *testing.T) {
+		var h latencyHistogram
+		assert.Nil(t, h.stats())
+	})
+}
@@ -0,0 +1,71 @@
+package analyzer
+
+import (
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/useragent"
+)
+
+// Requests a worker collects before passing them to the EntryWriter
+const EXPORT_BATCH = 4096
+
+// Request accepted by the filters with the fields reports derive from it.
+// Uri is normalized, RequestTime is parser.NO_REQUEST_TIME when it's not logged.
+type ExportedEntry struct {
+	parser.LogEntry
+
+	RawUri string
+
+	// Set when geoip databases are provided
+	Geo *geoip.Info
+
+	// Set when user agents are classified
+	Agent *useragent.Info
+}
+
+// Receives accepted requests of every worker in batches, so it must be safe
+// for concurrent use. Batches are not touched by the analyzer after the call.
+type EntryWriter interface {
+	WriteEntries(entries []ExportedEntry)
+}
+
+// Requests of a worker waiting for the EntryWriter
+type entryBatch struct {
+	writer  EntryWriter
+	entries []ExportedEntry
+}
+
+func newEntryBatch(writer EntryWriter) *entryBatch {
+	return &entryBatch{writer: writer, entries: make([]ExportedEntry, 0, EXPORT_BATCH)}
+}
+
+func (b *entryBatch) add(entry *parser.LogEntry, rawUri string, params ProcessParams) {
+	exported := ExportedEntry{LogEntry: *entry, RawUri: rawUri}
+	if !params.RequestTime {
+		exported.RequestTime = parser.NO_REQUEST_TIME
+	}
+
+	if params.Geo != nil {
+		info := params.Geo.Lookup(entry.Ip)
+		exported.Geo = &info
+	}
+
+	if params.UserAgents != nil {
+		info := params.UserAgents.Classify(entry.UserAgent)
+		exported.Agent = &info
+	}
+
+	b.entries = append(b.entries, exported)
+	if len(b.entries) == EXPORT_BATCH {
+		b.flush()
+	}
+}
+
+func (b *entryBatch) flush() {
+	if len(b.entries) == 0 {
+		return
+	}
+
+	b.writer.WriteEntries(b.entries)
+	b.entries = make([]ExportedEntry, 0, EXPORT_BATCH)
+}
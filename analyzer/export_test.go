@@ -0,0 +1,120 @@
+package analyzer
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Kostayne/go-nginx-analyzer/index"
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/realip"
+	"github.com/Kostayne/go-nginx-analyzer/uripath"
+	"github.com/Kostayne/go-nginx-analyzer/useragent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type entriesWriter struct {
+	mu      sync.Mutex
+	entries []ExportedEntry
+}
+
+func (w *entriesWriter) WriteEntries(entries []ExportedEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.entries = append(w.entries, entries...)
+}
+
+func TestAnalyzeExport(t *testing.T) {
+	testData := `10.0.0.1 - - [25/Dec/2023:10:00:00 +0000] "GET /users/1 HTTP/1.1" 200 100 "-" "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+10.0.0.1 - - [25/Dec/2023:10:01:00 +0000] "GET /about HTTP/1.1" 404 100 "-" "curl/8.0"
+10.0.0.2 - - [25/Dec/2023:10:02:00 +0000] "GET /users/2 HTTP/1.1" 500 100 "-" "curl/8.0"
+`
+
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(logPath, []byte(testData), 0644))
+
+	uris, err := uripath.New(uripath.Options{Auto: true})
+	require.NoError(t, err)
+
+	t.Run("should pass accepted requests with derived fields", func(t *testing.T) {
+		writer := &entriesWriter{}
+		opts := Options{
+			TopN:       10,
+			Desc:       true,
+			Uris:       uris,
+			UserAgents: useragent.Default(),
+			Statuses:   []StatusRange{{Min: 200, Max: 499}},
+			Export:     writer,
+		}
+
+		result, err := Analyze(logPath, opts)
+		require.NoError(t, err)
+		require.Len(t, writer.entries, int(result.TotalRequests))
+
+		entry := writer.entries[0]
+		if entry.StatusCode != 200 {
+			entry = writer.entries[1]
+		}
+
+		assert.Equal(t, "/users/{id}", entry.Uri)
+		assert.Equal(t, "/users/1", entry.RawUri)
+		assert.Equal(t, parser.NO_REQUEST_TIME, entry.RequestTime)
+		assert.Nil(t, entry.Geo)
+		require.NotNil(t, entry.Agent)
+		assert.Equal(t, "Chrome", entry.Agent.Browser)
+	})
+
+	t.Run("should export requests of an index like the ones of the log", func(t *testing.T) {
+		proxiedData := `10.0.0.9 - - [25/Dec/2023:10:00:00 +0000] "GET /users/1 HTTP/2.0" 200 100 "-" "curl/8.0" "203.0.113.7"
+10.0.0.9 - - [25/Dec/2023:10:01:00 +0100] "POST /login HTTP/1.1" 302 0 "-" "curl/8.0" "-"
+`
+		proxiedPath := filepath.Join(t.TempDir(), "proxied.log")
+		require.NoError(t, os.WriteFile(proxiedPath, []byte(proxiedData), 0644))
+
+		extraFields := []parser.ExtraField{parser.FIELD_X_FORWARDED_FOR}
+		resolver, err := realip.New(realip.SOURCE_X_FORWARDED_FOR, nil)
+		require.NoError(t, err)
+
+		export := func(analyze func(opts Options) *AnalyzeResult) []ExportedEntry {
+			writer := &entriesWriter{}
+			result := analyze(Options{TopN: 10, Desc: true, ExtraFields: extraFields, RealIp: resolver, Export: writer})
+			require.Len(t, writer.entries, int(result.TotalRequests))
+
+			slices.SortFunc(writer.entries, func(a, b ExportedEntry) int {
+				return a.Date.Compare(b.Date)
+			})
+			for i := range writer.entries {
+				// remote users and proxy headers are not indexed, dates are compared by instant
+				writer.entries[i].User = ""
+				writer.entries[i].XForwardedFor = ""
+				writer.entries[i].XRealIp = ""
+				writer.entries[i].Date = writer.entries[i].Date.UTC()
+			}
+
+			return writer.entries
+		}
+
+		expected := export(func(opts Options) *AnalyzeResult {
+			result, err := Analyze(proxiedPath, opts)
+			require.NoError(t, err)
+			return result
+		})
+
+		idx, err := index.BuildFile(proxiedPath, extraFields, resolver)
+		require.NoError(t, err)
+		actual := export(func(opts Options) *AnalyzeResult {
+			return AnalyzeIndex(idx, opts)
+		})
+
+		require.Len(t, actual, 2)
+		assert.Equal(t, netip.MustParseAddr("203.0.113.7"), actual[1].Ip)
+		assert.Equal(t, netip.MustParseAddr("10.0.0.9"), actual[1].RemoteAddr)
+		assert.Equal(t, "HTTP/2.0", actual[1].Protocol)
+		assert.Equal(t, expected, actual)
+	})
+}
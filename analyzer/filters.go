@@ -0,0 +1,97 @@
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// Returns false for entries excluded from every report
+func (params *ProcessParams) accepts(entry *parser.LogEntry) bool {
+	if !params.Since.IsZero() && entry.Date.Before(params.Since) {
+		return false
+	}
+
+	if !params.Until.IsZero() && !entry.Date.Before(params.Until) {
+		return false
+	}
+
+	if len(params.Statuses) > 0 && !matchesStatus(params.Statuses, entry.StatusCode) {
+		return false
+	}
+
+	if params.Ip.IsValid() && entry.Ip != params.Ip {
+		return false
+	}
+
+	if len(params.Countries) > 0 && params.Geo != nil {
+		if !slices.Contains(params.Countries, params.Geo.Lookup(entry.Ip).Country) {
+			return false
+		}
+	}
+
+	if params.ExcludeBots && params.UserAgents != nil {
+		if params.UserAgents.Classify(entry.UserAgent).IsBot() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Parses an RFC 3339 time or a duration back from now, like "1h".
+// An empty value is the zero time.
+func ParseTimeBound(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if ago, err := time.ParseDuration(value); err == nil {
+		return now.Add(-ago), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// Inclusive range of status codes
+type StatusRange struct {
+	Min uint16 `json:"min"`
+	Max uint16 `json:"max"`
+}
+
+// Parses codes like "404" and classes like "5xx"
+func ParseStatusRanges(values []string) ([]StatusRange, error) {
+	ranges := make([]StatusRange, 0, len(values))
+
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		if len(value) == 3 && strings.HasSuffix(value, "xx") && value[0] >= '1' && value[0] <= '5' {
+			class := uint16(value[0]-'0') * 100
+			ranges = append(ranges, StatusRange{Min: class, Max: class + 99})
+			continue
+		}
+
+		code, err := strconv.ParseUint(value, 10, 16)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status %q, expected a code like 404 or a class like 5xx", value)
+		}
+		ranges = append(ranges, StatusRange{Min: uint16(code), Max: uint16(code)})
+	}
+
+	return ranges, nil
+}
+
+func matchesStatus(ranges []StatusRange, code uint16) bool {
+	for _, r := range ranges {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,131 @@
+package analyzer
+
+import (
+	"time"
+)
+
+// Follows a growing log for windowed analyses. Every update analyzes only the
+// lines appended since the previous one, windows merge the kept parts.
+type Follower struct {
+	fpath string
+	opts  Options
+
+	// Parts ending this long before the last request are dropped
+	retain time.Duration
+
+	// Where the analyzed lines end and the result of the whole log
+	checkpoint *Checkpoint
+	parts      []logPart
+
+	// Per request reports can't be merged, windows are analyzed from the kept offsets
+	mergeable bool
+}
+
+// Lines appended between two updates
+type logPart struct {
+	start, end int64
+	result     *AnalyzeResult
+}
+
+// Windows passed to Since must fit into the retention
+func NewFollower(fpath string, opts Options, retain time.Duration) *Follower {
+	opts.State = true
+	return &Follower{fpath: fpath, opts: opts, retain: retain, mergeable: unmergeableReport(opts) == ""}
+}
+
+// Analyzes the lines appended since the last update, a rotated or truncated log
+// is followed from its start again
+func (f *Follower) Update() error {
+	if f.checkpoint != nil && f.checkpoint.checkFile(f.fpath) != nil {
+		f.checkpoint, f.parts = nil, nil
+	}
+
+	start := int64(0)
+	if f.checkpoint != nil {
+		start = f.checkpoint.Offset
+	}
+
+	appended, checkpoint, err := analyzeAppended(f.fpath, start, f.opts)
+	if err != nil {
+		return err
+	}
+
+	if f.checkpoint != nil && checkpoint.Offset == start {
+		return nil
+	}
+
+	checkpoint.Result = appended
+	if f.mergeable && f.checkpoint != nil {
+		checkpoint.Result, err = MergeSaved([]*AnalyzeResult{f.checkpoint.Result, appended}, incrementalParams(f.opts))
+		if err != nil {
+			return err
+		}
+	}
+
+	f.checkpoint = checkpoint
+	if appended.TotalRequests > 0 {
+		f.parts = append(f.parts, logPart{start: start, end: checkpoint.Offset, result: appended})
+	}
+
+	// windows start at most the retention before the newest request
+	if len(f.parts) > 0 {
+		oldest := f.parts[len(f.parts)-1].result.TimeRange.End.Add(-f.retain)
+		for f.parts[0].result.TimeRange.End.Before(oldest) {
+			f.parts = f.parts[1:]
+		}
+	}
+
+	return nil
+}
+
+// Result of the requests since the time as of the last update, the zero time
+// gives the whole log. Update must be called first.
+func (f *Follower) Since(since time.Time) (*AnalyzeResult, error) {
+	end := f.checkpoint.Offset
+
+	if since.IsZero() {
+		if f.mergeable {
+			return f.checkpoint.Result, nil
+		}
+
+		return analyzeRange(f.fpath, 0, end, end, f.opts)
+	}
+
+	first := len(f.parts)
+	for i, part := range f.parts {
+		if !part.result.TimeRange.End.Before(since) {
+			first = i
+			break
+		}
+	}
+
+	windowOpts := f.opts
+	windowOpts.Since = since
+
+	if !f.mergeable || first == len(f.parts) {
+		start := end
+		if first < len(f.parts) {
+			start = f.parts[first].start
+		}
+
+		return analyzeRange(f.fpath, start, end, end, windowOpts)
+	}
+
+	results := make([]*AnalyzeResult, 0, len(f.parts)-first)
+	for _, part := range f.parts[first:] {
+		res := part.result
+
+		// only the part the window starts in is read again
+		if res.TimeRange.Start.Before(since) {
+			var err error
+			res, err = analyzeRange(f.fpath, part.start, part.end, end, windowOpts)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		results = append(results, res)
+	}
+
+	return MergeSaved(results, incrementalParams(f.opts))
+}
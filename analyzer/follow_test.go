@@ -0,0 +1,125 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollower(t *testing.T) {
+	first := `10.0.0.1 - - [25/Dec/2023:10:00:00 +0000] "GET /about HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.1 - - [25/Dec/2023:10:04:00 +0000] "GET /about HTTP/1.1" 500 100 "-" "Mozilla/5.0"
+`
+	second := `10.0.0.2 - - [25/Dec/2023:10:06:00 +0000] "GET /cart HTTP/1.1" 500 100 "-" "Mozilla/5.0"
+10.0.0.3 - - [25/Dec/2023:10:07:00 +0000] "GET /cart HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+`
+	partial := `10.0.0.4 - - [25/Dec/2023:10:08:00 +0000] "GET /cart HTTP/1.1" 200 100`
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	at := func(minutes int) time.Time {
+		return time.Date(2023, 12, 25, 10, minutes, 0, 0, time.UTC)
+	}
+
+	appendLog := func(fpath, text string) {
+		file, err := os.OpenFile(fpath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		require.NoError(t, err)
+		_, err = file.WriteString(text)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+
+	appendLog(logPath, first)
+	follower := NewFollower(logPath, Options{TopN: 10, Desc: true, DatesBy: "none"}, 10*time.Minute)
+	require.NoError(t, follower.Update())
+
+	appendLog(logPath, second+partial)
+	require.NoError(t, follower.Update())
+
+	t.Run("should analyze only appended lines", func(t *testing.T) {
+		require.Len(t, follower.parts, 2)
+		assert.Equal(t, int64(len(first)), follower.parts[1].start)
+		assert.Equal(t, int64(len(first+second)), follower.parts[1].end)
+		assert.Equal(t, uint64(2), follower.parts[1].result.TotalRequests)
+	})
+
+	t.Run("should merge the whole log", func(t *testing.T) {
+		res, err := follower.Since(time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(4), res.TotalRequests)
+		assert.ElementsMatch(t, []HitsInfo[uint16]{{Key: 200, Hits: 2}, {Key: 500, Hits: 2}}, res.StatusCodes)
+	})
+
+	t.Run("should cut the window inside a part", func(t *testing.T) {
+		res, err := follower.Since(at(3))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), res.TotalRequests)
+
+		res, err = follower.Since(at(5))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), res.TotalRequests)
+		assert.NotNil(t, res.State)
+	})
+
+	t.Run("should return an empty window after the last request", func(t *testing.T) {
+		res, err := follower.Since(at(9))
+		require.NoError(t, err)
+		assert.Zero(t, res.TotalRequests)
+	})
+
+	t.Run("should match the window analysis of the whole log", func(t *testing.T) {
+		windowed, err := follower.Since(at(3))
+		require.NoError(t, err)
+
+		full, err := Analyze(logPath, Options{TopN: 10, Desc: true, DatesBy: "none", Since: at(3)})
+		require.NoError(t, err)
+
+		assert.Equal(t, full.TotalRequests, windowed.TotalRequests)
+		assert.ElementsMatch(t, full.Ips, windowed.Ips)
+		assert.ElementsMatch(t, full.StatusCodes, windowed.StatusCodes)
+	})
+
+	t.Run("should analyze windows with per request reports", func(t *testing.T) {
+		rates := NewFollower(logPath, Options{TopN: 10, Desc: true, DatesBy: "none", Rates: &RateOptions{ThrottlePercent: 1}}, 10*time.Minute)
+		require.NoError(t, rates.Update())
+
+		res, err := rates.Since(at(5))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), res.TotalRequests)
+		require.NotNil(t, res.Rates)
+		assert.Equal(t, uint64(2), res.Rates.Clients)
+	})
+
+	t.Run("should drop parts older than the retention", func(t *testing.T) {
+		shortPath := filepath.Join(dir, "short.log")
+		short := NewFollower(shortPath, Options{TopN: 10, Desc: true, DatesBy: "none"}, time.Minute)
+
+		appendLog(shortPath, first)
+		require.NoError(t, short.Update())
+		appendLog(shortPath, second)
+		require.NoError(t, short.Update())
+
+		require.Len(t, short.parts, 1)
+		assert.Equal(t, int64(len(first)), short.parts[0].start)
+
+		res, err := short.Since(time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(4), res.TotalRequests)
+	})
+
+	t.Run("should start over when the log is replaced", func(t *testing.T) {
+		require.NoError(t, os.Remove(logPath))
+		appendLog(logPath, second)
+		require.NoError(t, follower.Update())
+
+		res, err := follower.Since(time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), res.TotalRequests)
+		require.Len(t, follower.parts, 1)
+		assert.Zero(t, follower.parts[0].start)
+	})
+}
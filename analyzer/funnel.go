@@ -0,0 +1,129 @@
+package analyzer
+
+import (
+	"strings"
+	"time"
+)
+
+// Amount of consecutive pages in a navigation sequence
+const SEQUENCE_LENGTH = 3
+
+type FunnelOptions struct {
+	// Path prefixes of the funnel steps in order
+	Steps []string `json:"steps"`
+}
+
+type FunnelReport struct {
+	Steps []FunnelStep `json:"steps"`
+
+	// Most common sequences of SEQUENCE_LENGTH pages, like "/ -> /products -> /cart"
+	Sequences []HitsInfo[string] `json:"sequences"`
+}
+
+type FunnelStep struct {
+	Step string `json:"step"`
+
+	// Visitors reaching the step after every previous one
+	Visitors uint64 `json:"visitors"`
+
+	// Share of visitors of the previous step and of the first step, in percents
+	Conversion      float64 `json:"conversion"`
+	TotalConversion float64 `json:"totalConversion"`
+
+	// Median time since reaching the previous step
+	MedianTime time.Duration `json:"medianTime"`
+}
+
+// A uri reaches the step when its path is the step or is nested into it
+func matchesStep(uri, step string) bool {
+	p, _, _ := strings.Cut(uri, "?")
+	if !strings.HasPrefix(p, step) {
+		return false
+	}
+
+	return len(p) == len(step) || strings.HasSuffix(step, "/") || p[len(step)] == '/'
+}
+
+// Page views are expected sorted by time, sequences are split on the session timeout
+func funnelReport(pageViews map[visitor][]pageView, topN int, opts FunnelOptions, sessions SessionOptions) *FunnelReport {
+	timeout := sessions.timeoutSeconds()
+	reached := make([]uint64, len(opts.Steps))
+	waits := make([][]float64, len(opts.Steps))
+	sequences := make(map[string]uint64)
+
+	for _, views := range pageViews {
+		step := 0
+		var reachedAt int64
+
+		for _, view := range views {
+			if step < len(opts.Steps) && matchesStep(view.uri, opts.Steps[step]) {
+				if step > 0 {
+					waits[step] = append(waits[step], float64(view.second-reachedAt))
+				}
+
+				reached[step]++
+				reachedAt = view.second
+				step++
+			}
+		}
+
+		countSequences(views, timeout, sequences)
+	}
+
+	report := &FunnelReport{
+		Steps:     make([]FunnelStep, len(opts.Steps)),
+		Sequences: *getHitsInfo(sequences, topN, true),
+	}
+
+	for i, step := range opts.Steps {
+		report.Steps[i] = FunnelStep{Step: step, Visitors: reached[i]}
+
+		if i == 0 {
+			if reached[0] > 0 {
+				report.Steps[i].Conversion = 100
+				report.Steps[i].TotalConversion = 100
+			}
+			continue
+		}
+
+		if reached[i-1] > 0 {
+			report.Steps[i].Conversion = float64(reached[i]) / float64(reached[i-1]) * 100
+		}
+		if reached[0] > 0 {
+			report.Steps[i].TotalConversion = float64(reached[i]) / float64(reached[0]) * 100
+		}
+		if len(waits[i]) > 0 {
+			report.Steps[i].MedianTime = time.Duration(medianOf(waits[i]) * float64(time.Second))
+		}
+	}
+
+	return report
+}
+
+// Counts sequences of distinct consecutive pages, reloads don't make a step and
+// sequences don't span gaps longer than the timeout in seconds
+func countSequences(views []pageView, timeout int64, sequences map[string]uint64) {
+	pages := make([]string, 0, SEQUENCE_LENGTH)
+	var lastSecond int64
+
+	for _, view := range views {
+		if len(pages) > 0 && view.second-lastSecond > timeout {
+			pages = pages[:0]
+		}
+		lastSecond = view.second
+
+		if len(pages) > 0 && pages[len(pages)-1] == view.uri {
+			continue
+		}
+
+		if len(pages) == SEQUENCE_LENGTH {
+			copy(pages, pages[1:])
+			pages = pages[:SEQUENCE_LENGTH-1]
+		}
+		pages = append(pages, view.uri)
+
+		if len(pages) == SEQUENCE_LENGTH {
+			sequences[strings.Join(pages, " -> ")]++
+		}
+	}
+}
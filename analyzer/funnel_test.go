@@ -0,0 +1,122 @@
+package analyzer
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchesStep(t *testing.T) {
+	t.Run("should match the step and nested paths", func(t *testing.T) {
+		assert.True(t, matchesStep("/cart", "/cart"))
+		assert.True(t, matchesStep("/cart?coupon=1", "/cart"))
+		assert.True(t, matchesStep("/products/{id}", "/products"))
+		assert.True(t, matchesStep("/products/42", "/products/"))
+		assert.False(t, matchesStep("/cartoons", "/cart"))
+		assert.False(t, matchesStep("/", "/cart"))
+	})
+}
+
+func TestFunnelReport(t *testing.T) {
+	visitorOf := func(ip string) visitor {
+		return visitor{ip: netip.MustParseAddr(ip), userAgent: "Mozilla/5.0"}
+	}
+
+	pageViews := map[visitor][]pageView{
+		// completes the funnel
+		visitorOf("10.0.0.1"): {
+			{second: 0, uri: "/"},
+			{second: 10, uri: "/products/1"},
+			{second: 70, uri: "/cart"},
+			{second: 100, uri: "/checkout"},
+		},
+		// checkout before cart doesn't count
+		visitorOf("10.0.0.2"): {
+			{second: 0, uri: "/products/2"},
+			{second: 5, uri: "/checkout"},
+			{second: 125, uri: "/cart"},
+		},
+		// never reaches the first step
+		visitorOf("10.0.0.3"): {
+			{second: 0, uri: "/cart"},
+			{second: 1, uri: "/checkout"},
+		},
+	}
+
+	report := funnelReport(pageViews, 10, FunnelOptions{Steps: []string{"/products", "/cart", "/checkout"}}, SessionOptions{})
+
+	t.Run("should count visitors reaching steps in order", func(t *testing.T) {
+		require.Len(t, report.Steps, 3)
+		assert.Equal(t, FunnelStep{Step: "/products", Visitors: 2, Conversion: 100, TotalConversion: 100}, report.Steps[0])
+		assert.Equal(t, FunnelStep{Step: "/cart", Visitors: 2, Conversion: 100, TotalConversion: 100, MedianTime: 92500 * time.Millisecond}, report.Steps[1])
+		assert.Equal(t, FunnelStep{Step: "/checkout", Visitors: 1, Conversion: 50, TotalConversion: 50, MedianTime: 30 * time.Second}, report.Steps[2])
+	})
+
+	t.Run("should count navigation sequences", func(t *testing.T) {
+		assert.ElementsMatch(t, []HitsInfo[string]{
+			{Key: "/ -> /products/1 -> /cart", Hits: 1},
+			{Key: "/products/1 -> /cart -> /checkout", Hits: 1},
+			{Key: "/products/2 -> /checkout -> /cart", Hits: 1},
+		}, report.Sequences)
+	})
+}
+
+func TestCountSequences(t *testing.T) {
+	t.Run("should skip reloads and split on inactivity", func(t *testing.T) {
+		sequences := make(map[string]uint64)
+		countSequences([]pageView{
+			{second: 0, uri: "/"},
+			{second: 1, uri: "/"},
+			{second: 2, uri: "/a"},
+			{second: 3, uri: "/b"},
+			{second: 4, uri: "/c"},
+			{second: 10000, uri: "/d"},
+			{second: 10001, uri: "/e"},
+		}, int64(DEFAULT_SESSION_TIMEOUT/time.Second), sequences)
+
+		assert.Equal(t, map[string]uint64{"/ -> /a -> /b": 1, "/a -> /b -> /c": 1}, sequences)
+	})
+
+	t.Run("should split on the configured timeout", func(t *testing.T) {
+		views := []pageView{
+			{second: 0, uri: "/"},
+			{second: 60, uri: "/a"},
+			{second: 120, uri: "/b"},
+		}
+
+		sequences := make(map[string]uint64)
+		countSequences(views, 30, sequences)
+		assert.Empty(t, sequences)
+
+		report := funnelReport(map[visitor][]pageView{{ip: netip.MustParseAddr("10.0.0.1")}: views}, 10, FunnelOptions{}, SessionOptions{Timeout: 30 * time.Second})
+		assert.Empty(t, report.Sequences)
+	})
+}
+
+func TestAnalyzeFunnel(t *testing.T) {
+	t.Run("should follow visitors by ip and user agent", func(t *testing.T) {
+		testData := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET /products HTTP/1.1" 200 100 "-" "Firefox"
+10.0.0.1 - - [25/Dec/2023:10:30:50 +0000] "GET /products HTTP/1.1" 200 100 "-" "Chrome"
+10.0.0.1 - - [25/Dec/2023:10:31:45 +0000] "GET /cart HTTP/1.1" 200 100 "-" "Firefox"
+10.0.0.1 - - [25/Dec/2023:10:31:46 +0000] "GET /static/cart.js HTTP/1.1" 200 100 "-" "Firefox"
+`
+
+		fpath := filepath.Join(t.TempDir(), "access.log")
+		require.NoError(t, os.WriteFile(fpath, []byte(testData), 0644))
+
+		res, err := Analyze(fpath, Options{TopN: 10, Desc: true, Funnel: &FunnelOptions{Steps: []string{"/products", "/cart"}}})
+		require.NoError(t, err)
+		require.NotNil(t, res.Funnel)
+		assert.Nil(t, res.Sessions)
+
+		assert.Equal(t, uint64(2), res.Funnel.Steps[0].Visitors)
+		assert.Equal(t, uint64(1), res.Funnel.Steps[1].Visitors)
+		assert.Equal(t, time.Minute, res.Funnel.Steps[1].MedianTime)
+		assert.Empty(t, res.Funnel.Sequences)
+	})
+}
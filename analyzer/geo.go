@@ -0,0 +1,43 @@
+package analyzer
+
+import (
+	"net/netip"
+
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+)
+
+// Builds country & ASN reports from full ip counts, so every
+// distinct ip is looked up only once
+func enrich(ips map[netip.Addr]uint64, topIps []HitsInfo[netip.Addr], params MergeParams) ([]HitsInfo[string], []HitsInfo[geoip.Asn], map[netip.Addr]geoip.Info) {
+	countries := make(map[string]uint64)
+	asns := make(map[geoip.Asn]uint64)
+
+	for ip, hits := range ips {
+		info := params.Geo.Lookup(ip)
+
+		if params.Geo.HasCity() {
+			countries[info.Country] += hits
+		}
+
+		if params.Geo.HasAsn() {
+			asns[info.Asn] += hits
+		}
+	}
+
+	topGeo := make(map[netip.Addr]geoip.Info, len(topIps))
+	for _, ip := range topIps {
+		topGeo[ip.Key] = params.Geo.Lookup(ip.Key)
+	}
+
+	var topCountries []HitsInfo[string]
+	if params.Geo.HasCity() {
+		topCountries = *getHitsInfo(countries, params.TopN, params.Desc)
+	}
+
+	var topAsns []HitsInfo[geoip.Asn]
+	if params.Geo.HasAsn() {
+		topAsns = *getHitsInfo(asns, params.TopN, params.Desc)
+	}
+
+	return topCountries, topAsns, topGeo
+}
@@ -0,0 +1,383 @@
+package analyzer
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/index"
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// Rows a worker of the per request path processes at once
+const INDEX_ROWS_PER_WORKER = 1024 * 1024
+
+// Last opened index, repeated queries of serve and tui modes skip decoding
+var indexCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	idx     *index.Index
+}
+
+func openIndex(fpath string) (*index.Index, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	indexCache.Lock()
+	defer indexCache.Unlock()
+
+	if indexCache.idx != nil && indexCache.path == fpath &&
+		indexCache.modTime.Equal(info.ModTime()) && indexCache.size == info.Size() {
+		return indexCache.idx, nil
+	}
+
+	idx, err := index.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	indexCache.path = fpath
+	indexCache.modTime = info.ModTime()
+	indexCache.size = info.Size()
+	indexCache.idx = idx
+
+	return idx, nil
+}
+
+// Analyzes requests of an index. Top hits, filters and time series are counted
+// by dictionary ids, reports which need every request (security, rates, sessions,
+// ...) run on requests rebuilt from the columns. The client ip was resolved when
+// the index was built, so RealIp is ignored and remote addrs are not reported.
+// Remote users and proxy headers are not indexed, rebuilt requests leave them out.
+func AnalyzeIndex(idx *index.Index, opts Options) *AnalyzeResult {
+	opts.RealIp = nil
+
+	var agg *aggregator
+	if needsEntries(opts) {
+		agg = analyzeIndexEntries(idx, opts)
+	} else {
+		agg = analyzeIndexColumns(idx, opts)
+	}
+	defer putAggregator(agg)
+
+	agg.parseErrors = idx.ParseErrors
+
+	res := agg.result(mergeParams(opts, idx.SourceSize))
+	return &res
+}
+
+// Whether the options need requests rebuilt from the columns
+func needsEntries(opts Options) bool {
+	return opts.Security != nil || opts.Block != nil || opts.Rates != nil || opts.Anomalies != nil ||
+		opts.Sessions != nil || opts.Funnel != nil || opts.Metrics || opts.Export != nil
+}
+
+// Locations of the zone dictionary, like the parser uses the local one when
+// its offset at the date matches
+type indexZones struct {
+	offsets []int
+	fixed   []*time.Location
+}
+
+func newIndexZones(idx *index.Index) indexZones {
+	zones := indexZones{
+		offsets: make([]int, len(idx.Zones)),
+		fixed:   make([]*time.Location, len(idx.Zones)),
+	}
+	for i, offset := range idx.Zones {
+		zones.offsets[i] = int(offset)
+		zones.fixed[i] = time.FixedZone("", int(offset))
+	}
+
+	return zones
+}
+
+func (z indexZones) date(sec int64, zoneId uint32) time.Time {
+	date := time.Unix(sec, 0).In(time.Local)
+	if _, offset := date.Zone(); offset == z.offsets[zoneId] {
+		return date
+	}
+
+	return date.In(z.fixed[zoneId])
+}
+
+func analyzeIndexEntries(idx *index.Index, opts Options) *aggregator {
+	rows := idx.Rows()
+	workersCount := max(min(runtime.NumCPU(), (rows+INDEX_ROWS_PER_WORKER-1)/INDEX_ROWS_PER_WORKER), 1)
+	rowsPerWorker := (rows + workersCount - 1) / workersCount
+
+	zones := newIndexZones(idx)
+
+	resultChan := make(chan *aggregator, workersCount)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < workersCount; i++ {
+		wg.Add(1)
+
+		go func(start, end int) {
+			defer wg.Done()
+
+			agg := getAggregator()
+			params := newProcessParams(opts, idx.SourceSize)
+			params.RequestTime = idx.RequestTimes != nil
+
+			entry := &parser.LogEntry{}
+			for row := start; row < end; row++ {
+				*entry = parser.LogEntry{
+					Ip:            idx.Ips[idx.IpIds[row]],
+					RemoteAddr:    idx.Ips[idx.IpIds[row]],
+					Date:          zones.date(idx.Times[row], idx.ZoneIds[row]),
+					Method:        idx.Methods[idx.MethodIds[row]],
+					Protocol:      idx.Protocols[idx.ProtocolIds[row]],
+					Uri:           idx.Uris[idx.UriIds[row]],
+					StatusCode:    idx.Statuses[row],
+					RespBytes:     uint(idx.Bytes[row]),
+					Referrer:      idx.Referrers[idx.ReferrerIds[row]],
+					UserAgent:     idx.UserAgents[idx.UserAgentIds[row]],
+					XForwardedFor: "-",
+					XRealIp:       "-",
+					RequestTime:   parser.NO_REQUEST_TIME,
+				}
+				if params.RequestTime {
+					entry.RequestTime = idx.RequestTimes[row]
+				}
+				if idx.RemoteAddrIds != nil {
+					entry.RemoteAddr = idx.Ips[idx.RemoteAddrIds[row]]
+				}
+
+				processEntry(entry, agg, params)
+			}
+
+			if params.Export != nil {
+				params.Export.flush()
+			}
+
+			resultChan <- agg
+		}(min(i*rowsPerWorker, rows), min((i+1)*rowsPerWorker, rows))
+	}
+
+	wg.Wait()
+	close(resultChan)
+
+	total := getAggregator()
+	for agg := range resultChan {
+		total.merge(agg)
+		putAggregator(agg)
+	}
+
+	return total
+}
+
+// Counts requests by dictionary ids, strings and dates are looked up once per
+// distinct value instead of once per request
+func analyzeIndexColumns(idx *index.Index, opts Options) *aggregator {
+	agg := getAggregator()
+	params := newProcessParams(opts, idx.SourceSize)
+	rows := idx.Rows()
+	if rows == 0 {
+		return agg
+	}
+
+	zones := newIndexZones(idx)
+
+	// per ip and user agent filters
+	ipAccepted := make([]bool, len(idx.Ips))
+	for id, ip := range idx.Ips {
+		ipAccepted[id] = !params.Ip.IsValid() || ip == params.Ip
+		if ipAccepted[id] && len(params.Countries) > 0 && params.Geo != nil {
+			ipAccepted[id] = slices.Contains(params.Countries, params.Geo.Lookup(ip).Country)
+		}
+	}
+
+	bots := make([]string, len(idx.UserAgents))
+	uaAccepted := make([]bool, len(idx.UserAgents))
+	for id, userAgent := range idx.UserAgents {
+		uaAccepted[id] = true
+		if params.UserAgents == nil {
+			continue
+		}
+
+		if info := params.UserAgents.Classify(userAgent); info.IsBot() {
+			bots[id] = info.Bot
+			uaAccepted[id] = !params.ExcludeBots
+		}
+	}
+
+	// uris are normalized once per distinct raw uri
+	uris := idx.Uris
+	if params.Uris != nil {
+		uris = make([]string, len(idx.Uris))
+		for id, uri := range idx.Uris {
+			uris[id] = params.Uris.Normalize(uri)
+		}
+	}
+
+	uriAccepted := make([]bool, len(uris))
+	for id, uri := range uris {
+		uriAccepted[id] = params.Uri == "" || uri == params.Uri
+	}
+
+	since, until := ceilUnix(params.Since), ceilUnix(params.Until)
+
+	ipHits := make([]uint64, len(idx.Ips))
+	uriHits := make([]uint64, len(idx.Uris))
+	uaHits := make([]uint64, len(idx.UserAgents))
+	codeHits := make([]uint64, 1<<16)
+
+	seconds := newSecondCounter(idx)
+
+	minRow, maxRow := -1, -1
+	entry := &parser.LogEntry{}
+
+	for row := 0; row < rows; row++ {
+		sec := idx.Times[row]
+		status := idx.Statuses[row]
+		ipId, uriId, uaId := idx.IpIds[row], idx.UriIds[row], idx.UserAgentIds[row]
+
+		if (!params.Since.IsZero() && sec < since) || (!params.Until.IsZero() && sec >= until) ||
+			(len(params.Statuses) > 0 && !matchesStatus(params.Statuses, status)) ||
+			!ipAccepted[ipId] || !uaAccepted[uaId] || !uriAccepted[uriId] {
+			agg.filtered++
+			continue
+		}
+
+		agg.totalRequests++
+		agg.totalBytes += idx.Bytes[row]
+		ipHits[ipId]++
+		uriHits[uriId]++
+		uaHits[uaId]++
+		codeHits[status]++
+
+		if idx.RequestTimes != nil && idx.RequestTimes[row] != parser.NO_REQUEST_TIME {
+			agg.latency.add(idx.RequestTimes[row])
+		}
+
+		seconds.add(sec, idx.ZoneIds[row], statusClass(status))
+
+		if minRow == -1 || sec < idx.Times[minRow] {
+			minRow = row
+		}
+		if maxRow == -1 || sec > idx.Times[maxRow] {
+			maxRow = row
+		}
+
+		if bots[uaId] != "" {
+			entry.Ip = idx.Ips[ipId]
+			entry.Uri = uris[uriId]
+			entry.StatusCode = status
+			entry.RespBytes = uint(idx.Bytes[row])
+			agg.addBot(bots[uaId], entry, params)
+		}
+	}
+
+	seconds.each(func(sec int64, zoneId uint32, count *indexSecond) {
+		agg.dates[groupDate(zones.date(sec, zoneId), params.GroupBy)] += count.hits
+		if params.StatusTimeline {
+			counts := agg.classSeconds[sec]
+			for i, classCount := range count.classes {
+				counts[i] += classCount
+			}
+			agg.classSeconds[sec] = counts
+		}
+	})
+
+	for id, hits := range ipHits {
+		if hits > 0 {
+			agg.ips[idx.Ips[id]] = hits
+		}
+	}
+	for id, hits := range uriHits {
+		if hits > 0 {
+			agg.uris[uris[id]] += hits
+		}
+	}
+	for id, hits := range uaHits {
+		if hits > 0 {
+			agg.userAgents[idx.UserAgents[id]] = hits
+		}
+	}
+	for code, hits := range codeHits {
+		if hits > 0 {
+			agg.codes[uint16(code)] = hits
+		}
+	}
+
+	if minRow != -1 {
+		agg.trackTime(zones.date(idx.Times[minRow], idx.ZoneIds[minRow]), zones.date(idx.Times[maxRow], idx.ZoneIds[maxRow]))
+	}
+
+	return agg
+}
+
+// Requests and status classes of a second
+type indexSecond struct {
+	hits    uint64
+	classes ClassCounts
+}
+
+type zonedSecond struct {
+	sec    int64
+	zoneId uint32
+}
+
+// Counts requests per second and zone, dates and timelines are derived once
+// per second. Indexes of a single zone spanning up to DENSE_SECONDS are counted
+// in a slice, others in a map.
+type secondCounter struct {
+	first  int64
+	dense  []indexSecond
+	sparse map[zonedSecond]*indexSecond
+}
+
+const DENSE_SECONDS = 1 << 18 // 3 days
+
+func newSecondCounter(idx *index.Index) *secondCounter {
+	first, last := slices.Min(idx.Times), slices.Max(idx.Times)
+	if len(idx.Zones) == 1 && last-first < DENSE_SECONDS {
+		return &secondCounter{first: first, dense: make([]indexSecond, last-first+1)}
+	}
+
+	return &secondCounter{sparse: make(map[zonedSecond]*indexSecond)}
+}
+
+func (c *secondCounter) add(sec int64, zoneId uint32, class int) {
+	var count *indexSecond
+	if c.dense != nil {
+		count = &c.dense[sec-c.first]
+	} else if count = c.sparse[zonedSecond{sec, zoneId}]; count == nil {
+		count = &indexSecond{}
+		c.sparse[zonedSecond{sec, zoneId}] = count
+	}
+
+	count.hits++
+	if class != -1 {
+		count.classes[class]++
+	}
+}
+
+func (c *secondCounter) each(fn func(sec int64, zoneId uint32, count *indexSecond)) {
+	for i := range c.dense {
+		if c.dense[i].hits > 0 {
+			fn(c.first+int64(i), 0, &c.dense[i])
+		}
+	}
+
+	for key, count := range c.sparse {
+		fn(key.sec, key.zoneId, count)
+	}
+}
+
+// Unix seconds of the first whole second not before t
+func ceilUnix(t time.Time) int64 {
+	if t.Nanosecond() > 0 {
+		return t.Unix() + 1
+	}
+
+	return t.Unix()
+}
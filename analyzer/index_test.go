@@ -0,0 +1,129 @@
+package analyzer
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/index"
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/uripath"
+	"github.com/Kostayne/go-nginx-analyzer/useragent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeIndex(t *testing.T) {
+	content := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET /users/1 HTTP/1.1" 200 100 "-" "Mozilla/5.0" "0.120"
+10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "POST /users/2 HTTP/1.1" 500 200 "-" "Mozilla/5.0" "1.500"
+not a log line
+10.0.0.2 - - [25/Dec/2023:12:31:45 +0200] "GET /about HTTP/1.1" 404 300 "https://example.com/" "Mozilla/5.0" "-"
+66.249.64.10 - - [25/Dec/2023:11:31:45 +0000] "GET /robots.txt HTTP/1.1" 200 400 "-" "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)" "0.010"
+10.0.0.3 - - [25/Dec/2023:11:32:45 +0000] "GET /users/3 HTTP/1.1" 301 0 "-" "curl/8.0" "0.002"
+`
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	indexPath := logPath + index.EXTENSION
+	require.NoError(t, os.WriteFile(logPath, []byte(content), 0644))
+
+	extraFields := []parser.ExtraField{parser.FIELD_REQUEST_TIME}
+	idx, err := index.BuildFile(logPath, extraFields, nil)
+	require.NoError(t, err)
+
+	file, err := os.Create(indexPath)
+	require.NoError(t, err)
+	require.NoError(t, idx.Write(file))
+	require.NoError(t, file.Close())
+
+	uris, err := uripath.New(uripath.Options{Auto: true})
+	require.NoError(t, err)
+
+	base := Options{
+		TopN:        10,
+		Desc:        true,
+		ExtraFields: extraFields,
+		UserAgents:  useragent.Default(),
+		Uris:        uris,
+		State:       true,
+	}
+
+	cases := map[string]func(opts *Options){
+		"no filters": func(opts *Options) {},
+		"dates by hour and status timeline": func(opts *Options) {
+			opts.DatesBy = "hour"
+			opts.StatusTimeline = true
+		},
+		"time range": func(opts *Options) {
+			opts.Since = time.Date(2023, 12, 25, 10, 31, 0, 0, time.UTC)
+			opts.Until = time.Date(2023, 12, 25, 11, 32, 45, 500, time.UTC)
+		},
+		"status, ip and uri": func(opts *Options) {
+			opts.Statuses = []StatusRange{{Min: 200, Max: 299}, {Min: 500, Max: 599}}
+			opts.Ip = netip.MustParseAddr("10.0.0.1")
+			opts.Uri = "/users/{id}"
+		},
+		"excluded bots": func(opts *Options) {
+			opts.ExcludeBots = true
+		},
+		"per request reports": func(opts *Options) {
+			opts.Rates = &RateOptions{}
+			opts.Metrics = true
+		},
+	}
+
+	for name, apply := range cases {
+		t.Run("should match the log analysis with "+name, func(t *testing.T) {
+			opts := base
+			apply(&opts)
+
+			expected, err := Analyze(logPath, opts)
+			require.NoError(t, err)
+
+			actual, err := Analyze(indexPath, opts)
+			require.NoError(t, err)
+
+			assert.Equal(t, expected.TotalRequests, actual.TotalRequests)
+			assert.Equal(t, expected.TotalBytes, actual.TotalBytes)
+			assert.Equal(t, expected.UniqueIPs, actual.UniqueIPs)
+			assert.Equal(t, expected.ProcessingStats, actual.ProcessingStats)
+			assert.Equal(t, expected.Latency, actual.Latency)
+			assert.True(t, expected.TimeRange.Start.Equal(actual.TimeRange.Start))
+			assert.True(t, expected.TimeRange.End.Equal(actual.TimeRange.End))
+			assert.ElementsMatch(t, expected.Ips, actual.Ips)
+			assert.ElementsMatch(t, expected.Uris, actual.Uris)
+			assert.ElementsMatch(t, expected.BotReports, actual.BotReports)
+
+			// metrics routes are in map order
+			if expected.State.Metrics != nil {
+				require.NotNil(t, actual.State.Metrics)
+				assert.ElementsMatch(t, expected.State.Metrics.Routes, actual.State.Metrics.Routes)
+				expected.State.Metrics.Routes, actual.State.Metrics.Routes = nil, nil
+			}
+			assert.Equal(t, expected.State, actual.State)
+		})
+	}
+
+	t.Run("should count parse errors of the log", func(t *testing.T) {
+		res := AnalyzeIndex(idx, base)
+
+		assert.Equal(t, uint64(1), res.ProcessingStats.ParseErrors)
+		assert.Equal(t, int64(len(content)), res.ProcessingStats.FileSize)
+	})
+
+	t.Run("should reopen a rewritten index", func(t *testing.T) {
+		rewritten := index.NewBuilder(logPath, 0).Index(false)
+
+		file, err := os.Create(indexPath)
+		require.NoError(t, err)
+		require.NoError(t, rewritten.Write(file))
+		require.NoError(t, file.Close())
+		require.NoError(t, os.Chtimes(indexPath, time.Now(), time.Now().Add(time.Hour)))
+
+		res, err := Analyze(indexPath, base)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), res.TotalRequests)
+	})
+}
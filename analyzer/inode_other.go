@@ -0,0 +1,10 @@
+//go:build !unix
+
+package analyzer
+
+import "os"
+
+// Inodes aren't available, rotation is detected by size and the first line
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,117 @@
+package analyzer
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// Latency histogram buckets grow by 10%, so percentiles are off by 10% at most
+const LATENCY_BUCKET_GROWTH = 1.1
+const LATENCY_MIN = time.Millisecond
+const LATENCY_MAX = 10 * time.Minute
+
+// Upper bounds of latency histogram buckets, the last bucket has no bound
+var latencyBounds = func() []time.Duration {
+	bounds := []time.Duration{LATENCY_MIN}
+	for bounds[len(bounds)-1] < LATENCY_MAX {
+		next := time.Duration(float64(bounds[len(bounds)-1]) * LATENCY_BUCKET_GROWTH)
+		bounds = append(bounds, next.Round(time.Microsecond))
+	}
+
+	return bounds
+}()
+
+type LatencyStats struct {
+	// Requests with logged request time
+	Requests uint64        `json:"requests"`
+	Avg      time.Duration `json:"avg"`
+	P50      time.Duration `json:"p50"`
+	P95      time.Duration `json:"p95"`
+	P99      time.Duration `json:"p99"`
+	Max      time.Duration `json:"max"`
+}
+
+type latencyHistogram struct {
+	counts []uint64
+	total  time.Duration
+	max    time.Duration
+}
+
+func (h *latencyHistogram) add(latency time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBounds)+1)
+	}
+
+	i, _ := slices.BinarySearch(latencyBounds, latency)
+	h.counts[i]++
+	h.total += latency
+	h.max = max(h.max, latency)
+}
+
+func (h *latencyHistogram) merge(other *latencyHistogram) {
+	if other.counts == nil {
+		return
+	}
+
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBounds)+1)
+	}
+
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.total += other.total
+	h.max = max(h.max, other.max)
+}
+
+func (h *latencyHistogram) reset() {
+	clear(h.counts)
+	h.total = 0
+	h.max = 0
+}
+
+func (h *latencyHistogram) requests() uint64 {
+	requests := uint64(0)
+	for _, count := range h.counts {
+		requests += count
+	}
+
+	return requests
+}
+
+// Upper bound of the bucket holding the nearest rank p-th percentile, capped by the max latency
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	rank := max(uint64(math.Ceil(p/100*float64(h.requests()))), 1)
+
+	seen := uint64(0)
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			if i == len(latencyBounds) {
+				return h.max
+			}
+
+			return min(latencyBounds[i], h.max)
+		}
+	}
+
+	return h.max
+}
+
+// Nil when no request had its time logged
+func (h *latencyHistogram) stats() *LatencyStats {
+	requests := h.requests()
+	if requests == 0 {
+		return nil
+	}
+
+	return &LatencyStats{
+		Requests: requests,
+		Avg:      h.total / time.Duration(requests),
+		P50:      h.percentile(50),
+		P95:      h.percentile(95),
+		P99:      h.percentile(99),
+		Max:      h.max,
+	}
+}
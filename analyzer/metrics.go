@@ -0,0 +1,183 @@
+package analyzer
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// Methods kept as metric labels, others are counted as METHOD_OTHER
+var METRIC_METHODS = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "PATCH", "OPTIONS", "CONNECT", "TRACE"}
+
+const METHOD_OTHER = "OTHER"
+
+// Status class label of invalid codes
+const CLASS_OTHER = "other"
+
+// Upper bounds of request duration histograms, the Prometheus client defaults
+var DURATION_BUCKETS = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// Requests and response bytes of a route, method and status class
+type RouteCounts struct {
+	Route    string `json:"route"`
+	Method   string `json:"method"`
+	Class    string `json:"class"`
+	Requests uint64 `json:"requests"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+// Counts are per DURATION_BUCKETS bucket, not cumulative, the last one has no bound
+type DurationHistogram struct {
+	Counts []uint64      `json:"counts"`
+	Sum    time.Duration `json:"sum"`
+}
+
+// Counters behind the metrics exporter, routes are normalized uris without the query
+type MetricsState struct {
+	Routes []RouteCounts `json:"routes"`
+
+	// Set when request_time is logged
+	Durations map[string]*DurationHistogram `json:"durations,omitempty"`
+}
+
+type routeKey struct {
+	route  string
+	method string
+	class  string
+}
+
+type routeCounts struct {
+	requests uint64
+	bytes    uint64
+}
+
+func newDurationHistogram() *DurationHistogram {
+	return &DurationHistogram{Counts: make([]uint64, len(DURATION_BUCKETS)+1)}
+}
+
+func (h *DurationHistogram) add(duration time.Duration) {
+	i, _ := slices.BinarySearch(DURATION_BUCKETS, duration)
+	h.Counts[i]++
+	h.Sum += duration
+}
+
+func (h *DurationHistogram) merge(other *DurationHistogram) {
+	for i, count := range other.Counts {
+		h.Counts[i] += count
+	}
+	h.Sum += other.Sum
+}
+
+// Requests of the histogram
+func (h *DurationHistogram) Count() uint64 {
+	count := uint64(0)
+	for _, c := range h.Counts {
+		count += c
+	}
+
+	return count
+}
+
+func metricRoute(uri string) string {
+	route, _, _ := strings.Cut(uri, "?")
+	return route
+}
+
+func metricMethod(method string) string {
+	if slices.Contains(METRIC_METHODS, method) {
+		return method
+	}
+
+	return METHOD_OTHER
+}
+
+func metricClass(code uint16) string {
+	class := statusClass(code)
+	if class == -1 {
+		return CLASS_OTHER
+	}
+
+	return STATUS_CLASSES[class]
+}
+
+// Methods and classes are bounded here, routes are bounded by the exporter
+func (agg *aggregator) addMetrics(entry *parser.LogEntry, params ProcessParams) {
+	key := routeKey{route: metricRoute(entry.Uri), method: metricMethod(entry.Method), class: metricClass(entry.StatusCode)}
+
+	counts := agg.routes[key]
+	counts.requests++
+	counts.bytes += uint64(entry.RespBytes)
+	agg.routes[key] = counts
+
+	if params.RequestTime && entry.RequestTime != parser.NO_REQUEST_TIME {
+		histogram, ok := agg.durations[key.route]
+		if !ok {
+			histogram = newDurationHistogram()
+			agg.durations[key.route] = histogram
+		}
+		histogram.add(entry.RequestTime)
+	}
+}
+
+func mergeRoutes(dst, src map[routeKey]routeCounts) {
+	for key, counts := range src {
+		own := dst[key]
+		own.requests += counts.requests
+		own.bytes += counts.bytes
+		dst[key] = own
+	}
+}
+
+func mergeDurations(dst, src map[string]*DurationHistogram) {
+	for route, histogram := range src {
+		own, ok := dst[route]
+		if !ok {
+			own = newDurationHistogram()
+			dst[route] = own
+		}
+		own.merge(histogram)
+	}
+}
+
+// Nil when no request was counted
+func (agg *aggregator) metricsState() *MetricsState {
+	if len(agg.routes) == 0 {
+		return nil
+	}
+
+	state := &MetricsState{Routes: make([]RouteCounts, 0, len(agg.routes))}
+	for key, counts := range agg.routes {
+		state.Routes = append(state.Routes, RouteCounts{
+			Route:    key.route,
+			Method:   key.method,
+			Class:    key.class,
+			Requests: counts.requests,
+			Bytes:    counts.bytes,
+		})
+	}
+
+	if len(agg.durations) > 0 {
+		state.Durations = make(map[string]*DurationHistogram, len(agg.durations))
+		mergeDurations(state.Durations, agg.durations)
+	}
+
+	return state
+}
+
+func (agg *aggregator) addMetricsState(state *MetricsState) {
+	for _, counts := range state.Routes {
+		key := routeKey{route: counts.Route, method: counts.Method, class: counts.Class}
+		own := agg.routes[key]
+		own.requests += counts.Requests
+		own.bytes += counts.Bytes
+		agg.routes[key] = own
+	}
+
+	mergeDurations(agg.durations, state.Durations)
+}
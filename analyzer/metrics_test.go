@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeMetrics(t *testing.T) {
+	testData := `10.0.0.1 - - [25/Dec/2023:10:00:00 +0000] "GET /search?q=a HTTP/1.1" 200 100 "-" "Mozilla/5.0" "0.004"
+10.0.0.1 - - [25/Dec/2023:10:01:00 +0000] "GET /search?q=b HTTP/1.1" 200 50 "-" "Mozilla/5.0" "0.300"
+10.0.0.2 - - [25/Dec/2023:10:02:00 +0000] "PROPFIND /search HTTP/1.1" 405 10 "-" "curl/8.0" "-"
+10.0.0.2 - - [25/Dec/2023:10:03:00 +0000] "POST /login HTTP/1.1" 500 20 "-" "curl/8.0" "12.000"
+`
+
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(logPath, []byte(testData), 0644))
+
+	opts := Options{TopN: 10, Desc: true, State: true, Metrics: true, ExtraFields: []parser.ExtraField{parser.FIELD_REQUEST_TIME}}
+	res, err := Analyze(logPath, opts)
+	require.NoError(t, err)
+	require.NotNil(t, res.State.Metrics)
+
+	t.Run("should count routes without the query by method and class", func(t *testing.T) {
+		assert.ElementsMatch(t, []RouteCounts{
+			{Route: "/search", Method: "GET", Class: "2xx", Requests: 2, Bytes: 150},
+			{Route: "/search", Method: METHOD_OTHER, Class: "4xx", Requests: 1, Bytes: 10},
+			{Route: "/login", Method: "POST", Class: "5xx", Requests: 1, Bytes: 20},
+		}, res.State.Metrics.Routes)
+	})
+
+	t.Run("should keep duration histograms of logged request times", func(t *testing.T) {
+		search := res.State.Metrics.Durations["/search"]
+		require.NotNil(t, search)
+		assert.Equal(t, uint64(2), search.Count())
+		assert.Equal(t, uint64(1), search.Counts[0])
+		assert.Equal(t, 304*time.Millisecond, search.Sum)
+
+		// beyond the last bound
+		assert.Equal(t, uint64(1), res.State.Metrics.Durations["/login"].Counts[len(DURATION_BUCKETS)])
+	})
+
+	t.Run("should merge metrics of saved results", func(t *testing.T) {
+		merged, err := MergeSaved([]*AnalyzeResult{res, res}, MergeParams{TopN: 10, Desc: true, State: true})
+		require.NoError(t, err)
+
+		assert.Contains(t, merged.State.Metrics.Routes, RouteCounts{Route: "/search", Method: "GET", Class: "2xx", Requests: 4, Bytes: 300})
+		assert.Equal(t, uint64(4), merged.State.Metrics.Durations["/search"].Count())
+	})
+
+	t.Run("should skip metrics without the option", func(t *testing.T) {
+		res, err := Analyze(logPath, Options{TopN: 10, Desc: true, State: true})
+		require.NoError(t, err)
+		assert.Nil(t, res.State.Metrics)
+	})
+}
@@ -0,0 +1,209 @@
+package analyzer
+
+import (
+	"cmp"
+	"math"
+	"net/netip"
+	"slices"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// Length of the sliding window of per minute rates in seconds
+const RATE_WINDOW = 60
+
+type RateOptions struct {
+	// Share of clients the suggested limit_req values may throttle, in percents
+	ThrottlePercent float64 `json:"throttlePercent"`
+}
+
+type RateReport struct {
+	Clients uint64 `json:"clients"`
+
+	// Distribution of per client peaks
+	PeakRps RateDistribution `json:"peakRps"`
+	PeakRpm RateDistribution `json:"peakRpm"`
+
+	// Clients with the highest peak requests per second
+	TopBursting []ClientRate `json:"topBursting"`
+
+	Suggestion LimitReqSuggestion `json:"suggestion"`
+}
+
+type RateDistribution struct {
+	P50 uint64 `json:"p50"`
+	P90 uint64 `json:"p90"`
+	P99 uint64 `json:"p99"`
+	Max uint64 `json:"max"`
+}
+
+type ClientRate struct {
+	Ip       netip.Addr `json:"ip"`
+	Requests uint64     `json:"requests"`
+
+	// Max requests during a single second
+	PeakRps uint64 `json:"peakRps"`
+
+	// Max requests during any 60 seconds window
+	PeakRpm uint64 `json:"peakRpm"`
+}
+
+// limit_req values which would have throttled about the chosen share of clients
+type LimitReqSuggestion struct {
+	// Requests per minute, the limit_req_zone rate in "r/m"
+	Rate  uint64 `json:"rate"`
+	Burst uint64 `json:"burst"`
+
+	ThrottledClients uint64  `json:"throttledClients"`
+	ThrottledPercent float64 `json:"throttledPercent"`
+}
+
+// Requests of a client during a single second
+type clientSecond struct {
+	ip     netip.Addr
+	second int64
+}
+
+type secondCount struct {
+	second   int64
+	requests uint64
+}
+
+func (agg *aggregator) addSecond(entry *parser.LogEntry) {
+	agg.seconds[clientSecond{ip: entry.Ip, second: entry.Date.Unix()}]++
+}
+
+func rateReport(seconds map[clientSecond]uint64, topN int, opts RateOptions) *RateReport {
+	timelines := make(map[netip.Addr][]secondCount)
+	for key, requests := range seconds {
+		timelines[key.ip] = append(timelines[key.ip], secondCount{second: key.second, requests: requests})
+	}
+
+	clients := make([]ClientRate, 0, len(timelines))
+	for ip, timeline := range timelines {
+		slices.SortFunc(timeline, func(a, b secondCount) int {
+			return cmp.Compare(a.second, b.second)
+		})
+
+		client := ClientRate{Ip: ip}
+		var windowRequests uint64
+		windowStart := 0
+
+		for _, sc := range timeline {
+			client.Requests += sc.requests
+			client.PeakRps = max(client.PeakRps, sc.requests)
+
+			windowRequests += sc.requests
+			for timeline[windowStart].second <= sc.second-RATE_WINDOW {
+				windowRequests -= timeline[windowStart].requests
+				windowStart++
+			}
+			client.PeakRpm = max(client.PeakRpm, windowRequests)
+		}
+
+		clients = append(clients, client)
+	}
+
+	report := &RateReport{
+		Clients: uint64(len(clients)),
+		PeakRps: distribution(clients, func(c ClientRate) uint64 { return c.PeakRps }),
+		PeakRpm: distribution(clients, func(c ClientRate) uint64 { return c.PeakRpm }),
+	}
+
+	report.Suggestion = suggestLimitReq(clients, timelines, opts.ThrottlePercent)
+
+	slices.SortFunc(clients, func(a, b ClientRate) int {
+		if a.PeakRps != b.PeakRps {
+			return getSortCompareResultAsc(b.PeakRps, a.PeakRps)
+		}
+
+		return getSortCompareResultAsc(b.PeakRpm, a.PeakRpm)
+	})
+	report.TopBursting = clients[:min(len(clients), topN)]
+
+	return report
+}
+
+func distribution(clients []ClientRate, value func(ClientRate) uint64) RateDistribution {
+	values := make([]uint64, 0, len(clients))
+	for _, client := range clients {
+		values = append(values, value(client))
+	}
+	slices.Sort(values)
+
+	return RateDistribution{
+		P50: percentile(values, 50),
+		P90: percentile(values, 90),
+		P99: percentile(values, 99),
+		Max: percentile(values, 100),
+	}
+}
+
+// Nearest rank percentile of sorted values
+func percentile(sorted []uint64, p float64) uint64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank-1, 0), len(sorted)-1)]
+}
+
+// Rate is the percentile of peak per minute rates, burst is the percentile of
+// bursts clients need at that rate, so only the busiest share of clients is throttled
+func suggestLimitReq(clients []ClientRate, timelines map[netip.Addr][]secondCount, throttlePercent float64) LimitReqSuggestion {
+	if len(clients) == 0 {
+		return LimitReqSuggestion{}
+	}
+
+	p := 100 - throttlePercent
+
+	peaks := make([]uint64, 0, len(clients))
+	for _, client := range clients {
+		peaks = append(peaks, client.PeakRpm)
+	}
+	slices.Sort(peaks)
+	rate := max(percentile(peaks, p), 1)
+
+	bursts := make([]uint64, 0, len(clients))
+	for _, timeline := range timelines {
+		bursts = append(bursts, requiredBurst(timeline, rate))
+	}
+	slices.Sort(bursts)
+	burst := percentile(bursts, p)
+
+	throttled := uint64(0)
+	for _, needed := range bursts {
+		if needed > burst {
+			throttled++
+		}
+	}
+
+	return LimitReqSuggestion{
+		Rate:             rate,
+		Burst:            burst,
+		ThrottledClients: throttled,
+		ThrottledPercent: float64(throttled) / float64(len(clients)) * 100,
+	}
+}
+
+// Smallest limit_req burst which lets every request of the timeline through.
+// Follows the nginx leaky bucket: the excess drains at the rate and grows by one
+// per request, it's never negative and the first request of a client has zero excess.
+func requiredBurst(timeline []secondCount, ratePerMinute uint64) uint64 {
+	ratePerSecond := float64(ratePerMinute) / 60
+	excess := -1.0
+	maxExcess := 0.0
+
+	for i, sc := range timeline {
+		if i > 0 {
+			excess -= ratePerSecond * float64(sc.second-timeline[i-1].second)
+		}
+
+		// requests of the same second arrive at once
+		excess = max(excess+1, 0) + float64(sc.requests-1)
+		maxExcess = max(maxExcess, excess)
+	}
+
+	return uint64(math.Ceil(maxExcess - 1e-9))
+}
@@ -0,0 +1,69 @@
+package analyzer
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredBurst(t *testing.T) {
+	t.Run("should need no burst for requests within the rate", func(t *testing.T) {
+		timeline := make([]secondCount, 0, 60)
+		for i := range 60 {
+			timeline = append(timeline, secondCount{second: int64(i), requests: 1})
+		}
+
+		assert.Equal(t, uint64(0), requiredBurst(timeline, 60))
+		assert.Equal(t, uint64(30), requiredBurst(timeline, 30))
+	})
+
+	t.Run("should need a burst for simultaneous requests", func(t *testing.T) {
+		timeline := []secondCount{{second: 0, requests: 10}}
+
+		assert.Equal(t, uint64(9), requiredBurst(timeline, 60))
+	})
+
+	t.Run("should drain the excess between requests", func(t *testing.T) {
+		timeline := []secondCount{{second: 0, requests: 5}, {second: 2, requests: 5}}
+
+		// 4 after the first second, 4 - 2 + 5 after the third one
+		assert.Equal(t, uint64(7), requiredBurst(timeline, 60))
+	})
+}
+
+func TestPercentile(t *testing.T) {
+	values := []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	assert.Equal(t, uint64(5), percentile(values, 50))
+	assert.Equal(t, uint64(10), percentile(values, 99))
+	assert.Equal(t, uint64(10), percentile(values, 100))
+	assert.Equal(t, uint64(1), percentile(values, 0))
+	assert.Equal(t, uint64(0), percentile(nil, 50))
+}
+
+func TestRateReport(t *testing.T) {
+	seconds := make(map[clientSecond]uint64)
+
+	// 99 clients with a request per second during a minute
+	for i := range 99 {
+		ip := netip.AddrFrom4([4]byte{10, 0, 0, byte(i)})
+		for second := range 60 {
+			seconds[clientSecond{ip: ip, second: int64(second)}] = 1
+		}
+	}
+
+	// a single client bursting 100 requests twice
+	burster := netip.MustParseAddr("203.0.113.7")
+	seconds[clientSecond{ip: burster, second: 0}] = 100
+	seconds[clientSecond{ip: burster, second: 90}] = 100
+
+	report := rateReport(seconds, 2, RateOptions{ThrottlePercent: 1})
+
+	assert.Equal(t, uint64(100), report.Clients)
+	assert.Equal(t, RateDistribution{P50: 1, P90: 1, P99: 1, Max: 100}, report.PeakRps)
+	assert.Equal(t, RateDistribution{P50: 60, P90: 60, P99: 60, Max: 100}, report.PeakRpm)
+	assert.Equal(t, ClientRate{Ip: burster, Requests: 200, PeakRps: 100, PeakRpm: 100}, report.TopBursting[0])
+	assert.Len(t, report.TopBursting, 2)
+	assert.Equal(t, LimitReqSuggestion{Rate: 60, Burst: 0, ThrottledClients: 1, ThrottledPercent: 1}, report.Suggestion)
+}
@@ -0,0 +1,128 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+)
+
+// Nice timeseries buckets, AutoBucket picks the smallest one fitting the time range
+var AUTO_BUCKETS = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 3 * time.Hour, 6 * time.Hour, 24 * time.Hour,
+}
+
+// Limit of a single timeseries
+const MAX_BUCKETS = 100000
+
+// Requests of a bucket by status class
+type StatusBucket struct {
+	Start   time.Time         `json:"start"`
+	Classes map[string]uint64 `json:"classes"`
+}
+
+// Requests per bucket in time order, empty buckets included. Counted from the
+// status timeline when the result has one, so dates may be grouped coarser.
+func Traffic(state *ResultState, bucket time.Duration) ([]HitsInfo[time.Time], error) {
+	seconds := make(map[int64]uint64, max(len(state.ClassSeconds), len(state.Dates)))
+	if len(state.ClassSeconds) > 0 {
+		for second, counts := range state.ClassSeconds {
+			for _, count := range counts {
+				seconds[second] += count
+			}
+		}
+	} else {
+		for date, hits := range state.Dates {
+			seconds[date.Unix()] += hits
+		}
+	}
+
+	starts, counts, err := bucketize(seconds, bucket, func(dst *uint64, hits uint64) { *dst += hits })
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]HitsInfo[time.Time], 0, len(starts))
+	for _, start := range starts {
+		series = append(series, HitsInfo[time.Time]{Key: time.Unix(start, 0).UTC(), Hits: counts[start]})
+	}
+
+	return series, nil
+}
+
+// Requests per bucket and status class in time order, empty buckets included.
+// Requires the result to be analyzed with StatusTimeline.
+func StatusClasses(state *ResultState, bucket time.Duration) ([]StatusBucket, error) {
+	starts, counts, err := bucketize(state.ClassSeconds, bucket, func(dst *ClassCounts, counts ClassCounts) {
+		for i, count := range counts {
+			dst[i] += count
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]StatusBucket, 0, len(starts))
+	for _, start := range starts {
+		classes := make(map[string]uint64, len(STATUS_CLASSES))
+		for i, class := range STATUS_CLASSES {
+			classes[class] = counts[start][i]
+		}
+
+		series = append(series, StatusBucket{Start: time.Unix(start, 0).UTC(), Classes: classes})
+	}
+
+	return series, nil
+}
+
+// Smallest of AUTO_BUCKETS splitting the time range into less than maxBuckets
+func AutoBucket(timeRange TimeRange, maxBuckets int) time.Duration {
+	span := timeRange.End.Sub(timeRange.Start)
+
+	for _, bucket := range AUTO_BUCKETS {
+		if span/bucket < time.Duration(maxBuckets) {
+			return bucket
+		}
+	}
+
+	return AUTO_BUCKETS[len(AUTO_BUCKETS)-1]
+}
+
+// Sums per unix second values into buckets aligned to the unix epoch.
+// Returns starts of every bucket between the first and the last value.
+func bucketize[V any](seconds map[int64]V, bucket time.Duration, add func(dst *V, value V)) ([]int64, map[int64]V, error) {
+	step := int64(bucket / time.Second)
+	if step < 1 {
+		return nil, nil, fmt.Errorf("bucket must be at least 1s")
+	}
+
+	counts := make(map[int64]V)
+	first, last := int64(0), int64(0)
+
+	for second, value := range seconds {
+		start := second - ((second%step)+step)%step
+		if len(counts) == 0 || start < first {
+			first = start
+		}
+		if len(counts) == 0 || start > last {
+			last = start
+		}
+
+		own := counts[start]
+		add(&own, value)
+		counts[start] = own
+	}
+
+	if len(counts) == 0 {
+		return []int64{}, counts, nil
+	}
+
+	if (last-first)/step+1 > MAX_BUCKETS {
+		return nil, nil, fmt.Errorf("more than %d buckets, use a bigger bucket or a shorter range", MAX_BUCKETS)
+	}
+
+	starts := make([]int64, 0, (last-first)/step+1)
+	for start := first; start <= last; start += step {
+		starts = append(starts, start)
+	}
+
+	return starts, counts, nil
+}
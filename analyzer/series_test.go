@@ -0,0 +1,60 @@
+package analyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraffic(t *testing.T) {
+	start := time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC)
+	state := &ResultState{Dates: map[time.Time]uint64{
+		start:                       2,
+		start.Add(time.Minute):      1,
+		start.Add(25 * time.Minute): 3,
+	}}
+
+	t.Run("should bucket requests with empty buckets included", func(t *testing.T) {
+		series, err := Traffic(state, 10*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, []HitsInfo[time.Time]{
+			{Key: start, Hits: 3},
+			{Key: start.Add(10 * time.Minute), Hits: 0},
+			{Key: start.Add(20 * time.Minute), Hits: 3},
+		}, series)
+	})
+
+	t.Run("should count the status timeline over grouped dates", func(t *testing.T) {
+		state := &ResultState{
+			Dates:        map[time.Time]uint64{start.Truncate(time.Hour): 3},
+			ClassSeconds: map[int64]ClassCounts{start.Unix(): {0, 1, 0, 0, 1}, start.Add(25 * time.Minute).Unix(): {0, 1}},
+		}
+
+		series, err := Traffic(state, 10*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, []HitsInfo[time.Time]{
+			{Key: start, Hits: 2},
+			{Key: start.Add(10 * time.Minute), Hits: 0},
+			{Key: start.Add(20 * time.Minute), Hits: 1},
+		}, series)
+	})
+
+	t.Run("should reject too many buckets", func(t *testing.T) {
+		state := &ResultState{Dates: map[time.Time]uint64{start: 1, start.AddDate(10, 0, 0): 1}}
+		_, err := Traffic(state, time.Second)
+		assert.Error(t, err)
+	})
+}
+
+func TestAutoBucket(t *testing.T) {
+	t.Run("should keep the amount of buckets readable", func(t *testing.T) {
+		start := time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC)
+
+		assert.Equal(t, time.Minute, AutoBucket(TimeRange{Start: start, End: start.Add(30 * time.Minute)}, 120))
+		assert.Equal(t, 15*time.Minute, AutoBucket(TimeRange{Start: start, End: start.Add(24 * time.Hour)}, 120))
+		assert.Equal(t, time.Hour, AutoBucket(TimeRange{Start: start, End: start.Add(24 * time.Hour)}, 60))
+		assert.Equal(t, 24*time.Hour, AutoBucket(TimeRange{Start: start, End: start.AddDate(1, 0, 0)}, 120))
+	})
+}
@@ -0,0 +1,181 @@
+package analyzer
+
+import (
+	"cmp"
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// Inactivity after which the next request of a visitor starts a new session
+const DEFAULT_SESSION_TIMEOUT = 30 * time.Minute
+
+// Extensions of static files requested by pages, they aren't page views
+var STATIC_EXTENSIONS = []string{
+	".css", ".js", ".mjs", ".map", ".json", ".xml", ".txt",
+	".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".avif", ".ico", ".bmp",
+	".woff", ".woff2", ".ttf", ".otf", ".eot",
+	".mp4", ".webm", ".mp3", ".ogg", ".wav",
+	".pdf", ".zip", ".gz",
+}
+
+type SessionOptions struct {
+	// Inactivity timeout, DEFAULT_SESSION_TIMEOUT when zero
+	Timeout time.Duration `json:"timeout"`
+
+	// Counts static files as page views
+	Assets bool `json:"assets"`
+}
+
+type SessionReport struct {
+	Sessions uint64 `json:"sessions"`
+	Visitors uint64 `json:"visitors"`
+
+	// Seconds between the first and the last page view of a session
+	Duration SessionDistribution `json:"duration"`
+
+	// Page views per session
+	Depth SessionDistribution `json:"depth"`
+
+	// Share of single page sessions in percents
+	BounceRate float64 `json:"bounceRate"`
+
+	EntryPages []HitsInfo[string] `json:"entryPages"`
+	ExitPages  []HitsInfo[string] `json:"exitPages"`
+}
+
+type SessionDistribution struct {
+	Avg float64 `json:"avg"`
+	P50 uint64  `json:"p50"`
+	P90 uint64  `json:"p90"`
+	P99 uint64  `json:"p99"`
+	Max uint64  `json:"max"`
+}
+
+// A visitor is a client ip with its user agent, clients behind a NAT
+// are told apart by their browsers
+type visitor struct {
+	ip        netip.Addr
+	userAgent string
+}
+
+type pageView struct {
+	second int64
+	uri    string
+}
+
+func (agg *aggregator) addPageView(entry *parser.LogEntry, assets bool) {
+	if !assets && isStaticAsset(entry.Uri) {
+		return
+	}
+
+	key := visitor{ip: entry.Ip, userAgent: entry.UserAgent}
+	agg.pageViews[key] = append(agg.pageViews[key], pageView{second: entry.Date.Unix(), uri: entry.Uri})
+}
+
+func isStaticAsset(uri string) bool {
+	p, _, _ := strings.Cut(uri, "?")
+	ext := strings.ToLower(path.Ext(p))
+
+	return ext != "" && slices.Contains(STATIC_EXTENSIONS, ext)
+}
+
+func mergePageViews(dst, src map[visitor][]pageView) {
+	for key, views := range src {
+		if own, ok := dst[key]; ok {
+			dst[key] = append(own, views...)
+		} else {
+			dst[key] = views
+		}
+	}
+}
+
+// Workers append their chunks in any order, views of a chunk keep the log
+// order and stable sorting keeps it within a second
+func sortPageViews(pageViews map[visitor][]pageView) {
+	for _, views := range pageViews {
+		slices.SortStableFunc(views, func(a, b pageView) int {
+			return cmp.Compare(a.second, b.second)
+		})
+	}
+}
+
+// Configured inactivity timeout in seconds, DEFAULT_SESSION_TIMEOUT when unset
+func (opts SessionOptions) timeoutSeconds() int64 {
+	if opts.Timeout == 0 {
+		return int64(DEFAULT_SESSION_TIMEOUT / time.Second)
+	}
+
+	return int64(opts.Timeout / time.Second)
+}
+
+// Page views of every visitor, sorted by time, are split into sessions
+// on gaps longer than the timeout
+func sessionReport(pageViews map[visitor][]pageView, topN int, opts SessionOptions) *SessionReport {
+	timeout := opts.timeoutSeconds()
+
+	var durations, depths []uint64
+	entries := make(map[string]uint64)
+	exits := make(map[string]uint64)
+	bounces := uint64(0)
+
+	for _, views := range pageViews {
+		start := 0
+		for i := 1; i <= len(views); i++ {
+			if i < len(views) && views[i].second-views[i-1].second <= timeout {
+				continue
+			}
+
+			session := views[start:i]
+			durations = append(durations, uint64(session[len(session)-1].second-session[0].second))
+			depths = append(depths, uint64(len(session)))
+			entries[session[0].uri]++
+			exits[session[len(session)-1].uri]++
+			if len(session) == 1 {
+				bounces++
+			}
+
+			start = i
+		}
+	}
+
+	report := &SessionReport{
+		Sessions:   uint64(len(depths)),
+		Visitors:   uint64(len(pageViews)),
+		Duration:   sessionDistribution(durations),
+		Depth:      sessionDistribution(depths),
+		EntryPages: *getHitsInfo(entries, topN, true),
+		ExitPages:  *getHitsInfo(exits, topN, true),
+	}
+
+	if report.Sessions > 0 {
+		report.BounceRate = float64(bounces) / float64(report.Sessions) * 100
+	}
+
+	return report
+}
+
+func sessionDistribution(values []uint64) SessionDistribution {
+	if len(values) == 0 {
+		return SessionDistribution{}
+	}
+
+	slices.Sort(values)
+
+	sum := uint64(0)
+	for _, value := range values {
+		sum += value
+	}
+
+	return SessionDistribution{
+		Avg: float64(sum) / float64(len(values)),
+		P50: percentile(values, 50),
+		P90: percentile(values, 90),
+		P99: percentile(values, 99),
+		Max: percentile(values, 100),
+	}
+}
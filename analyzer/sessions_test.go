@@ -0,0 +1,89 @@
+package analyzer
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsStaticAsset(t *testing.T) {
+	t.Run("should detect static files by extension", func(t *testing.T) {
+		assert.True(t, isStaticAsset("/static/app.js"))
+		assert.True(t, isStaticAsset("/img/Logo.PNG?v=3"))
+		assert.False(t, isStaticAsset("/products"))
+		assert.False(t, isStaticAsset("/blog/post.html"))
+		assert.False(t, isStaticAsset("/search?q=a.css"))
+	})
+}
+
+func TestSessionReport(t *testing.T) {
+	start := time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC).Unix()
+	alice := visitor{ip: netip.MustParseAddr("10.0.0.1"), userAgent: "Firefox"}
+	bob := visitor{ip: netip.MustParseAddr("10.0.0.1"), userAgent: "Chrome"}
+
+	pageViews := map[visitor][]pageView{
+		// out of order, as workers append their chunks
+		alice: {
+			{second: start + 60, uri: "/products"},
+			{second: start, uri: "/"},
+			{second: start + 120, uri: "/checkout"},
+			{second: start + 3600, uri: "/"},
+		},
+		bob: {
+			{second: start, uri: "/"},
+		},
+	}
+
+	sortPageViews(pageViews)
+	report := sessionReport(pageViews, 10, SessionOptions{})
+
+	t.Run("should split sessions on inactivity", func(t *testing.T) {
+		assert.Equal(t, uint64(3), report.Sessions)
+		assert.Equal(t, uint64(2), report.Visitors)
+		assert.Equal(t, SessionDistribution{Avg: 40, P50: 0, P90: 120, P99: 120, Max: 120}, report.Duration)
+		assert.Equal(t, SessionDistribution{Avg: 5.0 / 3, P50: 1, P90: 3, P99: 3, Max: 3}, report.Depth)
+	})
+
+	t.Run("should report bounces, entry and exit pages", func(t *testing.T) {
+		assert.InDelta(t, 200.0/3, report.BounceRate, 1e-9)
+		assert.Equal(t, []HitsInfo[string]{{Key: "/", Hits: 3}}, report.EntryPages)
+		assert.ElementsMatch(t, []HitsInfo[string]{{Key: "/", Hits: 2}, {Key: "/checkout", Hits: 1}}, report.ExitPages)
+	})
+
+	t.Run("should use the timeout", func(t *testing.T) {
+		report := sessionReport(pageViews, 10, SessionOptions{Timeout: 2 * time.Hour})
+		assert.Equal(t, uint64(2), report.Sessions)
+	})
+}
+
+func TestAnalyzeSessions(t *testing.T) {
+	t.Run("should reconstruct sessions skipping static files", func(t *testing.T) {
+		testData := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 100 "-" "Firefox"
+10.0.0.1 - - [25/Dec/2023:10:30:46 +0000] "GET /static/app.css HTTP/1.1" 200 100 "-" "Firefox"
+10.0.0.1 - - [25/Dec/2023:10:31:45 +0000] "GET /products/42 HTTP/1.1" 200 100 "-" "Firefox"
+10.0.0.2 - - [25/Dec/2023:10:32:45 +0000] "GET /about HTTP/1.1" 200 100 "-" "Chrome"
+10.0.0.2 - - [25/Dec/2023:10:32:46 +0000] "GET /favicon.ico HTTP/1.1" 200 100 "-" "Chrome"
+`
+
+		fpath := filepath.Join(t.TempDir(), "access.log")
+		require.NoError(t, os.WriteFile(fpath, []byte(testData), 0644))
+
+		res, err := Analyze(fpath, Options{TopN: 10, Desc: true, Sessions: &SessionOptions{}})
+		require.NoError(t, err)
+		require.NotNil(t, res.Sessions)
+
+		assert.Equal(t, uint64(2), res.Sessions.Sessions)
+		assert.Equal(t, uint64(2), res.Sessions.Depth.Max)
+		assert.Equal(t, float64(50), res.Sessions.BounceRate)
+
+		res, err = Analyze(fpath, Options{TopN: 10, Desc: true, Sessions: &SessionOptions{Assets: true}})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), res.Sessions.Depth.Max)
+		assert.Equal(t, float64(0), res.Sessions.BounceRate)
+	})
+}
@@ -0,0 +1,165 @@
+package analyzer
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"time"
+)
+
+// Version of the saved result schema, bumped on incompatible changes of ResultState
+const RESULT_VERSION = 1
+
+// Full counters behind the top lists of a result, so saved results
+// of different logs can be merged and re-ranked
+type ResultState struct {
+	DatesBy     string                `json:"datesBy"`
+	Ips         map[netip.Addr]uint64 `json:"ips"`
+	RemoteAddrs map[netip.Addr]uint64 `json:"remoteAddrs,omitempty"`
+	Codes       map[uint16]uint64     `json:"codes"`
+	Dates       map[time.Time]uint64  `json:"dates"`
+	Uris        map[string]uint64     `json:"uris"`
+	UserAgents  map[string]uint64     `json:"userAgents"`
+	Latency     *LatencyState         `json:"latency,omitempty"`
+
+	// Bot reports by bot name, set when user agents are classified
+	Bots map[string]*BotState `json:"bots,omitempty"`
+
+	// Status classes per unix second, set when the status timeline is kept
+	ClassSeconds map[int64]ClassCounts `json:"classSeconds,omitempty"`
+
+	// Metrics exporter counters, set when metrics are kept
+	Metrics *MetricsState `json:"metrics,omitempty"`
+}
+
+// Latency histogram counts, buckets are the same for every result of a version
+type LatencyState struct {
+	Counts []uint64      `json:"counts"`
+	Total  time.Duration `json:"total"`
+	Max    time.Duration `json:"max"`
+}
+
+// Maps are copied, the aggregator is reused after the result is built
+func (agg *aggregator) state(groupBy string) *ResultState {
+	state := &ResultState{
+		DatesBy:     groupBy,
+		Ips:         maps.Clone(agg.ips),
+		RemoteAddrs: maps.Clone(agg.remoteAddrs),
+		Codes:       maps.Clone(agg.codes),
+		Dates:       maps.Clone(agg.dates),
+		Uris:        maps.Clone(agg.uris),
+		UserAgents:  maps.Clone(agg.userAgents),
+	}
+
+	if len(agg.classSeconds) > 0 {
+		state.ClassSeconds = maps.Clone(agg.classSeconds)
+	}
+
+	state.Bots = botsState(agg.bots)
+	state.Metrics = agg.metricsState()
+
+	if agg.latency.counts != nil {
+		state.Latency = &LatencyState{
+			Counts: append([]uint64(nil), agg.latency.counts...),
+			Total:  agg.latency.total,
+			Max:    agg.latency.max,
+		}
+	}
+
+	return state
+}
+
+// Checks the result was saved with the mergeable state of the current schema
+func validateState(res *AnalyzeResult) error {
+	if res.Version != RESULT_VERSION {
+		return fmt.Errorf("result schema version %d is not supported, expected %d", res.Version, RESULT_VERSION)
+	}
+
+	if res.State == nil {
+		return fmt.Errorf("result has no mergeable state")
+	}
+
+	if res.State.Latency != nil && len(res.State.Latency.Counts) != len(latencyBounds)+1 {
+		return fmt.Errorf("result has %d latency buckets, expected %d", len(res.State.Latency.Counts), len(latencyBounds)+1)
+	}
+
+	if res.State.Metrics != nil {
+		for route, histogram := range res.State.Metrics.Durations {
+			if len(histogram.Counts) != len(DURATION_BUCKETS)+1 {
+				return fmt.Errorf("result has %d duration buckets of %q, expected %d", len(histogram.Counts), route, len(DURATION_BUCKETS)+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Combines saved results into one, top lists are re-ranked from the full counters.
+// Reports which need per request data (security, rates, ...) are not merged.
+func MergeSaved(results []*AnalyzeResult, params MergeParams) (*AnalyzeResult, error) {
+	total := getAggregator()
+	defer putAggregator(total)
+
+	// decoded dates get distinct locations, equal instants must share a key
+	dateKeys := make(map[int64]time.Time)
+
+	for i, res := range results {
+		if err := validateState(res); err != nil {
+			return nil, fmt.Errorf("result %d: %w", i+1, err)
+		}
+
+		if i == 0 {
+			params.GroupBy = res.State.DatesBy
+		} else if res.State.DatesBy != params.GroupBy {
+			return nil, fmt.Errorf("result %d: dates are grouped by %q, expected %q", i+1, res.State.DatesBy, params.GroupBy)
+		}
+
+		total.addState(res, dateKeys)
+		params.FileSize += res.ProcessingStats.FileSize
+	}
+
+	merged := total.result(params)
+	return &merged, nil
+}
+
+func (agg *aggregator) addState(res *AnalyzeResult, dateKeys map[int64]time.Time) {
+	state := res.State
+
+	mergeCounts(agg.ips, state.Ips)
+	mergeCounts(agg.remoteAddrs, state.RemoteAddrs)
+	mergeCounts(agg.codes, state.Codes)
+	mergeCounts(agg.uris, state.Uris)
+	mergeCounts(agg.userAgents, state.UserAgents)
+	mergeClassSeconds(agg.classSeconds, state.ClassSeconds)
+	agg.addBotsState(state.Bots)
+
+	if state.Metrics != nil {
+		agg.addMetricsState(state.Metrics)
+	}
+
+	for date, hits := range state.Dates {
+		key, ok := dateKeys[date.Unix()]
+		if !ok {
+			key = date
+			dateKeys[date.Unix()] = date
+		}
+		agg.dates[key] += hits
+	}
+
+	if state.Latency != nil {
+		agg.latency.merge(&latencyHistogram{
+			counts: state.Latency.Counts,
+			total:  state.Latency.Total,
+			max:    state.Latency.Max,
+		})
+	}
+
+	agg.totalRequests += res.TotalRequests
+	agg.totalBytes += res.TotalBytes
+	agg.parseErrors += res.ProcessingStats.ParseErrors
+	agg.filtered += res.ProcessingStats.Filtered
+
+	if res.TotalRequests > 0 {
+		agg.trackTime(res.TimeRange.Start, res.TimeRange.End)
+	}
+}
@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeSaved(t *testing.T) {
+	serverA := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0100] "GET /api/users/1 HTTP/1.1" 200 100 "-" "Mozilla/5.0" "0.010"
+10.0.0.1 - - [25/Dec/2023:10:31:45 +0100] "GET /api/users/2 HTTP/1.1" 200 100 "-" "Mozilla/5.0" "0.020"
+10.0.0.2 - - [25/Dec/2023:11:31:45 +0100] "GET /about HTTP/1.1" 404 50 "-" "curl/8.0" "0.030"
+`
+	serverB := `10.0.0.3 - - [25/Dec/2023:10:40:45 +0100] "GET /about HTTP/1.1" 200 100 "-" "Mozilla/5.0" "0.100"
+10.0.0.3 - - [25/Dec/2023:10:41:45 +0100] "GET /about HTTP/1.1" 200 100 "-" "Mozilla/5.0" "0.200"
+10.0.0.3 - - [25/Dec/2023:12:41:45 +0100] "GET /about HTTP/1.1" 500 100 "-" "Mozilla/5.0" "0.300"
+10.0.0.1 - - [25/Dec/2023:12:42:45 +0100] "GET /api/users/3 HTTP/1.1" 200 100 "-" "Mozilla/5.0" "0.400"
+`
+
+	dir := t.TempDir()
+	opts := Options{TopN: 1, Desc: true, DatesBy: "hour", State: true, ExtraFields: []parser.ExtraField{parser.FIELD_REQUEST_TIME}}
+
+	// analyzes the log and round trips the result through JSON, like -o and merge do
+	saved := func(name, data string) *AnalyzeResult {
+		logPath := filepath.Join(dir, name+".log")
+		require.NoError(t, os.WriteFile(logPath, []byte(data), 0644))
+
+		res, err := Analyze(logPath, opts)
+		require.NoError(t, err)
+
+		jsonData, err := json.Marshal(res)
+		require.NoError(t, err)
+
+		jsonPath := filepath.Join(dir, name+".json")
+		require.NoError(t, os.WriteFile(jsonPath, jsonData, 0644))
+
+		loaded, err := LoadResult(jsonPath)
+		require.NoError(t, err)
+
+		return loaded
+	}
+
+	a := saved("a", serverA)
+	b := saved("b", serverB)
+
+	t.Run("should save the mergeable state", func(t *testing.T) {
+		assert.Equal(t, RESULT_VERSION, a.Version)
+		require.NotNil(t, a.State)
+		assert.Len(t, a.State.Ips, 2)
+		assert.Equal(t, "hour", a.State.DatesBy)
+	})
+
+	t.Run("should leave the state out without the option", func(t *testing.T) {
+		plain := opts
+		plain.State = false
+
+		res, err := Analyze(filepath.Join(dir, "a.log"), plain)
+		require.NoError(t, err)
+		assert.Nil(t, res.State)
+
+		jsonData, err := json.Marshal(res)
+		require.NoError(t, err)
+		assert.NotContains(t, string(jsonData), `"state"`)
+	})
+
+	t.Run("should re-rank merged counters", func(t *testing.T) {
+		merged, err := MergeSaved([]*AnalyzeResult{a, b}, MergeParams{TopN: 10, Desc: true, State: true})
+		require.NoError(t, err)
+
+		// saved top lists are cut to one entry, the merged ones come from full counters
+		assert.Len(t, a.Uris, 1)
+		assert.Len(t, merged.Ips, 3)
+		assert.Equal(t, HitsInfo[netip.Addr]{Key: netip.MustParseAddr("10.0.0.2"), Hits: 1}, merged.Ips[2])
+		assert.Equal(t, HitsInfo[string]{Key: "/about", Hits: 4}, merged.Uris[0])
+
+		assert.Equal(t, uint64(7), merged.TotalRequests)
+		assert.Equal(t, uint64(650), merged.TotalBytes)
+		assert.Equal(t, uint64(3), merged.UniqueIPs)
+		assert.Equal(t, uint64(2), merged.UniqueUserAgents)
+
+		// equal hours of both servers share a bucket
+		assert.Len(t, merged.Dates, 3)
+		assert.Equal(t, uint64(4), merged.Dates[0].Hits)
+
+		require.NotNil(t, merged.Latency)
+		assert.Equal(t, uint64(7), merged.Latency.Requests)
+		assert.Equal(t, 400*time.Millisecond, merged.Latency.Max)
+
+		assert.Equal(t, a.TimeRange.Start, merged.TimeRange.Start)
+		assert.Equal(t, b.TimeRange.End, merged.TimeRange.End)
+		assert.Equal(t, a.ProcessingStats.FileSize+b.ProcessingStats.FileSize, merged.ProcessingStats.FileSize)
+	})
+
+	t.Run("should match analyzing the logs together", func(t *testing.T) {
+		merged, err := MergeSaved([]*AnalyzeResult{a, b}, MergeParams{TopN: 10, Desc: true, State: true})
+		require.NoError(t, err)
+
+		together := saved("together", serverA+serverB)
+		assert.Equal(t, together.State.Ips, merged.State.Ips)
+		assert.Equal(t, together.State.Uris, merged.State.Uris)
+		assert.Equal(t, together.State.Codes, merged.State.Codes)
+		assert.Equal(t, together.Latency, merged.Latency)
+	})
+
+	t.Run("should merge merged results", func(t *testing.T) {
+		merged, err := MergeSaved([]*AnalyzeResult{a}, MergeParams{TopN: 10, Desc: true, State: true})
+		require.NoError(t, err)
+
+		twice, err := MergeSaved([]*AnalyzeResult{merged, b}, MergeParams{TopN: 10, Desc: true, State: true})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(7), twice.TotalRequests)
+	})
+
+	t.Run("should reject results without state", func(t *testing.T) {
+		old := *a
+		old.Version = 0
+		old.State = nil
+
+		_, err := MergeSaved([]*AnalyzeResult{a, &old}, MergeParams{TopN: 10})
+		assert.ErrorContains(t, err, "result 2: result schema version 0 is not supported")
+	})
+
+	t.Run("should reject different date grouping", func(t *testing.T) {
+		state := *b.State
+		state.DatesBy = "day"
+		daily := *b
+		daily.State = &state
+
+		_, err := MergeSaved([]*AnalyzeResult{a, &daily}, MergeParams{TopN: 10})
+		assert.ErrorContains(t, err, `dates are grouped by "day"`)
+	})
+}
+
+func TestLoadResultVersion(t *testing.T) {
+	t.Run("should reject newer schema versions", func(t *testing.T) {
+		fpath := filepath.Join(t.TempDir(), "result.json")
+		require.NoError(t, os.WriteFile(fpath, []byte(`{"version": 99}`), 0644))
+
+		_, err := LoadResult(fpath)
+		assert.ErrorContains(t, err, "schema version 99")
+	})
+}
@@ -0,0 +1,130 @@
+package analyzer
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Prefix lengths used to group ips into subnets
+type SubnetMasks struct {
+	V4 int `json:"v4"`
+	V6 int `json:"v6"`
+}
+
+// Used for the hot subnets report when ips aren't grouped explicitly
+var DEFAULT_SUBNET_MASKS = SubnetMasks{V4: 24, V6: 64}
+
+type HotSubnet struct {
+	Prefix    netip.Prefix `json:"prefix"`
+	Hits      uint64       `json:"hits"`
+	UniqueIps uint64       `json:"uniqueIps"`
+
+	// Hits of the busiest single ip of the subnet
+	MaxIpHits uint64 `json:"maxIpHits"`
+}
+
+// Parses "/24,/64" like lists, the v6 mask defaults to /64
+func ParseSubnetMasks(str string) (SubnetMasks, error) {
+	parts := strings.Split(str, ",")
+	if len(parts) > 2 {
+		return SubnetMasks{}, fmt.Errorf("expected at most 2 masks (v4,v6), got %d", len(parts))
+	}
+
+	masks := DEFAULT_SUBNET_MASKS
+	limits := []int{32, 128}
+	targets := []*int{&masks.V4, &masks.V6}
+
+	for i, part := range parts {
+		bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(part), "/"))
+		if err != nil {
+			return SubnetMasks{}, fmt.Errorf("invalid mask %q", part)
+		}
+
+		if bits < 0 || bits > limits[i] {
+			return SubnetMasks{}, fmt.Errorf("mask %q is out of range 0-%d", part, limits[i])
+		}
+
+		*targets[i] = bits
+	}
+
+	return masks, nil
+}
+
+func (m SubnetMasks) Prefix(addr netip.Addr) netip.Prefix {
+	// ::ffff:1.2.3.4 is an ipv4 client behind a dual stack listener
+	addr = addr.Unmap()
+
+	bits := m.V6
+	if addr.Is4() {
+		bits = m.V4
+	}
+
+	// error is impossible, masks are validated on parse
+	prefix, _ := addr.Prefix(bits)
+	return prefix
+}
+
+func groupSubnets(ips map[netip.Addr]uint64, masks SubnetMasks) map[netip.Prefix]*HotSubnet {
+	subnets := make(map[netip.Prefix]*HotSubnet)
+
+	for ip, hits := range ips {
+		prefix := masks.Prefix(ip)
+
+		subnet, ok := subnets[prefix]
+		if !ok {
+			subnet = &HotSubnet{Prefix: prefix}
+			subnets[prefix] = subnet
+		}
+
+		subnet.Hits += hits
+		subnet.UniqueIps++
+		subnet.MaxIpHits = max(subnet.MaxIpHits, hits)
+	}
+
+	return subnets
+}
+
+func subnetHits(subnets map[netip.Prefix]*HotSubnet) map[netip.Prefix]uint64 {
+	hits := make(map[netip.Prefix]uint64, len(subnets))
+	for prefix, subnet := range subnets {
+		hits[prefix] = subnet.Hits
+	}
+
+	return hits
+}
+
+// Finds subnets whose combined hits would put them into the top N ips,
+// while none of their addresses made it there on its own. There are none
+// without a top list.
+func findHotSubnets(ips map[netip.Addr]uint64, subnets map[netip.Prefix]*HotSubnet, topN int) []HotSubnet {
+	if topN <= 0 || len(ips) <= topN {
+		return []HotSubnet{}
+	}
+
+	allHits := make([]uint64, 0, len(ips))
+	for _, hits := range ips {
+		allHits = append(allHits, hits)
+	}
+	slices.SortFunc(allHits, func(a, b uint64) int {
+		return getSortCompareResultAsc(b, a)
+	})
+	threshold := allHits[topN-1]
+
+	hot := make([]HotSubnet, 0)
+	for _, subnet := range subnets {
+		if subnet.UniqueIps < 2 || subnet.Hits < threshold || subnet.MaxIpHits >= threshold {
+			continue
+		}
+
+		hot = append(hot, *subnet)
+	}
+
+	slices.SortFunc(hot, func(a, b HotSubnet) int {
+		return getSortCompareResultAsc(b.Hits, a.Hits)
+	})
+
+	return hot[:min(len(hot), topN)]
+}
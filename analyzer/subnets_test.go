@@ -0,0 +1,103 @@
+package analyzer
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSubnetMasks(t *testing.T) {
+	t.Run("should parse v4 and v6 masks", func(t *testing.T) {
+		masks, err := ParseSubnetMasks("/16,/48")
+
+		assert.NoError(t, err)
+		assert.Equal(t, SubnetMasks{V4: 16, V6: 48}, masks)
+	})
+
+	t.Run("should default v6 mask", func(t *testing.T) {
+		masks, err := ParseSubnetMasks("24")
+
+		assert.NoError(t, err)
+		assert.Equal(t, SubnetMasks{V4: 24, V6: 64}, masks)
+	})
+
+	t.Run("should return error for invalid masks", func(t *testing.T) {
+		for _, str := range []string{"/33", "/24,/129", "abc", "/24,/64,/8", "/-1"} {
+			_, err := ParseSubnetMasks(str)
+			assert.Error(t, err, str)
+		}
+	})
+}
+
+func TestSubnetMasksPrefix(t *testing.T) {
+	masks := SubnetMasks{V4: 24, V6: 64}
+
+	assert.Equal(t, netip.MustParsePrefix("192.168.1.0/24"), masks.Prefix(netip.MustParseAddr("192.168.1.100")))
+	assert.Equal(t, netip.MustParsePrefix("2001:db8:1:2::/64"), masks.Prefix(netip.MustParseAddr("2001:db8:1:2:3:4:5:6")))
+
+	t.Run("should use the v4 mask for mapped addresses", func(t *testing.T) {
+		assert.Equal(t, netip.MustParsePrefix("10.1.2.0/24"), masks.Prefix(netip.MustParseAddr("::ffff:10.1.2.3")))
+	})
+}
+
+func TestFindHotSubnets(t *testing.T) {
+	ips := map[netip.Addr]uint64{
+		netip.MustParseAddr("192.168.1.1"): 10,
+		netip.MustParseAddr("192.168.2.1"): 9,
+		netip.MustParseAddr("10.0.0.1"):    5,
+		netip.MustParseAddr("10.0.0.2"):    5,
+		netip.MustParseAddr("10.0.0.3"):    5,
+		netip.MustParseAddr("172.16.0.1"):  1,
+		netip.MustParseAddr("172.16.0.2"):  1,
+	}
+
+	t.Run("should find subnets missing in top ips", func(t *testing.T) {
+		subnets := groupSubnets(ips, DEFAULT_SUBNET_MASKS)
+
+		hot := findHotSubnets(ips, subnets, 2)
+
+		assert.Equal(t, []HotSubnet{
+			{Prefix: netip.MustParsePrefix("10.0.0.0/24"), Hits: 15, UniqueIps: 3, MaxIpHits: 5},
+		}, hot)
+	})
+
+	t.Run("should return empty list when every ip is in top", func(t *testing.T) {
+		subnets := groupSubnets(ips, DEFAULT_SUBNET_MASKS)
+
+		hot := findHotSubnets(ips, subnets, 10)
+
+		assert.Empty(t, hot)
+	})
+
+	t.Run("should return empty list without a top list", func(t *testing.T) {
+		subnets := groupSubnets(ips, DEFAULT_SUBNET_MASKS)
+
+		assert.Empty(t, findHotSubnets(ips, subnets, 0))
+		assert.Empty(t, findHotSubnets(ips, subnets, -1))
+	})
+
+	t.Run("should analyze with a zero top", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "access.log")
+		require.NoError(t, os.WriteFile(logPath, []byte(`10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 100 "-" "-"
+10.0.0.2 - - [25/Dec/2023:10:30:46 +0000] "GET / HTTP/1.1" 200 100 "-" "-"
+`), 0644))
+
+		res, err := Analyze(logPath, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), res.TotalRequests)
+		assert.Empty(t, res.HotSubnets)
+	})
+
+	t.Run("should sum subnet hits", func(t *testing.T) {
+		subnets := groupSubnets(ips, SubnetMasks{V4: 8, V6: 64})
+
+		hits := subnetHits(subnets)
+
+		assert.Equal(t, uint64(19), hits[netip.MustParsePrefix("192.0.0.0/8")])
+		assert.Equal(t, uint64(15), hits[netip.MustParsePrefix("10.0.0.0/8")])
+	})
+}
@@ -0,0 +1,155 @@
+package analyzer
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/security"
+)
+
+type SecurityReport struct {
+	// Requests matching at least one rule
+	Hits       uint64             `json:"hits"`
+	Categories []HitsInfo[string] `json:"categories"`
+	Rules      []HitsInfo[string] `json:"rules"`
+
+	// Ips sorted by matching requests
+	Offenders []SecurityOffender `json:"offenders"`
+}
+
+type SecurityOffender struct {
+	Ip         netip.Addr         `json:"ip"`
+	Hits       uint64             `json:"hits"`
+	FirstSeen  time.Time          `json:"firstSeen"`
+	LastSeen   time.Time          `json:"lastSeen"`
+	Categories []string           `json:"categories"`
+	Rules      []HitsInfo[string] `json:"rules"`
+}
+
+type threatStats struct {
+	hits       uint64
+	categories map[string]uint64
+	rules      map[string]uint64
+	offenders  map[netip.Addr]*offenderStats
+}
+
+type offenderStats struct {
+	hits       uint64
+	firstSeen  time.Time
+	lastSeen   time.Time
+	categories map[string]struct{}
+	rules      map[string]uint64
+}
+
+func newThreatStats() threatStats {
+	return threatStats{
+		categories: make(map[string]uint64),
+		rules:      make(map[string]uint64),
+		offenders:  make(map[netip.Addr]*offenderStats),
+	}
+}
+
+// Counts a request matching the rules, every rule and category once per request
+func (stats *threatStats) add(entry *parser.LogEntry, matched []*security.Rule) {
+	stats.hits++
+
+	offender, ok := stats.offenders[entry.Ip]
+	if !ok {
+		offender = &offenderStats{
+			firstSeen:  entry.Date,
+			lastSeen:   entry.Date,
+			categories: make(map[string]struct{}),
+			rules:      make(map[string]uint64),
+		}
+		stats.offenders[entry.Ip] = offender
+	}
+
+	offender.hits++
+	offender.trackTime(entry.Date, entry.Date)
+
+	for i, rule := range matched {
+		stats.rules[rule.Name]++
+		offender.rules[rule.Name]++
+		offender.categories[rule.Category] = struct{}{}
+
+		if !slices.ContainsFunc(matched[:i], func(prev *security.Rule) bool { return prev.Category == rule.Category }) {
+			stats.categories[rule.Category]++
+		}
+	}
+}
+
+func (offender *offenderStats) trackTime(first, last time.Time) {
+	if first.Before(offender.firstSeen) {
+		offender.firstSeen = first
+	}
+
+	if last.After(offender.lastSeen) {
+		offender.lastSeen = last
+	}
+}
+
+func (stats *threatStats) merge(other *threatStats) {
+	stats.hits += other.hits
+	mergeCounts(stats.categories, other.categories)
+	mergeCounts(stats.rules, other.rules)
+
+	for ip, offender := range other.offenders {
+		own, ok := stats.offenders[ip]
+		if !ok {
+			stats.offenders[ip] = offender
+			continue
+		}
+
+		own.hits += offender.hits
+		own.trackTime(offender.firstSeen, offender.lastSeen)
+		mergeCounts(own.rules, offender.rules)
+		for category := range offender.categories {
+			own.categories[category] = struct{}{}
+		}
+	}
+}
+
+func (stats *threatStats) reset() {
+	stats.hits = 0
+	clear(stats.categories)
+	clear(stats.rules)
+	clear(stats.offenders)
+}
+
+// Security report with top N offenders
+func (stats *threatStats) report(topN int) *SecurityReport {
+	report := &SecurityReport{
+		Hits:       stats.hits,
+		Categories: *getHitsInfo(stats.categories, topN, true),
+		Rules:      *getHitsInfo(stats.rules, topN, true),
+		Offenders:  make([]SecurityOffender, 0, min(len(stats.offenders), topN)),
+	}
+
+	ipHits := make(map[netip.Addr]uint64, len(stats.offenders))
+	for ip, offender := range stats.offenders {
+		ipHits[ip] = offender.hits
+	}
+
+	for _, top := range *getHitsInfo(ipHits, topN, true) {
+		offender := stats.offenders[top.Key]
+
+		categories := make([]string, 0, len(offender.categories))
+		for category := range offender.categories {
+			categories = append(categories, category)
+		}
+		slices.Sort(categories)
+
+		report.Offenders = append(report.Offenders, SecurityOffender{
+			Ip:         top.Key,
+			Hits:       offender.hits,
+			FirstSeen:  offender.firstSeen,
+			LastSeen:   offender.lastSeen,
+			Categories: categories,
+			Rules:      *getHitsInfo(offender.rules, topN, true),
+		})
+	}
+
+	return report
+}
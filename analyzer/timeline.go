@@ -0,0 +1,52 @@
+package analyzer
+
+import (
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// Requests of a second by status class, indexed like STATUS_CLASSES
+type ClassCounts [5]uint64
+
+// Index of the code class in STATUS_CLASSES, -1 for invalid codes
+func statusClass(code uint16) int {
+	class := int(code/100) - 1
+	if class < 0 || class >= len(STATUS_CLASSES) {
+		return -1
+	}
+
+	return class
+}
+
+// Requests by status class of a status code distribution
+func CountClasses(codes []HitsInfo[uint16]) ClassCounts {
+	var classes ClassCounts
+	for _, info := range codes {
+		if class := statusClass(info.Key); class != -1 {
+			classes[class] += info.Hits
+		}
+	}
+
+	return classes
+}
+
+// Seconds are unix times, workers have distinct locations of the same zone
+func (agg *aggregator) addClassSecond(entry *parser.LogEntry) {
+	class := statusClass(entry.StatusCode)
+	if class == -1 {
+		return
+	}
+
+	counts := agg.classSeconds[entry.Date.Unix()]
+	counts[class]++
+	agg.classSeconds[entry.Date.Unix()] = counts
+}
+
+func mergeClassSeconds(dst, src map[int64]ClassCounts) {
+	for second, counts := range src {
+		own := dst[second]
+		for i, count := range counts {
+			own[i] += count
+		}
+		dst[second] = own
+	}
+}
@@ -0,0 +1,29 @@
+package analyzer
+
+// Classifies every distinct user agent once and sums up its hits
+func classifyUserAgents(userAgents map[string]uint64, params MergeParams) (browsers, operatingSystems, devices, bots []HitsInfo[string]) {
+	browserHits := make(map[string]uint64)
+	osHits := make(map[string]uint64)
+	deviceHits := make(map[string]uint64)
+	botHits := make(map[string]uint64)
+
+	for userAgent, hits := range userAgents {
+		info := params.UserAgents.Classify(userAgent)
+
+		deviceHits[info.Device] += hits
+		if info.IsBot() {
+			botHits[info.Bot] += hits
+			continue
+		}
+
+		browserHits[info.BrowserVersion()] += hits
+		osHits[info.Os] += hits
+	}
+
+	browsers = *getHitsInfo(browserHits, params.TopN, params.Desc)
+	operatingSystems = *getHitsInfo(osHits, params.TopN, params.Desc)
+	devices = *getHitsInfo(deviceHits, params.TopN, params.Desc)
+	bots = *getHitsInfo(botHits, params.TopN, params.Desc)
+
+	return browsers, operatingSystems, devices, bots
+}
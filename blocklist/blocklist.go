@@ -0,0 +1,153 @@
+package blocklist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"time"
+
+	"go4.org/netipx"
+)
+
+type Format string
+
+const (
+	FORMAT_NGINX    Format = "nginx"
+	FORMAT_IPSET    Format = "ipset"
+	FORMAT_CIDR     Format = "cidr"
+	FORMAT_FAIL2BAN Format = "fail2ban"
+)
+
+// Default ipset name, v6 addresses go to the set with "-v6" suffix
+const DEFAULT_SET_NAME = "nginx-an"
+
+func IsValidFormat(format Format) bool {
+	switch format {
+	case FORMAT_NGINX, FORMAT_IPSET, FORMAT_CIDR, FORMAT_FAIL2BAN:
+		return true
+	}
+
+	return false
+}
+
+// Blocked prefix with an optional reason written as a comment
+type Entry struct {
+	Prefix netip.Prefix
+	Reason string
+}
+
+// Entry blocking a single address
+func NewEntry(addr netip.Addr, reason string) Entry {
+	return Entry{Prefix: netip.PrefixFrom(addr, addr.BitLen()), Reason: reason}
+}
+
+// Merges adjacent addresses into the minimal list of prefixes covering
+// exactly the same addresses. Reasons are dropped, a prefix may cover
+// addresses blocked for different reasons.
+func Collapse(entries []Entry) ([]Entry, error) {
+	var builder netipx.IPSetBuilder
+	for _, entry := range entries {
+		builder.AddPrefix(entry.Prefix)
+	}
+
+	set, err := builder.IPSet()
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := set.Prefixes()
+	collapsed := make([]Entry, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		collapsed = append(collapsed, Entry{Prefix: prefix})
+	}
+
+	return collapsed, nil
+}
+
+type WriteOptions struct {
+	Format Format
+
+	// ipset name, DEFAULT_SET_NAME when empty
+	SetName string
+
+	// Timestamp of fail2ban lines
+	Now time.Time
+}
+
+func Write(w io.Writer, entries []Entry, opts WriteOptions) error {
+	bw := bufio.NewWriter(w)
+
+	switch opts.Format {
+	case FORMAT_NGINX:
+		writeNginx(bw, entries)
+	case FORMAT_IPSET:
+		writeIpset(bw, entries, opts.SetName)
+	case FORMAT_CIDR:
+		for _, entry := range entries {
+			fmt.Fprintln(bw, formatPrefix(entry.Prefix))
+		}
+	case FORMAT_FAIL2BAN:
+		writeFail2ban(bw, entries, opts.Now)
+	default:
+		return fmt.Errorf("unknown blocklist format %q", opts.Format)
+	}
+
+	return bw.Flush()
+}
+
+// Single addresses are written without the mask, like people write them by hand
+func formatPrefix(prefix netip.Prefix) string {
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String()
+	}
+
+	return prefix.String()
+}
+
+// Include file for the http, server or location block
+func writeNginx(w io.Writer, entries []Entry) {
+	for _, entry := range entries {
+		if entry.Reason != "" {
+			fmt.Fprintf(w, "deny %s; # %s\n", formatPrefix(entry.Prefix), entry.Reason)
+		} else {
+			fmt.Fprintf(w, "deny %s;\n", formatPrefix(entry.Prefix))
+		}
+	}
+}
+
+// Input of "ipset restore", hash:net sets hold a single address family
+func writeIpset(w io.Writer, entries []Entry, setName string) {
+	if setName == "" {
+		setName = DEFAULT_SET_NAME
+	}
+	setNameV6 := setName + "-v6"
+
+	fmt.Fprintf(w, "create %s hash:net family inet -exist\n", setName)
+	if slices.ContainsFunc(entries, func(entry Entry) bool { return entry.Prefix.Addr().Is6() }) {
+		fmt.Fprintf(w, "create %s hash:net family inet6 -exist\n", setNameV6)
+	}
+
+	for _, entry := range entries {
+		name := setName
+		if entry.Prefix.Addr().Is6() {
+			name = setNameV6
+		}
+
+		fmt.Fprintf(w, "add %s %s -exist\n", name, entry.Prefix.String())
+	}
+}
+
+// Log lines matched by the filter "failregex = ^\S+ \S+ nginx-an block <SUBNET>"
+func writeFail2ban(w io.Writer, entries []Entry, now time.Time) {
+	timestamp := now.Format("2006-01-02 15:04:05")
+
+	for _, entry := range entries {
+		if entry.Reason != "" {
+			fmt.Fprintf(w, "%s nginx-an block %s reason=%q\n", timestamp, formatPrefix(entry.Prefix), entry.Reason)
+		} else {
+			fmt.Fprintf(w, "%s nginx-an block %s\n", timestamp, formatPrefix(entry.Prefix))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package blocklist
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEntries() []Entry {
+	return []Entry{
+		NewEntry(netip.MustParseAddr("203.0.113.7"), "security hits 3"),
+		NewEntry(netip.MustParseAddr("2001:db8::1"), ""),
+	}
+}
+
+func TestWrite(t *testing.T) {
+	now := time.Date(2023, 12, 25, 10, 30, 45, 0, time.UTC)
+
+	cases := []struct {
+		format   Format
+		expected string
+	}{
+		{FORMAT_NGINX, "deny 203.0.113.7; # security hits 3\ndeny 2001:db8::1;\n"},
+		{FORMAT_CIDR, "203.0.113.7\n2001:db8::1\n"},
+		{FORMAT_IPSET, "create nginx-an hash:net family inet -exist\n" +
+			"create nginx-an-v6 hash:net family inet6 -exist\n" +
+			"add nginx-an 203.0.113.7/32 -exist\n" +
+			"add nginx-an-v6 2001:db8::1/128 -exist\n"},
+		{FORMAT_FAIL2BAN, "2023-12-25 10:30:45 nginx-an block 203.0.113.7 reason=\"security hits 3\"\n" +
+			"2023-12-25 10:30:45 nginx-an block 2001:db8::1\n"},
+	}
+
+	for _, c := range cases {
+		t.Run("should write "+string(c.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Write(&buf, testEntries(), WriteOptions{Format: c.format, Now: now})
+
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, buf.String())
+		})
+	}
+
+	t.Run("should use the set name", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := Write(&buf, testEntries()[:1], WriteOptions{Format: FORMAT_IPSET, SetName: "abusers"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "create abusers hash:net family inet -exist\nadd abusers 203.0.113.7/32 -exist\n", buf.String())
+	})
+
+	t.Run("should reject unknown formats", func(t *testing.T) {
+		err := Write(&bytes.Buffer{}, testEntries(), WriteOptions{Format: "iptables"})
+		assert.Error(t, err)
+	})
+}
+
+func TestCollapse(t *testing.T) {
+	t.Run("should merge adjacent addresses into minimal prefixes", func(t *testing.T) {
+		entries := []Entry{}
+		for _, ip := range []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.5", "192.168.1.1", "2001:db8::", "2001:db8::1"} {
+			entries = append(entries, NewEntry(netip.MustParseAddr(ip), "reason"))
+		}
+
+		collapsed, err := Collapse(entries)
+		require.NoError(t, err)
+
+		assert.Equal(t, []Entry{
+			{Prefix: netip.MustParsePrefix("10.0.0.0/30")},
+			{Prefix: netip.MustParsePrefix("10.0.0.5/32")},
+			{Prefix: netip.MustParsePrefix("192.168.1.1/32")},
+			{Prefix: netip.MustParsePrefix("2001:db8::/127")},
+		}, collapsed)
+	})
+}
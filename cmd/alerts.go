@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/alerts"
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/Kostayne/go-nginx-analyzer/index"
+	"github.com/spf13/cobra"
+)
+
+// Exit code of a check with firing rules, errors exit with 1
+const ALERT_EXIT_CODE = 2
+
+const DEFAULT_ALERT_INTERVAL = time.Minute
+
+var alertsCmd = &cobra.Command{
+	Use:   "alerts <path-to-access.log>",
+	Short: "Evaluate alert rules against the log",
+	Long: `Evaluates rules like "error_rate_5xx > 2% over 5m" from a YAML file and notifies the configured sinks.
+Checks the log once and exits with code 2 when a rule fires, windows end at the last logged request.
+With --follow the rules are evaluated every --interval until interrupted, windows end at the current time
+and sinks are notified when a rule starts firing and when it's resolved.`,
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		alertFlags, err := parseAlertFlags(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		config, err := alerts.Load(alertFlags.Rules)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		firing, err := runAlerts(flags, alertFlags, config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		if firing {
+			os.Exit(ALERT_EXIT_CODE)
+		}
+	},
+}
+
+type AlertFlags struct {
+	Rules    string
+	Follow   bool
+	Interval time.Duration
+}
+
+func init() {
+	alertsCmd.Flags().String("rules", "", "YAML file with alert rules and sinks")
+	alertsCmd.Flags().Bool("follow", false, "evaluate the rules every interval until interrupted")
+	alertsCmd.Flags().Duration("interval", DEFAULT_ALERT_INTERVAL, "evaluation interval in follow mode")
+	alertsCmd.MarkFlagRequired("rules")
+	rootCmd.AddCommand(alertsCmd)
+}
+
+func parseAlertFlags(cmd *cobra.Command) (*AlertFlags, error) {
+	rules, rulesErr := cmd.Flags().GetString("rules")
+	if rulesErr != nil {
+		return nil, fmt.Errorf("failed to get rules flag: %w", rulesErr)
+	}
+
+	follow, followErr := cmd.Flags().GetBool("follow")
+	if followErr != nil {
+		return nil, fmt.Errorf("failed to get follow flag: %w", followErr)
+	}
+
+	interval, intervalErr := cmd.Flags().GetDuration("interval")
+	if intervalErr != nil {
+		return nil, fmt.Errorf("failed to get interval flag: %w", intervalErr)
+	}
+
+	if interval < time.Second {
+		return nil, fmt.Errorf("interval must be at least 1s")
+	}
+
+	return &AlertFlags{Rules: rules, Follow: follow, Interval: interval}, nil
+}
+
+// Checks the rules once and reports whether any fires, or follows the log
+// until interrupted. Geoip databases stay open meanwhile.
+func runAlerts(flags *Flags, alertFlags *AlertFlags, config *alerts.Config) (bool, error) {
+	opts := analyzerOptions(flags)
+	opts.DatesBy = "none"
+	opts.State = true
+	if config.NeedsRates() {
+		opts.Rates = &analyzer.RateOptions{ThrottlePercent: 1}
+	}
+
+	if flags.GeoIpDb != "" || flags.AsnDb != "" {
+		geo, err := geoip.Open(flags.GeoIpDb, flags.AsnDb)
+		if err != nil {
+			return false, err
+		}
+		defer geo.Close()
+
+		opts.Geo = geo
+	}
+
+	source := func(since time.Time) (*analyzer.AnalyzeResult, error) {
+		windowOpts := opts
+		windowOpts.Since = since
+		return analyzer.Analyze(flags.FilePath, windowOpts)
+	}
+
+	sinks := config.NewSinks(os.Stdout)
+
+	if alertFlags.Follow {
+		if index.IsIndex(flags.FilePath) {
+			return false, fmt.Errorf("an index can't be followed, follow the log instead")
+		}
+
+		// every tick analyzes only the appended lines
+		follower := analyzer.NewFollower(flags.FilePath, opts, config.MaxWindow())
+		source = func(since time.Time) (*analyzer.AnalyzeResult, error) {
+			if err := follower.Update(); err != nil {
+				return nil, err
+			}
+
+			return follower.Since(since)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		config.Watch(ctx, source, sinks, alertFlags.Interval, func(err error) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		})
+		return false, nil
+	}
+
+	results, err := config.Evaluate(source, time.Time{})
+	if err != nil {
+		return false, err
+	}
+
+	firing := alerts.NewTracker().Update(results, time.Now())
+	if len(firing) == 0 {
+		return false, nil
+	}
+
+	if err := sinks.Notify(firing); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/spf13/cobra"
+)
+
+var anomaliesCmd = &cobra.Command{
+	Use:   "anomalies <path-to-access.log>",
+	Short: "Detect spikes and drops of traffic over time",
+	Long:  "Finds date buckets with anomalous request volume, 5xx error rate or bytes and reports their top ips, uris and status codes.",
+	Args:  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		if flags.DatesBy == "none" {
+			fmt.Fprintln(os.Stderr, "anomalies require --dates-by hour or day")
+			os.Exit(1)
+		}
+
+		threshold, err := cmd.Flags().GetFloat64("threshold")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to get threshold flag: %w", err))
+			os.Exit(1)
+		}
+
+		opts := analyzerOptions(flags)
+		opts.Anomalies = &analyzer.AnomalyOptions{Threshold: threshold}
+
+		res, err := analyze(flags, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		printAnomalies(res.Anomalies)
+		printProcessingStats(res.ProcessingStats)
+
+		if flags.Output != "" {
+			err = saveToFile(*res, flags.Output)
+			if err != nil {
+				fmt.Println("Error saving to file:", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	anomaliesCmd.Flags().Float64("threshold", analyzer.DEFAULT_ANOMALY_THRESHOLD, "robust z-score marking a bucket as anomalous")
+	rootCmd.AddCommand(anomaliesCmd)
+}
+
+func printAnomalies(report *analyzer.AnomalyReport) {
+	msg := "Anomalies"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+	fmt.Printf("Buckets: %d, baseline: %s\n", report.Buckets, report.Baseline)
+
+	if report.Buckets < analyzer.MIN_ANOMALY_BUCKETS {
+		fmt.Printf("At least %d buckets are required\n", analyzer.MIN_ANOMALY_BUCKETS)
+	}
+	fmt.Println()
+
+	for _, anomaly := range report.Anomalies {
+		fmt.Printf("%s %s %s: %s, expected %s (score %.1f)\n", anomaly.Start.Format("2006-01-02 15:04:05"),
+			anomaly.Metric, anomaly.Kind, formatMetric(anomaly.Metric, anomaly.Value),
+			formatMetric(anomaly.Metric, anomaly.Expected), anomaly.Score)
+
+		ips := make([]string, 0, len(anomaly.Ips))
+		for _, ip := range anomaly.Ips {
+			ips = append(ips, fmt.Sprintf("%s: %d", ip.Key, ip.Hits))
+		}
+		fmt.Printf("  Ips: %s\n", strings.Join(ips, ", "))
+
+		uris := make([]string, 0, len(anomaly.Uris))
+		for _, uri := range anomaly.Uris {
+			uris = append(uris, fmt.Sprintf("%s: %d", uri.Key, uri.Hits))
+		}
+		fmt.Printf("  Uris: %s\n", strings.Join(uris, ", "))
+
+		codes := make([]string, 0, len(anomaly.Codes))
+		for _, code := range anomaly.Codes {
+			codes = append(codes, fmt.Sprintf("%d: %d", code.Key, code.Hits))
+		}
+		fmt.Printf("  Status codes: %s\n", strings.Join(codes, ", "))
+	}
+	fmt.Println()
+}
+
+func formatMetric(metric analyzer.AnomalyMetric, value float64) string {
+	switch metric {
+	case analyzer.METRIC_ERROR_RATE:
+		return fmt.Sprintf("%.2f%%", value*100)
+	case analyzer.METRIC_BYTES:
+		return fmt.Sprintf("%.2f MB", value/(1024*1024))
+	}
+
+	return fmt.Sprintf("%.0f", value)
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/blocklist"
+	"github.com/Kostayne/go-nginx-analyzer/security"
+	"github.com/spf13/cobra"
+)
+
+type BlockFlags struct {
+	Rules    analyzer.BlockRules
+	Format   blocklist.Format
+	Collapse bool
+	SetName  string
+	Output   string
+}
+
+var blockCmd = &cobra.Command{
+	Use:   "block <path-to-access.log>",
+	Short: "Export abusive clients as a blocklist",
+	Long:  "Finds clients exceeding rate, error or security thresholds and writes them as an nginx deny file, ipset restore script, CIDR list or fail2ban log.",
+	Args:  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		blockFlags, err := parseBlockFlags(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		// security rules are matched only when they take part in blocking
+		var scanner *security.Scanner
+		if blockFlags.Rules.MinSecurityHits > 0 {
+			scanner, err = parseSecurityRulesFlag(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
+
+		opts := analyzerOptions(flags)
+		opts.Security = scanner
+		opts.Block = &blockFlags.Rules
+
+		res, err := analyze(flags, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		entries := make([]blocklist.Entry, 0, len(res.Blocked))
+		for _, client := range res.Blocked {
+			entries = append(entries, blocklist.NewEntry(client.Ip, client.Reason()))
+		}
+
+		if blockFlags.Collapse {
+			entries, err = blocklist.Collapse(entries)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
+
+		err = writeBlocklist(entries, blockFlags)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing blocklist:", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Blocked %d clients in %d entries\n", len(res.Blocked), len(entries))
+
+		if flags.Output != "" {
+			err = saveToFile(*res, flags.Output)
+			if err != nil {
+				fmt.Println("Error saving to file:", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	blockCmd.Flags().Uint64("max-rpm", 0, "block clients making more requests per minute, 0 disables")
+	blockCmd.Flags().Uint64("max-4xx-per-minute", 0, "block clients getting more 4xx responses per minute, 0 disables")
+	blockCmd.Flags().Uint64("security-hits", 0, "block clients with at least this many requests matching security rules, 0 disables")
+	blockCmd.Flags().String("security-rules", "", "YAML or JSON file with rules added to the built-in ones")
+	blockCmd.Flags().String("format", "nginx", "blocklist format: nginx, ipset, cidr, fail2ban")
+	blockCmd.Flags().Bool("collapse", false, "merge adjacent addresses into minimal CIDRs")
+	blockCmd.Flags().String("set-name", blocklist.DEFAULT_SET_NAME, "ipset name, v6 addresses go to the set with -v6 suffix")
+	blockCmd.Flags().String("blocklist", "", "blocklist file, stdout by default")
+	rootCmd.AddCommand(blockCmd)
+}
+
+func parseBlockFlags(cmd *cobra.Command) (*BlockFlags, error) {
+	maxRpm, maxRpmErr := cmd.Flags().GetUint64("max-rpm")
+	if maxRpmErr != nil {
+		return nil, fmt.Errorf("failed to get max-rpm flag: %w", maxRpmErr)
+	}
+
+	max4xx, max4xxErr := cmd.Flags().GetUint64("max-4xx-per-minute")
+	if max4xxErr != nil {
+		return nil, fmt.Errorf("failed to get max-4xx-per-minute flag: %w", max4xxErr)
+	}
+
+	securityHits, securityHitsErr := cmd.Flags().GetUint64("security-hits")
+	if securityHitsErr != nil {
+		return nil, fmt.Errorf("failed to get security-hits flag: %w", securityHitsErr)
+	}
+
+	if maxRpm == 0 && max4xx == 0 && securityHits == 0 {
+		return nil, fmt.Errorf("at least one of --max-rpm, --max-4xx-per-minute, --security-hits is required")
+	}
+
+	format, formatErr := cmd.Flags().GetString("format")
+	if formatErr != nil {
+		return nil, fmt.Errorf("failed to get format flag: %w", formatErr)
+	}
+
+	if !blocklist.IsValidFormat(blocklist.Format(format)) {
+		return nil, fmt.Errorf("format must be one of: nginx, ipset, cidr, fail2ban")
+	}
+
+	collapse, collapseErr := cmd.Flags().GetBool("collapse")
+	if collapseErr != nil {
+		return nil, fmt.Errorf("failed to get collapse flag: %w", collapseErr)
+	}
+
+	setName, setNameErr := cmd.Flags().GetString("set-name")
+	if setNameErr != nil {
+		return nil, fmt.Errorf("failed to get set-name flag: %w", setNameErr)
+	}
+
+	output, outputErr := cmd.Flags().GetString("blocklist")
+	if outputErr != nil {
+		return nil, fmt.Errorf("failed to get blocklist flag: %w", outputErr)
+	}
+
+	return &BlockFlags{
+		Rules: analyzer.BlockRules{
+			MaxRequestsPerMinute: maxRpm,
+			MaxErrorsPerMinute:   max4xx,
+			MinSecurityHits:      securityHits,
+		},
+		Format:   blocklist.Format(format),
+		Collapse: collapse,
+		SetName:  setName,
+		Output:   output,
+	}, nil
+}
+
+func writeBlocklist(entries []blocklist.Entry, flags *BlockFlags) error {
+	var w io.Writer = os.Stdout
+
+	if flags.Output != "" {
+		file, err := os.Create(flags.Output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	return blocklist.Write(w, entries, blocklist.WriteOptions{
+		Format:  flags.Format,
+		SetName: flags.SetName,
+		Now:     time.Now(),
+	})
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <before> <after>",
+	Short: "Compare two logs, saved results or periods of a log",
+	Long: `Shows deltas of totals, status class shares, latency and top uris/ips between two access logs or JSON results saved with -o.
+With a single log the period between --before-since and --before-until is compared with the one between --since and --until,
+--since defaults to --before-until. Bounds are RFC 3339 times or durations back from now, like "2h".`,
+	Args: cobra.RangeArgs(1, 2),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		baseline, err := cmd.Flags().GetString("baseline")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to get baseline flag: %w", err))
+			os.Exit(1)
+		}
+
+		inputs := args
+		if baseline != "" {
+			inputs = append([]string{baseline}, args...)
+		}
+
+		periods, err := parsePeriodFlags(cmd, time.Now())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		if periods != nil {
+			if len(inputs) != 1 {
+				fmt.Fprintln(os.Stderr, "periods are compared within a single log: diff <log> --before-since <time> --since <time>")
+				os.Exit(1)
+			}
+
+			inputs = []string{inputs[0], inputs[0]}
+		} else if len(inputs) != 2 {
+			fmt.Fprintln(os.Stderr, "diff requires two inputs: <before> <after>, --baseline <before> <after> or a log with periods")
+			os.Exit(1)
+		}
+
+		flags, err := parseFlags(cmd, inputs[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		results := make([]*analyzer.AnalyzeResult, len(inputs))
+		for i, input := range inputs {
+			var period *Period
+			if periods != nil {
+				period = &periods[i]
+			}
+
+			results[i], err = loadOrAnalyze(flags, input, period)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
+
+		diff, err := analyzer.Diff(results[0], results[1], flags.Top)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		printDiff(diff, flags.Top)
+
+		if flags.Output != "" {
+			err = saveDiffToFile(diff, flags.Output)
+			if err != nil {
+				fmt.Println("Error saving to file:", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// Requests between the bounds, a zero bound is open
+type Period struct {
+	Since time.Time
+	Until time.Time
+}
+
+func init() {
+	diffCmd.Flags().String("baseline", "", "saved JSON result or log to compare with")
+	diffCmd.Flags().String("before-since", "", "start of the compared period of a single log")
+	diffCmd.Flags().String("before-until", "", "end of the compared period of a single log")
+	diffCmd.Flags().String("since", "", "start of the period compared with, --before-until by default")
+	diffCmd.Flags().String("until", "", "end of the period compared with")
+	rootCmd.AddCommand(diffCmd)
+}
+
+// Returns the before and after periods, nil when no bounds are provided
+func parsePeriodFlags(cmd *cobra.Command, now time.Time) ([]Period, error) {
+	names := []string{"before-since", "before-until", "since", "until"}
+	bounds := make([]time.Time, len(names))
+	set := false
+
+	for i, name := range names {
+		value, err := cmd.Flags().GetString(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s flag: %w", name, err)
+		}
+
+		bounds[i], err = analyzer.ParseTimeBound(value, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+
+		set = set || value != ""
+	}
+
+	if !set {
+		return nil, nil
+	}
+
+	periods := []Period{{Since: bounds[0], Until: bounds[1]}, {Since: bounds[2], Until: bounds[3]}}
+	if periods[0].Since.IsZero() && periods[0].Until.IsZero() {
+		return nil, fmt.Errorf("--before-since or --before-until is required to compare periods")
+	}
+
+	if periods[1].Since.IsZero() {
+		periods[1].Since = periods[0].Until
+	}
+
+	for _, period := range periods {
+		if !period.Since.IsZero() && !period.Until.IsZero() && !period.Since.Before(period.Until) {
+			return nil, fmt.Errorf("period start %s must be before its end %s", period.Since.Format(time.RFC3339), period.Until.Format(time.RFC3339))
+		}
+	}
+
+	return periods, nil
+}
+
+// Results saved with -o are loaded, anything else is analyzed as a log,
+// limited to the period when it's not nil
+func loadOrAnalyze(flags *Flags, fpath string, period *Period) (*analyzer.AnalyzeResult, error) {
+	if strings.EqualFold(filepath.Ext(fpath), ".json") {
+		if period != nil {
+			return nil, fmt.Errorf("periods are compared within a log, %s is a saved result", fpath)
+		}
+
+		return analyzer.LoadResult(fpath)
+	}
+
+	inputFlags := *flags
+	inputFlags.FilePath = fpath
+
+	opts := analyzerOptions(&inputFlags)
+	if period != nil {
+		opts.Since = period.Since
+		opts.Until = period.Until
+	}
+
+	return analyze(&inputFlags, opts)
+}
+
+func saveDiffToFile(diff analyzer.DiffResult, fileName string) error {
+	jsonData, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, jsonData, 0644)
+}
+
+func printDiff(diff analyzer.DiffResult, limit int) {
+	msg := "Totals"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+	for _, metric := range diff.Totals {
+		fmt.Printf("%s: %.2f -> %.2f (%+.2f, %+.1f%%)\n", metric.Name, metric.Before, metric.After, metric.Delta, metric.Percent)
+	}
+	fmt.Println()
+
+	msg = "Status classes"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+	for _, share := range diff.StatusClasses {
+		fmt.Printf("%s: %.2f%% -> %.2f%% (%+.2f)\n", share.Class, share.Before, share.After, share.Delta)
+	}
+	fmt.Println()
+
+	printRankDiff(diff.Uris, "Uris", limit)
+	printRankDiff(diff.Ips, "Ips", limit)
+}
+
+func printRankDiff[T comparable](diff analyzer.RankDiff[T], name string, limit int) {
+	msg := name + " changes"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+
+	for _, change := range diff.Appeared[:min(limit, len(diff.Appeared))] {
+		fmt.Printf("+ %v: #%d, %d hits\n", change.Key, change.AfterRank, change.AfterHits)
+	}
+
+	for _, change := range diff.Disappeared[:min(limit, len(diff.Disappeared))] {
+		fmt.Printf("- %v: was #%d, %d hits\n", change.Key, change.BeforeRank, change.BeforeHits)
+	}
+
+	for _, change := range diff.Changed[:min(limit, len(diff.Changed))] {
+		fmt.Printf("~ %v: #%d -> #%d, %d -> %d hits\n", change.Key, change.BeforeRank, change.AfterRank, change.BeforeHits, change.AfterHits)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeriodFlags(t *testing.T) {
+	now := time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC)
+	parse := func(t *testing.T, args ...string) ([]Period, error) {
+		cmd := &cobra.Command{}
+		for _, name := range []string{"before-since", "before-until", "since", "until"} {
+			cmd.Flags().String(name, "", "")
+		}
+		require.NoError(t, cmd.ParseFlags(args))
+
+		return parsePeriodFlags(cmd, now)
+	}
+
+	t.Run("should return nil without bounds", func(t *testing.T) {
+		periods, err := parse(t)
+		require.NoError(t, err)
+		assert.Nil(t, periods)
+	})
+
+	t.Run("should start the after period where the before one ends", func(t *testing.T) {
+		periods, err := parse(t, "--before-since", "2h", "--before-until", "1h")
+		require.NoError(t, err)
+		assert.Equal(t, []Period{
+			{Since: now.Add(-2 * time.Hour), Until: now.Add(-time.Hour)},
+			{Since: now.Add(-time.Hour)},
+		}, periods)
+	})
+
+	t.Run("should parse rfc 3339 bounds", func(t *testing.T) {
+		periods, err := parse(t, "--before-until", "2023-12-24T00:00:00Z", "--since", "2023-12-25T00:00:00Z", "--until", "2023-12-25T06:00:00Z")
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2023, 12, 24, 0, 0, 0, 0, time.UTC), periods[0].Until)
+		assert.Equal(t, time.Date(2023, 12, 25, 6, 0, 0, 0, time.UTC), periods[1].Until)
+	})
+
+	t.Run("should reject invalid periods", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--since", "1h"},
+			{"--before-since", "1h", "--before-until", "2h"},
+			{"--before-until", "yesterday"},
+		} {
+			_, err := parse(t, args...)
+			assert.Error(t, err, args)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Kostayne/go-nginx-analyzer/export"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export <path-to-access.log>",
+	Short: "Export parsed requests and aggregates to a SQLite file",
+	Long: "Writes every request accepted by the filters with normalized uris, geoip and user agent columns, " +
+		"and the aggregate tables of the report to a local SQLite file for ad-hoc SQL.",
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		sqlitePath, err := cmd.Flags().GetString("sqlite")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to get sqlite flag: %w", err))
+			os.Exit(1)
+		}
+
+		if sqlitePath == "" {
+			fmt.Fprintln(os.Stderr, "--sqlite is required")
+			os.Exit(1)
+		}
+
+		sqlite, err := export.CreateSqlite(sqlitePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		opts := analyzerOptions(flags)
+		opts.Export = sqlite
+		opts.State = true
+
+		res, err := analyze(flags, opts)
+		if err != nil {
+			sqlite.Abort()
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		if err := sqlite.Finish(res, flags.FilePath); err != nil {
+			fmt.Fprintln(os.Stderr, "Error exporting to sqlite:", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Exported %d requests to %s\n", sqlite.Rows(), sqlitePath)
+		printProcessingStats(res.ProcessingStats)
+	},
+}
+
+func init() {
+	exportCmd.Flags().String("sqlite", "", "SQLite file to write, replaced when it exists")
+	rootCmd.AddCommand(exportCmd)
+}
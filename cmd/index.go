@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Kostayne/go-nginx-analyzer/index"
+	"github.com/Kostayne/go-nginx-analyzer/internal/fsutil"
+	"github.com/spf13/cobra"
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index <path-to-access.log>",
+	Short: "Parse a log once into a columnar index for fast repeated queries",
+	Long: "Writes the requests of the log to <log>.idx (or -o) with dictionary encoded ips, uris and user agents " +
+		"and delta encoded times. Every command accepting a log also accepts its index.",
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		if index.IsIndex(flags.FilePath) {
+			fmt.Fprintf(os.Stderr, "%s is already an index\n", flags.FilePath)
+			os.Exit(1)
+		}
+
+		output := flags.Output
+		if output == "" {
+			output = flags.FilePath + index.EXTENSION
+		}
+
+		idx, err := index.BuildFile(flags.FilePath, flags.ExtraFields, flags.RealIp)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		err = fsutil.WriteFileAtomic(output, func(w io.Writer) error {
+			return idx.Write(w)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error saving index:", err)
+			os.Exit(1)
+		}
+
+		printIndexStats(idx, output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+}
+
+func printIndexStats(idx *index.Index, output string) {
+	msg := "Index"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+
+	fmt.Printf("Requests: %d\n", idx.Rows())
+	fmt.Printf("Unique ips: %d\n", len(idx.Ips))
+	fmt.Printf("Unique uris: %d\n", len(idx.Uris))
+	fmt.Printf("Unique user agents: %d\n", len(idx.UserAgents))
+	fmt.Printf("Parse errors: %d\n", idx.ParseErrors)
+
+	if info, err := os.Stat(output); err == nil {
+		fmt.Printf("Saved to %s (%d of %d bytes)\n", output, info.Size(), idx.SourceSize)
+	}
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <result.json>...",
+	Short: "Merge results saved with -o",
+	Long:  "Combines JSON results of several logs, e.g. analyzed on different servers, re-ranking top lists from their full counters.",
+	Args:  cobra.MinimumNArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		results := make([]*analyzer.AnalyzeResult, 0, len(args))
+		for _, fpath := range args {
+			res, err := analyzer.LoadResult(fpath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			results = append(results, res)
+		}
+
+		res, err := mergeSaved(flags, results)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		printResult(res, flags)
+
+		if flags.Output != "" {
+			err = saveToFile(*res, flags.Output)
+			if err != nil {
+				fmt.Println("Error saving to file:", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+}
+
+// Merges results with geoip databases from flags open, so merged top ips are enriched
+func mergeSaved(flags *Flags, results []*analyzer.AnalyzeResult) (*analyzer.AnalyzeResult, error) {
+	params := analyzer.MergeParams{
+		TopN:       flags.Top,
+		Desc:       flags.IsDesc,
+		State:      true,
+		GroupIp:    flags.GroupIp,
+		UserAgents: flags.UserAgents,
+		Crawlers:   flags.Crawlers,
+	}
+
+	if flags.GeoIpDb != "" || flags.AsnDb != "" {
+		geo, err := geoip.Open(flags.GeoIpDb, flags.AsnDb)
+		if err != nil {
+			return nil, err
+		}
+		defer geo.Close()
+
+		params.Geo = geo
+	}
+
+	return analyzer.MergeSaved(results, params)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/spf13/cobra"
+)
+
+var ratesCmd = &cobra.Command{
+	Use:   "rates <path-to-access.log>",
+	Short: "Per client request rates and limit_req suggestion",
+	Long:  "Reports per client request rate distribution, top bursting clients and limit_req values which would have throttled only the chosen share of clients.",
+	Args:  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		rateOpts, zoneName, err := parseRatesFlags(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		opts := analyzerOptions(flags)
+		opts.Rates = rateOpts
+
+		res, err := analyze(flags, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		printRateReport(res.Rates, rateOpts.ThrottlePercent, zoneName)
+		printProcessingStats(res.ProcessingStats)
+
+		if flags.Output != "" {
+			err = saveToFile(*res, flags.Output)
+			if err != nil {
+				fmt.Println("Error saving to file:", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	ratesCmd.Flags().Float64("throttle-percent", 1, "share of clients the suggested limits may throttle")
+	ratesCmd.Flags().String("zone-name", "perip", "limit_req zone name used in the suggestion")
+	rootCmd.AddCommand(ratesCmd)
+}
+
+func parseRatesFlags(cmd *cobra.Command) (*analyzer.RateOptions, string, error) {
+	throttlePercent, throttlePercentErr := cmd.Flags().GetFloat64("throttle-percent")
+	if throttlePercentErr != nil {
+		return nil, "", fmt.Errorf("failed to get throttle-percent flag: %w", throttlePercentErr)
+	}
+
+	if throttlePercent < 0 || throttlePercent >= 100 {
+		return nil, "", fmt.Errorf("throttle-percent must be in [0, 100)")
+	}
+
+	zoneName, zoneNameErr := cmd.Flags().GetString("zone-name")
+	if zoneNameErr != nil {
+		return nil, "", fmt.Errorf("failed to get zone-name flag: %w", zoneNameErr)
+	}
+
+	return &analyzer.RateOptions{ThrottlePercent: throttlePercent}, zoneName, nil
+}
+
+func printRateReport(report *analyzer.RateReport, throttlePercent float64, zoneName string) {
+	msg := "Client request rates"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+	fmt.Printf("Clients: %d\n", report.Clients)
+	fmt.Printf("Peak req/s  p50: %d, p90: %d, p99: %d, max: %d\n", report.PeakRps.P50, report.PeakRps.P90, report.PeakRps.P99, report.PeakRps.Max)
+	fmt.Printf("Peak req/min  p50: %d, p90: %d, p99: %d, max: %d\n", report.PeakRpm.P50, report.PeakRpm.P90, report.PeakRpm.P99, report.PeakRpm.Max)
+	fmt.Println()
+
+	msg = "Top bursting clients"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+	for i, client := range report.TopBursting {
+		fmt.Printf("%d %s: %d req/s, %d req/min, %d requests\n", i+1, client.Ip, client.PeakRps, client.PeakRpm, client.Requests)
+	}
+	fmt.Println()
+
+	msg = "Suggested limit_req"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+	fmt.Printf("limit_req_zone $binary_remote_addr zone=%s:10m rate=%dr/m;\n", zoneName, report.Suggestion.Rate)
+	fmt.Printf("limit_req zone=%s burst=%d nodelay;\n", zoneName, report.Suggestion.Burst)
+	fmt.Printf("Would have throttled %d clients (%.2f%%, target %.2f%%)\n",
+		report.Suggestion.ThrottledClients, report.Suggestion.ThrottledPercent, throttlePercent)
+	fmt.Println()
+}
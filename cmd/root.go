@@ -3,22 +3,52 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/crawlers"
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/Kostayne/go-nginx-analyzer/internal/fsutil"
+	"github.com/Kostayne/go-nginx-analyzer/metrics"
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/realip"
+	"github.com/Kostayne/go-nginx-analyzer/uripath"
+	"github.com/Kostayne/go-nginx-analyzer/useragent"
 	"github.com/spf13/cobra"
 )
 
 type Flags struct {
-	FilePath string
-	Top      int
-	IsDesc   bool
-	DatesBy  string
-	Output   string
+	FilePath    string
+	Top         int
+	IsDesc      bool
+	DatesBy     string
+	Output      string
+	ExtraFields []parser.ExtraField
+	RealIp      *realip.Resolver
+	GroupIp     *analyzer.SubnetMasks
+	GeoIpDb     string
+	AsnDb       string
+	Countries   []string
+	UserAgents  *useragent.Classifier
+	ExcludeBots bool
+	Crawlers    *crawlers.Ranges
+	Uris        *uripath.Normalizer
+	Funnel      *analyzer.FunnelOptions
 }
 
+// Output formats of the root command
+const (
+	FORMAT_TEXT        = "text"
+	FORMAT_OPENMETRICS = "openmetrics"
+)
+
+// Commands reporting browsers, devices and bots, the others classify user agents only for --exclude-bots
+var USER_AGENT_COMMANDS = []string{"nginx-an", "merge", "export", "serve"}
+
 var rootCmd = &cobra.Command{
 	Use:   "nginx-an <path-to-access.log>",
 	Short: "Nginx access log analyzer",
@@ -32,17 +62,46 @@ var rootCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		res, err := analyzer.Analyze(flags.FilePath, flags.Top, flags.IsDesc, flags.DatesBy)
+		format, err := parseFormatFlag(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		statePath, err := cmd.Flags().GetString("state")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to get state flag: %w", err))
+			os.Exit(1)
+		}
+
+		mergeable, err := cmd.Flags().GetBool("mergeable")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to get mergeable flag: %w", err))
+			os.Exit(1)
+		}
+
+		var res *analyzer.AnalyzeResult
+		if statePath != "" {
+			res, err = analyzeIncremental(cmd, flags, statePath)
+		} else {
+			opts := analyzerOptions(flags)
+			opts.State = mergeable
+			res, err = analyze(flags, opts)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
 
-		printSummary(res)
-		printTopInfo(res.Ips, "Top ips", flags.Top)
-		printTopInfo(res.Codes, "Top status codes", flags.Top)
-		printTopInfo(res.Dates, "Top dates", flags.Top)
-		printProcessingStats(res.ProcessingStats)
+		if format == FORMAT_OPENMETRICS {
+			if err := writeOpenMetrics(res, flags.Output); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+
+		printResult(res, flags)
 
 		if flags.Output != "" {
 			err = saveToFile(*res, flags.Output)
@@ -55,11 +114,62 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.Flags().String("format", FORMAT_TEXT, "output format: text (report, -o saves JSON), openmetrics (textfile to -o or stdout)")
+	rootCmd.Flags().String("state", "", "checkpoint file, only bytes appended since the previous run are analyzed")
+	rootCmd.Flags().Bool("mergeable", false, "keep full counters in the -o JSON, so it can be merged")
 	rootCmd.PersistentFlags().Bool("desc", true, "sort in descending order")
 	rootCmd.PersistentFlags().Bool("asc", false, "sort in ascending order")
 	rootCmd.PersistentFlags().Int("top", 10, "limit the number of results")
 	rootCmd.PersistentFlags().String("dates-by", "none", "group dates by: none, hour, day")
-	rootCmd.PersistentFlags().StringP("output", "o", "", "json output file name")
+	rootCmd.PersistentFlags().StringP("output", "o", "", "output file name, JSON unless --format is set")
+	rootCmd.PersistentFlags().StringSlice("log-fields", nil, "fields appended after the user agent: http_x_forwarded_for, http_x_real_ip, request_time")
+	rootCmd.PersistentFlags().String("client-ip", "remote", "client ip source: remote, xff, real-ip")
+	rootCmd.PersistentFlags().String("group-ip", "", "group ips by subnet masks for v4 and v6, e.g. /24,/64")
+	rootCmd.PersistentFlags().String("geoip-db", "", "local MaxMind country/city .mmdb file")
+	rootCmd.PersistentFlags().String("asn-db", "", "local MaxMind ASN .mmdb file")
+	rootCmd.PersistentFlags().StringSlice("country", nil, "only analyze requests from these ISO country codes, requires --geoip-db")
+	rootCmd.PersistentFlags().String("ua-rules", "", "JSON file with user agent rules taking precedence over the built-in ones")
+	rootCmd.PersistentFlags().Bool("exclude-bots", false, "exclude bots and crawlers from every report")
+	rootCmd.PersistentFlags().StringToString("crawler-ranges", nil, "published crawler ip ranges (JSON or CIDR list) by bot name, e.g. Googlebot=googlebot.json")
+	rootCmd.PersistentFlags().Bool("template-uris", false, "replace ids, uuids, hashes and dates in uris with placeholders")
+	rootCmd.PersistentFlags().StringSlice("route", nil, "route patterns collapsing uris, e.g. /users/:id/orders,/static/*")
+	rootCmd.PersistentFlags().Bool("strip-query", false, "drop query strings from uris")
+	rootCmd.PersistentFlags().StringSlice("keep-query", nil, "query params kept in uris, implies --strip-query for the others")
+	rootCmd.PersistentFlags().StringSlice("funnel", nil, "funnel steps visitors go through in order, e.g. /products,/cart,/checkout")
+	rootCmd.PersistentFlags().StringSlice("trusted-proxies", nil, "trusted proxy CIDRs skipped while resolving the client ip")
+}
+
+// Analyzer options taken from flags, geoip databases are opened by analyze
+func analyzerOptions(flags *Flags) analyzer.Options {
+	return analyzer.Options{
+		TopN:        flags.Top,
+		Desc:        flags.IsDesc,
+		DatesBy:     flags.DatesBy,
+		ExtraFields: flags.ExtraFields,
+		RealIp:      flags.RealIp,
+		GroupIp:     flags.GroupIp,
+		Countries:   flags.Countries,
+		UserAgents:  flags.UserAgents,
+		ExcludeBots: flags.ExcludeBots,
+		Crawlers:    flags.Crawlers,
+		Uris:        flags.Uris,
+		Funnel:      flags.Funnel,
+	}
+}
+
+// Runs the analyzer with geoip databases from flags open for the run
+func analyze(flags *Flags, opts analyzer.Options) (*analyzer.AnalyzeResult, error) {
+	if flags.GeoIpDb != "" || flags.AsnDb != "" {
+		geo, err := geoip.Open(flags.GeoIpDb, flags.AsnDb)
+		if err != nil {
+			return nil, err
+		}
+		defer geo.Close()
+
+		opts.Geo = geo
+	}
+
+	return analyzer.Analyze(flags.FilePath, opts)
 }
 
 func Execute() {
@@ -75,12 +185,23 @@ func saveToFile(res analyzer.AnalyzeResult, fileName string) error {
 		return err
 	}
 
-	err = os.WriteFile(fileName, jsonData, 0644)
-	if err != nil {
+	// a failed save keeps the previous result, which a later merge may read
+	return fsutil.WriteFileAtomic(fileName, func(w io.Writer) error {
+		_, err := w.Write(jsonData)
 		return err
+	})
+}
+
+// Writes the textfile atomically, so the node_exporter textfile collector never reads a partial one
+func writeOpenMetrics(res *analyzer.AnalyzeResult, fileName string) error {
+	now := time.Now()
+	if fileName == "" {
+		return metrics.WriteOpenMetrics(os.Stdout, res, now)
 	}
 
-	return nil
+	return fsutil.WriteFileAtomic(fileName, func(w io.Writer) error {
+		return metrics.WriteOpenMetrics(w, res, now)
+	})
 }
 
 func parseFlags(cmd *cobra.Command, args []string) (*Flags, error) {
@@ -106,22 +227,73 @@ func parseFlags(cmd *cobra.Command, args []string) (*Flags, error) {
 		return nil, err
 	}
 
+	extraFields, err := parseLogFieldsFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	realIp, err := parseClientIpFlags(cmd, extraFields)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIp, err := parseGroupIpFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	geoIpDb, asnDb, countries, err := parseGeoFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgents, excludeBots, err := parseUserAgentFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	crawlerRanges, err := parseCrawlerRangesFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	uris, err := parseUriFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	funnel, err := parseFunnelFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Flags{
-		FilePath: filePath,
-		Top:      top,
-		IsDesc:   isDesc,
-		DatesBy:  datesBy,
-		Output:   output,
+		FilePath:    filePath,
+		Top:         top,
+		IsDesc:      isDesc,
+		DatesBy:     datesBy,
+		Output:      output,
+		ExtraFields: extraFields,
+		RealIp:      realIp,
+		GroupIp:     groupIp,
+		GeoIpDb:     geoIpDb,
+		AsnDb:       asnDb,
+		Countries:   countries,
+		UserAgents:  userAgents,
+		ExcludeBots: excludeBots,
+		Crawlers:    crawlerRanges,
+		Uris:        uris,
+		Funnel:      funnel,
 	}, nil
 }
 
 func parseSortFlags(cmd *cobra.Command) (bool, error) {
-	desc, descErr := cmd.PersistentFlags().GetBool("desc")
+	desc, descErr := cmd.Flags().GetBool("desc")
 	if descErr != nil {
 		return false, fmt.Errorf("failed to get desc flag: %w", descErr)
 	}
 
-	asc, ascErr := cmd.PersistentFlags().GetBool("asc")
+	asc, ascErr := cmd.Flags().GetBool("asc")
 	if ascErr != nil {
 		return false, fmt.Errorf("failed to get asc flag: %w", ascErr)
 	}
@@ -134,7 +306,7 @@ func parseSortFlags(cmd *cobra.Command) (bool, error) {
 }
 
 func parseTopFlag(cmd *cobra.Command) (int, error) {
-	top, topErr := cmd.PersistentFlags().GetInt("top")
+	top, topErr := cmd.Flags().GetInt("top")
 	if topErr != nil {
 		return 0, fmt.Errorf("failed to get top flag: %w", topErr)
 	}
@@ -147,7 +319,7 @@ func parseTopFlag(cmd *cobra.Command) (int, error) {
 }
 
 func parseDatesByFlag(cmd *cobra.Command) (string, error) {
-	datesBy, datesByErr := cmd.PersistentFlags().GetString("dates-by")
+	datesBy, datesByErr := cmd.Flags().GetString("dates-by")
 	if datesByErr != nil {
 		return "", fmt.Errorf("failed to get dates-by flag: %w", datesByErr)
 	}
@@ -160,7 +332,7 @@ func parseDatesByFlag(cmd *cobra.Command) (string, error) {
 }
 
 func parseOutputFlag(cmd *cobra.Command) (string, error) {
-	output, outputErr := cmd.PersistentFlags().GetString("output")
+	output, outputErr := cmd.Flags().GetString("output")
 	if outputErr != nil {
 		return "", fmt.Errorf("failed to get output flag: %w", outputErr)
 	}
@@ -168,6 +340,222 @@ func parseOutputFlag(cmd *cobra.Command) (string, error) {
 	return output, nil
 }
 
+func parseFormatFlag(cmd *cobra.Command) (string, error) {
+	format, formatErr := cmd.Flags().GetString("format")
+	if formatErr != nil {
+		return "", fmt.Errorf("failed to get format flag: %w", formatErr)
+	}
+
+	if format != FORMAT_TEXT && format != FORMAT_OPENMETRICS {
+		return "", fmt.Errorf("invalid format %q, expected %s or %s", format, FORMAT_TEXT, FORMAT_OPENMETRICS)
+	}
+
+	return format, nil
+}
+
+func parseLogFieldsFlag(cmd *cobra.Command) ([]parser.ExtraField, error) {
+	names, namesErr := cmd.Flags().GetStringSlice("log-fields")
+	if namesErr != nil {
+		return nil, fmt.Errorf("failed to get log-fields flag: %w", namesErr)
+	}
+
+	fields := make([]parser.ExtraField, 0, len(names))
+	for _, name := range names {
+		field := parser.ExtraField(strings.TrimPrefix(name, "$"))
+		if !parser.IsValidExtraField(field) {
+			return nil, fmt.Errorf("unknown log field %q", name)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// Returns nil resolver when the client ip is taken from remote_addr
+func parseClientIpFlags(cmd *cobra.Command, extraFields []parser.ExtraField) (*realip.Resolver, error) {
+	source, sourceErr := cmd.Flags().GetString("client-ip")
+	if sourceErr != nil {
+		return nil, fmt.Errorf("failed to get client-ip flag: %w", sourceErr)
+	}
+
+	trustedList, trustedErr := cmd.Flags().GetStringSlice("trusted-proxies")
+	if trustedErr != nil {
+		return nil, fmt.Errorf("failed to get trusted-proxies flag: %w", trustedErr)
+	}
+
+	if !realip.IsValidSource(realip.Source(source)) {
+		return nil, fmt.Errorf("client-ip must be one of: remote, xff, real-ip")
+	}
+
+	if realip.Source(source) == realip.SOURCE_REMOTE_ADDR {
+		return nil, nil
+	}
+
+	requiredField := parser.FIELD_X_FORWARDED_FOR
+	if realip.Source(source) == realip.SOURCE_X_REAL_IP {
+		requiredField = parser.FIELD_X_REAL_IP
+	}
+
+	if !slices.Contains(extraFields, requiredField) {
+		return nil, fmt.Errorf("client-ip %s requires %s in --log-fields", source, requiredField)
+	}
+
+	trusted, err := realip.ParsePrefixes(trustedList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted-proxies: %w", err)
+	}
+
+	return realip.New(realip.Source(source), trusted)
+}
+
+// Returns nil when ips aren't grouped
+func parseGroupIpFlag(cmd *cobra.Command) (*analyzer.SubnetMasks, error) {
+	groupIp, groupIpErr := cmd.Flags().GetString("group-ip")
+	if groupIpErr != nil {
+		return nil, fmt.Errorf("failed to get group-ip flag: %w", groupIpErr)
+	}
+
+	if groupIp == "" {
+		return nil, nil
+	}
+
+	masks, err := analyzer.ParseSubnetMasks(groupIp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group-ip: %w", err)
+	}
+
+	return &masks, nil
+}
+
+func parseGeoFlags(cmd *cobra.Command) (string, string, []string, error) {
+	geoIpDb, geoIpDbErr := cmd.Flags().GetString("geoip-db")
+	if geoIpDbErr != nil {
+		return "", "", nil, fmt.Errorf("failed to get geoip-db flag: %w", geoIpDbErr)
+	}
+
+	asnDb, asnDbErr := cmd.Flags().GetString("asn-db")
+	if asnDbErr != nil {
+		return "", "", nil, fmt.Errorf("failed to get asn-db flag: %w", asnDbErr)
+	}
+
+	countries, countriesErr := cmd.Flags().GetStringSlice("country")
+	if countriesErr != nil {
+		return "", "", nil, fmt.Errorf("failed to get country flag: %w", countriesErr)
+	}
+
+	if len(countries) > 0 && geoIpDb == "" {
+		return "", "", nil, fmt.Errorf("--country requires --geoip-db")
+	}
+
+	// ISO codes are upper case, the placeholder of unresolved ips isn't
+	for i, country := range countries {
+		country = strings.TrimSpace(country)
+		if strings.EqualFold(country, geoip.UNKNOWN_COUNTRY) {
+			countries[i] = geoip.UNKNOWN_COUNTRY
+		} else {
+			countries[i] = strings.ToUpper(country)
+		}
+	}
+
+	return geoIpDb, asnDb, countries, nil
+}
+
+func parseUserAgentFlags(cmd *cobra.Command) (*useragent.Classifier, bool, error) {
+	rulesPath, rulesErr := cmd.Flags().GetString("ua-rules")
+	if rulesErr != nil {
+		return nil, false, fmt.Errorf("failed to get ua-rules flag: %w", rulesErr)
+	}
+
+	excludeBots, excludeBotsErr := cmd.Flags().GetBool("exclude-bots")
+	if excludeBotsErr != nil {
+		return nil, false, fmt.Errorf("failed to get exclude-bots flag: %w", excludeBotsErr)
+	}
+
+	if rulesPath == "" {
+		if !excludeBots && !slices.Contains(USER_AGENT_COMMANDS, cmd.Name()) {
+			return nil, false, nil
+		}
+
+		return useragent.Default(), excludeBots, nil
+	}
+
+	classifier, err := useragent.Load(rulesPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return classifier, excludeBots, nil
+}
+
+// Returns nil when no ranges are provided
+func parseCrawlerRangesFlag(cmd *cobra.Command) (*crawlers.Ranges, error) {
+	files, filesErr := cmd.Flags().GetStringToString("crawler-ranges")
+	if filesErr != nil {
+		return nil, fmt.Errorf("failed to get crawler-ranges flag: %w", filesErr)
+	}
+
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	return crawlers.LoadRanges(files)
+}
+
+// Returns nil when uris are counted as logged
+func parseUriFlags(cmd *cobra.Command) (*uripath.Normalizer, error) {
+	templateUris, templateUrisErr := cmd.Flags().GetBool("template-uris")
+	if templateUrisErr != nil {
+		return nil, fmt.Errorf("failed to get template-uris flag: %w", templateUrisErr)
+	}
+
+	routes, routesErr := cmd.Flags().GetStringSlice("route")
+	if routesErr != nil {
+		return nil, fmt.Errorf("failed to get route flag: %w", routesErr)
+	}
+
+	stripQuery, stripQueryErr := cmd.Flags().GetBool("strip-query")
+	if stripQueryErr != nil {
+		return nil, fmt.Errorf("failed to get strip-query flag: %w", stripQueryErr)
+	}
+
+	keepQuery, keepQueryErr := cmd.Flags().GetStringSlice("keep-query")
+	if keepQueryErr != nil {
+		return nil, fmt.Errorf("failed to get keep-query flag: %w", keepQueryErr)
+	}
+
+	if !templateUris && len(routes) == 0 && !stripQuery && len(keepQuery) == 0 {
+		return nil, nil
+	}
+
+	return uripath.New(uripath.Options{
+		Auto:        templateUris,
+		Routes:      routes,
+		StripQuery:  stripQuery,
+		QueryParams: keepQuery,
+	})
+}
+
+// Returns nil when no steps are provided
+func parseFunnelFlag(cmd *cobra.Command) (*analyzer.FunnelOptions, error) {
+	steps, stepsErr := cmd.Flags().GetStringSlice("funnel")
+	if stepsErr != nil {
+		return nil, fmt.Errorf("failed to get funnel flag: %w", stepsErr)
+	}
+
+	if len(steps) == 0 {
+		return nil, nil
+	}
+
+	for _, step := range steps {
+		if !strings.HasPrefix(step, "/") {
+			return nil, fmt.Errorf("invalid funnel step %q: must start with \"/\"", step)
+		}
+	}
+
+	return &analyzer.FunnelOptions{Steps: steps}, nil
+}
+
 func isValidDatesByOption(datesBy string) bool {
 	validOptions := []string{"none", "hour", "day"}
 	for _, option := range validOptions {
@@ -178,6 +566,40 @@ func isValidDatesByOption(datesBy string) bool {
 	return false
 }
 
+// Prints every report of the result
+func printResult(res *analyzer.AnalyzeResult, flags *Flags) {
+	printSummary(res)
+	if flags.GroupIp != nil {
+		printTopInfo(res.Subnets, "Top subnets", flags.Top)
+	} else {
+		printTopIps(res, flags.Top)
+	}
+	printHotSubnets(res.HotSubnets)
+	printTopInfo(res.Codes, "Top status codes", flags.Top)
+	printTopInfo(res.Uris, "Top uris", flags.Top)
+	printTopInfo(res.Dates, "Top dates", flags.Top)
+	printTopInfo(res.UserAgents, "Top user agents", flags.Top)
+	printTopInfo(res.Browsers, "Top browsers", flags.Top)
+	printTopInfo(res.OperatingSystems, "Top operating systems", flags.Top)
+	printTopInfo(res.Devices, "Top devices", flags.Top)
+	if len(res.BotReports) > 0 {
+		printBotReports(res.BotReports, flags.Top)
+	}
+	if res.Countries != nil {
+		printTopInfo(res.Countries, "Top countries", flags.Top)
+	}
+	if res.Asns != nil {
+		printTopInfo(res.Asns, "Top ASNs", flags.Top)
+	}
+	if flags.RealIp != nil {
+		printTopInfo(res.RemoteAddrs, "Top remote addrs", flags.Top)
+	}
+	if res.Funnel != nil {
+		printFunnelReport(res.Funnel, flags.Top)
+	}
+	printProcessingStats(res.ProcessingStats)
+}
+
 func printSummary(res *analyzer.AnalyzeResult) {
 	fmt.Println("SUMMARY")
 	fmt.Println(strings.Repeat("=", 7))
@@ -203,13 +625,103 @@ func printTopInfo[T comparable](hitsInfo []analyzer.HitsInfo[T], msg string, lim
 	fmt.Println()
 }
 
-func printProcessingStats(stats struct {
-	FileSize    int64  `json:"fileSize"`
-	ParseErrors uint64 `json:"parseErrors"`
-}) {
+func printTopIps(res *analyzer.AnalyzeResult, limit int) {
+	msg := "Top ips"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+
+	for i, info := range res.Ips[:min(limit, len(res.Ips))] {
+		geo, ok := res.IpsGeo[info.Key]
+		if !ok {
+			fmt.Printf("%d %v: %d \n", i+1, info.Key, info.Hits)
+			continue
+		}
+
+		fmt.Printf("%d %v: %d (%s)\n", i+1, info.Key, info.Hits, formatGeo(geo))
+	}
+	fmt.Println()
+}
+
+func formatGeo(geo geoip.Info) string {
+	parts := []string{geo.Country}
+	if geo.City != "" {
+		parts = append(parts, geo.City)
+	}
+	if geo.Asn.Number != 0 {
+		parts = append(parts, geo.Asn.String())
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func printBotReports(reports []analyzer.BotReport, limit int) {
+	msg := "Bots"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+
+	for i, report := range reports {
+		fmt.Printf("%d %s: %d hits, %.2f MB\n", i+1, report.Name, report.Hits, float64(report.Bytes)/(1024*1024))
+
+		codes := make([]string, 0, len(report.Codes))
+		for _, code := range report.Codes {
+			codes = append(codes, fmt.Sprintf("%d: %d", code.Key, code.Hits))
+		}
+		fmt.Printf("  Status codes: %s\n", strings.Join(codes, ", "))
+
+		for _, path := range report.Paths[:min(limit, len(report.Paths))] {
+			fmt.Printf("  %s: %d\n", path.Key, path.Hits)
+		}
+
+		if report.Verification != nil {
+			fmt.Printf("  Verified: %d, impersonators: %d\n", report.Verification.VerifiedHits, report.Verification.ImpersonatorHits)
+			for _, ip := range report.Verification.Impersonators {
+				fmt.Printf("    %s: %d\n", ip.Key, ip.Hits)
+			}
+		}
+	}
+	fmt.Println()
+}
+
+func printFunnelReport(report *analyzer.FunnelReport, limit int) {
+	msg := "Funnel"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+	for i, step := range report.Steps {
+		if i == 0 {
+			fmt.Printf("%d %s: %d visitors\n", i+1, step.Step, step.Visitors)
+			continue
+		}
+
+		fmt.Printf("%d %s: %d visitors, %.2f%% of previous, %.2f%% of first, median %s since previous\n",
+			i+1, step.Step, step.Visitors, step.Conversion, step.TotalConversion, step.MedianTime.Round(time.Second))
+	}
+	fmt.Println()
+
+	printTopInfo(report.Sequences, "Top navigation sequences", limit)
+}
+
+func printHotSubnets(subnets []analyzer.HotSubnet) {
+	if len(subnets) == 0 {
+		return
+	}
+
+	msg := "Hot subnets"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+
+	for i, subnet := range subnets {
+		fmt.Printf("%d %s: %d (%d ips, max %d per ip)\n", i+1, subnet.Prefix, subnet.Hits, subnet.UniqueIps, subnet.MaxIpHits)
+	}
+	fmt.Println()
+}
+
+func printProcessingStats(stats analyzer.ProcessingStats) {
 	fmt.Println("PROCESSING STATISTICS")
 	fmt.Println(strings.Repeat("=", 22))
 	fmt.Printf("File Size: %.2f MB\n", float64(stats.FileSize)/(1024*1024))
 	fmt.Printf("Parse Errors: %d\n", stats.ParseErrors)
+	if stats.Filtered > 0 {
+		fmt.Printf("Filtered Out: %d\n", stats.Filtered)
+	}
 	fmt.Println()
 }
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGeoFlags(t *testing.T) {
+	parse := func(t *testing.T, args ...string) ([]string, error) {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("geoip-db", "", "")
+		cmd.Flags().String("asn-db", "", "")
+		cmd.Flags().StringSlice("country", nil, "")
+		require.NoError(t, cmd.ParseFlags(args))
+
+		_, _, countries, err := parseGeoFlags(cmd)
+		return countries, err
+	}
+
+	t.Run("should upper case country codes", func(t *testing.T) {
+		countries, err := parse(t, "--geoip-db", "GeoLite2-Country.mmdb", "--country", "de, us")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"DE", "US"}, countries)
+	})
+
+	t.Run("should keep the unknown country matching unresolved ips", func(t *testing.T) {
+		countries, err := parse(t, "--geoip-db", "GeoLite2-Country.mmdb", "--country", "de,Unknown")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"DE", geoip.UNKNOWN_COUNTRY}, countries)
+	})
+
+	t.Run("should require a geoip database", func(t *testing.T) {
+		_, err := parse(t, "--country", "de")
+		assert.ErrorContains(t, err, "--country requires --geoip-db")
+	})
+}
+
+func TestParseUserAgentFlags(t *testing.T) {
+	parse := func(t *testing.T, use string, args ...string) (bool, bool) {
+		cmd := &cobra.Command{Use: use}
+		cmd.Flags().String("ua-rules", "", "")
+		cmd.Flags().Bool("exclude-bots", false, "")
+		require.NoError(t, cmd.ParseFlags(args))
+
+		classifier, excludeBots, err := parseUserAgentFlags(cmd)
+		require.NoError(t, err)
+		return classifier != nil, excludeBots
+	}
+
+	t.Run("should classify user agents for reports showing them", func(t *testing.T) {
+		classified, _ := parse(t, "nginx-an <path-to-access.log>")
+		assert.True(t, classified)
+	})
+
+	t.Run("should skip the classifier for other reports", func(t *testing.T) {
+		classified, _ := parse(t, "rates <path-to-access.log>")
+		assert.False(t, classified)
+	})
+
+	t.Run("should classify user agents to exclude bots", func(t *testing.T) {
+		classified, excludeBots := parse(t, "rates <path-to-access.log>", "--exclude-bots")
+		assert.True(t, classified)
+		assert.True(t, excludeBots)
+	})
+}
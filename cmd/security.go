@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/security"
+	"github.com/spf13/cobra"
+)
+
+var securityCmd = &cobra.Command{
+	Use:   "security <path-to-access.log>",
+	Short: "Detect probes, injections, traversal and scanners",
+	Long:  "Matches uris, user agents and referrers against attack signatures and ranks offending ips.",
+	Args:  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		scanner, err := parseSecurityRulesFlag(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		opts := analyzerOptions(flags)
+		opts.Security = scanner
+
+		res, err := analyze(flags, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		printSecurityReport(res.Security, res.TotalRequests)
+		printProcessingStats(res.ProcessingStats)
+
+		if flags.Output != "" {
+			err = saveToFile(*res, flags.Output)
+			if err != nil {
+				fmt.Println("Error saving to file:", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	securityCmd.Flags().String("security-rules", "", "YAML or JSON file with rules added to the built-in ones")
+	rootCmd.AddCommand(securityCmd)
+}
+
+func parseSecurityRulesFlag(cmd *cobra.Command) (*security.Scanner, error) {
+	rulesPath, rulesErr := cmd.Flags().GetString("security-rules")
+	if rulesErr != nil {
+		return nil, fmt.Errorf("failed to get security-rules flag: %w", rulesErr)
+	}
+
+	if rulesPath == "" {
+		return security.Default(), nil
+	}
+
+	return security.Load(rulesPath)
+}
+
+func printSecurityReport(report *analyzer.SecurityReport, totalRequests uint64) {
+	msg := "Security"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+	fmt.Printf("Suspicious requests: %d of %d\n", report.Hits, totalRequests)
+	fmt.Println()
+
+	printTopInfo(report.Categories, "Top attack categories", len(report.Categories))
+	printTopInfo(report.Rules, "Top matched rules", len(report.Rules))
+
+	msg = "Top offending ips"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+
+	for i, offender := range report.Offenders {
+		fmt.Printf("%d %s: %d requests, %s - %s\n", i+1, offender.Ip, offender.Hits,
+			offender.FirstSeen.Format("2006-01-02 15:04:05"), offender.LastSeen.Format("2006-01-02 15:04:05"))
+		fmt.Printf("  Categories: %s\n", strings.Join(offender.Categories, ", "))
+
+		rules := make([]string, 0, len(offender.Rules))
+		for _, rule := range offender.Rules {
+			rules = append(rules, fmt.Sprintf("%s: %d", rule.Key, rule.Hits))
+		}
+		fmt.Printf("  Rules: %s\n", strings.Join(rules, ", "))
+	}
+	fmt.Println()
+}
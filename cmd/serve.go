@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/Kostayne/go-nginx-analyzer/metrics"
+	"github.com/Kostayne/go-nginx-analyzer/server"
+	"github.com/spf13/cobra"
+)
+
+type ServeFlags struct {
+	Listen       string
+	Interval     time.Duration
+	MetricRoutes int
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve <path-to-access.log>...",
+	Short: "Serve the analysis over a REST API",
+	Long: `Analyzes the logs in the background every --interval and serves the result:
+  GET /api/status                                       files and time of the last analysis
+  GET /api/summary?since=&until=                        the analysis result
+  GET /api/top/{ips,remoteAddrs,codes,uris,userAgents}?n=20&since=&until=
+  GET /api/timeseries?bucket=5m&since=&until=           requests per bucket
+  GET /metrics                                          Prometheus metrics of the last analysis
+since and until are RFC 3339 times or durations back from now, like 1h. Timeseries are cut from the last analysis,
+other requests with them analyze the logs on demand, one at a time.`,
+	Args: cobra.MinimumNArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		serveFlags, err := parseServeFlags(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		if err := serve(flags, args, serveFlags); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("listen", ":8080", "address to listen on")
+	serveCmd.Flags().Duration("interval", server.DEFAULT_INTERVAL, "background re-analysis interval")
+	serveCmd.Flags().Int("metric-routes", metrics.DEFAULT_ROUTES, "busiest routes labeled in /metrics, others are collapsed into route=\"other\"")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func parseServeFlags(cmd *cobra.Command) (*ServeFlags, error) {
+	listen, listenErr := cmd.Flags().GetString("listen")
+	if listenErr != nil {
+		return nil, fmt.Errorf("failed to get listen flag: %w", listenErr)
+	}
+
+	interval, intervalErr := cmd.Flags().GetDuration("interval")
+	if intervalErr != nil {
+		return nil, fmt.Errorf("failed to get interval flag: %w", intervalErr)
+	}
+
+	if interval < time.Second {
+		return nil, fmt.Errorf("interval must be at least 1s")
+	}
+
+	metricRoutes, metricRoutesErr := cmd.Flags().GetInt("metric-routes")
+	if metricRoutesErr != nil {
+		return nil, fmt.Errorf("failed to get metric-routes flag: %w", metricRoutesErr)
+	}
+
+	if metricRoutes < 1 {
+		return nil, fmt.Errorf("metric-routes must be at least 1")
+	}
+
+	return &ServeFlags{Listen: listen, Interval: interval, MetricRoutes: metricRoutes}, nil
+}
+
+// Serves until SIGINT or SIGTERM, geoip databases stay open meanwhile
+func serve(flags *Flags, paths []string, serveFlags *ServeFlags) error {
+	opts := analyzerOptions(flags)
+
+	if flags.GeoIpDb != "" || flags.AsnDb != "" {
+		geo, err := geoip.Open(flags.GeoIpDb, flags.AsnDb)
+		if err != nil {
+			return err
+		}
+		defer geo.Close()
+
+		opts.Geo = geo
+	}
+
+	srv := server.New(server.Config{
+		Paths:        paths,
+		Options:      opts,
+		Interval:     serveFlags.Interval,
+		MetricRoutes: serveFlags.MetricRoutes,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go srv.Run(ctx)
+
+	httpServer := &http.Server{
+		Addr:              serveFlags.Listen,
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("listening on %s", serveFlags.Listen)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/spf13/cobra"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions <path-to-access.log>",
+	Short: "Visitor sessions and flow",
+	Long:  "Groups page views by ip and user agent into sessions split on inactivity, reports session duration and depth, bounce rate and top entry and exit pages.",
+	Args:  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		sessionOpts, err := parseSessionFlags(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		opts := analyzerOptions(flags)
+		opts.Sessions = sessionOpts
+
+		res, err := analyze(flags, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		printSessionReport(res.Sessions, flags.Top)
+		printProcessingStats(res.ProcessingStats)
+
+		if flags.Output != "" {
+			err = saveToFile(*res, flags.Output)
+			if err != nil {
+				fmt.Println("Error saving to file:", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	sessionsCmd.Flags().Duration("session-timeout", analyzer.DEFAULT_SESSION_TIMEOUT, "inactivity starting a new session")
+	sessionsCmd.Flags().Bool("session-assets", false, "count static files (css, js, images, fonts) as page views")
+	rootCmd.AddCommand(sessionsCmd)
+}
+
+func parseSessionFlags(cmd *cobra.Command) (*analyzer.SessionOptions, error) {
+	timeout, timeoutErr := cmd.Flags().GetDuration("session-timeout")
+	if timeoutErr != nil {
+		return nil, fmt.Errorf("failed to get session-timeout flag: %w", timeoutErr)
+	}
+
+	if timeout < time.Second {
+		return nil, fmt.Errorf("session-timeout must be at least 1s")
+	}
+
+	assets, assetsErr := cmd.Flags().GetBool("session-assets")
+	if assetsErr != nil {
+		return nil, fmt.Errorf("failed to get session-assets flag: %w", assetsErr)
+	}
+
+	return &analyzer.SessionOptions{Timeout: timeout, Assets: assets}, nil
+}
+
+func printSessionReport(report *analyzer.SessionReport, limit int) {
+	msg := "Sessions"
+	fmt.Println(msg)
+	fmt.Println(strings.Repeat("=", len(msg)))
+	fmt.Printf("Sessions: %d, visitors: %d\n", report.Sessions, report.Visitors)
+	fmt.Printf("Duration  avg: %s, p50: %s, p90: %s, p99: %s, max: %s\n",
+		seconds(report.Duration.Avg), seconds(float64(report.Duration.P50)), seconds(float64(report.Duration.P90)),
+		seconds(float64(report.Duration.P99)), seconds(float64(report.Duration.Max)))
+	fmt.Printf("Depth  avg: %.1f, p50: %d, p90: %d, p99: %d, max: %d\n",
+		report.Depth.Avg, report.Depth.P50, report.Depth.P90, report.Depth.P99, report.Depth.Max)
+	fmt.Printf("Bounce rate: %.2f%%\n", report.BounceRate)
+	fmt.Println()
+
+	printTopInfo(report.EntryPages, "Top entry pages", limit)
+	printTopInfo(report.ExitPages, "Top exit pages", limit)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Second)
+}
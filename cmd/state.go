@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/Kostayne/go-nginx-analyzer/index"
+	"github.com/Kostayne/go-nginx-analyzer/internal/fsutil"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Flags which only shape the report, a checkpoint resumes with any of their values
+var REPORT_FLAGS = []string{"top", "desc", "asc", "output", "format", "state", "mergeable", "group-ip"}
+
+// Analyzes the log appended since the checkpoint and saves the new one.
+// The log is analyzed from the start when there's no checkpoint, it was
+// rotated or the counting options changed.
+func analyzeIncremental(cmd *cobra.Command, flags *Flags, statePath string) (*analyzer.AnalyzeResult, error) {
+	if index.IsIndex(flags.FilePath) {
+		return nil, fmt.Errorf("--state requires a log, an index is already parsed once")
+	}
+
+	options := stateOptions(cmd)
+
+	opts := analyzerOptions(flags)
+	if flags.GeoIpDb != "" || flags.AsnDb != "" {
+		geo, err := geoip.Open(flags.GeoIpDb, flags.AsnDb)
+		if err != nil {
+			return nil, err
+		}
+		defer geo.Close()
+
+		// ips resolved with an updated database may land in other countries
+		opts.Geo = geo
+		options = append(options, "geoip-version="+geo.Version())
+	}
+
+	prev, err := analyzer.LoadCheckpoint(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if prev != nil {
+		if err := prev.Check(flags.FilePath, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Analyzing %s from the start: %v\n", flags.FilePath, err)
+			prev = nil
+		}
+	}
+
+	res, checkpoint, err := analyzer.AnalyzeIncremental(flags.FilePath, opts, prev, options)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fsutil.WriteFileAtomic(statePath, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(checkpoint)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save state: %w", err)
+	}
+
+	return res, nil
+}
+
+// Set flags changing what is counted, sorted by name
+func stateOptions(cmd *cobra.Command) []string {
+	options := []string{}
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if !slices.Contains(REPORT_FLAGS, flag.Name) {
+			options = append(options, flag.Name+"="+flag.Value.String())
+		}
+	})
+
+	return options
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/geoip"
+	"github.com/Kostayne/go-nginx-analyzer/tui"
+	"github.com/spf13/cobra"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui <path-to-access.log>",
+	Short: "Interactive terminal UI",
+	Long: `Shows the summary, requests over time and top lists in the terminal.
+Enter drills into the selected ip or uri, / edits the filter line, like "since=1h status=5xx uri=/login".
+With --follow the shown screen is re-analyzed every --interval.`,
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		flags, err := parseFlags(cmd, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		config, err := parseTuiFlags(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		config.Title = flags.FilePath
+
+		if err := runTui(flags, config); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	tuiCmd.Flags().String("filter", "", "initial filter, e.g. \"since=1h status=5xx\"")
+	tuiCmd.Flags().Bool("follow", false, "re-analyze the log every interval")
+	tuiCmd.Flags().Duration("interval", tui.DEFAULT_INTERVAL, "refresh interval in follow mode")
+	rootCmd.AddCommand(tuiCmd)
+}
+
+func parseTuiFlags(cmd *cobra.Command) (tui.Config, error) {
+	filter, filterErr := cmd.Flags().GetString("filter")
+	if filterErr != nil {
+		return tui.Config{}, fmt.Errorf("failed to get filter flag: %w", filterErr)
+	}
+
+	if _, err := tui.ParseFilter(filter, time.Now()); err != nil {
+		return tui.Config{}, err
+	}
+
+	follow, followErr := cmd.Flags().GetBool("follow")
+	if followErr != nil {
+		return tui.Config{}, fmt.Errorf("failed to get follow flag: %w", followErr)
+	}
+
+	interval, intervalErr := cmd.Flags().GetDuration("interval")
+	if intervalErr != nil {
+		return tui.Config{}, fmt.Errorf("failed to get interval flag: %w", intervalErr)
+	}
+
+	if interval < time.Second {
+		return tui.Config{}, fmt.Errorf("interval must be at least 1s")
+	}
+
+	return tui.Config{Filter: filter, Follow: follow, Interval: interval}, nil
+}
+
+// Dates are counted per second for the timeseries, geoip databases stay open meanwhile
+func runTui(flags *Flags, config tui.Config) error {
+	opts := analyzerOptions(flags)
+	opts.DatesBy = "none"
+	opts.State = true
+
+	if flags.GeoIpDb != "" || flags.AsnDb != "" {
+		geo, err := geoip.Open(flags.GeoIpDb, flags.AsnDb)
+		if err != nil {
+			return err
+		}
+		defer geo.Close()
+
+		opts.Geo = geo
+	}
+
+	return tui.Run(func(filter tui.Filter) (*analyzer.AnalyzeResult, error) {
+		return analyzer.Analyze(flags.FilePath, filter.Apply(opts))
+	}, config)
+}
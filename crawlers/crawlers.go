@@ -0,0 +1,137 @@
+package crawlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+type Verification int
+
+const (
+	// No ip ranges are known for the bot
+	UNVERIFIED Verification = iota
+	VERIFIED
+	IMPERSONATOR
+)
+
+// Published ip ranges of crawlers, keyed by bot name as reported
+// by the user agent classifier. Safe for concurrent use.
+type Ranges struct {
+	byBot map[string][]netip.Prefix
+}
+
+// Format of published range files (googlebot.json, bingbot.json)
+type rangesFile struct {
+	Prefixes []struct {
+		Ipv4Prefix string `json:"ipv4Prefix"`
+		Ipv6Prefix string `json:"ipv6Prefix"`
+	} `json:"prefixes"`
+}
+
+func NewRanges() *Ranges {
+	return &Ranges{byBot: make(map[string][]netip.Prefix)}
+}
+
+// Loads range files, keys are bot names & values are file paths
+func LoadRanges(files map[string]string) (*Ranges, error) {
+	r := NewRanges()
+
+	for bot, fpath := range files {
+		data, err := os.ReadFile(fpath)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes, err := ParseRanges(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ranges file %s: %w", fpath, err)
+		}
+
+		r.Add(bot, prefixes)
+	}
+
+	return r, nil
+}
+
+// Parses a published JSON ranges file or a plain list with one CIDR per line.
+// Empty lines and lines starting with "#" are skipped in plain lists.
+func ParseRanges(data []byte) ([]netip.Prefix, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseJsonRanges(trimmed)
+	}
+
+	prefixes := make([]netip.Prefix, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(line)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, scanner.Err()
+}
+
+func parseJsonRanges(data []byte) ([]netip.Prefix, error) {
+	var file rangesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(file.Prefixes))
+	for _, item := range file.Prefixes {
+		str := item.Ipv4Prefix
+		if str == "" {
+			str = item.Ipv6Prefix
+		}
+
+		prefix, err := netip.ParsePrefix(str)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func (r *Ranges) Add(bot string, prefixes []netip.Prefix) {
+	key := strings.ToLower(bot)
+	r.byBot[key] = append(r.byBot[key], prefixes...)
+}
+
+func (r *Ranges) Has(bot string) bool {
+	_, ok := r.byBot[strings.ToLower(bot)]
+	return ok
+}
+
+// Checks whether the ip belongs to the ranges published for the bot
+func (r *Ranges) Verify(bot string, addr netip.Addr) Verification {
+	prefixes, ok := r.byBot[strings.ToLower(bot)]
+	if !ok {
+		return UNVERIFIED
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return VERIFIED
+		}
+	}
+
+	return IMPERSONATOR
+}
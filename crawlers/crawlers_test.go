@@ -0,0 +1,71 @@
+package crawlers
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const googlebotJson = `{
+  "creationTime": "2024-01-01T00:00:00.000000",
+  "prefixes": [
+    {"ipv6Prefix": "2001:4860:4801:10::/64"},
+    {"ipv4Prefix": "66.249.64.0/27"}
+  ]
+}`
+
+func TestParseRanges(t *testing.T) {
+	t.Run("should parse published json format", func(t *testing.T) {
+		prefixes, err := ParseRanges([]byte(googlebotJson))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []netip.Prefix{
+			netip.MustParsePrefix("2001:4860:4801:10::/64"),
+			netip.MustParsePrefix("66.249.64.0/27"),
+		}, prefixes)
+	})
+
+	t.Run("should parse plain cidr list", func(t *testing.T) {
+		prefixes, err := ParseRanges([]byte("# bingbot\n157.55.39.0/24\n\n40.77.167.1/24\n"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []netip.Prefix{
+			netip.MustParsePrefix("157.55.39.0/24"),
+			netip.MustParsePrefix("40.77.167.0/24"),
+		}, prefixes)
+	})
+
+	t.Run("should return error for invalid cidr", func(t *testing.T) {
+		_, err := ParseRanges([]byte("157.55.39.0/33"))
+		assert.Error(t, err)
+
+		_, err = ParseRanges([]byte(`{"prefixes": [{"ipv4Prefix": "bad"}]}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	googlePath := filepath.Join(dir, "googlebot.json")
+	require.NoError(t, os.WriteFile(googlePath, []byte(googlebotJson), 0644))
+
+	r, err := LoadRanges(map[string]string{"googlebot": googlePath})
+	require.NoError(t, err)
+
+	assert.True(t, r.Has("Googlebot"))
+	assert.False(t, r.Has("Bingbot"))
+	assert.Equal(t, VERIFIED, r.Verify("Googlebot", netip.MustParseAddr("66.249.64.10")))
+	assert.Equal(t, VERIFIED, r.Verify("Googlebot", netip.MustParseAddr("2001:4860:4801:10::1")))
+	assert.Equal(t, IMPERSONATOR, r.Verify("Googlebot", netip.MustParseAddr("203.0.113.7")))
+	assert.Equal(t, UNVERIFIED, r.Verify("Bingbot", netip.MustParseAddr("203.0.113.7")))
+}
+
+func TestLoadRanges(t *testing.T) {
+	_, err := LoadRanges(map[string]string{"googlebot": "missing.json"})
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,429 @@
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	_ "modernc.org/sqlite"
+)
+
+// Version of the tables, stored as user_version and in the meta table
+const SCHEMA_VERSION = 1
+
+// Batches of workers waiting for the single sqlite writer
+const QUEUED_BATCHES = 8
+
+const SCHEMA = `
+CREATE TABLE meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE requests (
+	id           INTEGER PRIMARY KEY,
+	time         INTEGER NOT NULL, -- unix seconds
+	time_text    TEXT NOT NULL,    -- RFC 3339 with the logged offset
+	ip           TEXT NOT NULL,
+	remote_addr  TEXT NOT NULL,
+	method       TEXT NOT NULL,
+	uri          TEXT NOT NULL,    -- normalized
+	raw_uri      TEXT NOT NULL,
+	protocol     TEXT NOT NULL,
+	status       INTEGER NOT NULL,
+	status_class TEXT NOT NULL,
+	bytes        INTEGER NOT NULL,
+	referrer     TEXT NOT NULL,
+	user_agent   TEXT NOT NULL,
+	request_time REAL,             -- seconds, NULL when not logged
+	country      TEXT,
+	city         TEXT,
+	asn          INTEGER,
+	as_org       TEXT,
+	browser      TEXT,
+	os           TEXT,
+	device       TEXT,
+	bot          TEXT
+);
+
+CREATE TABLE summary (
+	total_requests     INTEGER NOT NULL,
+	total_bytes        INTEGER NOT NULL,
+	unique_ips         INTEGER NOT NULL,
+	unique_user_agents INTEGER NOT NULL,
+	start_time         TEXT,
+	end_time           TEXT,
+	file_size          INTEGER NOT NULL,
+	parse_errors       INTEGER NOT NULL,
+	filtered           INTEGER NOT NULL
+);
+
+CREATE TABLE ips (ip TEXT PRIMARY KEY, hits INTEGER NOT NULL);
+CREATE TABLE remote_addrs (remote_addr TEXT PRIMARY KEY, hits INTEGER NOT NULL);
+CREATE TABLE status_codes (status INTEGER PRIMARY KEY, hits INTEGER NOT NULL);
+CREATE TABLE uris (uri TEXT PRIMARY KEY, hits INTEGER NOT NULL);
+CREATE TABLE user_agents (user_agent TEXT PRIMARY KEY, hits INTEGER NOT NULL);
+CREATE TABLE dates (time INTEGER NOT NULL, time_text TEXT NOT NULL, hits INTEGER NOT NULL);
+CREATE TABLE bots (name TEXT PRIMARY KEY, hits INTEGER NOT NULL, bytes INTEGER NOT NULL, verified INTEGER NOT NULL);
+`
+
+// Created after the requests are inserted, which is faster than keeping them up to date
+const INDEXES = `
+CREATE INDEX requests_time ON requests (time);
+CREATE INDEX requests_ip ON requests (ip);
+CREATE INDEX requests_uri ON requests (uri);
+CREATE INDEX requests_status ON requests (status);
+CREATE INDEX dates_time ON dates (time);
+`
+
+const INSERT_REQUEST = `INSERT INTO requests (
+	time, time_text, ip, remote_addr, method, uri, raw_uri, protocol, status, status_class, bytes,
+	referrer, user_agent, request_time, country, city, asn, as_org, browser, os, device, bot
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// SQLite file being exported. Requests are inserted by a single goroutine in
+// a transaction per batch, the file appears at its path once Finish succeeds.
+type Sqlite struct {
+	path    string
+	tmpPath string
+	db      *sql.DB
+
+	batches chan []analyzer.ExportedEntry
+	done    chan struct{}
+
+	mu   sync.Mutex
+	err  error
+	rows uint64
+}
+
+// Creates the schema in a temporary file next to fpath
+func CreateSqlite(fpath string) (*Sqlite, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(fpath), "."+filepath.Base(fpath)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+
+	// like other outputs, not only readable by the owner
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	// a single connection, pragmas are per connection
+	db.SetMaxOpenConns(1)
+
+	s := &Sqlite{
+		path:    fpath,
+		tmpPath: tmp.Name(),
+		db:      db,
+		batches: make(chan []analyzer.ExportedEntry, QUEUED_BATCHES),
+		done:    make(chan struct{}),
+	}
+
+	// the file is renamed into place only when complete, so the journal isn't needed
+	_, err = db.Exec("PRAGMA journal_mode = OFF; PRAGMA synchronous = OFF; PRAGMA user_version = " + strconv.Itoa(SCHEMA_VERSION) + ";" + SCHEMA)
+	if err != nil {
+		db.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to create sqlite schema: %w", err)
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// Queues a batch, blocks while the writer is behind. Errors are returned by Finish.
+func (s *Sqlite) WriteEntries(entries []analyzer.ExportedEntry) {
+	s.batches <- entries
+}
+
+func (s *Sqlite) run() {
+	defer close(s.done)
+
+	for entries := range s.batches {
+		if s.failed() {
+			continue
+		}
+
+		if err := s.insert(entries); err != nil {
+			s.fail(fmt.Errorf("failed to insert requests: %w", err))
+		}
+	}
+}
+
+func (s *Sqlite) insert(entries []analyzer.ExportedEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(INSERT_REQUEST)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i := range entries {
+		if _, err := stmt.Exec(requestValues(&entries[i])...); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rows += uint64(len(entries))
+	s.mu.Unlock()
+
+	return nil
+}
+
+func requestValues(entry *analyzer.ExportedEntry) []any {
+	var requestTime, country, city, asn, asOrg any
+	var browser, operatingSystem, device, bot any
+
+	if entry.RequestTime != parser.NO_REQUEST_TIME {
+		requestTime = entry.RequestTime.Seconds()
+	}
+
+	if entry.Geo != nil {
+		country, city = nullString(entry.Geo.Country), nullString(entry.Geo.City)
+		if entry.Geo.Asn.Number != 0 {
+			asn, asOrg = int64(entry.Geo.Asn.Number), entry.Geo.Asn.Org
+		}
+	}
+
+	if entry.Agent != nil {
+		browser, operatingSystem, device = entry.Agent.Browser, entry.Agent.Os, entry.Agent.Device
+		bot = nullString(entry.Agent.Bot)
+	}
+
+	return []any{
+		entry.Date.Unix(),
+		entry.Date.Format(time.RFC3339),
+		entry.Ip.String(),
+		entry.RemoteAddr.String(),
+		entry.Method,
+		entry.Uri,
+		entry.RawUri,
+		entry.Protocol,
+		int64(entry.StatusCode),
+		statusClass(entry.StatusCode),
+		int64(entry.RespBytes),
+		entry.Referrer,
+		entry.UserAgent,
+		requestTime,
+		country,
+		city,
+		asn,
+		asOrg,
+		browser,
+		operatingSystem,
+		device,
+		bot,
+	}
+}
+
+func nullString(value string) any {
+	if value == "" {
+		return nil
+	}
+
+	return value
+}
+
+func statusClass(code uint16) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+func (s *Sqlite) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err != nil
+}
+
+func (s *Sqlite) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Inserted requests so far
+func (s *Sqlite) Rows() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rows
+}
+
+// Waits for queued requests, writes the aggregates of the result and
+// indexes, then moves the file to its path. The analysis must be done
+// with the State option.
+func (s *Sqlite) Finish(res *analyzer.AnalyzeResult, source string) error {
+	close(s.batches)
+	<-s.done
+
+	err := s.err
+	if err == nil {
+		err = s.writeResult(res, source)
+	}
+	if err == nil {
+		if _, err = s.db.Exec(INDEXES); err != nil {
+			err = fmt.Errorf("failed to create indexes: %w", err)
+		}
+	}
+
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(s.tmpPath, s.path)
+	}
+
+	if err != nil {
+		os.Remove(s.tmpPath)
+	}
+
+	return err
+}
+
+// Drops the temporary file instead of finishing it, queued requests are discarded
+func (s *Sqlite) Abort() {
+	s.fail(fmt.Errorf("export aborted"))
+	close(s.batches)
+	<-s.done
+
+	s.db.Close()
+	os.Remove(s.tmpPath)
+}
+
+func (s *Sqlite) writeResult(res *analyzer.AnalyzeResult, source string) error {
+	if res.State == nil {
+		return fmt.Errorf("result has no state, analyze with the State option")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	meta := map[string]string{
+		"schema_version": strconv.Itoa(SCHEMA_VERSION),
+		"source":         source,
+		"exported_at":    time.Now().Format(time.RFC3339),
+		"dates_by":       res.State.DatesBy,
+	}
+	for key, value := range meta {
+		if _, err := tx.Exec("INSERT INTO meta (key, value) VALUES (?, ?)", key, value); err != nil {
+			return fmt.Errorf("failed to insert meta: %w", err)
+		}
+	}
+
+	var start, end any
+	if !res.TimeRange.Start.IsZero() {
+		start, end = res.TimeRange.Start.Format(time.RFC3339), res.TimeRange.End.Format(time.RFC3339)
+	}
+
+	_, err = tx.Exec("INSERT INTO summary VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		res.TotalRequests, res.TotalBytes, res.UniqueIPs, res.UniqueUserAgents, start, end,
+		res.ProcessingStats.FileSize, res.ProcessingStats.ParseErrors, res.ProcessingStats.Filtered)
+	if err != nil {
+		return fmt.Errorf("failed to insert summary: %w", err)
+	}
+
+	state := res.State
+	err = insertCounts(tx, "INSERT INTO ips VALUES (?, ?)", state.Ips, netip.Addr.String)
+	if err == nil {
+		err = insertCounts(tx, "INSERT INTO remote_addrs VALUES (?, ?)", state.RemoteAddrs, netip.Addr.String)
+	}
+	if err == nil {
+		err = insertCounts(tx, "INSERT INTO status_codes VALUES (?, ?)", state.Codes, func(code uint16) int64 { return int64(code) })
+	}
+	if err == nil {
+		err = insertCounts(tx, "INSERT INTO uris VALUES (?, ?)", state.Uris, func(uri string) string { return uri })
+	}
+	if err == nil {
+		err = insertCounts(tx, "INSERT INTO user_agents VALUES (?, ?)", state.UserAgents, func(userAgent string) string { return userAgent })
+	}
+	if err == nil {
+		err = insertDates(tx, state.Dates)
+	}
+	if err == nil {
+		err = insertBots(tx, state.Bots)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert aggregates: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func insertCounts[K comparable, V any](tx *sql.Tx, query string, counts map[K]uint64, key func(K) V) error {
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for k, hits := range counts {
+		if _, err := stmt.Exec(key(k), hits); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func insertDates(tx *sql.Tx, dates map[time.Time]uint64) error {
+	stmt, err := tx.Prepare("INSERT INTO dates VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for date, hits := range dates {
+		if _, err := stmt.Exec(date.Unix(), date.Format(time.RFC3339), hits); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func insertBots(tx *sql.Tx, bots map[string]*analyzer.BotState) error {
+	stmt, err := tx.Prepare("INSERT INTO bots VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for name, bot := range bots {
+		if _, err := stmt.Exec(name, bot.Hits, bot.Bytes, bot.Verified); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
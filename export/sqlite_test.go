@@ -0,0 +1,169 @@
+package export
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/index"
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/useragent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqlite(t *testing.T) {
+	testData := `10.0.0.1 - - [25/Dec/2023:10:00:00 +0000] "GET /users/1 HTTP/1.1" 200 100 "-" "Mozilla/5.0" "0.250"
+10.0.0.1 - - [25/Dec/2023:10:01:00 +0000] "GET /about HTTP/1.1" 404 150 "https://example.com/" "curl/8.0" "-"
+10.0.0.2 - - [25/Dec/2023:10:02:00 +0200] "POST /login HTTP/1.1" 500 0 "-" "curl/8.0" "1.000"
+`
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	dbPath := filepath.Join(dir, "out.db")
+	require.NoError(t, os.WriteFile(logPath, []byte(testData), 0644))
+
+	extraFields := []parser.ExtraField{parser.FIELD_REQUEST_TIME}
+
+	exportTo := func(t *testing.T, input, output string) {
+		sqlite, err := CreateSqlite(output)
+		require.NoError(t, err)
+
+		res, err := analyzer.Analyze(input, analyzer.Options{
+			TopN:        10,
+			Desc:        true,
+			ExtraFields: extraFields,
+			UserAgents:  useragent.Default(),
+			Export:      sqlite,
+			State:       true,
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, sqlite.Finish(res, input))
+		assert.Equal(t, uint64(3), sqlite.Rows())
+	}
+	export := func(t *testing.T) {
+		exportTo(t, logPath, dbPath)
+	}
+
+	open := func(t *testing.T, fpath string) *sql.DB {
+		db, err := sql.Open("sqlite", fpath)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+
+		return db
+	}
+
+	query := func(t *testing.T, query string, dest ...any) {
+		require.NoError(t, open(t, dbPath).QueryRow(query).Scan(dest...))
+	}
+
+	t.Run("should write requests with derived columns", func(t *testing.T) {
+		export(t)
+
+		var count, requestTimes, bots int
+		query(t, "SELECT count(*), count(request_time), count(bot) FROM requests", &count, &requestTimes, &bots)
+		assert.Equal(t, 3, count)
+		assert.Equal(t, 2, requestTimes)
+		assert.Equal(t, 2, bots)
+
+		var timeText, ip, statusClass, referrer string
+		var unix int64
+		var requestTime float64
+		var country sql.NullString
+		query(t, "SELECT time, time_text, ip, status_class, referrer, request_time, country FROM requests WHERE uri = '/login'",
+			&unix, &timeText, &ip, &statusClass, &referrer, &requestTime, &country)
+		assert.Equal(t, int64(1703491320), unix)
+		assert.Equal(t, "2023-12-25T10:02:00+02:00", timeText)
+		assert.Equal(t, "10.0.0.2", ip)
+		assert.Equal(t, "5xx", statusClass)
+		assert.Equal(t, "-", referrer)
+		assert.Equal(t, 1.0, requestTime)
+		assert.False(t, country.Valid)
+	})
+
+	t.Run("should write aggregates and the schema version", func(t *testing.T) {
+		var version int
+		query(t, "PRAGMA user_version", &version)
+		assert.Equal(t, SCHEMA_VERSION, version)
+
+		var source string
+		query(t, "SELECT value FROM meta WHERE key = 'source'", &source)
+		assert.Equal(t, logPath, source)
+
+		var totalRequests, totalBytes int
+		query(t, "SELECT total_requests, total_bytes FROM summary", &totalRequests, &totalBytes)
+		assert.Equal(t, 3, totalRequests)
+		assert.Equal(t, 250, totalBytes)
+
+		var ipHits, botHits, indexes int
+		query(t, "SELECT hits FROM ips WHERE ip = '10.0.0.1'", &ipHits)
+		query(t, "SELECT hits FROM bots WHERE name = 'curl'", &botHits)
+		query(t, "SELECT count(*) FROM sqlite_master WHERE type = 'index' AND name LIKE 'requests_%'", &indexes)
+		assert.Equal(t, 2, ipHits)
+		assert.Equal(t, 2, botHits)
+		assert.Equal(t, 4, indexes)
+	})
+
+	t.Run("should replace an existing file", func(t *testing.T) {
+		export(t)
+
+		var count int
+		query(t, "SELECT count(*) FROM requests", &count)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("should export an index like its log", func(t *testing.T) {
+		idx, err := index.BuildFile(logPath, extraFields, nil)
+		require.NoError(t, err)
+
+		indexPath := logPath + index.EXTENSION
+		file, err := os.Create(indexPath)
+		require.NoError(t, err)
+		require.NoError(t, idx.Write(file))
+		require.NoError(t, file.Close())
+
+		indexDbPath := filepath.Join(dir, "index.db")
+		exportTo(t, indexPath, indexDbPath)
+
+		// every column but the id, workers insert rows in any order
+		rows := func(t *testing.T, fpath string) []string {
+			result, err := open(t, fpath).Query(`SELECT json_array(time, time_text, ip, remote_addr, method, uri, raw_uri,
+				protocol, status, status_class, bytes, referrer, user_agent, request_time, country, city, asn, as_org,
+				browser, os, device, bot) FROM requests ORDER BY time`)
+			require.NoError(t, err)
+			defer result.Close()
+
+			var rows []string
+			for result.Next() {
+				var row string
+				require.NoError(t, result.Scan(&row))
+				rows = append(rows, row)
+			}
+			require.NoError(t, result.Err())
+
+			return rows
+		}
+
+		assert.Equal(t, rows(t, dbPath), rows(t, indexDbPath))
+		assert.Contains(t, rows(t, indexDbPath)[0], "HTTP/1.1")
+	})
+
+	t.Run("should leave no file when aborted", func(t *testing.T) {
+		abortedPath := filepath.Join(dir, "aborted.db")
+		sqlite, err := CreateSqlite(abortedPath)
+		require.NoError(t, err)
+
+		sqlite.WriteEntries([]analyzer.ExportedEntry{{RawUri: "/"}})
+		sqlite.Abort()
+
+		_, err = os.Stat(abortedPath)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		tmpFiles, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+		require.NoError(t, err)
+		assert.Empty(t, tmpFiles)
+	})
+}
@@ -3,6 +3,7 @@ package generator
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"time"
@@ -53,6 +54,22 @@ func GenerateAccessLog() {
 	fmt.Printf("Successfully created a file %s with %d records\n", outputFile, numEntries)
 }
 
+// Writes random log entries until at least size bytes are written.
+// Used to produce big files for benchmarks.
+func WriteAccessLog(w io.Writer, size int64) (int64, error) {
+	written := int64(0)
+
+	for written < size {
+		n, err := io.WriteString(w, formatLogEntry(generateLogEntry())+"\n")
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
 func generateLogEntry() LogEntry {
 	// Values with different probability
 	ips := []string{
@@ -0,0 +1,164 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// Country code used when the ip is missing in the database
+const UNKNOWN_COUNTRY = "unknown"
+
+type Asn struct {
+	Number uint   `json:"number"`
+	Org    string `json:"org"`
+}
+
+func (asn Asn) String() string {
+	if asn.Number == 0 {
+		return "unknown"
+	}
+
+	return fmt.Sprintf("AS%d %s", asn.Number, asn.Org)
+}
+
+type Info struct {
+	Country string `json:"country"`
+	City    string `json:"city,omitempty"`
+	Asn     Asn    `json:"asn"`
+}
+
+// Local MaxMind format databases, nothing is fetched over network.
+// Lookups are safe for concurrent use.
+type DB struct {
+	city *maxminddb.Reader
+	asn  *maxminddb.Reader
+}
+
+type cityRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+type asnRecord struct {
+	Number uint   `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// Opens country/city and ASN databases, any of the paths may be empty
+func Open(cityPath, asnPath string) (*DB, error) {
+	if cityPath == "" && asnPath == "" {
+		return nil, errors.New("no geoip database provided")
+	}
+
+	db := &DB{}
+
+	if cityPath != "" {
+		city, err := maxminddb.Open(cityPath)
+		if err != nil {
+			return nil, err
+		}
+		db.city = city
+	}
+
+	if asnPath != "" {
+		asn, err := maxminddb.Open(asnPath)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.asn = asn
+	}
+
+	return db, nil
+}
+
+func (db *DB) Close() error {
+	var errs []error
+
+	if db.city != nil {
+		errs = append(errs, db.city.Close())
+	}
+
+	if db.asn != nil {
+		errs = append(errs, db.asn.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+func (db *DB) HasCity() bool {
+	return db.city != nil
+}
+
+func (db *DB) HasAsn() bool {
+	return db.asn != nil
+}
+
+// Build times of the open databases like "city=1700000000,asn=0", an updated
+// database at the same path gets a new one
+func (db *DB) Version() string {
+	epochs := []uint{0, 0}
+	for i, reader := range []*maxminddb.Reader{db.city, db.asn} {
+		if reader != nil {
+			epochs[i] = reader.Metadata.BuildEpoch
+		}
+	}
+
+	return fmt.Sprintf("city=%d,asn=%d", epochs[0], epochs[1])
+}
+
+// Looks up the ip in both databases, missing data is left empty
+func (db *DB) Lookup(addr netip.Addr) Info {
+	info := Info{Country: UNKNOWN_COUNTRY}
+
+	if db.city != nil {
+		var record cityRecord
+		if err := db.city.Lookup(addr).Decode(&record); err == nil {
+			if record.Country.IsoCode != "" {
+				info.Country = record.Country.IsoCode
+			}
+			info.City = record.City.Names["en"]
+		}
+	}
+
+	if db.asn != nil {
+		var record asnRecord
+		if err := db.asn.Lookup(addr).Decode(&record); err == nil {
+			info.Asn = Asn{Number: record.Number, Org: record.Org}
+		}
+	}
+
+	return info
+}
+
+func (db *DB) NewCache() *Cache {
+	return &Cache{
+		db:    db,
+		infos: make(map[netip.Addr]Info),
+	}
+}
+
+// Per worker lookup cache, decoding a record is far more expensive
+// than a map access and client ips repeat a lot. Not safe for concurrent use.
+type Cache struct {
+	db    *DB
+	infos map[netip.Addr]Info
+}
+
+func (c *Cache) Lookup(addr netip.Addr) Info {
+	if info, ok := c.infos[addr]; ok {
+		return info
+	}
+
+	info := c.db.Lookup(addr)
+	c.infos[addr] = info
+
+	return info
+}
@@ -0,0 +1,91 @@
+package geoip
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test databases in testdata resolve:
+//   - 203.0.113.0/24 to US, Mountain View and AS15169 GOOGLE
+//   - 198.51.100.0/24 and 2001:db8::/32 to DE, Berlin
+const (
+	TEST_CITY_DB = "testdata/GeoLite2-City-Test.mmdb"
+	TEST_ASN_DB  = "testdata/GeoLite2-ASN-Test.mmdb"
+)
+
+func openTestDB(t *testing.T) *DB {
+	db, err := Open(TEST_CITY_DB, TEST_ASN_DB)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestLookup(t *testing.T) {
+	db := openTestDB(t)
+
+	t.Run("should return country, city and asn", func(t *testing.T) {
+		info := db.Lookup(netip.MustParseAddr("203.0.113.7"))
+
+		assert.Equal(t, Info{
+			Country: "US",
+			City:    "Mountain View",
+			Asn:     Asn{Number: 15169, Org: "GOOGLE"},
+		}, info)
+	})
+
+	t.Run("should lookup ipv6 addresses", func(t *testing.T) {
+		info := db.Lookup(netip.MustParseAddr("2001:db8::1"))
+
+		assert.Equal(t, "DE", info.Country)
+		assert.Equal(t, "Berlin", info.City)
+		assert.Equal(t, Asn{}, info.Asn)
+	})
+
+	t.Run("should return unknown country for missing ip", func(t *testing.T) {
+		info := db.Lookup(netip.MustParseAddr("192.0.2.1"))
+
+		assert.Equal(t, Info{Country: UNKNOWN_COUNTRY}, info)
+	})
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("should require at least one database", func(t *testing.T) {
+		_, err := Open("", "")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should open only asn database", func(t *testing.T) {
+		db, err := Open("", TEST_ASN_DB)
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.False(t, db.HasCity())
+		assert.True(t, db.HasAsn())
+		assert.Equal(t, UNKNOWN_COUNTRY, db.Lookup(netip.MustParseAddr("203.0.113.7")).Country)
+		assert.Equal(t, "city=0,asn=1700000000", db.Version())
+	})
+
+	t.Run("should return error for missing file", func(t *testing.T) {
+		_, err := Open("missing.mmdb", "")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestCache(t *testing.T) {
+	db := openTestDB(t)
+	cache := db.NewCache()
+	addr := netip.MustParseAddr("203.0.113.7")
+
+	assert.Equal(t, db.Lookup(addr), cache.Lookup(addr))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.Lookup(addr)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
@@ -0,0 +1,356 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/realip"
+)
+
+// Max length of an indexed log line, longer lines are parse errors
+const MAX_LINE = 1024 * 1024
+
+// Ids of the values of a column in the order they were first seen
+type dictionary[T comparable] struct {
+	ids    map[T]uint32
+	values []T
+	counts []uint64
+}
+
+func newDictionary[T comparable]() *dictionary[T] {
+	return &dictionary[T]{ids: make(map[T]uint32)}
+}
+
+func (d *dictionary[T]) id(value T) uint32 {
+	id, ok := d.ids[value]
+	if !ok {
+		id = uint32(len(d.values))
+		d.ids[value] = id
+		d.values = append(d.values, value)
+		d.counts = append(d.counts, 0)
+	}
+
+	d.counts[id]++
+	return id
+}
+
+// Values sorted by frequency, so frequent ones get short varint ids,
+// and the new id of every old one
+func (d *dictionary[T]) sorted() ([]T, []uint32) {
+	order := make([]uint32, len(d.values))
+	for i := range order {
+		order[i] = uint32(i)
+	}
+	slices.SortStableFunc(order, func(a, b uint32) int {
+		return cmp.Compare(d.counts[b], d.counts[a])
+	})
+
+	values := make([]T, len(order))
+	remap := make([]uint32, len(order))
+	for newId, oldId := range order {
+		values[newId] = d.values[oldId]
+		remap[oldId] = uint32(newId)
+	}
+
+	return values, remap
+}
+
+// Collects parsed requests into an index
+type Builder struct {
+	source     string
+	sourceSize int64
+
+	parseErrors uint64
+
+	zones      *dictionary[int32]
+	ips        *dictionary[netip.Addr]
+	methods    *dictionary[string]
+	protocols  *dictionary[string]
+	uris       *dictionary[string]
+	referrers  *dictionary[string]
+	userAgents *dictionary[string]
+
+	times         []int64
+	zoneIds       []uint32
+	ipIds         []uint32
+	methodIds     []uint32
+	protocolIds   []uint32
+	uriIds        []uint32
+	referrerIds   []uint32
+	userAgentIds  []uint32
+	statuses      []uint16
+	bytes         []uint64
+	requestTimes  []time.Duration
+	remoteAddrIds []uint32
+
+	// Whether a client ip differs from its remote addr
+	resolved bool
+}
+
+func NewBuilder(source string, sourceSize int64) *Builder {
+	return &Builder{
+		source:     source,
+		sourceSize: sourceSize,
+		zones:      newDictionary[int32](),
+		ips:        newDictionary[netip.Addr](),
+		methods:    newDictionary[string](),
+		protocols:  newDictionary[string](),
+		uris:       newDictionary[string](),
+		referrers:  newDictionary[string](),
+		userAgents: newDictionary[string](),
+	}
+}
+
+func (b *Builder) Add(entry *parser.LogEntry) {
+	_, offset := entry.Date.Zone()
+
+	ipId := b.ips.id(entry.Ip)
+	remoteAddrId := ipId
+	if entry.RemoteAddr.IsValid() && entry.RemoteAddr != entry.Ip {
+		remoteAddrId = b.ips.id(entry.RemoteAddr)
+		b.resolved = true
+	}
+
+	b.times = append(b.times, entry.Date.Unix())
+	b.zoneIds = append(b.zoneIds, b.zones.id(int32(offset)))
+	b.ipIds = append(b.ipIds, ipId)
+	b.methodIds = append(b.methodIds, b.methods.id(entry.Method))
+	b.protocolIds = append(b.protocolIds, b.protocols.id(entry.Protocol))
+	b.uriIds = append(b.uriIds, b.uris.id(entry.Uri))
+	b.referrerIds = append(b.referrerIds, b.referrers.id(entry.Referrer))
+	b.userAgentIds = append(b.userAgentIds, b.userAgents.id(entry.UserAgent))
+	b.statuses = append(b.statuses, entry.StatusCode)
+	b.bytes = append(b.bytes, uint64(entry.RespBytes))
+	b.requestTimes = append(b.requestTimes, entry.RequestTime)
+	b.remoteAddrIds = append(b.remoteAddrIds, remoteAddrId)
+}
+
+func (b *Builder) AddParseError() {
+	b.parseErrors++
+}
+
+// Builds the index, request times are kept when the log has them
+func (b *Builder) Index(requestTime bool) *Index {
+	idx := &Index{
+		Source:      b.source,
+		SourceSize:  b.sourceSize,
+		ParseErrors: b.parseErrors,
+		Times:       b.times,
+		Statuses:    b.statuses,
+		Bytes:       b.bytes,
+	}
+
+	if requestTime {
+		idx.RequestTimes = b.requestTimes
+	}
+
+	var zoneIds, ipIds, methodIds, protocolIds, uriIds, referrerIds, userAgentIds []uint32
+	idx.Zones, zoneIds = b.zones.sorted()
+	idx.Ips, ipIds = b.ips.sorted()
+	idx.Methods, methodIds = b.methods.sorted()
+	idx.Protocols, protocolIds = b.protocols.sorted()
+	idx.Uris, uriIds = b.uris.sorted()
+	idx.Referrers, referrerIds = b.referrers.sorted()
+	idx.UserAgents, userAgentIds = b.userAgents.sorted()
+
+	idx.ZoneIds = remapIds(b.zoneIds, zoneIds)
+	idx.IpIds = remapIds(b.ipIds, ipIds)
+	idx.MethodIds = remapIds(b.methodIds, methodIds)
+	idx.ProtocolIds = remapIds(b.protocolIds, protocolIds)
+	idx.UriIds = remapIds(b.uriIds, uriIds)
+	idx.ReferrerIds = remapIds(b.referrerIds, referrerIds)
+	idx.UserAgentIds = remapIds(b.userAgentIds, userAgentIds)
+
+	if b.resolved {
+		idx.RemoteAddrIds = remapIds(b.remoteAddrIds, ipIds)
+	}
+
+	return idx
+}
+
+// Ids are replaced in place
+func remapIds(ids []uint32, remap []uint32) []uint32 {
+	for i, id := range ids {
+		ids[i] = remap[id]
+	}
+
+	return ids
+}
+
+// Parses the log into an index. The client ip is resolved from proxy headers
+// by a non nil resolver, like the analyzer does.
+func BuildFile(fpath string, extraFields []parser.ExtraField, realIp *realip.Resolver) (*Index, error) {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	builder := NewBuilder(fpath, info.Size())
+	lineParser := parser.NewParser(extraFields...)
+	entry := &parser.LogEntry{}
+
+	reader := bufio.NewReaderSize(file, MAX_LINE)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// the rest of an overlong line is skipped
+			for err == bufio.ErrBufferFull {
+				_, err = reader.ReadSlice('\n')
+			}
+			builder.AddParseError()
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		// like the analyzer, only the empty rest after the last line break is skipped
+		if err == nil || len(line) > 0 {
+			line = bytes.TrimSuffix(line, []byte("\n"))
+			if parseErr := lineParser.Parse(line, entry); parseErr != nil {
+				log.Print(parseErr.Error())
+				builder.AddParseError()
+			} else {
+				if realIp != nil {
+					entry.Ip = realIp.Resolve(entry.RemoteAddr, entry.XForwardedFor, entry.XRealIp)
+				}
+				builder.Add(entry)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return builder.Index(slices.Contains(extraFields, parser.FIELD_REQUEST_TIME)), nil
+}
+
+// Writes the index in the layout read by Open
+func (idx *Index) Write(w io.Writer) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+
+	e.raw([]byte(MAGIC))
+	e.uvarint(VERSION)
+	e.bytes([]byte(idx.Source))
+	e.varint(idx.SourceSize)
+	e.uvarint(idx.ParseErrors)
+
+	e.uvarint(uint64(len(idx.Zones)))
+	for _, zone := range idx.Zones {
+		e.varint(int64(zone))
+	}
+
+	e.uvarint(uint64(len(idx.Ips)))
+	for _, ip := range idx.Ips {
+		e.bytes(ip.AsSlice())
+	}
+
+	e.strings(idx.Methods)
+	e.strings(idx.Protocols)
+	e.strings(idx.Uris)
+	e.strings(idx.Referrers)
+	e.strings(idx.UserAgents)
+
+	e.uvarint(uint64(idx.Rows()))
+
+	last := int64(0)
+	for _, t := range idx.Times {
+		e.varint(t - last)
+		last = t
+	}
+
+	for _, ids := range [][]uint32{idx.ZoneIds, idx.IpIds, idx.MethodIds, idx.ProtocolIds, idx.UriIds, idx.ReferrerIds, idx.UserAgentIds} {
+		for _, id := range ids {
+			e.uvarint(uint64(id))
+		}
+	}
+
+	for _, status := range idx.Statuses {
+		e.uvarint(uint64(status))
+	}
+
+	for _, size := range idx.Bytes {
+		e.uvarint(size)
+	}
+
+	if idx.RequestTimes == nil {
+		e.uvarint(0)
+	} else {
+		e.uvarint(1)
+		for _, requestTime := range idx.RequestTimes {
+			if requestTime == parser.NO_REQUEST_TIME {
+				e.varint(-1)
+			} else {
+				e.varint(int64(requestTime / time.Microsecond))
+			}
+		}
+	}
+
+	if idx.RemoteAddrIds == nil {
+		e.uvarint(0)
+	} else {
+		e.uvarint(1)
+		for _, id := range idx.RemoteAddrIds {
+			e.uvarint(uint64(id))
+		}
+	}
+
+	return e.flush()
+}
+
+// Writes values one after another, the first error sticks
+type encoder struct {
+	w       *bufio.Writer
+	scratch [binary.MaxVarintLen64]byte
+	err     error
+}
+
+func (e *encoder) raw(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) uvarint(value uint64) {
+	e.raw(binary.AppendUvarint(e.scratch[:0], value))
+}
+
+func (e *encoder) varint(value int64) {
+	e.raw(binary.AppendVarint(e.scratch[:0], value))
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.raw(b)
+}
+
+func (e *encoder) strings(values []string) {
+	e.uvarint(uint64(len(values)))
+	for _, value := range values {
+		e.bytes([]byte(value))
+	}
+}
+
+func (e *encoder) flush() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	return e.w.Flush()
+}
@@ -0,0 +1,276 @@
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+)
+
+// First bytes of every index file
+const MAGIC = "NGXANIDX"
+
+// Version of the file layout, bumped on incompatible changes
+const VERSION = 2
+
+// Appended to the log path for the default index path
+const EXTENSION = ".idx"
+
+// Requests of a log stored by column. Values repeating across requests are
+// kept once in dictionaries sorted by frequency, columns hold their ids.
+// Rows are in log order.
+type Index struct {
+	// Log the index was built from and its size at that time
+	Source     string
+	SourceSize int64
+
+	ParseErrors uint64
+
+	// Dictionaries, Zones are UTC offsets in seconds
+	Zones      []int32
+	Ips        []netip.Addr
+	Methods    []string
+	Protocols  []string
+	Uris       []string
+	Referrers  []string
+	UserAgents []string
+
+	// Columns, Times are unix seconds
+	Times        []int64
+	ZoneIds      []uint32
+	IpIds        []uint32
+	MethodIds    []uint32
+	ProtocolIds  []uint32
+	UriIds       []uint32
+	ReferrerIds  []uint32
+	UserAgentIds []uint32
+	Statuses     []uint16
+	Bytes        []uint64
+
+	// Nil when request_time isn't logged, parser.NO_REQUEST_TIME for empty values
+	RequestTimes []time.Duration
+
+	// Ids of remote_addr in Ips, nil when every client ip is the remote addr
+	RemoteAddrIds []uint32
+}
+
+var errCorrupt = errors.New("corrupt index")
+
+func (idx *Index) Rows() int {
+	return len(idx.Times)
+}
+
+// Whether the file starts with MAGIC, unreadable files are not indexes
+func IsIndex(fpath string) bool {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(MAGIC))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+
+	return string(magic) == MAGIC
+}
+
+// Reads the whole index into memory
+func Open(fpath string) (*Index, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index %s: %w", fpath, err)
+	}
+
+	return idx, nil
+}
+
+// Reads values one after another, the first error sticks and zero values follow it
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errCorrupt
+	}
+	d.data = nil
+}
+
+func (d *decoder) uvarint() uint64 {
+	// most ids and deltas fit a byte
+	if len(d.data) > 0 && d.data[0] < 0x80 {
+		value := uint64(d.data[0])
+		d.data = d.data[1:]
+		return value
+	}
+
+	value, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return value
+}
+
+func (d *decoder) varint() int64 {
+	value, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return value
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail()
+		return nil
+	}
+
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+// Count of the next dictionary or column, every value takes at least a byte
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail()
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) strings() []string {
+	values := make([]string, d.count())
+	for i := range values {
+		values[i] = string(d.bytes())
+	}
+
+	return values
+}
+
+// Ids must point into a dictionary of the given size
+func (d *decoder) ids(rows, size int) []uint32 {
+	ids := make([]uint32, rows)
+	for i := range ids {
+		id := d.uvarint()
+		if id >= uint64(size) {
+			d.fail()
+			return ids
+		}
+		ids[i] = uint32(id)
+	}
+
+	return ids
+}
+
+func decode(data []byte) (*Index, error) {
+	if len(data) < len(MAGIC) || string(data[:len(MAGIC)]) != MAGIC {
+		return nil, fmt.Errorf("not an index")
+	}
+
+	d := &decoder{data: data[len(MAGIC):]}
+	if version := d.uvarint(); d.err == nil && version != VERSION {
+		return nil, fmt.Errorf("index version %d is not supported, expected %d", version, VERSION)
+	}
+
+	idx := &Index{
+		Source:      string(d.bytes()),
+		SourceSize:  d.varint(),
+		ParseErrors: d.uvarint(),
+	}
+
+	idx.Zones = make([]int32, d.count())
+	for i := range idx.Zones {
+		idx.Zones[i] = int32(d.varint())
+	}
+
+	idx.Ips = make([]netip.Addr, d.count())
+	for i := range idx.Ips {
+		addr, ok := netip.AddrFromSlice(d.bytes())
+		if !ok {
+			d.fail()
+		}
+		idx.Ips[i] = addr
+	}
+
+	idx.Methods = d.strings()
+	idx.Protocols = d.strings()
+	idx.Uris = d.strings()
+	idx.Referrers = d.strings()
+	idx.UserAgents = d.strings()
+
+	rows := d.count()
+
+	// delta encoded, logs are mostly sorted by time
+	idx.Times = make([]int64, rows)
+	last := int64(0)
+	for i := range idx.Times {
+		last += d.varint()
+		idx.Times[i] = last
+	}
+
+	idx.ZoneIds = d.ids(rows, len(idx.Zones))
+	idx.IpIds = d.ids(rows, len(idx.Ips))
+	idx.MethodIds = d.ids(rows, len(idx.Methods))
+	idx.ProtocolIds = d.ids(rows, len(idx.Protocols))
+	idx.UriIds = d.ids(rows, len(idx.Uris))
+	idx.ReferrerIds = d.ids(rows, len(idx.Referrers))
+	idx.UserAgentIds = d.ids(rows, len(idx.UserAgents))
+
+	idx.Statuses = make([]uint16, rows)
+	for i := range idx.Statuses {
+		idx.Statuses[i] = uint16(d.uvarint())
+	}
+
+	idx.Bytes = make([]uint64, rows)
+	for i := range idx.Bytes {
+		idx.Bytes[i] = d.uvarint()
+	}
+
+	if hasRequestTimes := d.uvarint(); hasRequestTimes == 1 {
+		idx.RequestTimes = make([]time.Duration, rows)
+		for i := range idx.RequestTimes {
+			if micros := d.varint(); micros >= 0 {
+				idx.RequestTimes[i] = time.Duration(micros) * time.Microsecond
+			} else {
+				idx.RequestTimes[i] = parser.NO_REQUEST_TIME
+			}
+		}
+	}
+
+	if hasRemoteAddrs := d.uvarint(); hasRemoteAddrs == 1 {
+		idx.RemoteAddrIds = d.ids(rows, len(idx.Ips))
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if len(d.data) != 0 {
+		return nil, errCorrupt
+	}
+
+	return idx, nil
+}
@@ -0,0 +1,162 @@
+package index
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/parser"
+	"github.com/Kostayne/go-nginx-analyzer/realip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildFile(t *testing.T) {
+	content := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET /about HTTP/1.1" 200 100 "-" "Mozilla/5.0" "0.120"
+10.0.0.2 - - [25/Dec/2023:10:30:46 +0200] "POST /login HTTP/1.1" 302 0 "https://example.com/" "curl/8.0" "-"
+not a log line
+10.0.0.2 - - [25/Dec/2023:10:30:44 +0000] "GET /about HTTP/1.1" 404 250 "-" "curl/8.0" "1.500"`
+
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(logPath, []byte(content), 0644))
+
+	idx, err := BuildFile(logPath, []parser.ExtraField{parser.FIELD_REQUEST_TIME}, nil)
+	require.NoError(t, err)
+
+	t.Run("should keep requests in log order", func(t *testing.T) {
+		require.Equal(t, 3, idx.Rows())
+		assert.Equal(t, uint64(1), idx.ParseErrors)
+		assert.Equal(t, logPath, idx.Source)
+		assert.Equal(t, int64(len(content)), idx.SourceSize)
+
+		assert.Equal(t, []int64{1703500245, 1703500246 - 2*60*60, 1703500244}, idx.Times)
+		assert.Equal(t, []uint16{200, 302, 404}, idx.Statuses)
+		assert.Equal(t, []uint64{100, 0, 250}, idx.Bytes)
+		assert.Equal(t, []time.Duration{120 * time.Millisecond, parser.NO_REQUEST_TIME, 1500 * time.Millisecond}, idx.RequestTimes)
+	})
+
+	t.Run("should sort dictionaries by frequency", func(t *testing.T) {
+		assert.Equal(t, []int32{0, 2 * 60 * 60}, idx.Zones)
+		assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.1")}, idx.Ips)
+		assert.Equal(t, []string{"/about", "/login"}, idx.Uris)
+		assert.Equal(t, []string{"curl/8.0", "Mozilla/5.0"}, idx.UserAgents)
+		assert.Equal(t, []string{"HTTP/1.1"}, idx.Protocols)
+
+		assert.Equal(t, []uint32{0, 1, 0}, idx.ZoneIds)
+		assert.Equal(t, []uint32{1, 0, 0}, idx.IpIds)
+		assert.Equal(t, []uint32{0, 1, 0}, idx.UriIds)
+		assert.Equal(t, []uint32{1, 0, 0}, idx.UserAgentIds)
+		assert.Equal(t, []uint32{0, 0, 0}, idx.ProtocolIds)
+	})
+
+	t.Run("should keep remote addrs only when client ips are resolved", func(t *testing.T) {
+		assert.Nil(t, idx.RemoteAddrIds)
+
+		proxied := `10.0.0.9 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/2.0" 200 100 "-" "curl/8.0" "203.0.113.7"
+10.0.0.9 - - [25/Dec/2023:10:30:46 +0000] "GET / HTTP/2.0" 200 100 "-" "curl/8.0" "-"`
+		proxiedPath := filepath.Join(t.TempDir(), "proxied.log")
+		require.NoError(t, os.WriteFile(proxiedPath, []byte(proxied), 0644))
+
+		resolver, err := realip.New(realip.SOURCE_X_FORWARDED_FOR, nil)
+		require.NoError(t, err)
+
+		resolved, err := BuildFile(proxiedPath, []parser.ExtraField{parser.FIELD_X_FORWARDED_FOR}, resolver)
+		require.NoError(t, err)
+
+		remoteAddr := netip.MustParseAddr("10.0.0.9")
+		require.Len(t, resolved.RemoteAddrIds, 2)
+		assert.Equal(t, netip.MustParseAddr("203.0.113.7"), resolved.Ips[resolved.IpIds[0]])
+		assert.Equal(t, remoteAddr, resolved.Ips[resolved.RemoteAddrIds[0]])
+		assert.Equal(t, remoteAddr, resolved.Ips[resolved.IpIds[1]])
+		assert.Equal(t, remoteAddr, resolved.Ips[resolved.RemoteAddrIds[1]])
+	})
+
+	t.Run("should skip request times which are not logged", func(t *testing.T) {
+		withoutTimes, err := BuildFile(logPath, []parser.ExtraField{parser.FIELD_X_FORWARDED_FOR}, nil)
+		require.NoError(t, err)
+
+		assert.Nil(t, withoutTimes.RequestTimes)
+	})
+}
+
+func TestOpen(t *testing.T) {
+	builder := NewBuilder("access.log", 1024)
+	for i, status := range []uint16{200, 404, 200} {
+		builder.Add(&parser.LogEntry{
+			Ip:          netip.MustParseAddr("2001:db8::1"),
+			RemoteAddr:  netip.MustParseAddr("10.0.0.9"),
+			Date:        time.Date(2023, 12, 25, 10, 30, 45-i, 0, time.FixedZone("", -5*60*60)),
+			Method:      "GET",
+			Uri:         "/",
+			Protocol:    "HTTP/2.0",
+			StatusCode:  status,
+			RespBytes:   uint(1 << (20 * i)),
+			Referrer:    "-",
+			UserAgent:   "Mozilla/5.0",
+			RequestTime: time.Duration(i) * time.Millisecond,
+		})
+	}
+	builder.AddParseError()
+	idx := builder.Index(true)
+
+	var buf bytes.Buffer
+	require.NoError(t, idx.Write(&buf))
+	data := buf.Bytes()
+
+	dir := t.TempDir()
+	write := func(data []byte) string {
+		fpath := filepath.Join(dir, "access.log.idx")
+		require.NoError(t, os.WriteFile(fpath, data, 0644))
+		return fpath
+	}
+
+	t.Run("should read what was written", func(t *testing.T) {
+		fpath := write(data)
+		assert.True(t, IsIndex(fpath))
+
+		opened, err := Open(fpath)
+		require.NoError(t, err)
+		assert.Equal(t, idx, opened)
+		assert.Len(t, opened.RemoteAddrIds, 3)
+	})
+
+	t.Run("should not take a log for an index", func(t *testing.T) {
+		fpath := write([]byte(`10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 100 "-" "-"`))
+		assert.False(t, IsIndex(fpath))
+		assert.False(t, IsIndex(filepath.Join(dir, "missing.idx")))
+
+		_, err := Open(fpath)
+		assert.ErrorContains(t, err, "not an index")
+	})
+
+	t.Run("should reject other versions", func(t *testing.T) {
+		other := append([]byte(MAGIC), VERSION+1)
+		_, err := Open(write(append(other, data[len(MAGIC)+1:]...)))
+		assert.ErrorContains(t, err, "not supported")
+	})
+
+	t.Run("should reject truncated and extended files", func(t *testing.T) {
+		for _, corrupt := range [][]byte{
+			data[:len(data)-1],
+			data[:len(MAGIC)+4],
+			append(bytes.Clone(data), 0),
+		} {
+			_, err := Open(write(corrupt))
+			assert.ErrorIs(t, err, errCorrupt)
+		}
+	})
+
+	t.Run("should reject ids out of dictionaries", func(t *testing.T) {
+		broken := *idx
+		broken.UriIds = []uint32{0, 1, 0}
+
+		var buf bytes.Buffer
+		require.NoError(t, broken.Write(&buf))
+
+		_, err := Open(write(buf.Bytes()))
+		assert.ErrorIs(t, err, errCorrupt)
+	})
+}
@@ -0,0 +1,57 @@
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Run("should replace the file and leave no temp files", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "nginx.prom")
+		require.NoError(t, os.WriteFile(path, []byte("old"), 0644))
+
+		require.NoError(t, WriteFileAtomic(path, func(w io.Writer) error {
+			_, err := io.WriteString(w, "new")
+			return err
+		}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(data))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("should keep the old file when writing fails", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "nginx.prom")
+		require.NoError(t, os.WriteFile(path, []byte("old"), 0644))
+
+		err := WriteFileAtomic(path, func(w io.Writer) error {
+			io.WriteString(w, "partial")
+			return errors.New("failed")
+		})
+		assert.Error(t, err)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "old", string(data))
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+}
@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+)
+
+// Prefix of every metric name, nginx_ alone clashes with the nginx exporter
+const PREFIX = "nginx_an_"
+
+const DEFAULT_ROUTES = 20
+
+// Route label of requests beyond the labeled routes, real routes start with "/"
+const ROUTE_OTHER = "other"
+
+// Content type of the Prometheus text exposition format
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// Writes analysis results as Prometheus metrics. Only the busiest routes get
+// their own label, the others are collapsed into ROUTE_OTHER. Labeled routes
+// stay labeled for the life of the exporter, so their counters don't move
+// between series when the ranking changes.
+type Exporter struct {
+	maxRoutes int
+
+	mu      sync.Mutex
+	labeled map[string]bool
+}
+
+type seriesKey struct {
+	route  string
+	method string
+	class  string
+}
+
+type seriesCounts struct {
+	requests uint64
+	bytes    uint64
+}
+
+// DEFAULT_ROUTES are labeled when maxRoutes is zero
+func NewExporter(maxRoutes int) *Exporter {
+	if maxRoutes == 0 {
+		maxRoutes = DEFAULT_ROUTES
+	}
+
+	return &Exporter{maxRoutes: maxRoutes, labeled: make(map[string]bool)}
+}
+
+// Writes request, byte and duration metrics of the result state and the parse error count.
+// The result must be analyzed with the Metrics option.
+func (e *Exporter) Write(w io.Writer, res *analyzer.AnalyzeResult) error {
+	var state analyzer.MetricsState
+	if res.State != nil && res.State.Metrics != nil {
+		state = *res.State.Metrics
+	}
+
+	route := e.labelRoutes(state.Routes)
+
+	series := make(map[seriesKey]seriesCounts)
+	for _, counts := range state.Routes {
+		key := seriesKey{route: route(counts.Route), method: counts.Method, class: counts.Class}
+		own := series[key]
+		own.requests += counts.Requests
+		own.bytes += counts.Bytes
+		series[key] = own
+	}
+
+	keys := make([]seriesKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b seriesKey) int {
+		return cmp.Or(strings.Compare(a.route, b.route), strings.Compare(a.method, b.method), strings.Compare(a.class, b.class))
+	})
+
+	bw := bufio.NewWriter(w)
+
+	writeHeader(bw, "http_requests_total", "counter", "Requests by route, method and status class.")
+	for _, key := range keys {
+		fmt.Fprintf(bw, "%shttp_requests_total%s %d\n", PREFIX, key.labels(), series[key].requests)
+	}
+
+	writeHeader(bw, "http_response_bytes_total", "counter", "Response body bytes by route, method and status class.")
+	for _, key := range keys {
+		fmt.Fprintf(bw, "%shttp_response_bytes_total%s %d\n", PREFIX, key.labels(), series[key].bytes)
+	}
+
+	if len(state.Durations) > 0 {
+		writeDurations(bw, state.Durations, route)
+	}
+
+	writeHeader(bw, "log_parse_errors_total", "counter", "Log lines that failed to parse.")
+	fmt.Fprintf(bw, "%slog_parse_errors_total %d\n", PREFIX, res.ProcessingStats.ParseErrors)
+
+	return bw.Flush()
+}
+
+// Labels the busiest routes while there's room and returns the label of a route
+func (e *Exporter) labelRoutes(counts []analyzer.RouteCounts) func(route string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.labeled) < e.maxRoutes {
+		totals := make(map[string]uint64)
+		for _, c := range counts {
+			totals[c.Route] += c.Requests
+		}
+
+		for _, info := range analyzer.TopHits(totals, len(totals), true) {
+			if len(e.labeled) == e.maxRoutes {
+				break
+			}
+			e.labeled[info.Key] = true
+		}
+	}
+
+	labeled := make(map[string]bool, len(e.labeled))
+	for route := range e.labeled {
+		labeled[route] = true
+	}
+
+	return func(route string) string {
+		if labeled[route] {
+			return route
+		}
+
+		return ROUTE_OTHER
+	}
+}
+
+// Histograms of collapsed routes are summed, buckets are cumulative
+func writeDurations(bw *bufio.Writer, durations map[string]*analyzer.DurationHistogram, route func(string) string) {
+	histograms := make(map[string][]uint64)
+	sums := make(map[string]time.Duration)
+
+	for r, histogram := range durations {
+		label := route(r)
+		counts, ok := histograms[label]
+		if !ok {
+			counts = make([]uint64, len(histogram.Counts))
+			histograms[label] = counts
+		}
+
+		for i, count := range histogram.Counts {
+			counts[i] += count
+		}
+		sums[label] += histogram.Sum
+	}
+
+	labels := make([]string, 0, len(histograms))
+	for label := range histograms {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+
+	writeHeader(bw, "http_request_duration_seconds", "histogram", "Request time by route.")
+	for _, label := range labels {
+		routeLabel := `route="` + escape(label) + `"`
+		cumulative := uint64(0)
+
+		for i, count := range histograms[label] {
+			cumulative += count
+
+			le := "+Inf"
+			if i < len(analyzer.DURATION_BUCKETS) {
+				le = formatFloat(analyzer.DURATION_BUCKETS[i].Seconds())
+			}
+			fmt.Fprintf(bw, "%shttp_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", PREFIX, routeLabel, le, cumulative)
+		}
+
+		fmt.Fprintf(bw, "%shttp_request_duration_seconds_sum{%s} %s\n", PREFIX, routeLabel, formatFloat(sums[label].Seconds()))
+		fmt.Fprintf(bw, "%shttp_request_duration_seconds_count{%s} %d\n", PREFIX, routeLabel, cumulative)
+	}
+}
+
+// Writes a gauge with its HELP and TYPE lines
+func WriteGauge(w io.Writer, name, help string, value float64) error {
+	bw := bufio.NewWriter(w)
+	writeFamily(bw, name, "gauge", help, sample{value: value})
+
+	return bw.Flush()
+}
+
+func writeHeader(bw *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(bw, "# HELP %s%s %s\n", PREFIX, name, help)
+	fmt.Fprintf(bw, "# TYPE %s%s %s\n", PREFIX, name, kind)
+}
+
+func (key seriesKey) labels() string {
+	return fmt.Sprintf(`{route="%s",method="%s",status_class="%s"}`, escape(key.route), escape(key.method), escape(key.class))
+}
+
+// Label values are logged by clients, they are escaped and made valid UTF-8
+func escape(value string) string {
+	value = strings.ToValidUTF8(value, "�")
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
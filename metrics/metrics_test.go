@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func result(routes []analyzer.RouteCounts, durations map[string]*analyzer.DurationHistogram) *analyzer.AnalyzeResult {
+	return &analyzer.AnalyzeResult{
+		State:           &analyzer.ResultState{Metrics: &analyzer.MetricsState{Routes: routes, Durations: durations}},
+		ProcessingStats: analyzer.ProcessingStats{ParseErrors: 3},
+	}
+}
+
+func write(t *testing.T, e *Exporter, res *analyzer.AnalyzeResult) string {
+	var b strings.Builder
+	require.NoError(t, e.Write(&b, res))
+	return b.String()
+}
+
+func TestExporter(t *testing.T) {
+	routes := []analyzer.RouteCounts{
+		{Route: "/", Method: "GET", Class: "2xx", Requests: 10, Bytes: 1000},
+		{Route: "/about", Method: "GET", Class: "2xx", Requests: 5, Bytes: 500},
+		{Route: "/login", Method: "POST", Class: "4xx", Requests: 2, Bytes: 20},
+		{Route: "/search", Method: "GET", Class: "2xx", Requests: 1, Bytes: 10},
+	}
+
+	t.Run("should collapse routes beyond the busiest ones", func(t *testing.T) {
+		out := write(t, NewExporter(2), result(routes, nil))
+
+		assert.Contains(t, out, "# TYPE nginx_an_http_requests_total counter\n")
+		assert.Contains(t, out, `nginx_an_http_requests_total{route="/",method="GET",status_class="2xx"} 10`)
+		assert.Contains(t, out, `nginx_an_http_requests_total{route="/about",method="GET",status_class="2xx"} 5`)
+		assert.Contains(t, out, `nginx_an_http_requests_total{route="other",method="GET",status_class="2xx"} 1`)
+		assert.Contains(t, out, `nginx_an_http_requests_total{route="other",method="POST",status_class="4xx"} 2`)
+		assert.Contains(t, out, `nginx_an_http_response_bytes_total{route="/",method="GET",status_class="2xx"} 1000`)
+		assert.Contains(t, out, "nginx_an_log_parse_errors_total 3\n")
+		assert.NotContains(t, out, "/login")
+		assert.NotContains(t, out, "duration")
+	})
+
+	t.Run("should keep labeled routes when the ranking changes", func(t *testing.T) {
+		e := NewExporter(2)
+		write(t, e, result(routes, nil))
+
+		out := write(t, e, result([]analyzer.RouteCounts{
+			{Route: "/", Method: "GET", Class: "2xx", Requests: 10},
+			{Route: "/about", Method: "GET", Class: "2xx", Requests: 5},
+			{Route: "/login", Method: "POST", Class: "4xx", Requests: 100},
+		}, nil))
+
+		assert.Contains(t, out, `route="/about"`)
+		assert.Contains(t, out, `nginx_an_http_requests_total{route="other",method="POST",status_class="4xx"} 100`)
+	})
+
+	t.Run("should write cumulative duration histograms", func(t *testing.T) {
+		counts := make([]uint64, len(analyzer.DURATION_BUCKETS)+1)
+		counts[0], counts[7], counts[len(counts)-1] = 2, 1, 1
+
+		out := write(t, NewExporter(1), result(routes, map[string]*analyzer.DurationHistogram{
+			"/":       {Counts: counts, Sum: 20 * time.Second},
+			"/search": {Counts: counts, Sum: 20 * time.Second},
+		}))
+
+		assert.Contains(t, out, "# TYPE nginx_an_http_request_duration_seconds histogram\n")
+		assert.Contains(t, out, `nginx_an_http_request_duration_seconds_bucket{route="/",le="0.005"} 2`)
+		assert.Contains(t, out, `nginx_an_http_request_duration_seconds_bucket{route="/",le="1"} 3`)
+		assert.Contains(t, out, `nginx_an_http_request_duration_seconds_bucket{route="/",le="+Inf"} 4`)
+		assert.Contains(t, out, `nginx_an_http_request_duration_seconds_sum{route="/"} 20`)
+		assert.Contains(t, out, `nginx_an_http_request_duration_seconds_count{route="other"} 4`)
+	})
+
+	t.Run("should escape label values", func(t *testing.T) {
+		out := write(t, NewExporter(1), result([]analyzer.RouteCounts{
+			{Route: "/a\"b\\c\nd\xff", Method: "GET", Class: "2xx", Requests: 1},
+		}, nil))
+
+		assert.Contains(t, out, `route="/a\"b\\c\nd�"`)
+	})
+
+	t.Run("should write empty families without metrics state", func(t *testing.T) {
+		out := write(t, NewExporter(1), &analyzer.AnalyzeResult{})
+		assert.Contains(t, out, "# TYPE nginx_an_http_requests_total counter\n")
+		assert.Contains(t, out, "nginx_an_log_parse_errors_total 0\n")
+	})
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+)
+
+// Labeled value of a metric family
+type sample struct {
+	labels string
+	value  float64
+}
+
+func label(name, value string) string {
+	return fmt.Sprintf(`{%s="%s"}`, name, escape(value))
+}
+
+// Writes a one-shot analysis as OpenMetrics gauges, values describe the analyzed
+// log and may go down between runs, e.g. after rotation. Top lists are written
+// as they are in the result, so their size is bounded by --top.
+func WriteOpenMetrics(w io.Writer, res *analyzer.AnalyzeResult, now time.Time) error {
+	bw := bufio.NewWriter(w)
+
+	writeFamily(bw, "analysis_timestamp_seconds", "gauge", "Unix time of the analysis.", sample{value: unixSeconds(now)})
+	writeFamily(bw, "requests", "gauge", "Requests in the analyzed log.", sample{value: float64(res.TotalRequests)})
+	writeFamily(bw, "response_bytes", "gauge", "Response body bytes in the analyzed log.", sample{value: float64(res.TotalBytes)})
+	writeFamily(bw, "unique_ips", "gauge", "Distinct client ips.", sample{value: float64(res.UniqueIPs)})
+	writeFamily(bw, "unique_user_agents", "gauge", "Distinct user agents.", sample{value: float64(res.UniqueUserAgents)})
+
+	if res.TotalRequests > 0 {
+		writeFamily(bw, "first_request_timestamp_seconds", "gauge", "Unix time of the first request.", sample{value: unixSeconds(res.TimeRange.Start)})
+		writeFamily(bw, "last_request_timestamp_seconds", "gauge", "Unix time of the last request.", sample{value: unixSeconds(res.TimeRange.End)})
+	}
+
+	// every class is written, so absent classes read as zero instead of missing
+	classes := analyzer.CountClasses(res.StatusCodes)
+	classSamples := make([]sample, 0, len(classes))
+	for i, count := range classes {
+		classSamples = append(classSamples, sample{labels: label("status_class", analyzer.STATUS_CLASSES[i]), value: float64(count)})
+	}
+	writeFamily(bw, "status_class_requests", "gauge", "Requests by status class.", classSamples...)
+
+	writeFamily(bw, "top_status_code_requests", "gauge", "Requests of the top status codes.",
+		topSamples(res.Codes, "code", func(code uint16) string { return strconv.Itoa(int(code)) })...)
+	writeFamily(bw, "top_ip_requests", "gauge", "Requests of the top client ips.",
+		topSamples(res.Ips, "ip", func(ip netip.Addr) string { return ip.String() })...)
+	writeFamily(bw, "top_uri_requests", "gauge", "Requests of the top uris.",
+		topSamples(res.Uris, "uri", func(uri string) string { return uri })...)
+	if res.UserAgents != nil {
+		writeFamily(bw, "top_user_agent_requests", "gauge", "Requests of the top user agents.",
+			topSamples(res.UserAgents, "user_agent", func(ua string) string { return ua })...)
+	}
+
+	if latency := res.Latency; latency != nil {
+		writeFamily(bw, "request_duration_seconds", "gauge", "Request time statistics.",
+			sample{labels: label("stat", "avg"), value: latency.Avg.Seconds()},
+			sample{labels: label("stat", "p50"), value: latency.P50.Seconds()},
+			sample{labels: label("stat", "p95"), value: latency.P95.Seconds()},
+			sample{labels: label("stat", "p99"), value: latency.P99.Seconds()},
+			sample{labels: label("stat", "max"), value: latency.Max.Seconds()},
+		)
+	}
+
+	stats := res.ProcessingStats
+	writeFamily(bw, "file_size_bytes", "gauge", "Size of the analyzed log.", sample{value: float64(stats.FileSize)})
+	writeFamily(bw, "parse_errors", "gauge", "Log lines that failed to parse.", sample{value: float64(stats.ParseErrors)})
+	writeFamily(bw, "filtered_requests", "gauge", "Parsed requests excluded by filters.", sample{value: float64(stats.Filtered)})
+
+	fmt.Fprintln(bw, "# EOF")
+	return bw.Flush()
+}
+
+func topSamples[T comparable](hits []analyzer.HitsInfo[T], name string, format func(T) string) []sample {
+	samples := make([]sample, 0, len(hits))
+	for _, info := range hits {
+		samples = append(samples, sample{labels: label(name, format(info.Key)), value: float64(info.Hits)})
+	}
+
+	return samples
+}
+
+func writeFamily(bw *bufio.Writer, name, kind, help string, samples ...sample) {
+	writeHeader(bw, name, kind, help)
+	for _, s := range samples {
+		fmt.Fprintf(bw, "%s%s%s %s\n", PREFIX, name, s.labels, formatFloat(s.value))
+	}
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	res := &analyzer.AnalyzeResult{
+		TotalRequests: 10,
+		TotalBytes:    2048,
+		StatusCodes:   []analyzer.HitsInfo[uint16]{{Key: 200, Hits: 7}, {Key: 404, Hits: 2}, {Key: 502, Hits: 1}},
+		Codes:         []analyzer.HitsInfo[uint16]{{Key: 200, Hits: 7}},
+		Ips:           []analyzer.HitsInfo[netip.Addr]{{Key: netip.MustParseAddr("10.0.0.1"), Hits: 6}},
+		Uris:          []analyzer.HitsInfo[string]{{Key: `/search?q="x"`, Hits: 3}},
+		Latency:       &analyzer.LatencyStats{Requests: 10, P95: 250 * time.Millisecond},
+		TimeRange: analyzer.TimeRange{
+			Start: time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC),
+			End:   time.Date(2023, 12, 25, 11, 0, 0, 0, time.UTC),
+		},
+		ProcessingStats: analyzer.ProcessingStats{FileSize: 4096, ParseErrors: 1},
+	}
+
+	var b strings.Builder
+	require.NoError(t, WriteOpenMetrics(&b, res, time.Unix(1700000000, 0)))
+	out := b.String()
+
+	t.Run("should write the summary as gauges", func(t *testing.T) {
+		assert.Contains(t, out, "# TYPE nginx_an_requests gauge\nnginx_an_requests 10\n")
+		assert.Contains(t, out, "nginx_an_response_bytes 2048\n")
+		assert.Contains(t, out, "nginx_an_analysis_timestamp_seconds 1700000000\n")
+		assert.Contains(t, out, "nginx_an_first_request_timestamp_seconds 1703498400\n")
+		assert.Contains(t, out, `nginx_an_request_duration_seconds{stat="p95"} 0.25`)
+		assert.Contains(t, out, "nginx_an_file_size_bytes 4096\n")
+		assert.Contains(t, out, "nginx_an_parse_errors 1\n")
+	})
+
+	t.Run("should write every status class", func(t *testing.T) {
+		assert.Contains(t, out, `nginx_an_status_class_requests{status_class="1xx"} 0`)
+		assert.Contains(t, out, `nginx_an_status_class_requests{status_class="2xx"} 7`)
+		assert.Contains(t, out, `nginx_an_status_class_requests{status_class="5xx"} 1`)
+	})
+
+	t.Run("should write top lists with escaped labels", func(t *testing.T) {
+		assert.Contains(t, out, `nginx_an_top_status_code_requests{code="200"} 7`)
+		assert.Contains(t, out, `nginx_an_top_ip_requests{ip="10.0.0.1"} 6`)
+		assert.Contains(t, out, `nginx_an_top_uri_requests{uri="/search?q=\"x\""} 3`)
+		assert.NotContains(t, out, "top_user_agent")
+	})
+
+	t.Run("should end with the EOF marker", func(t *testing.T) {
+		assert.True(t, strings.HasSuffix(out, "\n# EOF\n"))
+	})
+}
@@ -1,17 +1,137 @@
 package parser
 
 import (
+	"bytes"
 	"strings"
 	"time"
 )
 
+const dateLayout = "02/Jan/2006:15:04:05 -0700"
+
+var monthNames = [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
 func parseDateTime(dateStr string) (time.Time, error) {
 	str := strings.Trim(dateStr, "[]")
 
-	parsedTime, err := time.Parse("02/Jan/2006:15:04:05 -0700", str)
+	parsedTime, err := time.Parse(dateLayout, str)
 	if err != nil {
 		return time.Time{}, err
 	}
 
 	return parsedTime, nil
 }
+
+// Caches the last parsed timestamp. Log lines are mostly sorted by time,
+// so consecutive lines usually share the same second.
+type dateCache struct {
+	key   [len(dateLayout)]byte
+	value time.Time
+	valid bool
+	zones map[int]*time.Location
+}
+
+func (c *dateCache) parse(b []byte) (time.Time, error) {
+	if c.valid && bytes.Equal(c.key[:], b) {
+		return c.value, nil
+	}
+
+	t, ok := c.parseTimestamp(b)
+	if !ok {
+		// slow path also produces a descriptive error
+		return parseDateTime(string(b))
+	}
+
+	copy(c.key[:], b)
+	c.value = t
+	c.valid = true
+
+	return t, nil
+}
+
+// Hand parses the fixed "02/Jan/2006:15:04:05 -0700" layout.
+// Returns false for anything unusual, the caller falls back to time.Parse then.
+func (c *dateCache) parseTimestamp(b []byte) (time.Time, bool) {
+	if len(b) != len(dateLayout) {
+		return time.Time{}, false
+	}
+
+	if b[2] != '/' || b[6] != '/' || b[11] != ':' || b[14] != ':' || b[17] != ':' || b[20] != ' ' {
+		return time.Time{}, false
+	}
+
+	day, ok1 := parseDigits(b[0:2])
+	year, ok2 := parseDigits(b[7:11])
+	hour, ok3 := parseDigits(b[12:14])
+	minute, ok4 := parseDigits(b[15:17])
+	sec, ok5 := parseDigits(b[18:20])
+	zoneHour, ok6 := parseDigits(b[22:24])
+	zoneMin, ok7 := parseDigits(b[24:26])
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || !ok6 || !ok7 {
+		return time.Time{}, false
+	}
+
+	month := 0
+	for i, name := range monthNames {
+		if string(b[3:6]) == name {
+			month = i + 1
+			break
+		}
+	}
+
+	if month == 0 || day < 1 || day > daysIn(time.Month(month), year) {
+		return time.Time{}, false
+	}
+
+	if hour > 23 || minute > 59 || sec > 59 || zoneHour > 23 || zoneMin > 59 {
+		return time.Time{}, false
+	}
+
+	offset := (zoneHour*60 + zoneMin) * 60
+	switch b[21] {
+	case '+':
+	case '-':
+		offset = -offset
+	default:
+		return time.Time{}, false
+	}
+
+	t := time.Date(year, time.Month(month), day, hour, minute, sec, 0, time.UTC)
+	t = t.Add(-time.Duration(offset) * time.Second)
+
+	// Same location selection as time.Parse, so both paths return equal values
+	if _, localOffset := t.In(time.Local).Zone(); localOffset == offset {
+		return t.In(time.Local), true
+	}
+
+	return t.In(c.zone(offset)), true
+}
+
+func (c *dateCache) zone(offset int) *time.Location {
+	if c.zones == nil {
+		c.zones = make(map[int]*time.Location)
+	}
+
+	loc, ok := c.zones[offset]
+	if !ok {
+		loc = time.FixedZone("", offset)
+		c.zones[offset] = loc
+	}
+
+	return loc
+}
+
+func parseDigits(b []byte) (int, bool) {
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+
+	return n, true
+}
+
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
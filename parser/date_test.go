@@ -46,3 +46,45 @@ func TestParseDateTime(t *testing.T) {
 		assert.Equal(t, time.Time{}, result)
 	})
 }
+
+func TestDateCacheParse(t *testing.T) {
+	t.Run("should match time.Parse result", func(t *testing.T) {
+		dates := []string{
+			"25/Dec/2023:10:30:45 +0000",
+			"01/Jan/2024:00:00:00 +0300",
+			"29/Feb/2024:23:59:59 -0530",
+			"31/Oct/2025:12:01:02 +1400",
+		}
+
+		var cache dateCache
+		for _, date := range dates {
+			expected, err := time.Parse(dateLayout, date)
+			assert.NoError(t, err)
+
+			result, err := cache.parse([]byte(date))
+
+			assert.NoError(t, err)
+			assert.Equal(t, expected, result)
+		}
+	})
+
+	t.Run("should fall back to time.Parse for unusual input", func(t *testing.T) {
+		var cache dateCache
+
+		_, ok := cache.parseTimestamp([]byte("25/dec/2023:10:30:45 +0000"))
+		assert.False(t, ok)
+
+		result, err := cache.parse([]byte("25/dec/2023:10:30:45 +0000"))
+		assert.NoError(t, err)
+		assert.Equal(t, 25, result.Day())
+	})
+
+	t.Run("should return error for invalid dates", func(t *testing.T) {
+		var cache dateCache
+
+		for _, date := range []string{"30/Feb/2024:10:30:45 +0000", "25/Dec/2023:24:30:45 +0000", "25/Foo/2023:10:30:45 +0000", ""} {
+			_, err := cache.parse([]byte(date))
+			assert.Error(t, err, date)
+		}
+	})
+}
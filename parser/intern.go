@@ -0,0 +1,44 @@
+package parser
+
+// Interner deduplicates strings that repeat across log lines
+// (methods, protocols, user agents, popular uris) so the hot path
+// doesn't allocate a new string for every line.
+type Interner struct {
+	strs    map[string]string
+	maxSize int
+}
+
+func NewInterner(maxSize int) *Interner {
+	return &Interner{
+		strs:    make(map[string]string, min(maxSize, 1024)),
+		maxSize: maxSize,
+	}
+}
+
+// Returns a string equal to b, reusing the stored copy when possible.
+// Once the interner is full new strings are copied but not stored.
+func (in *Interner) Intern(b []byte) string {
+	if in == nil || in.strs == nil {
+		return string(b)
+	}
+
+	// map lookup with string(b) conversion doesn't allocate
+	if s, ok := in.strs[string(b)]; ok {
+		return s
+	}
+
+	s := string(b)
+	if len(in.strs) < in.maxSize {
+		in.strs[s] = s
+	}
+
+	return s
+}
+
+func (in *Interner) Len() int {
+	if in == nil {
+		return 0
+	}
+
+	return len(in.strs)
+}
@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterner(t *testing.T) {
+	t.Run("should return equal strings", func(t *testing.T) {
+		in := NewInterner(10)
+
+		assert.Equal(t, "GET", in.Intern([]byte("GET")))
+		assert.Equal(t, "GET", in.Intern([]byte("GET")))
+		assert.Equal(t, 1, in.Len())
+	})
+
+	t.Run("should stop storing strings when full", func(t *testing.T) {
+		in := NewInterner(1)
+
+		in.Intern([]byte("a"))
+		assert.Equal(t, "b", in.Intern([]byte("b")))
+		assert.Equal(t, 1, in.Len())
+	})
+
+	t.Run("should work on nil interner", func(t *testing.T) {
+		var in *Interner
+
+		assert.Equal(t, "a", in.Intern([]byte("a")))
+		assert.Equal(t, 0, in.Len())
+	})
+
+	t.Run("should not allocate for known strings", func(t *testing.T) {
+		in := NewInterner(10)
+		b := []byte("Mozilla/5.0")
+		in.Intern(b)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			in.Intern(b)
+		})
+
+		assert.Equal(t, float64(0), allocs)
+	})
+}
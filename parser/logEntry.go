@@ -1,16 +1,53 @@
 package parser
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"net/netip"
 	"strconv"
 	"time"
+)
+
+// Max amount of distinct strings kept by the parser interner
+const INTERN_MAX_SIZE = 1 << 16
 
-	"github.com/Kostayne/go-nginx-analyzer/worditer"
+var (
+	errEmptyIp        = errors.New("ip is empty")
+	errEmptyUser      = errors.New("user is empty")
+	errEmptyMethod    = errors.New("method is empty")
+	errEmptyUri       = errors.New("uri is empty")
+	errEmptyProtocol  = errors.New("protocol is empty")
+	errEmptyReferrer  = errors.New("referrer is empty")
+	errEmptyUserAgent = errors.New("user agent is empty")
 )
 
+// Field appended to the combined format after the user agent, quoted or not,
+// named after the nginx variable without the "$" sign
+type ExtraField string
+
+const (
+	FIELD_X_FORWARDED_FOR ExtraField = "http_x_forwarded_for"
+	FIELD_X_REAL_IP       ExtraField = "http_x_real_ip"
+	FIELD_REQUEST_TIME    ExtraField = "request_time"
+)
+
+// RequestTime value of "-"
+const NO_REQUEST_TIME time.Duration = -1
+
+func IsValidExtraField(field ExtraField) bool {
+	switch field {
+	case FIELD_X_FORWARDED_FOR, FIELD_X_REAL_IP, FIELD_REQUEST_TIME:
+		return true
+	}
+
+	return false
+}
+
 type LogEntry struct {
+	// Client ip, equals RemoteAddr unless resolved from proxy headers
 	Ip         netip.Addr
+	RemoteAddr netip.Addr
 	User       string
 	Date       time.Time
 	Method     string
@@ -20,73 +57,335 @@ type LogEntry struct {
 	RespBytes  uint
 	Referrer   string
 	UserAgent  string
+
+	// Extra fields, "-" when nginx logged an empty value
+	XForwardedFor string
+	XRealIp       string
+
+	// Extra field, NO_REQUEST_TIME when nginx logged an empty value
+	RequestTime time.Duration
+}
+
+// Parser parses log lines straight from byte slices without
+// allocating on the hot path. It is not safe for concurrent use,
+// every worker owns its own parser.
+type Parser struct {
+	strs        *Interner
+	dates       dateCache
+	extraFields []ExtraField
+}
+
+// extraFields lists quoted fields following the user agent in log_format order
+func NewParser(extraFields ...ExtraField) *Parser {
+	return &Parser{
+		strs:        NewInterner(INTERN_MAX_SIZE),
+		extraFields: extraFields,
+	}
 }
 
 func ParseLogEntry(line string) (*LogEntry, error) {
 	log := &LogEntry{}
-	iter := worditer.New(line)
 
-	ipStr := iter.NextOrEmpty()
-	if ipStr == "" {
-		return nil, fmt.Errorf("ip is empty")
+	var p Parser
+	if err := p.Parse([]byte(line), log); err != nil {
+		return nil, err
 	}
 
-	parsedIp, err := netip.ParseAddr(ipStr)
-	log.Ip = parsedIp
+	return log, nil
+}
+
+// Parses line into log. Strings stored in log never reference line memory,
+// so line may be reused or unmapped afterwards.
+func (p *Parser) Parse(line []byte, log *LogEntry) error {
+	// extra fields are cut from the end, so the rest is a regular combined line
+	line, err := p.parseExtraFields(line, log)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	iter.NextOrEmpty()
+	iter := fieldIter{line: line}
 
-	log.User = iter.NextOrEmpty()
-	if log.User == "" {
-		return nil, fmt.Errorf("user is empty")
+	ipBytes := iter.next()
+	if len(ipBytes) == 0 {
+		return errEmptyIp
 	}
 
-	dateStr := fmt.Sprintf("%s %s", iter.NextOrEmpty(), iter.NextOrEmpty())
-	parsedDate, err := parseDateTime(dateStr)
+	parsedIp, err := parseAddr(ipBytes)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	log.Ip = parsedIp
+	log.RemoteAddr = parsedIp
+
+	iter.next()
+
+	user := iter.next()
+	if len(user) == 0 {
+		return errEmptyUser
+	}
+	log.User = p.strs.Intern(user)
+
+	parsedDate, err := p.parseDate(iter.next(), iter.next())
+	if err != nil {
+		return err
 	}
 	log.Date = parsedDate
 
-	log.Method = iter.NextOrEmpty()
-	if log.Method == "" {
-		return nil, fmt.Errorf("method is empty")
+	// request line is quoted, method uri and protocol are split inside of it
+	request := fieldIter{line: iter.nextQuoted()}
+
+	method := request.next()
+	if len(method) == 0 {
+		return errEmptyMethod
 	}
+	log.Method = p.strs.Intern(method)
 
-	log.Uri = iter.NextOrEmpty()
-	if log.Uri == "" {
-		return nil, fmt.Errorf("uri is empty")
+	uri := request.next()
+	if len(uri) == 0 {
+		return errEmptyUri
 	}
+	log.Uri = p.strs.Intern(uri)
 
-	log.Protocol = iter.NextOrEmpty()
-	if log.Protocol == "" {
-		return nil, fmt.Errorf("protocol is empty")
+	protocol := request.next()
+	if len(protocol) == 0 {
+		return errEmptyProtocol
 	}
+	log.Protocol = p.strs.Intern(protocol)
 
-	statusCode, err := strconv.ParseUint(iter.NextOrEmpty(), 10, 16)
-	log.StatusCode = uint16(statusCode)
+	statusCode, err := parseUint(iter.next(), 16)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	log.StatusCode = uint16(statusCode)
 
-	respBytes, err := strconv.ParseUint(iter.NextOrEmpty(), 10, 32)
+	respBytes, err := parseUint(iter.next(), 32)
+	if err != nil {
+		return err
+	}
 	log.RespBytes = uint(respBytes)
+
+	referrer := iter.nextQuoted()
+	if len(referrer) == 0 {
+		return errEmptyReferrer
+	}
+	log.Referrer = p.strs.Intern(referrer)
+
+	userAgent := iter.nextQuoted()
+	if len(userAgent) == 0 {
+		return errEmptyUserAgent
+	}
+	log.UserAgent = p.strs.Intern(userAgent)
+
+	return nil
+}
+
+// Parses extra fields from the end of the line and returns the line without them
+func (p *Parser) parseExtraFields(line []byte, log *LogEntry) ([]byte, error) {
+	for i := len(p.extraFields) - 1; i >= 0; i-- {
+		field := p.extraFields[i]
+
+		end := len(line)
+		for end > 0 && line[end-1] == ' ' {
+			end--
+		}
+
+		if end == 0 {
+			return nil, fmt.Errorf("%s field is missing", field)
+		}
+
+		var value []byte
+		if line[end-1] == '"' {
+			start := bytes.LastIndexByte(line[:end-1], '"')
+			if start == -1 {
+				return nil, fmt.Errorf("%s field is missing", field)
+			}
+
+			value = line[start+1 : end-1]
+			line = line[:start]
+		} else {
+			// unquoted fields like $request_time are single words
+			start := bytes.LastIndexByte(line[:end], ' ') + 1
+			value = line[start:end]
+			line = line[:start]
+		}
+
+		if err := setExtraField(field, value, log); err != nil {
+			return nil, err
+		}
+	}
+
+	return line, nil
+}
+
+func setExtraField(field ExtraField, value []byte, log *LogEntry) error {
+	// proxy headers are mostly unique per client, interning them
+	// would only push popular strings out of the interner
+	switch field {
+	case FIELD_X_FORWARDED_FOR:
+		log.XForwardedFor = string(value)
+	case FIELD_X_REAL_IP:
+		log.XRealIp = string(value)
+	case FIELD_REQUEST_TIME:
+		requestTime, err := parseRequestTime(value)
+		if err != nil {
+			return err
+		}
+		log.RequestTime = requestTime
+	}
+
+	return nil
+}
+
+// Parses seconds with a fractional part, like "0.125"
+func parseRequestTime(b []byte) (time.Duration, error) {
+	if len(b) == 1 && b[0] == '-' {
+		return NO_REQUEST_TIME, nil
+	}
+
+	whole, frac, _ := bytes.Cut(b, []byte{'.'})
+	if len(whole) == 0 || len(frac) > 9 {
+		return 0, fmt.Errorf("invalid request_time %q", b)
+	}
+
+	seconds, err := parseUint(whole, 32)
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("invalid request_time %q", b)
+	}
+
+	nanos := uint64(0)
+	if len(frac) > 0 {
+		if nanos, err = parseUint(frac, 32); err != nil {
+			return 0, fmt.Errorf("invalid request_time %q", b)
+		}
+
+		for range 9 - len(frac) {
+			nanos *= 10
+		}
 	}
 
-	log.Referrer = iter.NextOrEmpty()
-	if log.Referrer == "" {
-		return nil, fmt.Errorf("referrer is empty")
+	return time.Duration(seconds)*time.Second + time.Duration(nanos), nil
+}
+
+// Joins two date tokens with a space & trims the surrounding brackets
+func (p *Parser) parseDate(datePart, zonePart []byte) (time.Time, error) {
+	var buf [len(dateLayout) + 8]byte
+
+	if len(datePart)+len(zonePart)+1 > len(buf) {
+		return parseDateTime(string(datePart) + " " + string(zonePart))
 	}
 
-	log.UserAgent = iter.NextOrEmpty()
-	if log.UserAgent == "" {
-		return nil, fmt.Errorf("user agent is empty")
+	n := copy(buf[:], datePart)
+	buf[n] = ' '
+	n++
+	n += copy(buf[n:], zonePart)
+
+	start, end := 0, n
+	for start < end && (buf[start] == '[' || buf[start] == ']') {
+		start++
+	}
+	for end > start && (buf[end-1] == '[' || buf[end-1] == ']') {
+		end--
 	}
 
-	return log, nil
+	return p.dates.parse(buf[start:end])
+}
+
+// Splits a line by spaces skipping empty words,
+// quoted fields may contain spaces
+type fieldIter struct {
+	line []byte
+	pos  int
+}
+
+func (iter *fieldIter) next() []byte {
+	for iter.pos < len(iter.line) && iter.line[iter.pos] == ' ' {
+		iter.pos++
+	}
+
+	start := iter.pos
+	for iter.pos < len(iter.line) && iter.line[iter.pos] != ' ' {
+		iter.pos++
+	}
+
+	return iter.line[start:iter.pos]
+}
+
+// Returns the content of a quoted field without quotes. nginx escapes
+// quotes inside of values, so the field ends at the next quote.
+// Unquoted fields are read as regular words.
+func (iter *fieldIter) nextQuoted() []byte {
+	for iter.pos < len(iter.line) && iter.line[iter.pos] == ' ' {
+		iter.pos++
+	}
+
+	if iter.pos >= len(iter.line) || iter.line[iter.pos] != '"' {
+		return iter.next()
+	}
+
+	start := iter.pos + 1
+	end := bytes.IndexByte(iter.line[start:], '"')
+	if end == -1 {
+		// unterminated quote, take the rest of the line
+		iter.pos = len(iter.line)
+		return iter.line[start:]
+	}
+
+	iter.pos = start + end + 1
+	return iter.line[start : start+end]
+}
+
+// Fast path for dotted IPv4 addresses, everything else goes to netip
+func parseAddr(b []byte) (netip.Addr, error) {
+	var octets [4]byte
+	octet, digits, dots := 0, 0, 0
+
+	for i, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			// leading zeros are rejected by netip as well
+			if digits == 1 && octet == 0 {
+				return netip.ParseAddr(string(b))
+			}
+
+			octet = octet*10 + int(c-'0')
+			digits++
+			if octet > 255 {
+				return netip.ParseAddr(string(b))
+			}
+		case c == '.' && digits > 0 && dots < 3 && i != len(b)-1:
+			octets[dots] = byte(octet)
+			dots++
+			octet, digits = 0, 0
+		default:
+			return netip.ParseAddr(string(b))
+		}
+	}
+
+	if dots != 3 || digits == 0 {
+		return netip.ParseAddr(string(b))
+	}
+	octets[3] = byte(octet)
+
+	return netip.AddrFrom4(octets), nil
+}
+
+// Parses a decimal number, strconv is only used to build the error
+func parseUint(b []byte, bitSize int) (uint64, error) {
+	if len(b) == 0 || len(b) > 19 {
+		return strconv.ParseUint(string(b), 10, bitSize)
+	}
+
+	n := uint64(0)
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return strconv.ParseUint(string(b), 10, bitSize)
+		}
+		n = n*10 + uint64(c-'0')
+	}
+
+	if n >= 1<<bitSize {
+		return strconv.ParseUint(string(b), 10, bitSize)
+	}
+
+	return n, nil
 }
@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/worditer"
+)
+
+// Previous string based implementation, kept as the benchmark baseline
+func parseLogEntryLegacy(line string) (*LogEntry, error) {
+	log := &LogEntry{}
+	iter := worditer.New(line)
+
+	ipStr := iter.NextOrEmpty()
+	if ipStr == "" {
+		return nil, fmt.Errorf("ip is empty")
+	}
+
+	parsedIp, err := netip.ParseAddr(ipStr)
+	log.Ip = parsedIp
+	if err != nil {
+		return nil, err
+	}
+
+	iter.NextOrEmpty()
+	log.User = iter.NextOrEmpty()
+
+	dateStr := fmt.Sprintf("%s %s", iter.NextOrEmpty(), iter.NextOrEmpty())
+	parsedDate, err := parseDateTime(dateStr)
+	if err != nil {
+		return nil, err
+	}
+	log.Date = parsedDate
+
+	log.Method = iter.NextOrEmpty()
+	log.Uri = iter.NextOrEmpty()
+	log.Protocol = iter.NextOrEmpty()
+
+	statusCode, err := strconv.ParseUint(iter.NextOrEmpty(), 10, 16)
+	log.StatusCode = uint16(statusCode)
+	if err != nil {
+		return nil, err
+	}
+
+	respBytes, err := strconv.ParseUint(iter.NextOrEmpty(), 10, 32)
+	log.RespBytes = uint(respBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Referrer = iter.NextOrEmpty()
+	log.UserAgent = iter.NextOrEmpty()
+
+	return log, nil
+}
+
+// Lines similar to the generator output, several lines share a second
+func benchLines(n int) [][]byte {
+	ips := []string{"192.168.1.100", "192.168.1.101", "10.0.0.50", "172.16.0.10", "2001:db8::1"}
+	uris := []string{"/", "/about", "/products/books", "/api/v1/users", "/blog/post/123"}
+	agents := []string{"Mozilla/5.0", "Googlebot/2.1", "curl/7.68.0"}
+	start := time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC)
+
+	lines := make([][]byte, n)
+	for i := range lines {
+		date := start.Add(time.Duration(i/4) * time.Second).Format("[02/Jan/2006:15:04:05 -0700]")
+		lines[i] = fmt.Appendf(nil, `%s - - %s "GET %s HTTP/1.1" %d %d "https://example.com/" "%s"`,
+			ips[i%len(ips)], date, uris[i%len(uris)], 200+i%3, 200+i%5000, agents[i%len(agents)])
+	}
+
+	return lines
+}
+
+func TestParserDoesNotAllocate(t *testing.T) {
+	lines := benchLines(64)
+	p := NewParser()
+	entry := &LogEntry{}
+
+	// warm up interner and date cache
+	for _, line := range lines {
+		p.Parse(line, entry)
+	}
+
+	i := 0
+	allocs := testing.AllocsPerRun(1000, func() {
+		p.Parse(lines[i%len(lines)], entry)
+		i++
+	})
+
+	if allocs != 0 {
+		t.Errorf("Expected 0 allocs per line, got %.2f", allocs)
+	}
+}
+
+func BenchmarkParseLogEntryLegacy(b *testing.B) {
+	lines := benchLines(4096)
+	strLines := make([]string, len(lines))
+	for i, line := range lines {
+		strLines[i] = string(line)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseLogEntryLegacy(strLines[i%len(strLines)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportLinesPerSec(b)
+}
+
+// Mirrors the old analyzer hot path: string(mmapData[...]) + ParseLogEntry
+func BenchmarkParseLogEntryFromBytes(b *testing.B) {
+	lines := benchLines(4096)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseLogEntry(string(lines[i%len(lines)])); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportLinesPerSec(b)
+}
+
+func BenchmarkParserParse(b *testing.B) {
+	lines := benchLines(4096)
+	p := NewParser()
+	entry := &LogEntry{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := p.Parse(lines[i%len(lines)], entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportLinesPerSec(b)
+}
+
+func BenchmarkDateCacheParse(b *testing.B) {
+	b.Run("cached", func(b *testing.B) {
+		var cache dateCache
+		date := []byte("25/Dec/2023:10:30:45 +0000")
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cache.parse(date)
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		var cache dateCache
+		date := []byte("25/Dec/2023:10:30:45 +0000")
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cache.parseTimestamp(date)
+		}
+	})
+
+	b.Run("time.Parse", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			time.Parse(dateLayout, "25/Dec/2023:10:30:45 +0000")
+		}
+	})
+}
+
+func reportLinesPerSec(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "lines/s")
+}
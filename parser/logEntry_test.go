@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"net/netip"
 	"testing"
 	"time"
 
@@ -17,19 +18,39 @@ func TestParseLogEntry(t *testing.T) {
 		assert.NotNil(t, log)
 		assert.Equal(t, "192.168.1.100", log.Ip.String())
 		assert.Equal(t, "-", log.User)
-		assert.Equal(t, `"GET`, log.Method) // Quotes remain in method field
+		assert.Equal(t, "GET", log.Method)
 		assert.Equal(t, "/api/users", log.Uri)
-		assert.Equal(t, `HTTP/1.1"`, log.Protocol) // Quotes remain in protocol field
+		assert.Equal(t, "HTTP/1.1", log.Protocol)
 		assert.Equal(t, uint16(200), log.StatusCode)
 		assert.Equal(t, uint(1234), log.RespBytes)
-		assert.Equal(t, `"https://example.com"`, log.Referrer) // Quotes remain in referrer
-		assert.Equal(t, `"Mozilla/5.0"`, log.UserAgent)        // Quotes remain in user agent
+		assert.Equal(t, "https://example.com", log.Referrer)
+		assert.Equal(t, "Mozilla/5.0", log.UserAgent)
 
 		// Check date parsing
 		expectedTime, _ := time.Parse("02/Jan/2006:15:04:05 -0700", "25/Dec/2023:10:30:45 +0000")
 		assert.Equal(t, expectedTime, log.Date)
 	})
 
+	t.Run("should capture user agent with spaces", func(t *testing.T) {
+		line := `192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET /api/users?q=a%20b HTTP/1.1" 200 1234 "-" "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36"`
+
+		log, err := ParseLogEntry(line)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "/api/users?q=a%20b", log.Uri)
+		assert.Equal(t, "-", log.Referrer)
+		assert.Equal(t, "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36", log.UserAgent)
+	})
+
+	t.Run("should return error for malformed request line", func(t *testing.T) {
+		line := `192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "-" 400 0 "-" "-"`
+
+		log, err := ParseLogEntry(line)
+
+		assert.EqualError(t, err, "uri is empty")
+		assert.Nil(t, log)
+	})
+
 	t.Run("should return error when status code is not a number", func(t *testing.T) {
 		line := `192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET /api/users HTTP/1.1" abc 1234 "https://example.com" "Mozilla/5.0"`
 
@@ -66,3 +87,198 @@ func TestParseLogEntry(t *testing.T) {
 		assert.Nil(t, log)
 	})
 }
+
+func TestParserParse(t *testing.T) {
+	t.Run("should match ParseLogEntry result", func(t *testing.T) {
+		lines := []string{
+			`192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "https://example.com" "Mozilla/5.0"`,
+			`10.0.0.1 - admin [01/Jan/2024:00:00:00 +0300] "POST /login HTTP/2.0" 302 0 "-" "curl/7.68.0"`,
+			`2001:db8::1 - - [29/Feb/2024:23:59:59 -0530] "GET / HTTP/1.1" 404 10 "-" "Googlebot/2.1"`,
+		}
+
+		p := NewParser()
+		for _, line := range lines {
+			expected, err := ParseLogEntry(line)
+			assert.NoError(t, err)
+
+			var entry LogEntry
+			err = p.Parse([]byte(line), &entry)
+
+			assert.NoError(t, err)
+			assert.Equal(t, *expected, entry)
+		}
+	})
+
+	t.Run("should not reference line memory", func(t *testing.T) {
+		line := []byte(`192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET /api/users HTTP/1.1" 200 1234 "https://example.com" "Mozilla/5.0"`)
+
+		var entry LogEntry
+		err := NewParser().Parse(line, &entry)
+		assert.NoError(t, err)
+
+		for i := range line {
+			line[i] = 'x'
+		}
+
+		assert.Equal(t, "/api/users", entry.Uri)
+		assert.Equal(t, "Mozilla/5.0", entry.UserAgent)
+	})
+
+	t.Run("should reuse cached date for the same second", func(t *testing.T) {
+		p := NewParser()
+		var first, second LogEntry
+
+		err := p.Parse([]byte(`192.168.1.100 - - [25/Dec/2023:10:30:45 +0200] "GET / HTTP/1.1" 200 1 "-" "a"`), &first)
+		assert.NoError(t, err)
+		err = p.Parse([]byte(`192.168.1.101 - - [25/Dec/2023:10:30:45 +0200] "GET / HTTP/1.1" 200 1 "-" "b"`), &second)
+		assert.NoError(t, err)
+
+		assert.Equal(t, first.Date, second.Date)
+		assert.Equal(t, 2*60*60, offsetOf(second.Date))
+	})
+
+	t.Run("should return error for invalid ip", func(t *testing.T) {
+		var entry LogEntry
+		err := NewParser().Parse([]byte(`192.168.01.100 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 1 "-" "a"`), &entry)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error for status code overflow", func(t *testing.T) {
+		var entry LogEntry
+		err := NewParser().Parse([]byte(`192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 70000 1 "-" "a"`), &entry)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error for missing user agent", func(t *testing.T) {
+		var entry LogEntry
+		err := NewParser().Parse([]byte(`192.168.1.100 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 1 "-"`), &entry)
+
+		assert.EqualError(t, err, "user agent is empty")
+	})
+}
+
+func TestParseAddr(t *testing.T) {
+	t.Run("should parse ipv4 addresses", func(t *testing.T) {
+		for _, s := range []string{"0.0.0.0", "1.2.3.4", "255.255.255.255", "10.0.0.50"} {
+			addr, err := parseAddr([]byte(s))
+
+			assert.NoError(t, err)
+			assert.Equal(t, netip.MustParseAddr(s), addr)
+		}
+	})
+
+	t.Run("should parse ipv6 addresses", func(t *testing.T) {
+		addr, err := parseAddr([]byte("2001:db8::1"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, netip.MustParseAddr("2001:db8::1"), addr)
+	})
+
+	t.Run("should reject malformed ipv4 addresses", func(t *testing.T) {
+		for _, s := range []string{"1.2.3", "1.2.3.4.", "1..2.3", "256.1.1.1", "01.2.3.4", "1.2.3.4.5", "a.b.c.d"} {
+			_, err := parseAddr([]byte(s))
+
+			assert.Error(t, err, s)
+		}
+	})
+}
+
+func TestParseUint(t *testing.T) {
+	t.Run("should parse numbers", func(t *testing.T) {
+		n, err := parseUint([]byte("65535"), 16)
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(65535), n)
+	})
+
+	t.Run("should return strconv errors", func(t *testing.T) {
+		_, err := parseUint([]byte("65536"), 16)
+		assert.Error(t, err)
+
+		_, err = parseUint([]byte("-1"), 16)
+		assert.Error(t, err)
+
+		_, err = parseUint([]byte(""), 16)
+		assert.Error(t, err)
+	})
+}
+
+func offsetOf(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
+}
+
+func TestParserExtraFields(t *testing.T) {
+	t.Run("should parse fields appended after user agent", func(t *testing.T) {
+		line := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 1 "-" "Mozilla/5.0" "203.0.113.7, 10.0.0.2" "203.0.113.7"`
+		p := NewParser(FIELD_X_FORWARDED_FOR, FIELD_X_REAL_IP)
+
+		var entry LogEntry
+		err := p.Parse([]byte(line), &entry)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "203.0.113.7, 10.0.0.2", entry.XForwardedFor)
+		assert.Equal(t, "203.0.113.7", entry.XRealIp)
+		assert.Equal(t, "Mozilla/5.0", entry.UserAgent)
+		assert.Equal(t, "10.0.0.1", entry.RemoteAddr.String())
+		assert.Equal(t, entry.RemoteAddr, entry.Ip)
+	})
+
+	t.Run("should parse empty field", func(t *testing.T) {
+		line := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 1 "-" "Mozilla/5.0" "-"`
+		p := NewParser(FIELD_X_FORWARDED_FOR)
+
+		var entry LogEntry
+		err := p.Parse([]byte(line), &entry)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "-", entry.XForwardedFor)
+	})
+
+	t.Run("should parse unquoted request time", func(t *testing.T) {
+		line := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 1 "-" "Mozilla/5.0" "203.0.113.7" 0.125`
+		p := NewParser(FIELD_X_FORWARDED_FOR, FIELD_REQUEST_TIME)
+
+		var entry LogEntry
+		err := p.Parse([]byte(line), &entry)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "203.0.113.7", entry.XForwardedFor)
+		assert.Equal(t, 125*time.Millisecond, entry.RequestTime)
+		assert.Equal(t, "Mozilla/5.0", entry.UserAgent)
+	})
+
+	t.Run("should parse request time", func(t *testing.T) {
+		cases := map[string]time.Duration{
+			"0.000":    0,
+			"1.5":      1500 * time.Millisecond,
+			"12":       12 * time.Second,
+			"0.000123": 123 * time.Microsecond,
+			"-":        NO_REQUEST_TIME,
+		}
+
+		for value, expected := range cases {
+			requestTime, err := parseRequestTime([]byte(value))
+
+			assert.NoError(t, err, value)
+			assert.Equal(t, expected, requestTime, value)
+		}
+
+		for _, value := range []string{"", ".5", "1.x", "abc", "1.0000000001"} {
+			_, err := parseRequestTime([]byte(value))
+			assert.Error(t, err, value)
+		}
+	})
+
+	t.Run("should return error when field is missing", func(t *testing.T) {
+		line := `10.0.0.1 - - [25/Dec/2023:10:30:45 +0000] "GET / HTTP/1.1" 200 1 "-" "Mozilla/5.0"`
+		p := NewParser(FIELD_X_FORWARDED_FOR, FIELD_X_REAL_IP)
+
+		var entry LogEntry
+		err := p.Parse([]byte(line), &entry)
+
+		assert.Error(t, err)
+	})
+}
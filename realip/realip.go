@@ -0,0 +1,148 @@
+package realip
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Header used to derive the client ip
+type Source string
+
+const (
+	SOURCE_REMOTE_ADDR     Source = "remote"
+	SOURCE_X_FORWARDED_FOR Source = "xff"
+	SOURCE_X_REAL_IP       Source = "real-ip"
+)
+
+// Resolves the client ip the same way nginx realip module does
+// with real_ip_recursive enabled. Safe for concurrent use.
+type Resolver struct {
+	source  Source
+	trusted []netip.Prefix
+}
+
+// With empty trusted list the immediate peer (remote_addr) is
+// the only trusted proxy.
+func New(source Source, trusted []netip.Prefix) (*Resolver, error) {
+	if !IsValidSource(source) {
+		return nil, fmt.Errorf("unknown client ip source %q", source)
+	}
+
+	return &Resolver{
+		source:  source,
+		trusted: trusted,
+	}, nil
+}
+
+func IsValidSource(source Source) bool {
+	switch source {
+	case SOURCE_REMOTE_ADDR, SOURCE_X_FORWARDED_FOR, SOURCE_X_REAL_IP:
+		return true
+	}
+
+	return false
+}
+
+// Parses a list of CIDRs, plain addresses are treated as single host prefixes
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func (r *Resolver) Source() Source {
+	return r.source
+}
+
+// Returns the client ip. forwardedFor & realIp are raw header values,
+// "-" or empty values mean the header was absent.
+func (r *Resolver) Resolve(remote netip.Addr, forwardedFor, realIp string) netip.Addr {
+	if len(r.trusted) > 0 && !r.IsTrusted(remote) {
+		return remote
+	}
+
+	switch r.source {
+	case SOURCE_X_FORWARDED_FOR:
+		return r.resolveForwardedFor(remote, forwardedFor)
+	case SOURCE_X_REAL_IP:
+		addr, err := netip.ParseAddr(strings.TrimSpace(realIp))
+		if err != nil {
+			return remote
+		}
+
+		return addr.Unmap()
+	}
+
+	return remote
+}
+
+func (r *Resolver) IsTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Walks the chain right to left skipping trusted proxies. The first untrusted
+// address is the client, if every address is trusted the leftmost one is used.
+func (r *Resolver) resolveForwardedFor(remote netip.Addr, forwardedFor string) netip.Addr {
+	client := remote
+	rest := forwardedFor
+
+	for rest != "" {
+		item := rest
+		rest = ""
+
+		if i := strings.LastIndexByte(item, ','); i != -1 {
+			item, rest = item[i+1:], item[:i]
+		}
+
+		item = strings.TrimSpace(item)
+		if item == "" || item == "-" {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			// Garbage in the chain, the last valid hop is the best guess
+			return client
+		}
+
+		client = addr.Unmap()
+		if !r.IsTrusted(client) {
+			return client
+		}
+	}
+
+	return client
+}
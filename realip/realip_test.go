@@ -0,0 +1,115 @@
+package realip
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	trusted, err := ParsePrefixes([]string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.1"})
+	require.NoError(t, err)
+
+	lb := netip.MustParseAddr("10.0.0.1")
+	client := netip.MustParseAddr("203.0.113.7")
+
+	t.Run("should take rightmost untrusted address from xff", func(t *testing.T) {
+		r, err := New(SOURCE_X_FORWARDED_FOR, trusted)
+		require.NoError(t, err)
+
+		ip := r.Resolve(lb, "198.51.100.1, 203.0.113.7, 10.0.0.5", "-")
+
+		assert.Equal(t, client, ip)
+	})
+
+	t.Run("should take leftmost address when every hop is trusted", func(t *testing.T) {
+		r, _ := New(SOURCE_X_FORWARDED_FOR, trusted)
+
+		ip := r.Resolve(lb, "10.1.1.1,10.2.2.2", "-")
+
+		assert.Equal(t, netip.MustParseAddr("10.1.1.1"), ip)
+	})
+
+	t.Run("should keep remote address when peer is not trusted", func(t *testing.T) {
+		r, _ := New(SOURCE_X_FORWARDED_FOR, trusted)
+
+		ip := r.Resolve(client, "198.51.100.1", "-")
+
+		assert.Equal(t, client, ip)
+	})
+
+	t.Run("should trust only the peer when trusted list is empty", func(t *testing.T) {
+		r, _ := New(SOURCE_X_FORWARDED_FOR, nil)
+
+		ip := r.Resolve(lb, "198.51.100.1, 203.0.113.7", "-")
+
+		assert.Equal(t, client, ip)
+	})
+
+	t.Run("should keep remote address for absent header", func(t *testing.T) {
+		r, _ := New(SOURCE_X_FORWARDED_FOR, trusted)
+
+		assert.Equal(t, lb, r.Resolve(lb, "-", "-"))
+		assert.Equal(t, lb, r.Resolve(lb, "", ""))
+	})
+
+	t.Run("should stop at invalid address", func(t *testing.T) {
+		r, _ := New(SOURCE_X_FORWARDED_FOR, trusted)
+
+		ip := r.Resolve(lb, "203.0.113.7, unknown, 10.0.0.5", "-")
+
+		assert.Equal(t, netip.MustParseAddr("10.0.0.5"), ip)
+	})
+
+	t.Run("should use x-real-ip header", func(t *testing.T) {
+		r, _ := New(SOURCE_X_REAL_IP, trusted)
+
+		assert.Equal(t, client, r.Resolve(lb, "-", "203.0.113.7"))
+		assert.Equal(t, lb, r.Resolve(lb, "-", "-"))
+	})
+
+	t.Run("should unmap ipv4 mapped addresses", func(t *testing.T) {
+		r, _ := New(SOURCE_X_FORWARDED_FOR, trusted)
+
+		ip := r.Resolve(lb, "::ffff:203.0.113.7", "-")
+
+		assert.Equal(t, client, ip)
+	})
+
+	t.Run("should not allocate", func(t *testing.T) {
+		r, _ := New(SOURCE_X_FORWARDED_FOR, trusted)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			r.Resolve(lb, "198.51.100.1, 203.0.113.7, 10.0.0.5", "-")
+		})
+
+		assert.Equal(t, float64(0), allocs)
+	})
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("forwarded", nil)
+
+	assert.Error(t, err)
+}
+
+func TestParsePrefixes(t *testing.T) {
+	t.Run("should parse cidrs and addresses", func(t *testing.T) {
+		prefixes, err := ParsePrefixes([]string{"10.0.0.1/8", " 192.168.1.1 ", "", "::1"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("192.168.1.1/32"),
+			netip.MustParsePrefix("::1/128"),
+		}, prefixes)
+	})
+
+	t.Run("should return error for invalid prefix", func(t *testing.T) {
+		_, err := ParsePrefixes([]string{"10.0.0.0/33"})
+
+		assert.Error(t, err)
+	})
+}
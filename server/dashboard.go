@@ -0,0 +1,81 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+)
+
+// Timeseries of the dashboard are split into at most this many buckets by default
+const DASHBOARD_BUCKETS = 120
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// Everything the dashboard shows, a single request analyzes filtered logs once
+type Dashboard struct {
+	Summary analyzer.AnalyzeResult `json:"summary"`
+
+	// Bucket of the timeseries in seconds
+	Bucket     int64                           `json:"bucket"`
+	Traffic    []analyzer.HitsInfo[time.Time]  `json:"traffic"`
+	Statuses   []analyzer.StatusBucket         `json:"statuses"`
+	Ips        []analyzer.HitsInfo[netip.Addr] `json:"ips"`
+	Uris       []analyzer.HitsInfo[string]     `json:"uris"`
+	UserAgents []analyzer.HitsInfo[string]     `json:"userAgents"`
+}
+
+func dashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.FileServerFS(files)
+}
+
+// Bucket is picked from the time range when it isn't set
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	n, err := parseTopN(r, s.config.Options.TopN)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	bucket, err := parseBucket(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res, err := s.result(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	bucket = orDefault(bucket, analyzer.AutoBucket(res.TimeRange, DASHBOARD_BUCKETS))
+	dashboard := Dashboard{
+		Summary:    summary(res),
+		Bucket:     int64(bucket / time.Second),
+		Ips:        analyzer.TopHits(res.State.Ips, n, true),
+		Uris:       analyzer.TopHits(res.State.Uris, n, true),
+		UserAgents: analyzer.TopHits(res.State.UserAgents, n, true),
+	}
+
+	if dashboard.Traffic, err = analyzer.Traffic(res.State, bucket); err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+
+	if dashboard.Statuses, err = analyzer.StatusClasses(res.State, bucket); err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dashboard)
+}
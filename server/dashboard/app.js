@@ -0,0 +1,321 @@
+"use strict";
+
+// Log values are attacker controlled, they are rendered with textContent only
+
+const CLASS_COLORS = {
+  "1xx": "#8c959f",
+  "2xx": "#2e9d4f",
+  "3xx": "#3b7dd8",
+  "4xx": "#e0a100",
+  "5xx": "#d64541",
+};
+
+const REFRESH_INTERVAL = 60 * 1000;
+const SVG_NS = "http://www.w3.org/2000/svg";
+
+const form = document.getElementById("filters");
+let refreshTimer = null;
+
+// Form state is kept in the page url, so a filtered view can be shared
+function readUrl() {
+  const params = new URLSearchParams(location.search);
+  for (const name of ["range", "since", "until", "status", "bucket", "n"]) {
+    if (params.has(name)) {
+      form.elements[name].value = params.get(name);
+    }
+  }
+  form.elements.refresh.checked = params.get("refresh") !== "0";
+}
+
+function writeUrl() {
+  const params = new URLSearchParams();
+  for (const name of ["range", "since", "until", "status", "bucket", "n"]) {
+    const value = form.elements[name].value;
+    if (value !== "" && (form.elements.range.value === "custom" || (name !== "since" && name !== "until"))) {
+      params.set(name, value);
+    }
+  }
+  if (!form.elements.refresh.checked) {
+    params.set("refresh", "0");
+  }
+  history.replaceState(null, "", "?" + params);
+}
+
+function apiQuery() {
+  const query = new URLSearchParams();
+  const range = form.elements.range.value;
+
+  if (range === "custom") {
+    for (const name of ["since", "until"]) {
+      const value = form.elements[name].value;
+      if (value !== "") {
+        query.set(name, new Date(value).toISOString());
+      }
+    }
+  } else if (range !== "") {
+    query.set("since", range);
+  }
+
+  for (const name of ["status", "bucket", "n"]) {
+    const value = form.elements[name].value.trim();
+    if (value !== "") {
+      query.set(name, value);
+    }
+  }
+
+  return query;
+}
+
+function toggleCustom() {
+  const custom = form.elements.range.value === "custom";
+  for (const label of form.querySelectorAll(".custom")) {
+    label.hidden = !custom;
+  }
+}
+
+async function load() {
+  const error = document.getElementById("error");
+
+  try {
+    const resp = await fetch("api/dashboard?" + apiQuery());
+    const data = await resp.json();
+    if (!resp.ok) {
+      throw new Error(data.error);
+    }
+
+    error.hidden = true;
+    render(data);
+  } catch (err) {
+    error.textContent = err.message;
+    error.hidden = false;
+  }
+
+  loadStatus();
+}
+
+async function loadStatus() {
+  const footer = document.getElementById("status");
+
+  try {
+    const status = await (await fetch("api/status")).json();
+    const files = (status.files || []).join(", ");
+    footer.textContent = `Analyzed ${files} at ${new Date(status.updatedAt).toLocaleString()}`;
+    if (status.error) {
+      footer.textContent += ` (last analysis failed: ${status.error})`;
+    }
+  } catch (err) {
+    footer.textContent = "";
+  }
+}
+
+function scheduleRefresh() {
+  clearInterval(refreshTimer);
+  if (form.elements.refresh.checked) {
+    refreshTimer = setInterval(load, REFRESH_INTERVAL);
+  }
+}
+
+function render(data) {
+  renderCards(data.summary);
+
+  document.getElementById("bucket").textContent = `per ${formatBucket(data.bucket)}`;
+  renderBars(document.getElementById("traffic"), data.traffic.map((point) => ({
+    start: point.key,
+    values: [{ value: point.hits, color: CLASS_COLORS["3xx"], label: "requests" }],
+  })));
+
+  renderLegend();
+  renderBars(document.getElementById("statuses"), data.statuses.map((bucket) => ({
+    start: bucket.start,
+    values: Object.keys(CLASS_COLORS).map((cls) => ({ value: bucket.classes[cls], color: CLASS_COLORS[cls], label: cls })),
+  })));
+
+  const total = data.summary.totalRequests;
+  renderTable(document.getElementById("ips"), data.ips, total);
+  renderTable(document.getElementById("uris"), data.uris, total);
+  renderTable(document.getElementById("userAgents"), data.userAgents, total);
+}
+
+function renderCards(summary) {
+  const errors = summary.statusCodes
+    .filter((code) => code.key >= 500)
+    .reduce((sum, code) => sum + code.hits, 0);
+
+  const cards = [
+    ["Requests", formatNumber(summary.totalRequests)],
+    ["Unique IPs", formatNumber(summary.uniqueIps)],
+    ["Unique user agents", formatNumber(summary.uniqueUserAgents)],
+    ["Traffic", formatBytes(summary.totalBytes)],
+    ["5xx rate", summary.totalRequests ? (errors / summary.totalRequests * 100).toFixed(2) + "%" : "-"],
+  ];
+
+  if (summary.latency) {
+    cards.push(["Latency p95", formatMillis(summary.latency.p95)]);
+  }
+
+  if (summary.totalRequests) {
+    cards.push(["From", new Date(summary.timeRange.start).toLocaleString()]);
+    cards.push(["To", new Date(summary.timeRange.end).toLocaleString()]);
+  }
+
+  const container = document.getElementById("cards");
+  container.replaceChildren(...cards.map(([label, value]) => {
+    const card = document.createElement("div");
+    card.className = "card";
+
+    const valueEl = document.createElement("div");
+    valueEl.className = "value";
+    valueEl.textContent = value;
+
+    const labelEl = document.createElement("div");
+    labelEl.className = "label";
+    labelEl.textContent = label;
+
+    card.append(valueEl, labelEl);
+    return card;
+  }));
+}
+
+function renderLegend() {
+  const legend = document.getElementById("legend");
+  legend.replaceChildren(...Object.entries(CLASS_COLORS).map(([cls, color]) => {
+    const item = document.createElement("span");
+    item.style.setProperty("--color", color);
+    item.textContent = cls;
+    return item;
+  }));
+}
+
+// Stacked bars, every point has values drawn bottom up
+function renderBars(svg, points) {
+  const width = svg.clientWidth || 800;
+  const height = svg.clientHeight || 220;
+  const padding = { top: 8, right: 8, bottom: 20, left: 48 };
+  const plotWidth = width - padding.left - padding.right;
+  const plotHeight = height - padding.top - padding.bottom;
+
+  svg.setAttribute("viewBox", `0 0 ${width} ${height}`);
+  svg.replaceChildren();
+
+  const max = Math.max(1, ...points.map((point) => point.values.reduce((sum, v) => sum + v.value, 0)));
+  const barWidth = points.length ? plotWidth / points.length : 0;
+
+  svg.append(
+    svgText(padding.left - 4, padding.top + 8, formatNumber(max), "end"),
+    svgText(padding.left - 4, padding.top + plotHeight, "0", "end"),
+  );
+
+  points.forEach((point, i) => {
+    const x = padding.left + i * barWidth;
+    let y = padding.top + plotHeight;
+
+    const group = document.createElementNS(SVG_NS, "g");
+    const title = document.createElementNS(SVG_NS, "title");
+    title.textContent = new Date(point.start).toLocaleString() + "\n" +
+      point.values.map((v) => `${v.label}: ${formatNumber(v.value)}`).join("\n");
+    group.append(title);
+
+    for (const v of point.values) {
+      const barHeight = v.value / max * plotHeight;
+      y -= barHeight;
+
+      const rect = document.createElementNS(SVG_NS, "rect");
+      rect.setAttribute("x", x + barWidth * 0.1);
+      rect.setAttribute("y", y);
+      rect.setAttribute("width", Math.max(barWidth * 0.8, 1));
+      rect.setAttribute("height", barHeight);
+      rect.setAttribute("fill", v.color);
+      group.append(rect);
+    }
+
+    svg.append(group);
+  });
+
+  // first, middle and last bucket starts
+  const labeled = new Set([0, Math.floor(points.length / 2), points.length - 1]);
+  for (const i of labeled) {
+    if (i < 0 || i >= points.length) {
+      continue;
+    }
+
+    const anchor = i === 0 ? "start" : i === points.length - 1 ? "end" : "middle";
+    const x = padding.left + i * barWidth + (anchor === "start" ? 0 : anchor === "end" ? barWidth : barWidth / 2);
+    svg.append(svgText(x, height - 4, new Date(points[i].start).toLocaleString(), anchor));
+  }
+}
+
+function svgText(x, y, text, anchor) {
+  const el = document.createElementNS(SVG_NS, "text");
+  el.setAttribute("x", x);
+  el.setAttribute("y", y);
+  el.setAttribute("text-anchor", anchor);
+  el.textContent = text;
+  return el;
+}
+
+function renderTable(table, hits, total) {
+  table.replaceChildren(...hits.map((info) => {
+    const row = document.createElement("tr");
+
+    const key = document.createElement("td");
+    key.textContent = info.key;
+    key.title = info.key;
+
+    const count = document.createElement("td");
+    count.className = "hits";
+    count.textContent = formatNumber(info.hits);
+
+    const share = document.createElement("td");
+    share.className = "share";
+    const bar = document.createElement("div");
+    bar.className = "bar";
+    bar.style.width = (total ? info.hits / total * 100 : 0) + "%";
+    share.append(bar);
+
+    row.append(key, count, share);
+    return row;
+  }));
+}
+
+function formatNumber(n) {
+  return n.toLocaleString();
+}
+
+function formatBytes(bytes) {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let i = 0;
+  while (bytes >= 1024 && i < units.length - 1) {
+    bytes /= 1024;
+    i++;
+  }
+  return bytes.toFixed(i ? 1 : 0) + " " + units[i];
+}
+
+// Go durations are encoded in nanoseconds
+function formatMillis(ns) {
+  return (ns / 1e6).toFixed(0) + " ms";
+}
+
+function formatBucket(seconds) {
+  if (seconds % 86400 === 0) return seconds / 86400 + "d";
+  if (seconds % 3600 === 0) return seconds / 3600 + "h";
+  if (seconds % 60 === 0) return seconds / 60 + "m";
+  return seconds + "s";
+}
+
+form.addEventListener("submit", (event) => {
+  event.preventDefault();
+  writeUrl();
+  scheduleRefresh();
+  load();
+});
+form.elements.range.addEventListener("change", toggleCustom);
+form.elements.refresh.addEventListener("change", () => {
+  writeUrl();
+  scheduleRefresh();
+});
+
+readUrl();
+toggleCustom();
+scheduleRefresh();
+load();
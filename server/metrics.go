@@ -0,0 +1,43 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Kostayne/go-nginx-analyzer/metrics"
+)
+
+// Counters of the served result and the state of the background analysis.
+// Counters restart when logs are rotated, which Prometheus handles as a reset.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	res, status := s.snapshot, s.status
+	s.mu.RUnlock()
+
+	if res == nil {
+		writeError(w, &requestError{status: http.StatusServiceUnavailable, err: errors.New("logs are not analyzed yet")})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := s.exporter.Write(&buf, res); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	success := 1.0
+	if status.Error != "" {
+		success = 0
+	}
+
+	metrics.WriteGauge(&buf, "last_analysis_timestamp_seconds", "Unix time of the last successful analysis.", float64(status.UpdatedAt.UnixNano())/1e9)
+	metrics.WriteGauge(&buf, "last_analysis_duration_seconds", "Duration of the last successful analysis.", status.Took.Seconds())
+	metrics.WriteGauge(&buf, "last_analysis_success", "Whether the last analysis succeeded.", success)
+
+	w.Header().Set("Content-Type", metrics.CONTENT_TYPE)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+)
+
+// Request filters, the ones the status timeline can't answer analyze the logs on demand
+type filters struct {
+	since    time.Time
+	until    time.Time
+	statuses []analyzer.StatusRange
+}
+
+func (f filters) isEmpty() bool {
+	return f.since.IsZero() && f.until.IsZero() && len(f.statuses) == 0
+}
+
+// Since is inclusive and until exclusive, like in the analyzer
+func (f filters) contains(date time.Time) bool {
+	return (f.since.IsZero() || !date.Before(f.since)) && (f.until.IsZero() || date.Before(f.until))
+}
+
+// Status classes the filters keep, indexed like analyzer.STATUS_CLASSES.
+// False when single codes are filtered, the timeline counts only classes.
+func (f filters) classes() ([5]bool, bool) {
+	var classes [5]bool
+	if len(f.statuses) == 0 {
+		return [5]bool{true, true, true, true, true}, true
+	}
+
+	for _, r := range f.statuses {
+		if r.Min%100 != 0 || r.Max != r.Min+99 {
+			return classes, false
+		}
+		classes[r.Min/100-1] = true
+	}
+
+	return classes, true
+}
+
+// Bounds rounded down to the minute and sorted statuses, so relative bounds
+// like "1h" share a cached analysis
+func (f filters) normalized() filters {
+	statuses := slices.Clone(f.statuses)
+	slices.SortFunc(statuses, func(a, b analyzer.StatusRange) int {
+		return cmp.Or(cmp.Compare(a.Min, b.Min), cmp.Compare(a.Max, b.Max))
+	})
+
+	return filters{
+		since:    f.since.Truncate(time.Minute),
+		until:    f.until.Truncate(time.Minute),
+		statuses: slices.Compact(statuses),
+	}
+}
+
+func (f filters) key() string {
+	var key strings.Builder
+	fmt.Fprintf(&key, "%d,%d", f.since.Unix(), f.until.Unix())
+	for _, r := range f.statuses {
+		fmt.Fprintf(&key, ",%d-%d", r.Min, r.Max)
+	}
+
+	return key.String()
+}
+
+// since and until are RFC 3339 times or durations back from now, like "1h",
+// status is a comma separated list of codes and classes, like "404,5xx"
+func parseFilters(r *http.Request) (filters, error) {
+	var f filters
+	var err error
+	query := r.URL.Query()
+	now := time.Now()
+
+	if f.since, err = analyzer.ParseTimeBound(query.Get("since"), now); err != nil {
+		return filters{}, badRequest("invalid since: %v", err)
+	}
+
+	if f.until, err = analyzer.ParseTimeBound(query.Get("until"), now); err != nil {
+		return filters{}, badRequest("invalid until: %v", err)
+	}
+
+	if !f.since.IsZero() && !f.until.IsZero() && !f.since.Before(f.until) {
+		return filters{}, badRequest("since must be before until")
+	}
+
+	if status := query.Get("status"); status != "" {
+		if f.statuses, err = analyzer.ParseStatusRanges(strings.Split(status, ",")); err != nil {
+			return filters{}, badRequest("%v", err)
+		}
+	}
+
+	return f, nil
+}
+
+func parseTopN(r *http.Request, defaultN int) (int, error) {
+	param := r.URL.Query().Get("n")
+	if param == "" {
+		return defaultN, nil
+	}
+
+	n, err := strconv.Atoi(param)
+	if err != nil || n < 1 || n > MAX_TOP_N {
+		return 0, badRequest("n must be a number in [1, %d]", MAX_TOP_N)
+	}
+
+	return n, nil
+}
+
+// Zero when the bucket isn't set
+func parseBucket(r *http.Request) (time.Duration, error) {
+	param := r.URL.Query().Get("bucket")
+	if param == "" {
+		return 0, nil
+	}
+
+	bucket, err := time.ParseDuration(param)
+	if err != nil || bucket < time.Second || bucket%time.Second != 0 {
+		return 0, badRequest("bucket must be a duration of whole seconds, e.g. 5m")
+	}
+
+	return bucket, nil
+}
+
+func orDefault(bucket, defaultBucket time.Duration) time.Duration {
+	if bucket == 0 {
+		return defaultBucket
+	}
+
+	return bucket
+}
@@ -0,0 +1,486 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/metrics"
+)
+
+const DEFAULT_INTERVAL = time.Minute
+const DEFAULT_BUCKET = 5 * time.Minute
+
+// Limits of a single response
+const MAX_TOP_N = 10000
+
+// Filtered results kept until the next refresh, the oldest is dropped first
+const MAX_CACHED_FILTERS = 32
+
+// Suggested wait of a request rejected while another filter is analyzed
+const BUSY_RETRY_AFTER = 5 * time.Second
+
+// Categories of /api/top/{category}
+var TOP_CATEGORIES = []string{"ips", "remoteAddrs", "codes", "uris", "userAgents"}
+
+type Config struct {
+	// Log paths or glob patterns, expanded on every analysis so new files are picked up
+	Paths []string
+
+	// Status classes are always counted per second, timeseries are bucketed on request
+	Options analyzer.Options
+
+	// Background re-analysis interval, DEFAULT_INTERVAL when zero
+	Interval time.Duration
+
+	// Routes labeled in /metrics, metrics.DEFAULT_ROUTES when zero
+	MetricRoutes int
+}
+
+type Status struct {
+	Files     []string  `json:"files"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Duration of the last analysis
+	Took time.Duration `json:"took"`
+
+	// Error of the last analysis, the previous result is served meanwhile
+	Error string `json:"error,omitempty"`
+}
+
+// Serves the result of the last background analysis. Timeseries are cut
+// from its status timeline, other filtered requests analyze the logs on
+// demand, one filter at a time.
+type Server struct {
+	config   Config
+	exporter *metrics.Exporter
+
+	// Serializes background analyses
+	refreshMu sync.Mutex
+
+	// Held by the single on demand analysis, others are rejected meanwhile
+	filterMu sync.Mutex
+
+	mu       sync.RWMutex
+	snapshot *analyzer.AnalyzeResult
+	status   Status
+
+	// Filtered results of the current snapshot by filters.key
+	cache     map[string]*analyzer.AnalyzeResult
+	cacheKeys []string
+
+	// Incremented by every refresh, results of older ones aren't cached
+	generation uint64
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Error with the http status it's reported with
+type requestError struct {
+	status int
+	err    error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...any) error {
+	return &requestError{status: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+func New(config Config) *Server {
+	config.Options.State = true
+	config.Options.StatusTimeline = true
+	config.Options.Metrics = true
+	if config.Interval == 0 {
+		config.Interval = DEFAULT_INTERVAL
+	}
+
+	return &Server{config: config, exporter: metrics.NewExporter(config.MetricRoutes)}
+}
+
+// Analyzes the logs and replaces the served result,
+// the previous one is kept when the analysis fails
+func (s *Server) Refresh() error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	start := time.Now()
+	res, files, err := s.analyze(filters{})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.status.Error = err.Error()
+		return err
+	}
+
+	s.snapshot = res
+	s.status = Status{Files: files, UpdatedAt: time.Now(), Took: time.Since(start)}
+	s.cache, s.cacheKeys = nil, nil
+	s.generation++
+	return nil
+}
+
+// Refreshes the result every interval until the context is done
+func (s *Server) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(); err != nil {
+			log.Printf("analysis failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/summary", s.handleSummary)
+	mux.HandleFunc("GET /api/top/{category}", s.handleTop)
+	mux.HandleFunc("GET /api/timeseries", s.handleTimeseries)
+	mux.HandleFunc("GET /api/timeseries/status", s.handleStatusTimeseries)
+	mux.HandleFunc("GET /api/dashboard", s.handleDashboard)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.Handle("GET /", dashboardHandler())
+
+	return mux
+}
+
+// Paths with glob patterns expanded, sorted and deduplicated
+func (s *Server) files() ([]string, error) {
+	files := make([]string, 0, len(s.config.Paths))
+
+	for _, path := range s.config.Paths {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log path %q: %w", path, err)
+		}
+
+		// plain paths are kept, so a missing file is reported by the analyzer
+		if len(matches) == 0 && !strings.ContainsAny(path, "*?[") {
+			matches = []string{path}
+		}
+
+		files = append(files, matches...)
+	}
+
+	slices.Sort(files)
+	files = slices.Compact(files)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no log files match %s", strings.Join(s.config.Paths, ", "))
+	}
+
+	return files, nil
+}
+
+// Analyzes every file with the filters and merges the results
+func (s *Server) analyze(f filters) (*analyzer.AnalyzeResult, []string, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := s.config.Options
+	opts.Since = f.since
+	opts.Until = f.until
+	opts.Statuses = f.statuses
+
+	results := make([]*analyzer.AnalyzeResult, 0, len(files))
+	for _, file := range files {
+		res, err := analyzer.Analyze(file, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to analyze %s: %w", file, err)
+		}
+		results = append(results, res)
+	}
+
+	res, err := analyzer.MergeSaved(results, analyzer.MergeParams{
+		TopN:       opts.TopN,
+		Desc:       opts.Desc,
+		State:      true,
+		GroupIp:    opts.GroupIp,
+		Geo:        opts.Geo,
+		UserAgents: opts.UserAgents,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res, files, nil
+}
+
+// The served result or the analysis of the filtered requests
+func (s *Server) result(r *http.Request) (*analyzer.AnalyzeResult, error) {
+	f, err := parseFilters(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.filtered(f)
+}
+
+// Analyzes the logs once per normalized filter until the next refresh.
+// Requests are rejected while another filter is being analyzed.
+func (s *Server) filtered(f filters) (*analyzer.AnalyzeResult, error) {
+	if f.isEmpty() {
+		return s.current()
+	}
+
+	f = f.normalized()
+	key := f.key()
+
+	s.mu.RLock()
+	res, ok := s.cache[key]
+	generation := s.generation
+	s.mu.RUnlock()
+
+	if ok {
+		return res, nil
+	}
+
+	if !s.filterMu.TryLock() {
+		return nil, &requestError{status: http.StatusTooManyRequests, err: errors.New("another filter is being analyzed, retry later")}
+	}
+	defer s.filterMu.Unlock()
+
+	res, _, err := s.analyze(f)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.generation == generation {
+		s.cacheResult(key, res)
+	}
+
+	return res, nil
+}
+
+// Must be called with mu held
+func (s *Server) cacheResult(key string, res *analyzer.AnalyzeResult) {
+	if s.cache == nil {
+		s.cache = make(map[string]*analyzer.AnalyzeResult)
+	}
+
+	if len(s.cacheKeys) == MAX_CACHED_FILTERS {
+		delete(s.cache, s.cacheKeys[0])
+		s.cacheKeys = s.cacheKeys[1:]
+	}
+
+	s.cache[key] = res
+	s.cacheKeys = append(s.cacheKeys, key)
+}
+
+// Status timeline of the filtered requests. Time ranges and whole classes are
+// cut from the served timeline, single codes are analyzed on demand.
+func (s *Server) timeline(r *http.Request) (*analyzer.ResultState, error) {
+	f, err := parseFilters(r)
+	if err != nil {
+		return nil, err
+	}
+
+	classes, ok := f.classes()
+	if !ok {
+		res, err := s.filtered(f)
+		if err != nil {
+			return nil, err
+		}
+
+		return res.State, nil
+	}
+
+	res, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+
+	if f.isEmpty() {
+		return res.State, nil
+	}
+
+	seconds := make(map[int64]analyzer.ClassCounts)
+	for second, counts := range res.State.ClassSeconds {
+		if !f.contains(time.Unix(second, 0)) {
+			continue
+		}
+
+		for i := range counts {
+			if !classes[i] {
+				counts[i] = 0
+			}
+		}
+
+		if counts != (analyzer.ClassCounts{}) {
+			seconds[second] = counts
+		}
+	}
+
+	return &analyzer.ResultState{ClassSeconds: seconds}, nil
+}
+
+func (s *Server) current() (*analyzer.AnalyzeResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.snapshot == nil {
+		return nil, &requestError{status: http.StatusServiceUnavailable, err: errors.New("logs are not analyzed yet")}
+	}
+
+	return s.snapshot, nil
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	status := s.status
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	res, err := s.result(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summary(res))
+}
+
+// AnalyzeResult without its mergeable state
+func summary(res *analyzer.AnalyzeResult) analyzer.AnalyzeResult {
+	summary := *res
+	summary.State = nil
+
+	return summary
+}
+
+func (s *Server) handleTop(w http.ResponseWriter, r *http.Request) {
+	category := r.PathValue("category")
+	if !slices.Contains(TOP_CATEGORIES, category) {
+		writeError(w, &requestError{
+			status: http.StatusNotFound,
+			err:    fmt.Errorf("unknown category %q, expected one of: %s", category, strings.Join(TOP_CATEGORIES, ", ")),
+		})
+		return
+	}
+
+	n, err := parseTopN(r, s.config.Options.TopN)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res, err := s.result(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	state, desc := res.State, s.config.Options.Desc
+	switch category {
+	case "ips":
+		writeJSON(w, http.StatusOK, analyzer.TopHits(state.Ips, n, desc))
+	case "remoteAddrs":
+		writeJSON(w, http.StatusOK, analyzer.TopHits(state.RemoteAddrs, n, desc))
+	case "codes":
+		writeJSON(w, http.StatusOK, analyzer.TopHits(state.Codes, n, desc))
+	case "uris":
+		writeJSON(w, http.StatusOK, analyzer.TopHits(state.Uris, n, desc))
+	case "userAgents":
+		writeJSON(w, http.StatusOK, analyzer.TopHits(state.UserAgents, n, desc))
+	}
+}
+
+func (s *Server) handleTimeseries(w http.ResponseWriter, r *http.Request) {
+	bucket, err := parseBucket(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	state, err := s.timeline(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	series, err := analyzer.Traffic(state, orDefault(bucket, DEFAULT_BUCKET))
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, series)
+}
+
+func (s *Server) handleStatusTimeseries(w http.ResponseWriter, r *http.Request) {
+	bucket, err := parseBucket(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	state, err := s.timeline(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	series, err := analyzer.StatusClasses(state, orDefault(bucket, DEFAULT_BUCKET))
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, series)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		status = reqErr.status
+	}
+
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", strconv.Itoa(int(BUSY_RETRY_AFTER/time.Second)))
+	}
+
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
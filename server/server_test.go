@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/Kostayne/go-nginx-analyzer/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLogA = `10.0.0.1 - - [25/Dec/2023:10:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.1 - - [25/Dec/2023:10:01:00 +0000] "GET /about HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.2 - - [25/Dec/2023:10:07:00 +0000] "GET / HTTP/1.1" 404 100 "-" "curl/8.0"
+`
+
+const testLogB = `10.0.0.3 - - [25/Dec/2023:10:02:00 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.2 - - [25/Dec/2023:10:20:00 +0000] "GET / HTTP/1.1" 500 100 "-" "curl/8.0"
+10.0.0.2 - - [25/Dec/2023:10:21:00 +0000] "GET / HTTP/1.1" 500 100 "-" "curl/8.0"
+`
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.log"), []byte(testLogA), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.log"), []byte(testLogB), 0644))
+
+	srv := New(Config{
+		Paths:   []string{filepath.Join(dir, "*.log")},
+		Options: analyzer.Options{TopN: 10, Desc: true},
+	})
+	require.NoError(t, srv.Refresh())
+
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	return srv, ts
+}
+
+// Later requests can only be answered from the served or cached results
+func removeLogs(t *testing.T, srv *Server) {
+	files, err := srv.files()
+	require.NoError(t, err)
+
+	for _, file := range files {
+		require.NoError(t, os.Remove(file))
+	}
+}
+
+func getJSON(t *testing.T, url string, v any) int {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	t.Run("should report status", func(t *testing.T) {
+		var status Status
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/status", &status))
+		assert.Len(t, status.Files, 2)
+		assert.Empty(t, status.Error)
+	})
+
+	t.Run("should serve the merged summary without state", func(t *testing.T) {
+		var res analyzer.AnalyzeResult
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/summary", &res))
+		assert.Equal(t, uint64(6), res.TotalRequests)
+		assert.Equal(t, uint64(3), res.UniqueIPs)
+		assert.Nil(t, res.State)
+	})
+
+	t.Run("should serve top lists", func(t *testing.T) {
+		var ips []analyzer.HitsInfo[netip.Addr]
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/top/ips?n=1", &ips))
+		assert.Equal(t, []analyzer.HitsInfo[netip.Addr]{{Key: netip.MustParseAddr("10.0.0.2"), Hits: 3}}, ips)
+
+		var codes []analyzer.HitsInfo[uint16]
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/top/codes", &codes))
+		assert.Len(t, codes, 3)
+	})
+
+	t.Run("should analyze a time range on demand", func(t *testing.T) {
+		var ips []analyzer.HitsInfo[netip.Addr]
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/top/ips?until=2023-12-25T10:05:00Z", &ips))
+		assert.ElementsMatch(t, []analyzer.HitsInfo[netip.Addr]{
+			{Key: netip.MustParseAddr("10.0.0.1"), Hits: 2},
+			{Key: netip.MustParseAddr("10.0.0.3"), Hits: 1},
+		}, ips)
+	})
+
+	t.Run("should bucket the timeseries", func(t *testing.T) {
+		var series []analyzer.HitsInfo[time.Time]
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/timeseries?bucket=10m", &series))
+		assert.Equal(t, []analyzer.HitsInfo[time.Time]{
+			{Key: time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC), Hits: 4},
+			{Key: time.Date(2023, 12, 25, 10, 10, 0, 0, time.UTC), Hits: 0},
+			{Key: time.Date(2023, 12, 25, 10, 20, 0, 0, time.UTC), Hits: 2},
+		}, series)
+
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/timeseries?bucket=10m&since=2023-12-25T10:05:00Z", &series))
+		assert.Equal(t, uint64(1), series[0].Hits)
+	})
+
+	t.Run("should filter by status", func(t *testing.T) {
+		var res analyzer.AnalyzeResult
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/summary?status=4xx,500", &res))
+		assert.Equal(t, uint64(3), res.TotalRequests)
+		assert.Equal(t, uint64(3), res.ProcessingStats.Filtered)
+	})
+
+	t.Run("should bucket status classes", func(t *testing.T) {
+		var series []analyzer.StatusBucket
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/timeseries/status?bucket=15m", &series))
+		require.Len(t, series, 2)
+		assert.Equal(t, map[string]uint64{"1xx": 0, "2xx": 3, "3xx": 0, "4xx": 1, "5xx": 0}, series[0].Classes)
+		assert.Equal(t, uint64(2), series[1].Classes["5xx"])
+	})
+
+	t.Run("should serve the dashboard data in one response", func(t *testing.T) {
+		var dashboard Dashboard
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/dashboard?n=2&status=2xx", &dashboard))
+		assert.Equal(t, uint64(3), dashboard.Summary.TotalRequests)
+		assert.Nil(t, dashboard.Summary.State)
+		assert.Equal(t, int64(60), dashboard.Bucket)
+		assert.Len(t, dashboard.Traffic, 3)
+		assert.Len(t, dashboard.Statuses, 3)
+		assert.Len(t, dashboard.Ips, 2)
+		assert.Equal(t, []analyzer.HitsInfo[string]{{Key: "Mozilla/5.0", Hits: 3}}, dashboard.UserAgents)
+	})
+
+	t.Run("should serve the dashboard page", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	})
+
+	t.Run("should expose prometheus metrics", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/metrics")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, metrics.CONTENT_TYPE, resp.Header.Get("Content-Type"))
+		assert.Contains(t, string(body), `nginx_an_http_requests_total{route="/",method="GET",status_class="5xx"} 2`)
+		assert.Contains(t, string(body), "nginx_an_last_analysis_success 1\n")
+	})
+
+	t.Run("should reject invalid requests", func(t *testing.T) {
+		var errResp errorResponse
+		assert.Equal(t, http.StatusNotFound, getJSON(t, ts.URL+"/api/top/bots", &errResp))
+		assert.Contains(t, errResp.Error, "unknown category")
+
+		assert.Equal(t, http.StatusBadRequest, getJSON(t, ts.URL+"/api/top/ips?n=0", &errResp))
+		assert.Equal(t, http.StatusBadRequest, getJSON(t, ts.URL+"/api/timeseries?bucket=1ms", &errResp))
+		assert.Equal(t, http.StatusBadRequest, getJSON(t, ts.URL+"/api/summary?since=yesterday", &errResp))
+		assert.Equal(t, http.StatusBadRequest, getJSON(t, ts.URL+"/api/dashboard?status=6xx", &errResp))
+	})
+}
+
+func TestServerFilters(t *testing.T) {
+	srv, ts := newTestServer(t)
+
+	var summary analyzer.AnalyzeResult
+	require.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/summary?since=2023-12-25T10:05:30Z&status=5xx,404", &summary))
+	removeLogs(t, srv)
+
+	t.Run("should cut the timeseries from the status timeline", func(t *testing.T) {
+		var series []analyzer.HitsInfo[time.Time]
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/timeseries?bucket=10m&since=2023-12-25T10:01:00Z&until=2023-12-25T10:20:00Z", &series))
+		assert.Equal(t, []analyzer.HitsInfo[time.Time]{{Key: time.Date(2023, 12, 25, 10, 0, 0, 0, time.UTC), Hits: 3}}, series)
+
+		var classes []analyzer.StatusBucket
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/timeseries/status?bucket=15m&status=5xx,4xx", &classes))
+		require.Len(t, classes, 2)
+		assert.Equal(t, map[string]uint64{"1xx": 0, "2xx": 0, "3xx": 0, "4xx": 1, "5xx": 0}, classes[0].Classes)
+		assert.Equal(t, uint64(2), classes[1].Classes["5xx"])
+	})
+
+	t.Run("should reuse the analysis of the same normalized filters", func(t *testing.T) {
+		var res analyzer.AnalyzeResult
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/summary?since=2023-12-25T10:05:00Z&status=404,5xx,404", &res))
+		assert.Equal(t, summary.TotalRequests, res.TotalRequests)
+		assert.Equal(t, uint64(3), res.TotalRequests)
+
+		var errResp errorResponse
+		assert.Equal(t, http.StatusInternalServerError, getJSON(t, ts.URL+"/api/summary?since=2023-12-25T10:06:00Z", &errResp))
+	})
+
+	t.Run("should reject filters while another one is analyzed", func(t *testing.T) {
+		srv.filterMu.Lock()
+		defer srv.filterMu.Unlock()
+
+		resp, err := http.Get(ts.URL + "/api/top/ips?status=404")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "5", resp.Header.Get("Retry-After"))
+	})
+
+	t.Run("should forget filtered results on refresh", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(srv.config.Paths[0]), "a.log"), []byte(testLogA), 0644))
+		require.NoError(t, srv.Refresh())
+		assert.Empty(t, srv.cache)
+
+		var res analyzer.AnalyzeResult
+		assert.Equal(t, http.StatusOK, getJSON(t, ts.URL+"/api/summary?since=2023-12-25T10:05:00Z&status=404,5xx", &res))
+		assert.Equal(t, uint64(1), res.TotalRequests)
+	})
+}
+
+func TestServerNotReady(t *testing.T) {
+	t.Run("should be unavailable before the first analysis", func(t *testing.T) {
+		ts := httptest.NewServer(New(Config{Paths: []string{"missing.log"}}).Handler())
+		defer ts.Close()
+
+		var errResp errorResponse
+		assert.Equal(t, http.StatusServiceUnavailable, getJSON(t, ts.URL+"/api/summary", &errResp))
+	})
+
+	t.Run("should keep the error of a failed analysis", func(t *testing.T) {
+		srv := New(Config{Paths: []string{filepath.Join(t.TempDir(), "missing.log")}})
+		assert.Error(t, srv.Refresh())
+		assert.NotEmpty(t, srv.status.Error)
+	})
+}
@@ -0,0 +1,72 @@
+package tui
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+)
+
+// Keys of the filter line
+var FILTER_KEYS = []string{"since", "until", "status", "ip", "uri"}
+
+// Requests the screens are analyzed for
+type Filter struct {
+	Since    time.Time
+	Until    time.Time
+	Statuses []analyzer.StatusRange
+	Ip       netip.Addr
+	Uri      string
+}
+
+// Parses space separated key=value pairs, like "since=1h status=5xx,404 uri=/login".
+// since and until are RFC 3339 times or durations back from now.
+func ParseFilter(text string, now time.Time) (Filter, error) {
+	var f Filter
+
+	for _, field := range strings.Fields(text) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || value == "" {
+			return Filter{}, fmt.Errorf("invalid filter %q, expected key=value", field)
+		}
+
+		var err error
+		switch key {
+		case "since":
+			f.Since, err = analyzer.ParseTimeBound(value, now)
+		case "until":
+			f.Until, err = analyzer.ParseTimeBound(value, now)
+		case "status":
+			f.Statuses, err = analyzer.ParseStatusRanges(strings.Split(value, ","))
+		case "ip":
+			f.Ip, err = netip.ParseAddr(value)
+		case "uri":
+			f.Uri = value
+		default:
+			return Filter{}, fmt.Errorf("unknown filter %q, expected one of: %s", key, strings.Join(FILTER_KEYS, ", "))
+		}
+
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	if !f.Since.IsZero() && !f.Until.IsZero() && !f.Since.Before(f.Until) {
+		return Filter{}, fmt.Errorf("since must be before until")
+	}
+
+	return f, nil
+}
+
+// Applies the filter to analyzer options
+func (f Filter) Apply(opts analyzer.Options) analyzer.Options {
+	opts.Since = f.Since
+	opts.Until = f.Until
+	opts.Statuses = f.Statuses
+	opts.Ip = f.Ip
+	opts.Uri = f.Uri
+
+	return opts
+}
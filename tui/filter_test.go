@@ -0,0 +1,41 @@
+package tui
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	now := time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC)
+
+	t.Run("should parse every key", func(t *testing.T) {
+		f, err := ParseFilter(" since=1h until=2023-12-25T11:30:00Z status=5xx,404  ip=10.0.0.1 uri=/login ", now)
+		require.NoError(t, err)
+
+		assert.Equal(t, Filter{
+			Since:    now.Add(-time.Hour),
+			Until:    time.Date(2023, 12, 25, 11, 30, 0, 0, time.UTC),
+			Statuses: []analyzer.StatusRange{{Min: 500, Max: 599}, {Min: 404, Max: 404}},
+			Ip:       netip.MustParseAddr("10.0.0.1"),
+			Uri:      "/login",
+		}, f)
+	})
+
+	t.Run("should accept an empty filter", func(t *testing.T) {
+		f, err := ParseFilter("", now)
+		require.NoError(t, err)
+		assert.Equal(t, Filter{}, f)
+	})
+
+	t.Run("should reject invalid filters", func(t *testing.T) {
+		for _, text := range []string{"since", "host=a", "status=6xx", "ip=abc", "since=yesterday", "since=1h until=2h"} {
+			_, err := ParseFilter(text, now)
+			assert.Error(t, err, text)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package tui
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Names of special keys, printable keys are passed as their text
+const (
+	KEY_UP        = "up"
+	KEY_DOWN      = "down"
+	KEY_LEFT      = "left"
+	KEY_RIGHT     = "right"
+	KEY_PAGE_UP   = "pgup"
+	KEY_PAGE_DOWN = "pgdown"
+	KEY_HOME      = "home"
+	KEY_END       = "end"
+	KEY_TAB       = "tab"
+	KEY_BACKTAB   = "backtab"
+	KEY_ENTER     = "enter"
+	KEY_ESC       = "esc"
+	KEY_BACKSPACE = "backspace"
+	KEY_CTRL_C    = "ctrl+c"
+)
+
+// Escape sequences of xterm compatible terminals
+var ESCAPE_KEYS = map[string]string{
+	"\x1b[A": KEY_UP, "\x1bOA": KEY_UP,
+	"\x1b[B": KEY_DOWN, "\x1bOB": KEY_DOWN,
+	"\x1b[C": KEY_RIGHT, "\x1bOC": KEY_RIGHT,
+	"\x1b[D": KEY_LEFT, "\x1bOD": KEY_LEFT,
+	"\x1b[H": KEY_HOME, "\x1bOH": KEY_HOME, "\x1b[1~": KEY_HOME,
+	"\x1b[F": KEY_END, "\x1bOF": KEY_END, "\x1b[4~": KEY_END,
+	"\x1b[5~": KEY_PAGE_UP,
+	"\x1b[6~": KEY_PAGE_DOWN,
+	"\x1b[Z":  KEY_BACKTAB,
+}
+
+// Splits raw terminal input into keys, unknown sequences are dropped
+func parseKeys(input []byte) []string {
+	var keys []string
+
+	for len(input) > 0 {
+		switch c := input[0]; {
+		case c == 0x1b:
+			n := escapeLength(input)
+			if n == 1 {
+				keys = append(keys, KEY_ESC)
+			} else if key, ok := ESCAPE_KEYS[string(input[:n])]; ok {
+				keys = append(keys, key)
+			}
+			input = input[n:]
+			continue
+		case c == '\r' || c == '\n':
+			keys = append(keys, KEY_ENTER)
+		case c == '\t':
+			keys = append(keys, KEY_TAB)
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, KEY_BACKSPACE)
+		case c == 0x03:
+			keys = append(keys, KEY_CTRL_C)
+		case c < ' ':
+		default:
+			r, size := utf8.DecodeRune(input)
+			if r != utf8.RuneError {
+				keys = append(keys, string(r))
+			}
+			input = input[size:]
+			continue
+		}
+
+		input = input[1:]
+	}
+
+	return keys
+}
+
+// Length of the escape sequence at the start of the input,
+// 1 for a lone escape key
+func escapeLength(input []byte) int {
+	if len(input) < 2 {
+		return 1
+	}
+
+	switch input[1] {
+	case 'O':
+		return min(3, len(input))
+	case '[':
+		// CSI parameters end with a byte in 0x40-0x7e
+		end := bytes.IndexFunc(input[2:], func(r rune) bool { return r >= 0x40 && r <= 0x7e })
+		if end == -1 {
+			return len(input)
+		}
+		return end + 3
+	}
+
+	return 1
+}
@@ -0,0 +1,22 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeys(t *testing.T) {
+	t.Run("should split escape sequences and text", func(t *testing.T) {
+		keys := parseKeys([]byte("\x1b[Aj\x1b[6~\r/5ö\x7f\t\x1b[Z\x03"))
+		assert.Equal(t, []string{KEY_UP, "j", KEY_PAGE_DOWN, KEY_ENTER, "/", "5", "ö", KEY_BACKSPACE, KEY_TAB, KEY_BACKTAB, KEY_CTRL_C}, keys)
+	})
+
+	t.Run("should read a lone escape as the escape key", func(t *testing.T) {
+		assert.Equal(t, []string{KEY_ESC}, parseKeys([]byte("\x1b")))
+	})
+
+	t.Run("should drop unknown sequences and control characters", func(t *testing.T) {
+		assert.Equal(t, []string{"q"}, parseKeys([]byte("\x1b[1;5Pq\x01")))
+	})
+}
@@ -0,0 +1,331 @@
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+)
+
+// Rows of a top list, enough to scroll through
+const LIST_SIZE = 200
+
+// Rows moved by page up and page down when the list height is unknown
+const DEFAULT_PAGE = 10
+
+type listKind int
+
+const (
+	LIST_IPS listKind = iota
+	LIST_URIS
+	LIST_CODES
+	LIST_USER_AGENTS
+)
+
+var LIST_NAMES = []string{"IPs", "URIs", "Status codes", "User agents"}
+
+// Analyzes the logs for a screen, results must carry the state
+type Source func(filter Filter) (*analyzer.AnalyzeResult, error)
+
+// What the run loop does after a key
+type action int
+
+const (
+	ACTION_NONE action = iota
+	ACTION_LOAD
+	ACTION_QUIT
+)
+
+type row struct {
+	key  string
+	hits uint64
+}
+
+// Screens are stacked, every drill down narrows the requests of the screen below
+type screen struct {
+	// Selection the screen is drilled into, unset on the first screen
+	drill    listKind
+	drillKey string
+
+	lists    []listKind
+	list     int
+	selected []int
+	rows     [][]row
+
+	result    *analyzer.AnalyzeResult
+	err       error
+	updatedAt time.Time
+	loading   bool
+
+	// Filter or data changed since the last load
+	stale bool
+}
+
+type request struct {
+	screen *screen
+	filter Filter
+}
+
+type Model struct {
+	source Source
+	title  string
+
+	// Refreshes the shown screen every interval
+	follow bool
+
+	// Applied filter line, parsed on every load so relative times move
+	filterText string
+
+	screens []*screen
+
+	editing bool
+	input   []rune
+	message string
+
+	// Rows of the list in the last rendered view
+	page int
+}
+
+func NewModel(source Source, title, filterText string, follow bool) *Model {
+	return &Model{
+		source:     source,
+		title:      title,
+		follow:     follow,
+		filterText: filterText,
+		screens:    []*screen{newScreen(nil, 0, "")},
+		page:       DEFAULT_PAGE,
+	}
+}
+
+// Lists of the screen exclude the kinds the stack is drilled into
+func newScreen(parents []*screen, drill listKind, key string) *screen {
+	s := &screen{drill: drill, drillKey: key, stale: true}
+
+	for _, kind := range []listKind{LIST_IPS, LIST_URIS, LIST_CODES, LIST_USER_AGENTS} {
+		drilled := kind == drill && key != ""
+		for _, parent := range parents {
+			drilled = drilled || (parent.drillKey != "" && parent.drill == kind)
+		}
+
+		if !drilled {
+			s.lists = append(s.lists, kind)
+		}
+	}
+
+	s.selected = make([]int, len(s.lists))
+	s.rows = make([][]row, len(s.lists))
+	return s
+}
+
+func (m *Model) top() *screen {
+	return m.screens[len(m.screens)-1]
+}
+
+// Request of the shown screen, the filter line narrowed by every drill down
+func (m *Model) load() (request, error) {
+	s := m.top()
+	s.loading = true
+
+	var err error
+	req := request{screen: s}
+	if req.filter, err = ParseFilter(m.filterText, time.Now()); err != nil {
+		return req, err
+	}
+
+	for _, drilled := range m.screens[1:] {
+		switch drilled.drill {
+		case LIST_IPS:
+			req.filter.Ip, _ = netip.ParseAddr(drilled.drillKey)
+		case LIST_URIS:
+			req.filter.Uri = drilled.drillKey
+		}
+	}
+
+	return req, nil
+}
+
+func (m *Model) loaded(req request, res *analyzer.AnalyzeResult, err error) {
+	s := req.screen
+	s.loading = false
+	s.stale = false
+
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	s.result, s.err, s.updatedAt = res, nil, time.Now()
+	for i, kind := range s.lists {
+		s.rows[i] = listRows(res, kind)
+		s.selected[i] = min(s.selected[i], max(len(s.rows[i])-1, 0))
+	}
+}
+
+func listRows(res *analyzer.AnalyzeResult, kind listKind) []row {
+	var rows []row
+
+	switch kind {
+	case LIST_IPS:
+		for _, info := range analyzer.TopHits(res.State.Ips, LIST_SIZE, true) {
+			rows = append(rows, row{key: info.Key.String(), hits: info.Hits})
+		}
+	case LIST_URIS:
+		for _, info := range analyzer.TopHits(res.State.Uris, LIST_SIZE, true) {
+			rows = append(rows, row{key: info.Key, hits: info.Hits})
+		}
+	case LIST_CODES:
+		for _, info := range analyzer.TopHits(res.State.Codes, LIST_SIZE, true) {
+			rows = append(rows, row{key: strconv.Itoa(int(info.Key)), hits: info.Hits})
+		}
+	case LIST_USER_AGENTS:
+		for _, info := range analyzer.TopHits(res.State.UserAgents, LIST_SIZE, true) {
+			rows = append(rows, row{key: info.Key, hits: info.Hits})
+		}
+	}
+
+	// ties are ordered by key, so rows don't jump between refreshes
+	slices.SortFunc(rows, func(a, b row) int {
+		if a.hits != b.hits {
+			return cmp.Compare(b.hits, a.hits)
+		}
+		return strings.Compare(a.key, b.key)
+	})
+
+	return rows
+}
+
+// Marks every screen for a reload, the shown one is reloaded right away
+func (m *Model) invalidate() action {
+	for _, s := range m.screens {
+		s.stale = true
+	}
+
+	return ACTION_LOAD
+}
+
+func (m *Model) handleKey(key string) action {
+	if key == KEY_CTRL_C {
+		return ACTION_QUIT
+	}
+
+	if m.editing {
+		return m.handleEditKey(key)
+	}
+
+	s := m.top()
+	switch key {
+	case "q":
+		return ACTION_QUIT
+	case KEY_TAB, KEY_RIGHT, "l":
+		s.list = (s.list + 1) % len(s.lists)
+	case KEY_BACKTAB, KEY_LEFT, "h":
+		s.list = (s.list + len(s.lists) - 1) % len(s.lists)
+	case KEY_UP, "k":
+		s.move(-1)
+	case KEY_DOWN, "j":
+		s.move(1)
+	case KEY_PAGE_UP:
+		s.move(-m.page)
+	case KEY_PAGE_DOWN:
+		s.move(m.page)
+	case KEY_HOME, "g":
+		s.move(-len(s.rows[s.list]))
+	case KEY_END, "G":
+		s.move(len(s.rows[s.list]))
+	case KEY_ENTER:
+		return m.drillDown()
+	case KEY_ESC, KEY_BACKSPACE:
+		return m.back()
+	case "/":
+		m.editing = true
+		m.input = []rune(m.filterText)
+		m.message = ""
+	case "r":
+		return m.invalidate()
+	case "f":
+		m.follow = !m.follow
+	}
+
+	return ACTION_NONE
+}
+
+func (m *Model) handleEditKey(key string) action {
+	switch key {
+	case KEY_ENTER:
+		text := string(m.input)
+		if _, err := ParseFilter(text, time.Now()); err != nil {
+			m.message = err.Error()
+			return ACTION_NONE
+		}
+
+		m.editing = false
+		m.message = ""
+		m.filterText = text
+		return m.invalidate()
+	case KEY_ESC:
+		m.editing = false
+		m.message = ""
+	case KEY_BACKSPACE:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	default:
+		if r := []rune(key); len(r) == 1 && r[0] >= ' ' {
+			m.input = append(m.input, r[0])
+		}
+	}
+
+	return ACTION_NONE
+}
+
+func (s *screen) move(delta int) {
+	rows := len(s.rows[s.list])
+	s.selected[s.list] = max(0, min(s.selected[s.list]+delta, rows-1))
+}
+
+// Opens a screen for the selected ip or uri
+func (m *Model) drillDown() action {
+	s := m.top()
+	kind := s.lists[s.list]
+	rows := s.rows[s.list]
+
+	if (kind != LIST_IPS && kind != LIST_URIS) || len(rows) == 0 {
+		return ACTION_NONE
+	}
+
+	m.screens = append(m.screens, newScreen(m.screens, kind, rows[s.selected[s.list]].key))
+	return ACTION_LOAD
+}
+
+func (m *Model) back() action {
+	if len(m.screens) == 1 {
+		return ACTION_NONE
+	}
+
+	m.screens = m.screens[:len(m.screens)-1]
+	if m.top().stale {
+		return ACTION_LOAD
+	}
+
+	return ACTION_NONE
+}
+
+// Path of the drill downs, like "ip 10.0.0.1 > uri /login"
+func (m *Model) breadcrumbs() string {
+	path := ""
+	for _, s := range m.screens[1:] {
+		name := "ip"
+		if s.drill == LIST_URIS {
+			name = "uri"
+		}
+
+		path += fmt.Sprintf(" > %s %s", name, s.drillKey)
+	}
+
+	return path
+}
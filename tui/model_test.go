@@ -0,0 +1,191 @@
+package tui
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLog = `10.0.0.1 - - [25/Dec/2023:10:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.1 - - [25/Dec/2023:10:01:00 +0000] "GET /about HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+10.0.0.1 - - [25/Dec/2023:10:02:00 +0000] "GET /login HTTP/1.1" 500 100 "-" "Mozilla/5.0"
+10.0.0.2 - - [25/Dec/2023:10:07:00 +0000] "GET /login HTTP/1.1" 404 100 "-" "curl/8.0"
+`
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;?]*[a-zA-Z]")
+
+func testSource(t *testing.T) Source {
+	path := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(path, []byte(testLog), 0644))
+
+	return func(filter Filter) (*analyzer.AnalyzeResult, error) {
+		return analyzer.Analyze(path, filter.Apply(analyzer.Options{TopN: 10, Desc: true, DatesBy: "none", State: true}))
+	}
+}
+
+// Loads the shown screen synchronously
+func load(t *testing.T, m *Model) {
+	req, err := m.load()
+	require.NoError(t, err)
+
+	res, err := m.source(req.filter)
+	m.loaded(req, res, err)
+}
+
+func plain(lines []string) string {
+	return ansi.ReplaceAllString(strings.Join(lines, "\n"), "")
+}
+
+func TestModel(t *testing.T) {
+	t.Run("should render the summary, chart and the selected list", func(t *testing.T) {
+		m := NewModel(testSource(t), "access.log", "", false)
+		load(t, m)
+
+		lines := m.view(80, 30)
+		require.Len(t, lines, 30)
+		for _, line := range lines {
+			assert.Equal(t, 80, len([]rune(ansi.ReplaceAllString(line, ""))))
+		}
+
+		view := plain(lines)
+		assert.Contains(t, view, "Requests 4")
+		assert.Contains(t, view, "2xx 50.0%")
+		assert.Contains(t, view, "Requests per 1m")
+		assert.Contains(t, view, "10.0.0.1")
+		assert.Contains(t, view, "75.00%")
+	})
+
+	t.Run("should drill into the selected ip and back", func(t *testing.T) {
+		m := NewModel(testSource(t), "access.log", "", false)
+		load(t, m)
+
+		assert.Equal(t, ACTION_LOAD, m.handleKey(KEY_ENTER))
+		load(t, m)
+
+		s := m.top()
+		assert.Equal(t, "10.0.0.1", s.drillKey)
+		assert.Equal(t, uint64(3), s.result.TotalRequests)
+		assert.Equal(t, []listKind{LIST_URIS, LIST_CODES, LIST_USER_AGENTS}, s.lists)
+		assert.Contains(t, plain(m.view(80, 30)), "> ip 10.0.0.1")
+
+		// the uri list of the ip, drilled further into /login
+		m.handleKey(KEY_END)
+		require.Equal(t, "/login", s.rows[0][s.selected[0]].key)
+		m.handleKey(KEY_ENTER)
+		load(t, m)
+		assert.Equal(t, uint64(1), m.top().result.TotalRequests)
+
+		assert.Equal(t, ACTION_NONE, m.handleKey(KEY_ESC))
+		assert.Equal(t, ACTION_NONE, m.handleKey(KEY_ESC))
+		assert.Len(t, m.screens, 1)
+	})
+
+	t.Run("should not drill into status codes", func(t *testing.T) {
+		m := NewModel(testSource(t), "access.log", "", false)
+		load(t, m)
+
+		m.handleKey(KEY_TAB)
+		m.handleKey(KEY_TAB)
+		assert.Equal(t, ACTION_NONE, m.handleKey(KEY_ENTER))
+		assert.Len(t, m.screens, 1)
+	})
+
+	t.Run("should edit the filter and reload every screen", func(t *testing.T) {
+		m := NewModel(testSource(t), "access.log", "", false)
+		load(t, m)
+		m.handleKey(KEY_ENTER)
+		load(t, m)
+
+		m.handleKey("/")
+		for _, key := range parseKeys([]byte("status=6xx\r")) {
+			m.handleKey(key)
+		}
+		assert.True(t, m.editing)
+		assert.Contains(t, m.message, "invalid status")
+
+		for range 3 {
+			m.handleKey(KEY_BACKSPACE)
+		}
+		for _, key := range []string{"5", "x", "x"} {
+			m.handleKey(key)
+		}
+		assert.Equal(t, ACTION_LOAD, m.handleKey(KEY_ENTER))
+		assert.False(t, m.editing)
+		assert.Equal(t, "status=5xx", m.filterText)
+
+		load(t, m)
+		assert.Equal(t, uint64(1), m.top().result.TotalRequests)
+
+		// the first screen reloads with the new filter when shown again
+		assert.Equal(t, ACTION_LOAD, m.handleKey(KEY_ESC))
+		load(t, m)
+		assert.Equal(t, uint64(1), m.top().result.TotalRequests)
+	})
+
+	t.Run("should strip control characters of log values", func(t *testing.T) {
+		l := newLine(20).add("", "curl/8.0 \x1b[31m\n")
+		assert.Equal(t, "curl/8.0 ?[31m?     ", l.fill(""))
+	})
+
+	t.Run("should show analysis errors", func(t *testing.T) {
+		m := NewModel(func(Filter) (*analyzer.AnalyzeResult, error) { return nil, os.ErrNotExist }, "missing.log", "", false)
+		load(t, m)
+
+		assert.Contains(t, plain(m.view(80, 20)), "Error: file does not exist")
+	})
+}
+
+// Signals when a written frame contains the text, frames are kept for the
+// test to read once the loop is done
+type frameWriter struct {
+	mu    sync.Mutex
+	out   bytes.Buffer
+	text  string
+	once  sync.Once
+	shown chan struct{}
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if strings.Contains(string(p), w.text) {
+		w.once.Do(func() { close(w.shown) })
+	}
+
+	return w.out.Write(p)
+}
+
+func TestRun(t *testing.T) {
+	t.Run("should render frames until quit", func(t *testing.T) {
+		m := NewModel(testSource(t), "access.log", "", true)
+		keys := make(chan string)
+		out := &frameWriter{text: "10.0.0.2", shown: make(chan struct{})}
+
+		done := make(chan error)
+		go func() {
+			done <- m.run(keys, out, func() (int, int, error) { return 80, 24, nil }, time.Hour)
+		}()
+
+		// keys are handled once the first analysis is shown
+		select {
+		case <-out.shown:
+		case <-time.After(time.Second):
+			t.Fatal("first analysis was not shown")
+		}
+		keys <- KEY_DOWN
+		keys <- "q"
+
+		require.NoError(t, <-done)
+		assert.Contains(t, out.out.String(), "10.0.0.2")
+	})
+}
@@ -0,0 +1,316 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+)
+
+// SGR styles
+const (
+	STYLE_RESET   = "\x1b[0m"
+	STYLE_BOLD    = "\x1b[1m"
+	STYLE_DIM     = "\x1b[2m"
+	STYLE_REVERSE = "\x1b[7m"
+	STYLE_RED     = "\x1b[31m"
+	STYLE_BLUE    = "\x1b[34m"
+)
+
+// Colors of STATUS_CLASSES
+var CLASS_STYLES = []string{"", "\x1b[32m", "\x1b[36m", "\x1b[33m", "\x1b[31m"}
+
+// Eighths of a chart cell from empty to full
+var CHART_BLOCKS = []rune(" ▁▂▃▄▅▆▇█")
+
+const MAX_CHART_HEIGHT = 8
+
+// Lines of the view besides the chart and the list
+const FIXED_LINES = 11
+
+const TIME_FORMAT = "2006-01-02 15:04:05"
+
+const HELP = "←/→ list  ↑/↓ select  enter drill down  esc back  / filter  r refresh  f follow  q quit"
+const EDIT_HELP = "enter apply  esc cancel  keys: since= until= status= ip= uri="
+
+// Line of a fixed width, text beyond the width is cut
+type line struct {
+	b     strings.Builder
+	width int
+	max   int
+}
+
+func newLine(width int) *line {
+	return &line{max: width}
+}
+
+// Log values may hold control characters, they are replaced so they can't
+// move the cursor or restyle the terminal
+func sanitize(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, text)
+}
+
+func (l *line) add(style, text string) *line {
+	text = sanitize(text)
+	if rest := l.max - l.width; utf8.RuneCountInString(text) > rest {
+		text = string([]rune(text)[:max(rest, 0)])
+	}
+
+	if style != "" {
+		l.b.WriteString(style)
+	}
+	l.b.WriteString(text)
+	if style != "" {
+		l.b.WriteString(STYLE_RESET)
+	}
+
+	l.width += utf8.RuneCountInString(text)
+	return l
+}
+
+// Pads the line to its width, the padding takes the style
+func (l *line) fill(style string) string {
+	l.add(style, strings.Repeat(" ", max(l.max-l.width, 0)))
+	return l.b.String()
+}
+
+// Text aligned to the right edge of the line
+func (l *line) right(style, text string) *line {
+	l.add("", strings.Repeat(" ", max(l.max-l.width-utf8.RuneCountInString(text), 0)))
+	return l.add(style, text)
+}
+
+// Renders the model into lines of exactly width columns
+func (m *Model) view(width, height int) []string {
+	s := m.top()
+	lines := make([]string, 0, height)
+
+	status := ""
+	switch {
+	case s.loading:
+		status = "loading…"
+	case s.result != nil:
+		status = "updated " + s.updatedAt.Format("15:04:05")
+	}
+	if m.follow {
+		status = "follow · " + status
+	}
+
+	header := newLine(width).add(STYLE_REVERSE+STYLE_BOLD, " nginx-an ").add(STYLE_REVERSE, " "+m.title+m.breadcrumbs())
+	lines = append(lines, header.right(STYLE_REVERSE, status+" ").fill(STYLE_REVERSE))
+	lines = append(lines, m.filterLine(width))
+
+	chartHeight := min(MAX_CHART_HEIGHT, max(1, (height-FIXED_LINES)/3))
+	listHeight := max(1, height-FIXED_LINES-chartHeight)
+
+	switch {
+	case s.err != nil:
+		lines = append(lines, newLine(width).add(STYLE_RED, "Error: "+s.err.Error()).fill(""))
+	case s.result == nil:
+		lines = append(lines, newLine(width).fill(""))
+	default:
+		lines = append(lines, newLine(width).fill(""))
+		lines = append(lines, summaryLines(s.result, width)...)
+		lines = append(lines, newLine(width).fill(""))
+		lines = append(lines, chartLines(s.result, width, chartHeight)...)
+		lines = append(lines, newLine(width).fill(""))
+		lines = append(lines, m.listLines(s, width, listHeight)...)
+		m.page = listHeight
+	}
+
+	for len(lines) < height-1 {
+		lines = append(lines, newLine(width).fill(""))
+	}
+
+	help := HELP
+	if m.editing {
+		help = EDIT_HELP
+	}
+	lines = append(lines[:min(len(lines), height-1)], newLine(width).add(STYLE_REVERSE, " "+help).fill(STYLE_REVERSE))
+
+	return lines
+}
+
+func (m *Model) filterLine(width int) string {
+	l := newLine(width).add(STYLE_BOLD, "Filter: ")
+
+	switch {
+	case m.editing:
+		l.add("", string(m.input)).add(STYLE_REVERSE, " ")
+	case m.filterText == "":
+		l.add(STYLE_DIM, "none, press / to edit")
+	default:
+		l.add("", m.filterText)
+	}
+
+	if m.message != "" {
+		l.add("", "  ").add(STYLE_RED, m.message)
+	}
+
+	return l.fill("")
+}
+
+func summaryLines(res *analyzer.AnalyzeResult, width int) []string {
+	counts := newLine(width).
+		add(STYLE_BOLD, "Requests ").add("", fmt.Sprintf("%d  ", res.TotalRequests)).
+		add(STYLE_BOLD, "IPs ").add("", fmt.Sprintf("%d  ", res.UniqueIPs)).
+		add(STYLE_BOLD, "User agents ").add("", fmt.Sprintf("%d  ", res.UniqueUserAgents)).
+		add(STYLE_BOLD, "Traffic ").add("", formatBytes(res.TotalBytes)+"  ")
+	if res.Latency != nil {
+		counts.add(STYLE_BOLD, "Latency p95 ").add("", res.Latency.P95.String())
+	}
+
+	timeRange := newLine(width)
+	if res.TotalRequests > 0 {
+		timeRange.add(STYLE_BOLD, "From ").add("", res.TimeRange.Start.Format(TIME_FORMAT)+"  ").
+			add(STYLE_BOLD, "To ").add("", res.TimeRange.End.Format(TIME_FORMAT))
+	}
+
+	return []string{counts.fill(""), timeRange.fill(""), statusMixLine(res, width)}
+}
+
+// Share of requests by status class
+func statusMixLine(res *analyzer.AnalyzeResult, width int) string {
+	l := newLine(width).add(STYLE_BOLD, "Status ")
+	for i, count := range analyzer.CountClasses(res.StatusCodes) {
+		if count == 0 {
+			continue
+		}
+
+		l.add(CLASS_STYLES[i], fmt.Sprintf("%s %.1f%%", analyzer.STATUS_CLASSES[i], share(count, res.TotalRequests))).add("", "  ")
+	}
+
+	return l.fill("")
+}
+
+// Requests over time, one bar per bucket of the widest fitting size
+func chartLines(res *analyzer.AnalyzeResult, width, height int) []string {
+	bucket := analyzer.AutoBucket(res.TimeRange, width)
+	series, err := analyzer.Traffic(res.State, bucket)
+	if err != nil {
+		return []string{newLine(width).add(STYLE_RED, err.Error()).fill("")}
+	}
+
+	// the newest buckets are kept when the range doesn't fit
+	series = series[max(len(series)-width, 0):]
+
+	peak := uint64(0)
+	for _, point := range series {
+		peak = max(peak, point.Hits)
+	}
+
+	lines := []string{newLine(width).add(STYLE_BOLD, "Requests per "+formatBucket(bucket)).add(STYLE_DIM, fmt.Sprintf("  max %d", peak)).fill("")}
+
+	if len(series) == 0 || peak == 0 {
+		for range height + 1 {
+			lines = append(lines, newLine(width).fill(""))
+		}
+		return lines
+	}
+
+	columns := max(1, width/len(series))
+	for r := range height {
+		var b strings.Builder
+		for _, point := range series {
+			level := int(point.Hits * uint64(height*8) / peak)
+			cell := max(0, min(8, level-(height-1-r)*8))
+			b.WriteString(strings.Repeat(string(CHART_BLOCKS[cell]), columns))
+		}
+		lines = append(lines, newLine(width).add(STYLE_BLUE, b.String()).fill(""))
+	}
+
+	location := res.TimeRange.Start.Location()
+	first := series[0].Key.In(location).Format(TIME_FORMAT)
+	last := series[len(series)-1].Key.In(location).Format(TIME_FORMAT)
+	axis := newLine(width).add(STYLE_DIM, first)
+	if len(series) > 1 {
+		axis.right(STYLE_DIM, last)
+	}
+	lines = append(lines, axis.fill(""))
+
+	return lines
+}
+
+// List tabs and the rows around the selected one
+func (m *Model) listLines(s *screen, width, height int) []string {
+	tabs := newLine(width)
+	for i, kind := range s.lists {
+		style := STYLE_DIM
+		if i == s.list {
+			style = STYLE_REVERSE + STYLE_BOLD
+		}
+		tabs.add(style, " "+LIST_NAMES[kind]+" ").add("", " ")
+	}
+	lines := []string{tabs.fill("")}
+
+	rows := s.rows[s.list]
+	selected := s.selected[s.list]
+	height = max(height-1, 1)
+	offset := max(0, selected-height+1)
+
+	for i := offset; i < min(len(rows), offset+height); i++ {
+		style := ""
+		if i == selected {
+			style = STYLE_REVERSE
+		}
+
+		// key, hits and the share of all requests of the screen
+		stats := fmt.Sprintf(" %10d %6.2f%%", rows[i].hits, share(rows[i].hits, s.result.TotalRequests))
+		keyWidth := max(width-len(stats)-5, 0)
+		key := []rune(sanitize(rows[i].key))
+		if len(key) > keyWidth {
+			key = append(key[:max(keyWidth-1, 0)], '…')
+		}
+
+		lines = append(lines, newLine(width).add(style, fmt.Sprintf("%4d %-*s%s", i+1, keyWidth, string(key), stats)).fill(style))
+	}
+
+	if len(rows) == 0 {
+		lines = append(lines, newLine(width).add(STYLE_DIM, "no requests").fill(""))
+	}
+
+	return lines
+}
+
+func share(hits, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(total) * 100
+}
+
+func formatBytes(bytes uint64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(bytes)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+
+	if i == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+func formatBucket(bucket time.Duration) string {
+	switch {
+	case bucket%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", bucket/(24*time.Hour))
+	case bucket%time.Hour == 0:
+		return fmt.Sprintf("%dh", bucket/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", bucket/time.Minute)
+	}
+}
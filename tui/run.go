@@ -0,0 +1,166 @@
+package tui
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Kostayne/go-nginx-analyzer/analyzer"
+	"golang.org/x/term"
+)
+
+const DEFAULT_INTERVAL = 5 * time.Second
+
+// Terminal size is polled, there's no portable resize signal
+const RESIZE_POLL = 250 * time.Millisecond
+
+// Alternate screen with a hidden cursor, restored on exit
+const (
+	ENTER_SCREEN = "\x1b[?1049h\x1b[?25l"
+	LEAVE_SCREEN = "\x1b[?25h\x1b[?1049l"
+)
+
+type Config struct {
+	// Shown in the header, usually the log path
+	Title string
+
+	// Initial filter line
+	Filter string
+
+	// Refreshes the shown screen every Interval, DEFAULT_INTERVAL when zero
+	Follow   bool
+	Interval time.Duration
+}
+
+type response struct {
+	req request
+	res *analyzer.AnalyzeResult
+	err error
+}
+
+// Runs the ui on the terminal of stdin and stdout until the user quits
+func Run(source Source, config Config) error {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return errors.New("tui requires an interactive terminal")
+	}
+
+	if _, err := ParseFilter(config.Filter, time.Now()); err != nil {
+		return err
+	}
+
+	if config.Interval == 0 {
+		config.Interval = DEFAULT_INTERVAL
+	}
+
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(in, state)
+
+	io.WriteString(os.Stdout, ENTER_SCREEN)
+	defer io.WriteString(os.Stdout, LEAVE_SCREEN)
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+
+	m := NewModel(source, config.Title, config.Filter, config.Follow)
+	return m.run(keys, os.Stdout, func() (int, int, error) { return term.GetSize(out) }, config.Interval)
+}
+
+func readKeys(r io.Reader, keys chan<- string) {
+	buf := make([]byte, 256)
+
+	for {
+		n, err := r.Read(buf)
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+
+		if err != nil {
+			close(keys)
+			return
+		}
+	}
+}
+
+// Event loop, a single analysis runs at a time and a load requested
+// meanwhile starts once it's done
+func (m *Model) run(keys <-chan string, out io.Writer, size func() (int, int, error), interval time.Duration) error {
+	// buffered so an analysis still running on quit doesn't block
+	responses := make(chan response, 1)
+	busy, queued := false, false
+
+	load := func() {
+		if busy {
+			m.top().loading = true
+			queued = true
+			return
+		}
+
+		req, err := m.load()
+		if err != nil {
+			m.loaded(req, nil, err)
+			return
+		}
+
+		busy = true
+		go func() {
+			res, err := m.source(req.filter)
+			responses <- response{req: req, res: res, err: err}
+		}()
+	}
+
+	refresh := time.NewTicker(interval)
+	defer refresh.Stop()
+	resize := time.NewTicker(RESIZE_POLL)
+	defer resize.Stop()
+
+	load()
+
+	lastFrame := ""
+	for {
+		width, height, err := size()
+		if err != nil {
+			return err
+		}
+
+		if frame := "\x1b[H" + strings.Join(m.view(width, height), "\r\n"); frame != lastFrame {
+			if _, err := io.WriteString(out, frame); err != nil {
+				return err
+			}
+			lastFrame = frame
+		}
+
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+
+			switch m.handleKey(key) {
+			case ACTION_QUIT:
+				return nil
+			case ACTION_LOAD:
+				load()
+			}
+		case resp := <-responses:
+			busy = false
+			m.loaded(resp.req, resp.res, resp.err)
+
+			if queued {
+				queued = false
+				load()
+			}
+		case <-refresh.C:
+			if m.follow && !busy {
+				m.invalidate()
+				load()
+			}
+		case <-resize.C:
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package uripath
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Placeholders of automatically detected path segments
+const (
+	PLACEHOLDER_ID   = "{id}"
+	PLACEHOLDER_UUID = "{uuid}"
+	PLACEHOLDER_HASH = "{hash}"
+	PLACEHOLDER_DATE = "{date}"
+)
+
+// Min length of a hex segment treated as a hash, shorter ones are likely words
+const MIN_HASH_LEN = 16
+
+// Max amount of uris remembered by a worker cache
+const CACHE_MAX_SIZE = 1 << 16
+
+type Options struct {
+	// Replaces ids, uuids, hashes and dates in path segments with placeholders
+	Auto bool
+
+	// Route patterns like "/users/:id/orders", a trailing "*" matches the rest
+	// of the path. The first matching route wins over automatic placeholders.
+	Routes []string
+
+	// Drops the query string except for the whitelisted params,
+	// a non empty whitelist strips the query as well
+	StripQuery  bool
+	QueryParams []string
+}
+
+type route struct {
+	template string
+	segments []string
+	wildcard bool
+}
+
+// Collapses uris differing only in ids into a single template.
+// Safe for concurrent use.
+type Normalizer struct {
+	auto        bool
+	routes      []route
+	stripQuery  bool
+	queryParams []string
+}
+
+func New(opts Options) (*Normalizer, error) {
+	n := &Normalizer{
+		auto:        opts.Auto,
+		stripQuery:  opts.StripQuery || len(opts.QueryParams) > 0,
+		queryParams: opts.QueryParams,
+	}
+
+	for _, pattern := range opts.Routes {
+		r, err := parseRoute(pattern)
+		if err != nil {
+			return nil, err
+		}
+		n.routes = append(n.routes, r)
+	}
+
+	return n, nil
+}
+
+func parseRoute(pattern string) (route, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return route{}, fmt.Errorf("invalid route %q: must start with \"/\"", pattern)
+	}
+
+	r := route{segments: strings.Split(pattern[1:], "/")}
+
+	for i, segment := range r.segments {
+		if segment == "*" {
+			if i != len(r.segments)-1 {
+				return route{}, fmt.Errorf("invalid route %q: \"*\" is allowed only at the end", pattern)
+			}
+
+			r.segments = r.segments[:i]
+			r.wildcard = true
+			break
+		}
+
+		if segment == ":" {
+			return route{}, fmt.Errorf("invalid route %q: empty param name", pattern)
+		}
+
+		if strings.HasPrefix(segment, ":") {
+			r.segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+
+	r.template = "/" + strings.Join(r.segments, "/")
+	if r.wildcard {
+		r.template = strings.TrimSuffix(r.template, "/") + "/*"
+	}
+
+	return r, nil
+}
+
+// Returns the templated path, like "/users/{id}/orders", with the query
+// string handled according to the options
+func (n *Normalizer) Normalize(uri string) string {
+	path, query, hasQuery := strings.Cut(uri, "?")
+
+	template, ok := n.matchRoute(path)
+	if !ok && n.auto {
+		template = templatePath(path)
+	} else if !ok {
+		template = path
+	}
+
+	if !hasQuery {
+		return template
+	}
+
+	if n.stripQuery {
+		query = n.filterQuery(query)
+		if query == "" {
+			return template
+		}
+	}
+
+	return template + "?" + query
+}
+
+func (n *Normalizer) matchRoute(path string) (string, bool) {
+	if len(n.routes) == 0 || !strings.HasPrefix(path, "/") {
+		return "", false
+	}
+
+	segments := strings.Split(path[1:], "/")
+
+	for _, r := range n.routes {
+		if r.matches(segments) {
+			return r.template, true
+		}
+	}
+
+	return "", false
+}
+
+func (r *route) matches(segments []string) bool {
+	if len(segments) < len(r.segments) || (!r.wildcard && len(segments) != len(r.segments)) {
+		return false
+	}
+
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+
+		if segment != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Keeps only whitelisted params in their original order
+func (n *Normalizer) filterQuery(query string) string {
+	if len(n.queryParams) == 0 {
+		return ""
+	}
+
+	kept := make([]string, 0, len(n.queryParams))
+	for param := range strings.SplitSeq(query, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		if slices.Contains(n.queryParams, name) {
+			kept = append(kept, param)
+		}
+	}
+
+	return strings.Join(kept, "&")
+}
+
+// Replaces every recognized segment with its placeholder,
+// the path is copied only when something is replaced
+func templatePath(path string) string {
+	var b strings.Builder
+	copied := 0
+
+	for start := 0; start < len(path); {
+		end := strings.IndexByte(path[start:], '/')
+		if end == -1 {
+			end = len(path)
+		} else {
+			end += start
+		}
+
+		if placeholder := classifySegment(path[start:end]); placeholder != "" {
+			b.WriteString(path[copied:start])
+			b.WriteString(placeholder)
+			copied = end
+		}
+
+		start = end + 1
+	}
+
+	if copied == 0 {
+		return path
+	}
+
+	b.WriteString(path[copied:])
+	return b.String()
+}
+
+// Returns the placeholder of a segment or "" when it's a regular word
+func classifySegment(segment string) string {
+	switch {
+	case segment == "":
+		return ""
+	case isDigits(segment):
+		return PLACEHOLDER_ID
+	case isUuid(segment):
+		return PLACEHOLDER_UUID
+	case isDate(segment):
+		return PLACEHOLDER_DATE
+	case isHash(segment):
+		return PLACEHOLDER_HASH
+	}
+
+	return ""
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return len(s) > 0
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// 8-4-4-4-12 hex digits
+func isUuid(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// YYYY-MM-DD
+func isDate(s string) bool {
+	return len(s) == 10 && s[4] == '-' && s[7] == '-' &&
+		isDigits(s[0:4]) && isDigits(s[5:7]) && isDigits(s[8:10])
+}
+
+// Long hex string with at least one digit, so words like "deadbeefcafebabe" are kept
+func isHash(s string) bool {
+	if len(s) < MIN_HASH_LEN {
+		return false
+	}
+
+	hasDigit := false
+	for i := 0; i < len(s); i++ {
+		if !isHex(s[i]) {
+			return false
+		}
+		if s[i] <= '9' {
+			hasDigit = true
+		}
+	}
+
+	return hasDigit
+}
+
+func (n *Normalizer) NewCache() *Cache {
+	return &Cache{
+		normalizer: n,
+		templates:  make(map[string]string),
+	}
+}
+
+// Per worker template cache, popular uris repeat a lot.
+// Holds up to CACHE_MAX_SIZE uris. Not safe for concurrent use.
+type Cache struct {
+	normalizer *Normalizer
+	templates  map[string]string
+}
+
+func (c *Cache) Normalize(uri string) string {
+	if template, ok := c.templates[uri]; ok {
+		return template
+	}
+
+	template := c.normalizer.Normalize(uri)
+	if len(c.templates) < CACHE_MAX_SIZE {
+		c.templates[uri] = template
+	}
+
+	return template
+}
@@ -0,0 +1,90 @@
+package uripath
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Run("should replace ids, uuids, hashes and dates", func(t *testing.T) {
+		n, err := New(Options{Auto: true})
+		require.NoError(t, err)
+
+		cases := map[string]string{
+			"/blog/post/123":                                   "/blog/post/{id}",
+			"/blog/post/456/comments/7":                        "/blog/post/{id}/comments/{id}",
+			"/files/3f2504e0-4f89-11d3-9a0c-0305e82c3301":      "/files/{uuid}",
+			"/static/app.9f86d081884c7d659a2feaa0c55ad015.js":  "/static/app.9f86d081884c7d659a2feaa0c55ad015.js",
+			"/commit/9f86d081884c7d659a2feaa0c55ad015a3bf4f1b": "/commit/{hash}",
+			"/archive/2023-12-25/":                             "/archive/{date}/",
+			"/about":                                           "/about",
+			"/":                                                "/",
+			"/word/deadbeefcafebabe":                           "/word/deadbeefcafebabe",
+			"/v2/api":                                          "/v2/api",
+		}
+
+		for uri, expected := range cases {
+			assert.Equal(t, expected, n.Normalize(uri), uri)
+		}
+	})
+
+	t.Run("should keep the path when auto is disabled", func(t *testing.T) {
+		n, err := New(Options{})
+		require.NoError(t, err)
+
+		assert.Equal(t, "/blog/post/123?page=2", n.Normalize("/blog/post/123?page=2"))
+	})
+
+	t.Run("should prefer routes over automatic placeholders", func(t *testing.T) {
+		n, err := New(Options{
+			Auto:   true,
+			Routes: []string{"/users/:name/orders", "/static/*"},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "/users/{name}/orders", n.Normalize("/users/john/orders"))
+		assert.Equal(t, "/users/{name}/orders?sort=asc", n.Normalize("/users/42/orders?sort=asc"))
+		assert.Equal(t, "/static/*", n.Normalize("/static/css/main.css"))
+		assert.Equal(t, "/static/*", n.Normalize("/static/"))
+		assert.Equal(t, "/users/{id}", n.Normalize("/users/42"))
+		assert.Equal(t, "/users//orders", n.Normalize("/users//orders"))
+	})
+
+	t.Run("should strip the query", func(t *testing.T) {
+		n, err := New(Options{StripQuery: true})
+		require.NoError(t, err)
+
+		assert.Equal(t, "/search", n.Normalize("/search?q=nginx&page=2"))
+	})
+
+	t.Run("should keep whitelisted query params", func(t *testing.T) {
+		n, err := New(Options{QueryParams: []string{"page", "lang"}})
+		require.NoError(t, err)
+
+		assert.Equal(t, "/search?page=2&lang", n.Normalize("/search?q=nginx&page=2&lang"))
+		assert.Equal(t, "/search", n.Normalize("/search?q=nginx"))
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Run("should reject invalid routes", func(t *testing.T) {
+		for _, pattern := range []string{"users/:id", "/static/*/x", "/users/:"} {
+			_, err := New(Options{Routes: []string{pattern}})
+			assert.Error(t, err, pattern)
+		}
+	})
+}
+
+func TestCache(t *testing.T) {
+	t.Run("should return normalized uris", func(t *testing.T) {
+		n, err := New(Options{Auto: true})
+		require.NoError(t, err)
+
+		cache := n.NewCache()
+		assert.Equal(t, "/blog/post/{id}", cache.Normalize("/blog/post/1"))
+		assert.Equal(t, "/blog/post/{id}", cache.Normalize("/blog/post/1"))
+		assert.Len(t, cache.templates, 1)
+	})
+}
@@ -0,0 +1,213 @@
+package useragent
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Value used for unrecognized browser, os or device
+const OTHER = "other"
+
+// Device type of every bot
+const DEVICE_BOT = "bot"
+
+//go:embed rules.json
+var defaultRulesJson []byte
+
+// Regex rule, the first capture group of a browser rule is its major version
+type Rule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// Rules are checked in order, the first match wins
+type Rules struct {
+	Bots     []Rule `json:"bots"`
+	Browsers []Rule `json:"browsers"`
+	Os       []Rule `json:"os"`
+	Devices  []Rule `json:"devices"`
+}
+
+type Info struct {
+	Browser      string `json:"browser"`
+	BrowserMajor string `json:"browserMajor,omitempty"`
+	Os           string `json:"os"`
+	Device       string `json:"device"`
+
+	// Bot name, empty for regular browsers
+	Bot string `json:"bot,omitempty"`
+}
+
+func (info Info) IsBot() bool {
+	return info.Bot != ""
+}
+
+// Browser family with major version, like "Chrome 120"
+func (info Info) BrowserVersion() string {
+	if info.BrowserMajor == "" {
+		return info.Browser
+	}
+
+	return info.Browser + " " + info.BrowserMajor
+}
+
+type compiledRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Rule based user agent classifier. Safe for concurrent use.
+type Classifier struct {
+	bots     []compiledRule
+	browsers []compiledRule
+	os       []compiledRule
+	devices  []compiledRule
+}
+
+func DefaultRules() Rules {
+	var rules Rules
+	if err := json.Unmarshal(defaultRulesJson, &rules); err != nil {
+		panic(fmt.Sprintf("invalid embedded user agent rules: %v", err))
+	}
+
+	return rules
+}
+
+// Classifier with rules embedded into the binary
+func Default() *Classifier {
+	c, err := New(DefaultRules())
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded user agent rules: %v", err))
+	}
+
+	return c
+}
+
+// Loads a JSON rules file, its rules take precedence over the embedded ones
+func Load(fpath string) (*Classifier, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var custom Rules
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("invalid user agent rules %s: %w", fpath, err)
+	}
+
+	defaults := DefaultRules()
+
+	return New(Rules{
+		Bots:     append(custom.Bots, defaults.Bots...),
+		Browsers: append(custom.Browsers, defaults.Browsers...),
+		Os:       append(custom.Os, defaults.Os...),
+		Devices:  append(custom.Devices, defaults.Devices...),
+	})
+}
+
+func New(rules Rules) (*Classifier, error) {
+	c := &Classifier{}
+	var err error
+
+	if c.bots, err = compileRules(rules.Bots); err != nil {
+		return nil, err
+	}
+
+	if c.browsers, err = compileRules(rules.Browsers); err != nil {
+		return nil, err
+	}
+
+	if c.os, err = compileRules(rules.Os); err != nil {
+		return nil, err
+	}
+
+	if c.devices, err = compileRules(rules.Devices); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func compileRules(rules []Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of rule %q: %w", rule.Name, err)
+		}
+
+		compiled = append(compiled, compiledRule{name: rule.Name, re: re})
+	}
+
+	return compiled, nil
+}
+
+func (c *Classifier) Classify(userAgent string) Info {
+	info := Info{
+		Browser: OTHER,
+		Os:      matchName(c.os, userAgent),
+		Device:  matchName(c.devices, userAgent),
+	}
+
+	for _, rule := range c.browsers {
+		match := rule.re.FindStringSubmatch(userAgent)
+		if match == nil {
+			continue
+		}
+
+		info.Browser = rule.name
+		for _, group := range match[1:] {
+			if group != "" {
+				info.BrowserMajor = group
+				break
+			}
+		}
+		break
+	}
+
+	if bot := matchName(c.bots, userAgent); bot != OTHER {
+		info.Bot = bot
+		info.Device = DEVICE_BOT
+	}
+
+	return info
+}
+
+func matchName(rules []compiledRule, userAgent string) string {
+	for _, rule := range rules {
+		if rule.re.MatchString(userAgent) {
+			return rule.name
+		}
+	}
+
+	return OTHER
+}
+
+func (c *Classifier) NewCache() *Cache {
+	return &Cache{
+		classifier: c,
+		infos:      make(map[string]Info),
+	}
+}
+
+// Per worker classification cache, user agents repeat a lot
+// and regex matching is expensive. Not safe for concurrent use.
+type Cache struct {
+	classifier *Classifier
+	infos      map[string]Info
+}
+
+func (c *Cache) Classify(userAgent string) Info {
+	if info, ok := c.infos[userAgent]; ok {
+		return info
+	}
+
+	info := c.classifier.Classify(userAgent)
+	c.infos[userAgent] = info
+
+	return info
+}
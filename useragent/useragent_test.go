@@ -0,0 +1,124 @@
+package useragent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	c := Default()
+
+	cases := []struct {
+		userAgent string
+		expected  Info
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			Info{Browser: "Chrome", BrowserMajor: "120", Os: "Windows", Device: "desktop"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			Info{Browser: "Edge", BrowserMajor: "120", Os: "Windows", Device: "desktop"},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			Info{Browser: "Safari", BrowserMajor: "17", Os: "iOS", Device: "mobile"},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			Info{Browser: "Safari", BrowserMajor: "16", Os: "iOS", Device: "tablet"},
+		},
+		{
+			"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			Info{Browser: "Firefox", BrowserMajor: "121", Os: "Linux", Device: "desktop"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36",
+			Info{Browser: "Chrome", BrowserMajor: "120", Os: "Android", Device: "mobile"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 6.1; Trident/7.0; rv:11.0) like Gecko",
+			Info{Browser: "Internet Explorer", BrowserMajor: "11", Os: "Windows", Device: "desktop"},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			Info{Browser: OTHER, Os: OTHER, Device: DEVICE_BOT, Bot: "Googlebot"},
+		},
+		{
+			"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm) Chrome/116.0.1938.76 Safari/537.36",
+			Info{Browser: "Chrome", BrowserMajor: "116", Os: OTHER, Device: DEVICE_BOT, Bot: "Bingbot"},
+		},
+		{
+			"curl/7.68.0",
+			Info{Browser: OTHER, Os: OTHER, Device: DEVICE_BOT, Bot: "curl"},
+		},
+		{
+			"SomeCrawler/1.0",
+			Info{Browser: OTHER, Os: OTHER, Device: DEVICE_BOT, Bot: "Other bot"},
+		},
+		{
+			"-",
+			Info{Browser: OTHER, Os: OTHER, Device: OTHER},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.userAgent, func(t *testing.T) {
+			assert.Equal(t, tc.expected, c.Classify(tc.userAgent))
+		})
+	}
+}
+
+func TestInfo(t *testing.T) {
+	assert.Equal(t, "Chrome 120", Info{Browser: "Chrome", BrowserMajor: "120"}.BrowserVersion())
+	assert.Equal(t, OTHER, Info{Browser: OTHER}.BrowserVersion())
+	assert.True(t, Info{Bot: "curl"}.IsBot())
+	assert.False(t, Info{}.IsBot())
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("should give file rules precedence", func(t *testing.T) {
+		fpath := filepath.Join(t.TempDir(), "rules.json")
+		err := os.WriteFile(fpath, []byte(`{"bots": [{"name": "Internal monitor", "pattern": "^curl/7\\.68"}]}`), 0644)
+		require.NoError(t, err)
+
+		c, err := Load(fpath)
+		require.NoError(t, err)
+
+		assert.Equal(t, "Internal monitor", c.Classify("curl/7.68.0").Bot)
+		assert.Equal(t, "curl", c.Classify("curl/8.0.0").Bot)
+	})
+
+	t.Run("should return error for invalid pattern", func(t *testing.T) {
+		fpath := filepath.Join(t.TempDir(), "rules.json")
+		err := os.WriteFile(fpath, []byte(`{"os": [{"name": "broken", "pattern": "("}]}`), 0644)
+		require.NoError(t, err)
+
+		_, err = Load(fpath)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should return error for missing file", func(t *testing.T) {
+		_, err := Load("missing.json")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestCache(t *testing.T) {
+	c := Default()
+	cache := c.NewCache()
+	userAgent := "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36"
+
+	assert.Equal(t, c.Classify(userAgent), cache.Classify(userAgent))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.Classify(userAgent)
+	})
+	assert.Equal(t, float64(0), allocs)
+}